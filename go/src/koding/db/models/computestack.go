@@ -15,6 +15,9 @@ type ComputeStack struct {
 	// Points to a document in jStackTemplates
 	BaseStackId bson.ObjectId `bson:"baseStackId"`
 
+	// Revision of the jStackTemplate the stack was last applied with.
+	StackRevision string `bson:"stackRevision,omitempty"`
+
 	// Points to a document in jAccounts
 	OriginId bson.ObjectId `bson:"originId"`
 
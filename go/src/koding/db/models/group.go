@@ -24,6 +24,20 @@ type Group struct {
 	// channels
 	DefaultChannels []string `bson:"defaultChannels,omitempty" json:"defaultChannels"`
 	Payment         Payment  `bson:"payment" json:"payment"`
+
+	// Budget limits the estimated monthly cost of group stacks.
+	Budget *Budget `bson:"budget,omitempty" json:"budget,omitempty"`
+
+	// StackPolicy restricts what group stack templates can create.
+	StackPolicy *StackPolicy `bson:"stackPolicy,omitempty" json:"stackPolicy,omitempty"`
+}
+
+// Budget represents a spending limit of a group.
+type Budget struct {
+	// MonthlyLimit is a maximum estimated monthly cost of a single
+	// stack, in the currency of kloud's price table. Zero means
+	// no limit.
+	MonthlyLimit float64 `bson:"monthlyLimit" json:"monthlyLimit"`
 }
 
 type Payment struct {
@@ -41,6 +55,28 @@ type Customer struct {
 	ID string `bson:"id" json:"id"`
 }
 
+// StackPolicy represents rules stack templates of a group must follow.
+// Empty values do not restrict anything.
+type StackPolicy struct {
+	// Providers lists allowed providers, e.g. "aws" or "vagrant".
+	Providers []string `bson:"providers,omitempty" json:"providers,omitempty"`
+
+	// InstanceTypes lists allowed types of aws_instance resources.
+	InstanceTypes []string `bson:"instanceTypes,omitempty" json:"instanceTypes,omitempty"`
+
+	// Regions lists allowed provider regions.
+	Regions []string `bson:"regions,omitempty" json:"regions,omitempty"`
+
+	// MaxCount is a maximum value of a resource count.
+	MaxCount int `bson:"maxCount,omitempty" json:"maxCount,omitempty"`
+
+	// MaxInstances is a maximum number of instances in a single stack.
+	MaxInstances int `bson:"maxInstances,omitempty" json:"maxInstances,omitempty"`
+
+	// RequiredTags lists tags each aws_instance resource must have.
+	RequiredTags []string `bson:"requiredTags,omitempty" json:"requiredTags,omitempty"`
+}
+
 // DeletedMember holds information about deleted members from a group.
 type DeletedMember struct {
 	Id        bson.ObjectId `bson:"_id" json:"-"`
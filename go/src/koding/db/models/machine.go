@@ -37,6 +37,26 @@ type MachineGeneratedFrom struct {
 	Revision   string        `bson:"revision" json:"revision"`
 }
 
+// MachineSchedule describes when a machine is automatically started
+// and stopped.
+type MachineSchedule struct {
+	// Start and Stop are cron expressions, e.g. "0 9 * * 1-5"
+	// for 9am on weekdays.
+	Start string `bson:"start,omitempty" json:"start,omitempty"`
+	Stop  string `bson:"stop,omitempty" json:"stop,omitempty"`
+
+	// Timezone is an IANA time zone name the expressions are
+	// evaluated in. Empty means UTC.
+	Timezone string `bson:"timezone,omitempty" json:"timezone,omitempty"`
+
+	// Group is a slug of the group, if the schedule was set for
+	// all the group machines.
+	Group string `bson:"group,omitempty" json:"group,omitempty"`
+
+	NextStart time.Time `bson:"nextStart,omitempty" json:"nextStart,omitempty"`
+	NextStop  time.Time `bson:"nextStop,omitempty" json:"nextStop,omitempty"`
+}
+
 type Machine struct {
 	ObjectId      bson.ObjectId        `bson:"_id" json:"_id"`
 	Uid           string               `bson:"uid" json:"uid"`
@@ -56,6 +76,7 @@ type Machine struct {
 	Assignee      MachineAssignee      `bson:"assignee" json:"assignee"`
 	UserDeleted   bool                 `bson:"userDeleted" json:"userDeleted"`
 	GeneratedFrom MachineGeneratedFrom `bson:"generatedFrom,omitempty" json:"generatedFrom,omitempty"`
+	Schedule      *MachineSchedule     `bson:"schedule,omitempty" json:"schedule,omitempty"`
 }
 
 // Owner returns the owner of a machine
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// MachineAudit is a document from jMachineAudits collection. It records
+// a single change of a machine made by kloud without user's request,
+// e.g. a state correction made by the reconciler.
+type MachineAudit struct {
+	Id        bson.ObjectId `bson:"_id" json:"-"`
+	MachineId bson.ObjectId `bson:"machineId" json:"machineId"`
+	Provider  string        `bson:"provider" json:"provider"`
+
+	// Source is the name of the kloud component that made the change.
+	Source string `bson:"source" json:"source"`
+
+	OldState  string    `bson:"oldState" json:"oldState"`
+	NewState  string    `bson:"newState" json:"newState"`
+	Reason    string    `bson:"reason" json:"reason"`
+	CreatedAt time.Time `bson:"createdAt" json:"createdAt"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// StackTemplateRevision is a document from jStackTemplateRevisions
+// collection. It is an immutable snapshot of a jStackTemplate content,
+// identified by the template sum, taken each time the content is saved.
+type StackTemplateRevision struct {
+	Id         bson.ObjectId `bson:"_id" json:"-"`
+	TemplateId bson.ObjectId `bson:"templateId" json:"templateId"`
+
+	// Revision is a sum of the template content, the same value
+	// as in jStackTemplate.template.sum and jMachine.generatedFrom.revision.
+	Revision string `bson:"revision" json:"revision"`
+
+	Content     string              `bson:"content" json:"content"`
+	RawContent  string              `bson:"rawContent" json:"rawContent"`
+	Credentials map[string][]string `bson:"credentials" json:"credentials"`
+	CreatedAt   time.Time           `bson:"createdAt" json:"createdAt"`
+}
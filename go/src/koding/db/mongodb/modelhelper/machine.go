@@ -25,6 +25,11 @@ type MachineContainer struct {
 var (
 	MachinesColl           = "jMachines"
 	MachineConstructorName = "JMachine"
+
+	// LeasesColl is a collection of machine locks, as maintained by
+	// the koding/kites/kloud/pkg/lease.MongoDB backend. The lease
+	// ids are hex-encoded machine ids.
+	LeasesColl = "jLeases"
 )
 
 func GetMachine(id string) (*models.Machine, error) {
@@ -445,15 +450,23 @@ func ChangeMachineState(machineId bson.ObjectId, reason string, state machinesta
 	return Mongo.Run(MachinesColl, query)
 }
 
-// CheckAndUpdate state updates only if the given machine id is not used by
-// anyone else
+// CheckAndUpdateState updates the state only if the given machine is not
+// locked by an ongoing operation, which holds a live lease for it.
+//
+// If the machine is locked, mgo.ErrNotFound is returned.
 func CheckAndUpdateState(machineId bson.ObjectId, state machinestate.State) error {
+	leased, err := IsMachineLeased(machineId)
+	if err != nil {
+		return err
+	}
+
+	if leased {
+		return mgo.ErrNotFound
+	}
+
 	query := func(c *mgo.Collection) error {
-		return c.Update(
-			bson.M{
-				"_id": machineId,
-				"assignee.inProgress": false, // only update if it's not locked by someone else
-			},
+		return c.UpdateId(
+			machineId,
 			bson.M{
 				"$set": bson.M{
 					"status.state":      state.String(),
@@ -466,6 +479,26 @@ func CheckAndUpdateState(machineId bson.ObjectId, state machinestate.State) erro
 	return Mongo.Run(MachinesColl, query)
 }
 
+// IsMachineLeased tells whether the given machine is locked with a lease,
+// which has not expired yet.
+func IsMachineLeased(machineId bson.ObjectId) (bool, error) {
+	var n int
+
+	query := func(c *mgo.Collection) (err error) {
+		n, err = c.Find(bson.M{
+			"_id":       machineId.Hex(),
+			"expiresAt": bson.M{"$gt": time.Now().UTC()},
+		}).Count()
+		return err
+	}
+
+	if err := Mongo.Run(LeasesColl, query); err != nil {
+		return false, err
+	}
+
+	return n != 0, nil
+}
+
 func CreateMachine(m *models.Machine) error {
 	query := func(c *mgo.Collection) error {
 		return c.Insert(m)
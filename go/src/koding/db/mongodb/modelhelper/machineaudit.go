@@ -0,0 +1,24 @@
+package modelhelper
+
+import (
+	"time"
+
+	"koding/db/models"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+const MachineAuditsColl = "jMachineAudits"
+
+// AddMachineAudit stores the given audit event.
+func AddMachineAudit(a *models.MachineAudit) error {
+	if a.Id == "" {
+		a.Id = bson.NewObjectId()
+	}
+
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = time.Now().UTC()
+	}
+
+	return Mongo.Run(MachineAuditsColl, insertQuery(a))
+}
@@ -29,3 +29,8 @@ func DeleteSnapshot(snapshotId string) error {
 
 	return Mongo.Run(SnapshotCol, query)
 }
+
+func CreateSnapshot(s *models.Snapshot) error {
+	query := insertQuery(s)
+	return Mongo.Run(SnapshotCol, query)
+}
@@ -27,7 +27,23 @@ func GetStackTemplate(id string) (*models.StackTemplate, error) {
 	return stackTemplate, nil
 }
 
+// CreateStackTemplate inserts the given template and stores
+// revision of its content.
 func CreateStackTemplate(tmpl *models.StackTemplate) error {
 	query := insertQuery(tmpl)
-	return Mongo.Run(StackTemplateColl, query)
+	if err := Mongo.Run(StackTemplateColl, query); err != nil {
+		return err
+	}
+
+	_, err := AddStackTemplateRevision(tmpl)
+	return err
+}
+
+// DeleteStackTemplate removes the given template.
+func DeleteStackTemplate(id string) error {
+	if !bson.IsObjectIdHex(id) {
+		return fmt.Errorf("Not valid ObjectIdHex: '%s'", id)
+	}
+
+	return RemoveDocument(StackTemplateColl, bson.ObjectIdHex(id))
 }
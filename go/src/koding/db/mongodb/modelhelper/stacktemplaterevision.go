@@ -0,0 +1,144 @@
+package modelhelper
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"koding/db/models"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const StackTemplateRevisionColl = "jStackTemplateRevisions"
+
+// StackTemplateSum gives a revision of the given template content.
+func StackTemplateSum(content string) string {
+	sum := sha1.Sum([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// EnsureStackTemplateRevisionIndex creates an index for reading
+// template revisions in the order they were saved.
+func EnsureStackTemplateRevisionIndex() error {
+	index := mgo.Index{
+		Key:        []string{"templateId", "-createdAt"},
+		Background: true,
+	}
+
+	return Mongo.EnsureIndex(StackTemplateRevisionColl, index)
+}
+
+// AddStackTemplateRevision stores the current content of the given
+// template as an immutable revision.
+//
+// It is called each time a template content is saved. Revisions form
+// an append-only history, so a revision saved again after other ones
+// is stored once more; saving the latest revision again is a no-op.
+//
+// It returns the revision of the stored content.
+func AddStackTemplateRevision(tmpl *models.StackTemplate) (string, error) {
+	revision := tmpl.Template.Sum
+	if revision == "" {
+		revision = StackTemplateSum(tmpl.Template.Content)
+	}
+
+	rev := &models.StackTemplateRevision{
+		Id:          bson.NewObjectId(),
+		TemplateId:  tmpl.Id,
+		Revision:    revision,
+		Content:     tmpl.Template.Content,
+		RawContent:  tmpl.Template.RawContent,
+		Credentials: tmpl.Credentials,
+		CreatedAt:   time.Now().UTC(),
+	}
+
+	query := func(c *mgo.Collection) error {
+		var last models.StackTemplateRevision
+
+		err := c.Find(bson.M{"templateId": tmpl.Id}).Sort("-createdAt", "-_id").One(&last)
+		if err == nil && last.Revision == revision {
+			return nil
+		}
+
+		if err != nil && err != mgo.ErrNotFound {
+			return err
+		}
+
+		return c.Insert(rev)
+	}
+
+	if err := Mongo.Run(StackTemplateRevisionColl, query); err != nil {
+		return "", err
+	}
+
+	return revision, nil
+}
+
+// GetStackTemplateRevision gives the given revision of a template,
+// the most recently saved one if it was saved more than once.
+func GetStackTemplateRevision(templateID, revision string) (*models.StackTemplateRevision, error) {
+	if !bson.IsObjectIdHex(templateID) {
+		return nil, fmt.Errorf("Not valid ObjectIdHex: '%s'", templateID)
+	}
+
+	rev := new(models.StackTemplateRevision)
+	query := func(c *mgo.Collection) error {
+		return c.Find(bson.M{
+			"templateId": bson.ObjectIdHex(templateID),
+			"revision":   revision,
+		}).Sort("-createdAt", "-_id").One(rev)
+	}
+
+	if err := Mongo.Run(StackTemplateRevisionColl, query); err != nil {
+		return nil, err
+	}
+
+	return rev, nil
+}
+
+// GetStackTemplateRevisions gives the history of template revisions,
+// starting from the most recent one. A revision may appear more than
+// once, if it was saved again after other ones.
+func GetStackTemplateRevisions(templateID string) ([]*models.StackTemplateRevision, error) {
+	if !bson.IsObjectIdHex(templateID) {
+		return nil, fmt.Errorf("Not valid ObjectIdHex: '%s'", templateID)
+	}
+
+	var revs []*models.StackTemplateRevision
+	query := func(c *mgo.Collection) error {
+		return c.Find(bson.M{
+			"templateId": bson.ObjectIdHex(templateID),
+		}).Sort("-createdAt", "-_id").All(&revs)
+	}
+
+	if err := Mongo.Run(StackTemplateRevisionColl, query); err != nil {
+		return nil, err
+	}
+
+	return revs, nil
+}
+
+// GetPreviousStackTemplateRevision gives a revision that was saved
+// right before the most recent save of the given one. If there's no
+// such revision, it returns mgo.ErrNotFound.
+func GetPreviousStackTemplateRevision(templateID, revision string) (*models.StackTemplateRevision, error) {
+	revs, err := GetStackTemplateRevisions(templateID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, rev := range revs {
+		if rev.Revision == revision {
+			if i+1 < len(revs) {
+				return revs[i+1], nil
+			}
+
+			break
+		}
+	}
+
+	return nil, mgo.ErrNotFound
+}
@@ -0,0 +1,114 @@
+package modelhelper
+
+import (
+	"testing"
+
+	"koding/db/models"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestStackTemplateRevisions(t *testing.T) {
+	initMongoConn()
+	defer Close()
+
+	if err := EnsureStackTemplateRevisionIndex(); err != nil {
+		t.Fatalf("EnsureStackTemplateRevisionIndex()=%s", err)
+	}
+
+	tmpl := models.NewStackTemplate("aws", "identifier")
+	tmpl.Template.Content = `{"resource": {}}`
+	tmpl.Template.Sum = StackTemplateSum(tmpl.Template.Content)
+
+	if err := CreateStackTemplate(tmpl); err != nil {
+		t.Fatalf("CreateStackTemplate()=%s", err)
+	}
+	defer DeleteStackTemplate(tmpl.Id.Hex())
+	defer Mongo.Run(StackTemplateRevisionColl, func(c *mgo.Collection) error {
+		_, err := c.RemoveAll(bson.M{"templateId": tmpl.Id})
+		return err
+	})
+
+	first := tmpl.Template.Sum
+
+	// Template creation must store the initial revision.
+	rev, err := GetStackTemplateRevision(tmpl.Id.Hex(), first)
+	if err != nil {
+		t.Fatalf("GetStackTemplateRevision()=%s", err)
+	}
+
+	if rev.Content != tmpl.Template.Content {
+		t.Fatalf("got %q content, want %q", rev.Content, tmpl.Template.Content)
+	}
+
+	tmpl.Template.Content = `{"resource": {"aws_instance": {}}}`
+	tmpl.Template.Sum = StackTemplateSum(tmpl.Template.Content)
+
+	for i := 0; i < 2; i++ {
+		revision, err := AddStackTemplateRevision(tmpl)
+		if err != nil {
+			t.Fatalf("%d: AddStackTemplateRevision()=%s", i, err)
+		}
+
+		if revision != tmpl.Template.Sum {
+			t.Fatalf("%d: got %q revision, want %q", i, revision, tmpl.Template.Sum)
+		}
+	}
+
+	revs, err := GetStackTemplateRevisions(tmpl.Id.Hex())
+	if err != nil {
+		t.Fatalf("GetStackTemplateRevisions()=%s", err)
+	}
+
+	if len(revs) != 2 {
+		t.Fatalf("got %d revisions, want 2", len(revs))
+	}
+
+	prev, err := GetPreviousStackTemplateRevision(tmpl.Id.Hex(), tmpl.Template.Sum)
+	if err != nil {
+		t.Fatalf("GetPreviousStackTemplateRevision()=%s", err)
+	}
+
+	if prev.Revision != first {
+		t.Fatalf("got %q previous revision, want %q", prev.Revision, first)
+	}
+
+	// Saving the first content again must make it the latest revision,
+	// so rolling back goes to the second one - A -> B -> A.
+	second := tmpl.Template.Sum
+
+	tmpl.Template.Content = `{"resource": {}}`
+	tmpl.Template.Sum = first
+
+	if _, err := AddStackTemplateRevision(tmpl); err != nil {
+		t.Fatalf("AddStackTemplateRevision()=%s", err)
+	}
+
+	revs, err = GetStackTemplateRevisions(tmpl.Id.Hex())
+	if err != nil {
+		t.Fatalf("GetStackTemplateRevisions()=%s", err)
+	}
+
+	if len(revs) != 3 {
+		t.Fatalf("got %d revisions, want 3", len(revs))
+	}
+
+	prev, err = GetPreviousStackTemplateRevision(tmpl.Id.Hex(), first)
+	if err != nil {
+		t.Fatalf("GetPreviousStackTemplateRevision()=%s", err)
+	}
+
+	if prev.Revision != second {
+		t.Fatalf("got %q previous revision, want %q", prev.Revision, second)
+	}
+
+	prev, err = GetPreviousStackTemplateRevision(tmpl.Id.Hex(), second)
+	if err != nil {
+		t.Fatalf("GetPreviousStackTemplateRevision()=%s", err)
+	}
+
+	if prev.Revision != first {
+		t.Fatalf("got %q previous revision, want %q", prev.Revision, first)
+	}
+}
@@ -3,6 +3,8 @@ package transport
 import (
 	"testing"
 
+	"koding/klient/fs/ignore"
+
 	. "github.com/smartystreets/goconvey/convey"
 )
 
@@ -13,7 +15,7 @@ func TestDualTransport(t *testing.T) {
 func TestNewDualTransport(t *testing.T) {
 	Convey("It should set ignore dirs for RemoteTransport", t, func() {
 		rt := &RemoteTransport{
-			IgnoreDirs: defaultDirIgnoreList,
+			IgnoreDirs: ignore.Folders,
 		}
 		dt := &DiskTransport{}
 
@@ -1,13 +0,0 @@
-package transport
-
-var defaultDirIgnoreList = []string{
-	".svn",
-	".hg",
-	".build",
-	".vagrant",
-	".git",
-	".logs",
-	"CVS",
-	"logs",
-	"node_modules",
-}
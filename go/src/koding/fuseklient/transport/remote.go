@@ -7,6 +7,8 @@ import (
 	"syscall"
 	"time"
 
+	"koding/klient/fs/ignore"
+
 	"github.com/koding/kite"
 	"github.com/koding/kite/dnode"
 )
@@ -62,7 +64,7 @@ func NewRemoteTransport(c Teller, t time.Duration, p string) (*RemoteTransport,
 		Client:      c,
 		RemotePath:  p,
 		TellTimeout: t,
-		IgnoreDirs:  defaultDirIgnoreList,
+		IgnoreDirs:  ignore.Folders,
 	}, nil
 }
 
@@ -0,0 +1,164 @@
+package amazon
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/credentials/stscreds"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// DefaultRoleDuration is a default expiry duration of temporary
+// credentials obtained by RoleProvider.
+var DefaultRoleDuration = time.Hour
+
+// DefaultRoleValidity is a default minimum time the credentials
+// given by RoleProvider are valid for.
+var DefaultRoleValidity = 45 * time.Minute
+
+// RoleProvider gives temporary credentials for IAM roles, which are
+// obtained with STS AssumeRole call.
+//
+// Credentials are cached per role and external ID, and are refreshed
+// transparently when they are about to expire.
+type RoleProvider struct {
+	// STS is used to assume roles.
+	STS stscreds.AssumeRoler
+
+	// SessionName is a name of the role session, which appears
+	// in the CloudTrail logs of the role's account.
+	//
+	// If empty, "koding-kloud" is used.
+	SessionName string
+
+	// Duration is an expiry duration of the credentials, it must not
+	// exceed maximum session duration of the roles.
+	//
+	// If zero, DefaultRoleDuration is used.
+	Duration time.Duration
+
+	// Validity is a minimum time the credentials are valid for after
+	// they are read, it is expected to cover the longest operation the
+	// credentials are passed to, e.g. a Terraform apply. Credentials
+	// are refreshed when they are about to be valid for less time.
+	//
+	// Validity must be shorter than Duration. If zero,
+	// DefaultRoleValidity is used.
+	Validity time.Duration
+
+	mu    sync.Mutex
+	creds map[roleKey]*credentials.Credentials
+}
+
+type roleKey struct {
+	arn        string
+	externalID string
+}
+
+// NewRoleProvider gives new RoleProvider, which assumes roles
+// with an STS client created from the given session.
+func NewRoleProvider(c client.ConfigProvider) *RoleProvider {
+	return &RoleProvider{
+		STS: sts.New(c),
+	}
+}
+
+// Valid returns non-nil error if the credentials can't be requested
+// to be valid for the configured Validity.
+func (rp *RoleProvider) Valid() error {
+	if rp.duration() <= rp.validity() {
+		return fmt.Errorf("role duration %s is required to be longer than validity %s", rp.duration(), rp.validity())
+	}
+
+	return nil
+}
+
+// Credentials gives temporary credentials for the given role.
+//
+// The STS is not called until the credentials are used. Reading the
+// credentials fails if the STS grants them for shorter than Validity.
+func (rp *RoleProvider) Credentials(roleARN, externalID string) *credentials.Credentials {
+	key := roleKey{
+		arn:        roleARN,
+		externalID: externalID,
+	}
+
+	rp.mu.Lock()
+	defer rp.mu.Unlock()
+
+	if c, ok := rp.creds[key]; ok {
+		return c
+	}
+
+	if rp.creds == nil {
+		rp.creds = make(map[roleKey]*credentials.Credentials)
+	}
+
+	// Remove credentials of roles that are no longer used.
+	for k, c := range rp.creds {
+		if c.IsExpired() {
+			delete(rp.creds, k)
+		}
+	}
+
+	c := credentials.NewCredentials(&roleCredentials{
+		AssumeRoleProvider: &stscreds.AssumeRoleProvider{
+			Client:          rp.STS,
+			RoleARN:         roleARN,
+			RoleSessionName: rp.sessionName(),
+			ExternalID:      &externalID,
+			Duration:        rp.duration(),
+			ExpiryWindow:    rp.validity(),
+		},
+	})
+
+	rp.creds[key] = c
+
+	return c
+}
+
+func (rp *RoleProvider) sessionName() string {
+	if rp.SessionName != "" {
+		return rp.SessionName
+	}
+	return "koding-kloud"
+}
+
+func (rp *RoleProvider) duration() time.Duration {
+	if rp.Duration != 0 {
+		return rp.Duration
+	}
+	return DefaultRoleDuration
+}
+
+func (rp *RoleProvider) validity() time.Duration {
+	if rp.Validity != 0 {
+		return rp.Validity
+	}
+	return DefaultRoleValidity
+}
+
+// roleCredentials fails to retrieve credentials, which are granted
+// for shorter than the expiry window.
+type roleCredentials struct {
+	*stscreds.AssumeRoleProvider
+}
+
+func (rc *roleCredentials) Retrieve() (credentials.Value, error) {
+	v, err := rc.AssumeRoleProvider.Retrieve()
+	if err != nil {
+		return v, err
+	}
+
+	// The credentials expire earlier by the ExpiryWindow, so they
+	// are already expired if granted for shorter than it.
+	if rc.IsExpired() {
+		return credentials.Value{ProviderName: v.ProviderName}, fmt.Errorf("credentials for %q role are granted for shorter than %s",
+			rc.RoleARN, rc.ExpiryWindow)
+	}
+
+	return v, nil
+}
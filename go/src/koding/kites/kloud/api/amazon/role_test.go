@@ -0,0 +1,207 @@
+package amazon_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"koding/kites/kloud/api/amazon"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// fakeSTS is a local stand-in for the STS service, which
+// implements the AssumeRole action.
+type fakeSTS struct {
+	roles map[string]string // maps role ARN to its external ID
+	grant time.Duration     // if non-zero, overrides requested duration
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (f *fakeSTS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if action := r.PostForm.Get("Action"); action != "AssumeRole" {
+		http.Error(w, "unsupported action: "+action, http.StatusBadRequest)
+		return
+	}
+
+	f.mu.Lock()
+	f.calls++
+	n := f.calls
+	f.mu.Unlock()
+
+	arn := r.PostForm.Get("RoleArn")
+
+	if id, ok := f.roles[arn]; !ok || id != r.PostForm.Get("ExternalId") {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintf(w, `<ErrorResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <Error>
+    <Type>Sender</Type>
+    <Code>AccessDenied</Code>
+    <Message>Not authorized to perform sts:AssumeRole</Message>
+  </Error>
+  <RequestId>%d</RequestId>
+</ErrorResponse>`, n)
+		return
+	}
+
+	sec, err := strconv.Atoi(r.PostForm.Get("DurationSeconds"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if f.grant != 0 {
+		sec = int(f.grant / time.Second)
+	}
+
+	fmt.Fprintf(w, `<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>access%[1]d</AccessKeyId>
+      <SecretAccessKey>secret%[1]d</SecretAccessKey>
+      <SessionToken>token%[1]d</SessionToken>
+      <Expiration>%[2]s</Expiration>
+    </Credentials>
+    <AssumedRoleUser>
+      <Arn>%[3]s/%[4]s</Arn>
+      <AssumedRoleId>ROLE:%[4]s</AssumedRoleId>
+    </AssumedRoleUser>
+  </AssumeRoleResult>
+  <ResponseMetadata>
+    <RequestId>%[1]d</RequestId>
+  </ResponseMetadata>
+</AssumeRoleResponse>`, n, time.Now().Add(time.Duration(sec)*time.Second).UTC().Format(time.RFC3339),
+		arn, r.PostForm.Get("RoleSessionName"))
+}
+
+func (f *fakeSTS) Calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func newRoleProvider(roles map[string]string) (*amazon.RoleProvider, *fakeSTS, func()) {
+	f := &fakeSTS{roles: roles}
+	srv := httptest.NewServer(f)
+
+	sess := session.New(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("kloud", "kloud", ""),
+		Endpoint:    aws.String(srv.URL),
+		Region:      aws.String("us-east-1"),
+		MaxRetries:  aws.Int(0),
+	})
+
+	return amazon.NewRoleProvider(sess), f, srv.Close
+}
+
+const testRoleARN = "arn:aws:iam::123456789012:role/koding"
+
+func TestRoleProvider(t *testing.T) {
+	rp, f, done := newRoleProvider(map[string]string{testRoleARN: "external"})
+	defer done()
+
+	v, err := rp.Credentials(testRoleARN, "external").Get()
+	if err != nil {
+		t.Fatalf("Get()=%s", err)
+	}
+
+	want := credentials.Value{
+		AccessKeyID:     "access1",
+		SecretAccessKey: "secret1",
+		SessionToken:    "token1",
+		ProviderName:    "AssumeRoleProvider",
+	}
+
+	if v != want {
+		t.Fatalf("got %+v, want %+v", v, want)
+	}
+
+	// Credentials are cached and valid, STS is not called again.
+	if v, err = rp.Credentials(testRoleARN, "external").Get(); err != nil {
+		t.Fatalf("Get()=%s", err)
+	}
+
+	if v != want {
+		t.Fatalf("got %+v, want %+v", v, want)
+	}
+
+	if n := f.Calls(); n != 1 {
+		t.Fatalf("got %d calls, want 1", n)
+	}
+
+	if _, err := rp.Credentials(testRoleARN, "other").Get(); err == nil {
+		t.Fatal("expected Get to fail for invalid external ID")
+	}
+
+	if _, err := rp.Credentials("arn:aws:iam::123456789012:role/other", "external").Get(); err == nil {
+		t.Fatal("expected Get to fail for unknown role")
+	}
+}
+
+func TestRoleProviderRefresh(t *testing.T) {
+	rp, f, done := newRoleProvider(map[string]string{testRoleARN: "external"})
+	defer done()
+
+	// The credentials are going to be valid for required
+	// validity only for a second after they're obtained.
+	rp.Duration = 15 * time.Minute
+	rp.Validity = rp.Duration - time.Second
+
+	c := rp.Credentials(testRoleARN, "external")
+
+	for i, want := range []string{"token1", "token1", "token2"} {
+		if i == 2 {
+			time.Sleep(1100 * time.Millisecond)
+		}
+
+		v, err := c.Get()
+		if err != nil {
+			t.Fatalf("%d: Get()=%s", i, err)
+		}
+
+		if v.SessionToken != want {
+			t.Fatalf("%d: got %q, want %q", i, v.SessionToken, want)
+		}
+	}
+
+	if n := f.Calls(); n != 2 {
+		t.Fatalf("got %d calls, want 2", n)
+	}
+}
+
+func TestRoleProviderValidity(t *testing.T) {
+	rp, f, done := newRoleProvider(map[string]string{testRoleARN: "external"})
+	defer done()
+
+	if err := rp.Valid(); err != nil {
+		t.Fatalf("Valid()=%s", err)
+	}
+
+	// The role grants credentials for shorter than they are
+	// required to be valid for, e.g. due to its maximum
+	// session duration.
+	f.grant = 30 * time.Minute
+
+	if _, err := rp.Credentials(testRoleARN, "external").Get(); err == nil {
+		t.Fatal("expected Get to fail for too short credentials")
+	}
+
+	rp.Duration = 30 * time.Minute
+
+	if err := rp.Valid(); err == nil {
+		t.Fatal("expected Valid to fail for duration shorter than validity")
+	}
+}
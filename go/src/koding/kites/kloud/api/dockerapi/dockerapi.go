@@ -0,0 +1,394 @@
+// Package dockerapi is a minimal client for the Docker Engine remote API,
+// which covers the container and network operations needed by
+// the docker provider.
+package dockerapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"koding/kites/kloud/machinestate"
+)
+
+// APIVersion is a version of the Docker Engine API used by the client.
+const APIVersion = "v1.24"
+
+const defaultTimeout = 30 * time.Second
+
+// PullTimeout is a maximum time pulling a single image can take.
+var PullTimeout = 15 * time.Minute
+
+// ErrNotFound is returned when the requested container or network
+// does not exist.
+var ErrNotFound = errors.New("docker: no such object")
+
+// Status represents consts for container states.
+type Status string
+
+const (
+	StatusCreated    = Status("created")
+	StatusRestarting = Status("restarting")
+	StatusRunning    = Status("running")
+	StatusPaused     = Status("paused")
+	StatusExited     = Status("exited")
+	StatusRemoving   = Status("removing")
+	StatusDead       = Status("dead")
+)
+
+// MachineState maps the Status value to machinestate.State value.
+func (s Status) MachineState() machinestate.State {
+	switch s {
+	case StatusCreated, StatusExited, StatusPaused:
+		return machinestate.Stopped
+	case StatusRestarting:
+		return machinestate.Starting
+	case StatusRunning:
+		return machinestate.Running
+	case StatusRemoving:
+		return machinestate.Terminating
+	case StatusDead:
+		return machinestate.Terminated
+	default:
+		return machinestate.Unknown
+	}
+}
+
+// Container represents a response of the container inspect request.
+type Container struct {
+	ID    string `json:"Id"`
+	Name  string `json:"Name"`
+	State struct {
+		Status  Status `json:"Status"`
+		Running bool   `json:"Running"`
+	} `json:"State"`
+	Config struct {
+		Hostname string `json:"Hostname"`
+		Image    string `json:"Image"`
+	} `json:"Config"`
+	NetworkSettings struct {
+		Networks map[string]struct {
+			IPAddress string `json:"IPAddress"`
+		} `json:"Networks"`
+	} `json:"NetworkSettings"`
+}
+
+// IPAddress gives an IP address of the container in the given network.
+func (c *Container) IPAddress(network string) string {
+	if n, ok := c.NetworkSettings.Networks[network]; ok {
+		return n.IPAddress
+	}
+
+	return ""
+}
+
+// Image represents a response of the image inspect request.
+type Image struct {
+	ID       string   `json:"Id"`
+	RepoTags []string `json:"RepoTags"`
+}
+
+// Network represents a response of the network inspect request.
+type Network struct {
+	ID     string            `json:"Id"`
+	Name   string            `json:"Name"`
+	Driver string            `json:"Driver"`
+	Labels map[string]string `json:"Labels"`
+}
+
+// Error represents an error response of the Docker Engine API.
+type Error struct {
+	StatusCode int
+	Message    string `json:"message"`
+}
+
+// Error implements the built-in error interface.
+func (e *Error) Error() string {
+	return fmt.Sprintf("docker: %s (status code %d)", e.Message, e.StatusCode)
+}
+
+// Client is used to access Docker Engine API of a single host.
+type Client struct {
+	// Host is an address of the Docker daemon, e.g.
+	// unix:///var/run/docker.sock or tcp://127.0.0.1:2375.
+	Host string
+
+	// Client is used to make the requests. If nil, a client
+	// created for the Host is used.
+	Client *http.Client
+
+	base string
+}
+
+// New gives new client for the given Docker host.
+func New(host string) (*Client, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		Host: host,
+	}
+
+	switch u.Scheme {
+	case "unix":
+		path := u.Path
+
+		c.base = "http://docker"
+		c.Client = &http.Client{
+			Timeout: defaultTimeout,
+			Transport: &http.Transport{
+				Dial: func(string, string) (net.Conn, error) {
+					return net.DialTimeout("unix", path, defaultTimeout)
+				},
+			},
+		}
+	case "tcp", "http":
+		c.base = "http://" + u.Host
+	case "https":
+		c.base = "https://" + u.Host
+	default:
+		return nil, fmt.Errorf("docker: unsupported host scheme: %q", u.Scheme)
+	}
+
+	if c.Client == nil {
+		c.Client = &http.Client{
+			Timeout: defaultTimeout,
+		}
+	}
+
+	return c, nil
+}
+
+// Version gives a version of the Docker daemon.
+func (c *Client) Version() (string, error) {
+	var v struct {
+		Version string `json:"Version"`
+	}
+
+	if err := c.do("GET", "/version", nil, &v); err != nil {
+		return "", err
+	}
+
+	return v.Version, nil
+}
+
+// Container inspects the container with the given id or name.
+func (c *Client) Container(id string) (*Container, error) {
+	var container Container
+
+	if err := c.do("GET", "/containers/"+id+"/json", nil, &container); err != nil {
+		return nil, err
+	}
+
+	return &container, nil
+}
+
+// StartContainer starts the container. It is a nop if the container
+// is already running.
+func (c *Client) StartContainer(id string) error {
+	return c.do("POST", "/containers/"+id+"/start", nil, nil)
+}
+
+// StopContainer stops the container, killing it if it does not stop
+// within the given timeout. It is a nop if the container is already
+// stopped.
+func (c *Client) StopContainer(id string, timeout time.Duration) error {
+	path := "/containers/" + id + "/stop?t=" + strconv.Itoa(int(timeout.Seconds()))
+
+	return c.do("POST", path, nil, nil)
+}
+
+// Image inspects the image with the given id or name.
+func (c *Client) Image(name string) (*Image, error) {
+	var image Image
+
+	if err := c.do("GET", "/images/"+name+"/json", nil, &image); err != nil {
+		return nil, err
+	}
+
+	return &image, nil
+}
+
+// PullImage pulls the image with the given name from its registry.
+// If the name has no tag, the latest one is pulled.
+func (c *Client) PullImage(name string) error {
+	image, tag := splitTag(name)
+
+	query := make(url.Values)
+	query.Set("fromImage", image)
+	query.Set("tag", tag)
+
+	req, err := http.NewRequest("POST", c.base+"/"+APIVersion+"/images/create?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+
+	// Pulling takes longer than regular requests.
+	client := *c.Client
+	client.Timeout = PullTimeout
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode >= 400:
+		return newError(resp)
+	}
+
+	// The response is a stream of progress messages, a failed
+	// pull is reported with a message carrying the error.
+	dec := json.NewDecoder(resp.Body)
+
+	for {
+		var msg struct {
+			Error string `json:"error"`
+		}
+
+		switch err := dec.Decode(&msg); {
+		case err == io.EOF:
+			return nil
+		case err != nil:
+			return err
+		case msg.Error != "":
+			return &Error{
+				StatusCode: resp.StatusCode,
+				Message:    msg.Error,
+			}
+		}
+	}
+}
+
+// splitTag splits the image name into repository and tag. Images
+// referenced by digest are not split.
+func splitTag(name string) (image, tag string) {
+	if strings.Contains(name, "@") {
+		return name, ""
+	}
+
+	// The tag follows the last colon, unless it is a port
+	// of the registry host.
+	if i := strings.LastIndex(name, ":"); i != -1 && !strings.Contains(name[i+1:], "/") {
+		return name[:i], name[i+1:]
+	}
+
+	return name, "latest"
+}
+
+// Network inspects the network with the given id or name.
+func (c *Client) Network(id string) (*Network, error) {
+	var network Network
+
+	if err := c.do("GET", "/networks/"+id, nil, &network); err != nil {
+		return nil, err
+	}
+
+	return &network, nil
+}
+
+// CreateNetwork creates a bridge network with the given name and labels.
+func (c *Client) CreateNetwork(name string, labels map[string]string) (*Network, error) {
+	req := map[string]interface{}{
+		"Name":           name,
+		"Driver":         "bridge",
+		"CheckDuplicate": true,
+		"Labels":         labels,
+	}
+
+	var resp struct {
+		ID string `json:"Id"`
+	}
+
+	if err := c.do("POST", "/networks/create", req, &resp); err != nil {
+		return nil, err
+	}
+
+	return &Network{
+		ID:     resp.ID,
+		Name:   name,
+		Driver: "bridge",
+		Labels: labels,
+	}, nil
+}
+
+// RemoveNetwork removes the network with the given id or name.
+func (c *Client) RemoveNetwork(id string) error {
+	return c.do("DELETE", "/networks/"+id, nil, nil)
+}
+
+func (c *Client) do(method, path string, in, out interface{}) error {
+	var body io.Reader
+
+	if in != nil {
+		p, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+
+		body = bytes.NewReader(p)
+	}
+
+	req, err := http.NewRequest(method, c.base+"/"+APIVersion+path, body)
+	if err != nil {
+		return err
+	}
+
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case resp.StatusCode == http.StatusNotModified:
+		// container already started or stopped
+		return nil
+	case resp.StatusCode >= 400:
+		return newError(resp)
+	}
+
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func newError(resp *http.Response) error {
+	e := &Error{
+		StatusCode: resp.StatusCode,
+	}
+
+	p, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		e.Message = err.Error()
+		return e
+	}
+
+	if err := json.Unmarshal(p, e); err != nil || e.Message == "" {
+		e.Message = strings.TrimSpace(string(p))
+	}
+
+	return e
+}
@@ -0,0 +1,213 @@
+package dockerapi_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"koding/kites/kloud/api/dockerapi"
+	"koding/kites/kloud/machinestate"
+)
+
+func newServer(t *testing.T) (*dockerapi.Client, func()) {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/v1.24/version", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Version":"1.12.3"}`))
+	})
+
+	mux.HandleFunc("/v1.24/containers/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1.24/containers/foo/json":
+			w.Write([]byte(`{"Id":"123","Name":"/foo","State":{"Status":"exited"},` +
+				`"NetworkSettings":{"Networks":{"koding":{"IPAddress":"172.18.0.2"}}}}`))
+		case "/v1.24/containers/foo/start":
+			w.WriteHeader(http.StatusNotModified)
+		case "/v1.24/containers/foo/stop":
+			if r.URL.Query().Get("t") != "10" {
+				t.Errorf("got %q timeout, want 10", r.URL.Query().Get("t"))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			http.Error(w, `{"message":"No such container"}`, http.StatusNotFound)
+		}
+	})
+
+	mux.HandleFunc("/v1.24/networks/create", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Name   string
+			Driver string
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("Decode()=%s", err)
+		}
+
+		if req.Name == "koding" {
+			http.Error(w, `{"message":"network with name koding already exists"}`, http.StatusConflict)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"Id":"abc"}`))
+	})
+
+	s := httptest.NewServer(mux)
+
+	c, err := dockerapi.New("tcp://" + strings.TrimPrefix(s.URL, "http://"))
+	if err != nil {
+		s.Close()
+		t.Fatalf("New()=%s", err)
+	}
+
+	return c, s.Close
+}
+
+func TestClient(t *testing.T) {
+	c, done := newServer(t)
+	defer done()
+
+	v, err := c.Version()
+	if err != nil {
+		t.Fatalf("Version()=%s", err)
+	}
+
+	if v != "1.12.3" {
+		t.Fatalf("got %q, want %q", v, "1.12.3")
+	}
+
+	container, err := c.Container("foo")
+	if err != nil {
+		t.Fatalf("Container()=%s", err)
+	}
+
+	if got := container.State.Status.MachineState(); got != machinestate.Stopped {
+		t.Fatalf("got %s, want %s", got, machinestate.Stopped)
+	}
+
+	if got := container.IPAddress("koding"); got != "172.18.0.2" {
+		t.Fatalf("got %q, want %q", got, "172.18.0.2")
+	}
+
+	if _, err := c.Container("bar"); err != dockerapi.ErrNotFound {
+		t.Fatalf("got %v, want %v", err, dockerapi.ErrNotFound)
+	}
+
+	if err := c.StartContainer("foo"); err != nil {
+		t.Fatalf("StartContainer()=%s", err)
+	}
+
+	if err := c.StopContainer("foo", 10*time.Second); err != nil {
+		t.Fatalf("StopContainer()=%s", err)
+	}
+
+	n, err := c.CreateNetwork("koding-team", nil)
+	if err != nil {
+		t.Fatalf("CreateNetwork()=%s", err)
+	}
+
+	if n.ID != "abc" {
+		t.Fatalf("got %q, want %q", n.ID, "abc")
+	}
+
+	_, err = c.CreateNetwork("koding", nil)
+	if e, ok := err.(*dockerapi.Error); !ok || e.StatusCode != http.StatusConflict {
+		t.Fatalf("got %v, want status code %d", err, http.StatusConflict)
+	}
+}
+
+func TestNew(t *testing.T) {
+	cases := map[string]bool{
+		"unix:///var/run/docker.sock": true,
+		"tcp://127.0.0.1:2375":        true,
+		"https://docker.local:2376":   true,
+		"ftp://docker.local":          false,
+	}
+
+	for host, ok := range cases {
+		_, err := dockerapi.New(host)
+
+		if ok && err != nil {
+			t.Errorf("%s: New()=%s", host, err)
+		}
+
+		if !ok && err == nil {
+			t.Errorf("%s: expected New() to fail", host)
+		}
+	}
+}
+
+func TestPullImage(t *testing.T) {
+	pulled := make(map[string]bool)
+
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/v1.24/images/create", func(w http.ResponseWriter, r *http.Request) {
+		image := r.URL.Query().Get("fromImage") + ":" + r.URL.Query().Get("tag")
+
+		w.Write([]byte(`{"status":"Pulling from library"}` + "\n"))
+
+		if strings.HasPrefix(image, "missing") {
+			w.Write([]byte(`{"error":"image not found"}` + "\n"))
+			return
+		}
+
+		w.Write([]byte(`{"status":"Download complete"}` + "\n"))
+		pulled[image] = true
+	})
+
+	mux.HandleFunc("/v1.24/images/", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1.24/images/"), "/json")
+
+		if !pulled[name] {
+			http.Error(w, `{"message":"No such image"}`, http.StatusNotFound)
+			return
+		}
+
+		w.Write([]byte(`{"Id":"sha256:abc","RepoTags":["` + name + `"]}`))
+	})
+
+	s := httptest.NewServer(mux)
+	defer s.Close()
+
+	c, err := dockerapi.New("tcp://" + strings.TrimPrefix(s.URL, "http://"))
+	if err != nil {
+		t.Fatalf("New()=%s", err)
+	}
+
+	if _, err := c.Image("ubuntu:14.04"); err != dockerapi.ErrNotFound {
+		t.Fatalf("got %v, want %v", err, dockerapi.ErrNotFound)
+	}
+
+	cases := map[string]string{
+		"ubuntu:14.04":                 "ubuntu:14.04",
+		"ubuntu":                       "ubuntu:latest",
+		"localhost:5000/koding/ubuntu": "localhost:5000/koding/ubuntu:latest",
+	}
+
+	for name, want := range cases {
+		if err := c.PullImage(name); err != nil {
+			t.Fatalf("%s: PullImage()=%s", name, err)
+		}
+
+		if !pulled[want] {
+			t.Fatalf("%s: %q was not pulled: %v", name, want, pulled)
+		}
+	}
+
+	image, err := c.Image("ubuntu:14.04")
+	if err != nil {
+		t.Fatalf("Image()=%s", err)
+	}
+
+	if image.ID != "sha256:abc" {
+		t.Fatalf("got %q, want %q", image.ID, "sha256:abc")
+	}
+
+	if err := c.PullImage("missing"); err == nil || !strings.Contains(err.Error(), "image not found") {
+		t.Fatalf("got %v, want image not found error", err)
+	}
+}
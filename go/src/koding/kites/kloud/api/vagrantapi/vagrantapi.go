@@ -56,9 +56,11 @@ type Create struct {
 	Debug          bool             // enable klient/vagrant debug logging
 }
 
-// Command represents vagrant.{up,halt,destroy} requests.
+// Command represents vagrant.{up,halt,destroy} and
+// vagrant.snapshot{Save,Restore,Delete} requests.
 type Command struct {
 	FilePath  string // can be relative or absolute
+	Name      string `json:"name,omitempty"` // snapshot name
 	Success   dnode.Function
 	Failure   dnode.Function
 	Output    dnode.Function
@@ -145,9 +147,13 @@ func (k *Klient) send(queryString, method string, req, resp interface{}) (string
 }
 
 func (k *Klient) cmd(queryString, method, boxPath string) error {
+	return k.command(queryString, method, &Command{FilePath: boxPath})
+}
+
+func (k *Klient) command(queryString, method string, req *Command) error {
 	queryString = utils.QueryString(queryString)
 
-	k.Log.Debug("calling %q command on %q with %q", method, queryString, boxPath)
+	k.Log.Debug("calling %q command on %q with %q", method, queryString, req.FilePath)
 
 	kref, err := klient.ConnectTimeout(k.Kite, queryString, k.dialTimeout())
 	if err != nil {
@@ -208,12 +214,9 @@ func (k *Klient) cmd(queryString, method, boxPath string) error {
 		beat <- struct{}{}
 	})
 
-	req := &Command{
-		FilePath:  boxPath,
-		Success:   success,
-		Failure:   failure,
-		Heartbeat: heartbeat,
-	}
+	req.Success = success
+	req.Failure = failure
+	req.Heartbeat = heartbeat
 
 	if k.Debug {
 		log := k.Log.New(method)
@@ -245,6 +248,7 @@ func (k *Klient) Create(queryString string, req *Create) (resp *Create, err erro
 		share := map[string]interface{}{
 			"username":  req.Username,
 			"permanent": true,
+			"role":      "full",
 		}
 
 		if _, err := k.send(queryString, "klient.share", share, nil); err != nil {
@@ -307,6 +311,21 @@ func (k *Klient) Halt(queryString, boxPath string) error {
 	return k.cmd(queryString, "vagrant.halt", boxPath)
 }
 
+// SnapshotSave calls vagrant.snapshotSave method on a kite given by the queryString.
+func (k *Klient) SnapshotSave(queryString, boxPath, name string) error {
+	return k.command(queryString, "vagrant.snapshotSave", &Command{FilePath: boxPath, Name: name})
+}
+
+// SnapshotRestore calls vagrant.snapshotRestore method on a kite given by the queryString.
+func (k *Klient) SnapshotRestore(queryString, boxPath, name string) error {
+	return k.command(queryString, "vagrant.snapshotRestore", &Command{FilePath: boxPath, Name: name})
+}
+
+// SnapshotDelete calls vagrant.snapshotDelete method on a kite given by the queryString.
+func (k *Klient) SnapshotDelete(queryString, boxPath, name string) error {
+	return k.command(queryString, "vagrant.snapshotDelete", &Command{FilePath: boxPath, Name: name})
+}
+
 // Version calls vagrant.version method on a kite given by the queryString.
 func (k *Klient) Version(queryString string) (string, error) {
 	req := &struct {
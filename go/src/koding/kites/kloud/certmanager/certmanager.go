@@ -0,0 +1,530 @@
+// Package certmanager obtains and renews TLS certificates for custom
+// domains of machines and installs them on the machines' klients.
+package certmanager
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"koding/db/mongodb/modelhelper"
+	"koding/kites/kloud/dnsstorage"
+	"koding/kites/kloud/klient"
+	"koding/kites/kloud/pkg/acme"
+	"koding/kites/kloud/pkg/dnsclient"
+
+	"github.com/koding/kite"
+	"github.com/koding/logging"
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+const (
+	// DefaultInterval is used when Manager.Interval is zero.
+	DefaultInterval = 12 * time.Hour
+
+	// DefaultRenewBefore is used when Manager.RenewBefore is zero.
+	DefaultRenewBefore = 30 * 24 * time.Hour
+
+	// DefaultTimeout is used when Manager.Timeout is zero.
+	DefaultTimeout = 5 * time.Minute
+)
+
+var defaultLog = logging.NewLogger("certmanager")
+
+// ErrNoChallenge is returned by Verify when the domain has
+// no pending ownership challenge.
+var ErrNoChallenge = errors.New("domain has no pending challenge")
+
+// Manager obtains certificates for custom domains stored in dnsstorage.
+//
+// The ownership of a domain is proven with either a dns-01 or http-01
+// challenge, which the user is asked to publish after adding the domain.
+// Before the challenge is submitted to the CA, Manager checks whether it
+// was published, so users are not rate-limited for invalid attempts.
+//
+// When the _acme-challenge record of a custom domain is CNAME-delegated
+// into the hosted zone, Manager renews the certificate on its own by
+// publishing the dns-01 challenge with the DNS client.
+type Manager struct {
+	ACME    *acme.Client
+	Storage dnsstorage.Storage
+	Kite    *kite.Kite
+	Log     logging.Logger
+
+	// Contact is a list of contact URLs (e.g. "mailto:admin@example.com")
+	// the ACME account is registered with.
+	Contact []string
+
+	// DNS is used to publish challenges of delegated domains. If nil,
+	// each renewal requires user's interaction.
+	DNS dnsclient.Client
+
+	// Interval is a time between renewal runs.
+	Interval time.Duration
+
+	// RenewBefore is a time before expiration when a certificate
+	// is going to be renewed.
+	RenewBefore time.Duration
+
+	// Timeout is a maximum time for obtaining a single certificate.
+	Timeout time.Duration
+
+	// Install is used to install certificates on machines. If nil,
+	// the certificates are pushed to klient's tlsproxy.
+	Install func(d *dnsstorage.Domain) error
+
+	// LookupTXT and LookupCNAME are used to check whether challenges
+	// are published. If nil, net.LookupTXT and net.LookupCNAME
+	// are used.
+	LookupTXT   func(name string) ([]string, error)
+	LookupCNAME func(name string) (string, error)
+
+	// HTTPClient is used to check whether http-01 challenges are
+	// published. If nil, http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	mu sync.Mutex // serializes account registration
+}
+
+// Challenge creates a new order for the domain and stores the ownership
+// challenge of the given type, which the user is expected to publish.
+func (m *Manager) Challenge(ctx context.Context, d *dnsstorage.Domain, typ string) (*dnsstorage.Challenge, error) {
+	if typ == "" {
+		typ = acme.ChallengeDNS01
+	}
+
+	if typ != acme.ChallengeDNS01 && typ != acme.ChallengeHTTP01 {
+		return nil, fmt.Errorf("unsupported challenge type %q", typ)
+	}
+
+	if err := m.register(ctx); err != nil {
+		return nil, err
+	}
+
+	order, err := m.ACME.NewOrder(ctx, d.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(order.Authorizations) == 0 {
+		return nil, fmt.Errorf("no authorizations for %q", d.Name)
+	}
+
+	authz, err := m.ACME.GetAuthorization(ctx, order.Authorizations[0])
+	if err != nil {
+		return nil, err
+	}
+
+	chal := authz.Challenge(typ)
+	if chal == nil {
+		return nil, fmt.Errorf("%s challenge is not offered for %q", typ, d.Name)
+	}
+
+	keyAuth, err := m.ACME.KeyAuthorization(chal.Token)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &dnsstorage.Challenge{
+		Type:      typ,
+		Token:     chal.Token,
+		KeyAuth:   keyAuth,
+		URL:       chal.URL,
+		AuthzURL:  authz.URL,
+		OrderURL:  order.URL,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	switch typ {
+	case acme.ChallengeDNS01:
+		if c.RecordValue, err = m.ACME.DNS01Record(chal.Token); err != nil {
+			return nil, err
+		}
+
+		c.RecordName = acme.DNS01Name(d.Name)
+		c.Delegation = m.Delegation(d)
+	case acme.ChallengeHTTP01:
+		c.Path = acme.HTTP01Path(chal.Token)
+		c.Content = keyAuth
+	}
+
+	if err := m.Storage.UpdateChallenge(d.Name, c); err != nil {
+		return nil, err
+	}
+
+	d.Challenge = c
+
+	return c, nil
+}
+
+// Verify checks whether the pending challenge of the domain was published
+// and, if so, obtains a certificate for the domain and installs it
+// on the domain's machine.
+func (m *Manager) Verify(ctx context.Context, name string) (*dnsstorage.Certificate, error) {
+	d, err := m.Storage.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if d.Challenge == nil {
+		return nil, ErrNoChallenge
+	}
+
+	if err := m.Check(ctx, d); err != nil {
+		return nil, err
+	}
+
+	return m.issue(ctx, d)
+}
+
+// Check returns non-nil error when the challenge of the given domain
+// is not published yet.
+func (m *Manager) Check(ctx context.Context, d *dnsstorage.Domain) error {
+	c := d.Challenge
+
+	switch c.Type {
+	case acme.ChallengeDNS01:
+		txt, err := m.lookupTXT(c.RecordName)
+		if err != nil {
+			return fmt.Errorf("unable to lookup TXT record %q: %s", c.RecordName, err)
+		}
+
+		for _, value := range txt {
+			if value == c.RecordValue {
+				return nil
+			}
+		}
+
+		return fmt.Errorf("TXT record %q does not contain %q", c.RecordName, c.RecordValue)
+	case acme.ChallengeHTTP01:
+		u := "http://" + d.Name + c.Path
+
+		resp, err := ctxhttp.Get(ctx, m.httpClient(), u)
+		if err != nil {
+			return fmt.Errorf("unable to get %q: %s", u, err)
+		}
+		defer resp.Body.Close()
+
+		p, err := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		if err != nil {
+			return fmt.Errorf("unable to get %q: %s", u, err)
+		}
+
+		if resp.StatusCode != http.StatusOK || strings.TrimSpace(string(p)) != c.Content {
+			return fmt.Errorf("%q does not serve the challenge response", u)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unsupported challenge type %q", c.Type)
+	}
+}
+
+// Delegation gives a name in the hosted zone, which the _acme-challenge
+// record of the domain can be CNAME-delegated to in order to have the
+// certificate renewed automatically.
+//
+// If m.DNS is nil, the method returns empty string.
+func (m *Manager) Delegation(d *dnsstorage.Domain) string {
+	if m.DNS == nil {
+		return ""
+	}
+
+	sum := sha1.Sum([]byte(strings.ToLower(d.Name)))
+
+	return fmt.Sprintf("_acme-%s.%s", hex.EncodeToString(sum[:8]), m.DNS.HostedZone())
+}
+
+// Remove uninstalls the certificate of the domain from its machine.
+func (m *Manager) Remove(d *dnsstorage.Domain) error {
+	return m.install(&dnsstorage.Domain{
+		Username:  d.Username,
+		MachineId: d.MachineId,
+		Name:      d.Name,
+		Custom:    d.Custom,
+	})
+}
+
+// Run renews expiring certificates every m.Interval. It never returns.
+func (m *Manager) Run() {
+	for range time.Tick(m.interval()) {
+		m.RunOnce(time.Now().UTC())
+	}
+}
+
+// RunOnce renews certificates that expire before now + m.RenewBefore.
+//
+// Domains with a pending challenge are verified, so the users are
+// not required to call domain.verify after publishing the challenge.
+func (m *Manager) RunOnce(now time.Time) {
+	domains, err := m.Storage.GetExpiring(now.Add(m.renewBefore()))
+	if err != nil {
+		m.log().Error("failed to fetch expiring domains: %s", err)
+		return
+	}
+
+	for _, d := range domains {
+		if err := m.renew(d); err != nil {
+			m.log().Warning("[%s] unable to renew certificate: %s", d.Name, err)
+		}
+	}
+}
+
+func (m *Manager) renew(d *dnsstorage.Domain) error {
+	ctx, cancel := context.WithTimeout(context.Background(), m.timeout())
+	defer cancel()
+
+	if d.Challenge != nil {
+		if err := m.Check(ctx, d); err != nil {
+			m.log().Debug("[%s] challenge is not published yet: %s", d.Name, err)
+			return nil
+		}
+
+		_, err := m.issue(ctx, d)
+		return err
+	}
+
+	c, err := m.Challenge(ctx, d, acme.ChallengeDNS01)
+	if err != nil {
+		return err
+	}
+
+	if !m.delegated(d, c) {
+		m.log().Info("[%s] certificate expires soon, waiting for the challenge to be published", d.Name)
+		return nil
+	}
+
+	rec := &dnsclient.Record{
+		Name: c.Delegation,
+		Type: "TXT",
+		IP:   c.RecordValue,
+		TTL:  30,
+	}
+
+	if err := m.DNS.UpsertRecord(rec); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err := m.DNS.DeleteRecord(rec); err != nil {
+			m.log().Warning("[%s] unable to delete challenge record: %s", d.Name, err)
+		}
+	}()
+
+	_, err = m.issue(ctx, d)
+	return err
+}
+
+// delegated tells whether the _acme-challenge record of the domain
+// is a CNAME pointing to the delegation name.
+func (m *Manager) delegated(d *dnsstorage.Domain, c *dnsstorage.Challenge) bool {
+	if c.Delegation == "" {
+		return false
+	}
+
+	cname, err := m.lookupCNAME(c.RecordName)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(strings.TrimSuffix(cname, "."), c.Delegation)
+}
+
+// issue submits the challenge of the domain, finalizes its order and
+// stores the obtained certificate.
+func (m *Manager) issue(ctx context.Context, d *dnsstorage.Domain) (*dnsstorage.Certificate, error) {
+	if err := m.register(ctx); err != nil {
+		return nil, err
+	}
+
+	c := d.Challenge
+
+	authz, err := m.ACME.GetAuthorization(ctx, c.AuthzURL)
+	if err != nil {
+		return nil, err
+	}
+
+	if authz.Status != acme.StatusValid {
+		if _, err := m.ACME.Accept(ctx, &acme.Challenge{Type: c.Type, URL: c.URL, Token: c.Token}); err != nil {
+			return nil, err
+		}
+
+		if _, err := m.ACME.WaitAuthorization(ctx, c.AuthzURL); err != nil {
+			return nil, err
+		}
+	}
+
+	order, err := m.ACME.GetOrder(ctx, c.OrderURL)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: d.Name},
+		DNSNames: []string{d.Name},
+	}, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if order, err = m.ACME.Finalize(ctx, order, csr); err != nil {
+		return nil, err
+	}
+
+	chain, err := m.ACME.Certificate(ctx, order.Certificate)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := newCertificate(chain, key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.Storage.UpdateCertificate(d.Name, cert); err != nil {
+		return nil, err
+	}
+
+	d.Challenge = nil
+	d.Certificate = cert
+
+	// The certificate is stored, so failing to install it is not fatal -
+	// the machine may be stopped at the moment.
+	if err := m.install(d); err != nil {
+		m.log().Warning("[%s] unable to install certificate on %q: %s", d.Name, d.MachineId, err)
+	}
+
+	return cert, nil
+}
+
+func (m *Manager) install(d *dnsstorage.Domain) error {
+	if m.Install != nil {
+		return m.Install(d)
+	}
+
+	if d.MachineId == "" {
+		return nil
+	}
+
+	machine, err := modelhelper.GetMachine(d.MachineId)
+	if err != nil {
+		return err
+	}
+
+	k, err := klient.ConnectTimeout(m.Kite, machine.QueryString, time.Minute)
+	if err != nil {
+		return err
+	}
+	defer k.Close()
+
+	var certPEM, keyPEM string
+	if d.Certificate != nil {
+		certPEM, keyPEM = d.Certificate.CertPEM, d.Certificate.KeyPEM
+	}
+
+	return k.SetCertificate(d.Name, certPEM, keyPEM)
+}
+
+func (m *Manager) register(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.ACME.AccountURL != "" {
+		return nil
+	}
+
+	_, err := m.ACME.Register(ctx, m.Contact...)
+	return err
+}
+
+func (m *Manager) lookupTXT(name string) ([]string, error) {
+	if m.LookupTXT != nil {
+		return m.LookupTXT(name)
+	}
+	return net.LookupTXT(name)
+}
+
+func (m *Manager) lookupCNAME(name string) (string, error) {
+	if m.LookupCNAME != nil {
+		return m.LookupCNAME(name)
+	}
+	return net.LookupCNAME(name)
+}
+
+func (m *Manager) httpClient() *http.Client {
+	if m.HTTPClient != nil {
+		return m.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (m *Manager) interval() time.Duration {
+	if m.Interval != 0 {
+		return m.Interval
+	}
+	return DefaultInterval
+}
+
+func (m *Manager) renewBefore() time.Duration {
+	if m.RenewBefore != 0 {
+		return m.RenewBefore
+	}
+	return DefaultRenewBefore
+}
+
+func (m *Manager) timeout() time.Duration {
+	if m.Timeout != 0 {
+		return m.Timeout
+	}
+	return DefaultTimeout
+}
+
+func (m *Manager) log() logging.Logger {
+	if m.Log != nil {
+		return m.Log
+	}
+	return defaultLog
+}
+
+func newCertificate(chain []byte, key *ecdsa.PrivateKey) (*dnsstorage.Certificate, error) {
+	block, _ := pem.Decode(chain)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("unable to decode certificate chain")
+	}
+
+	crt, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dnsstorage.Certificate{
+		CertPEM:  string(chain),
+		KeyPEM:   string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})),
+		NotAfter: crt.NotAfter,
+	}, nil
+}
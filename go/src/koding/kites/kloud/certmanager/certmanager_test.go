@@ -0,0 +1,360 @@
+package certmanager_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"koding/kites/kloud/certmanager"
+	"koding/kites/kloud/dnsstorage"
+	"koding/kites/kloud/pkg/acme"
+	"koding/kites/kloud/pkg/dnsclient"
+
+	"golang.org/x/net/context"
+)
+
+type memStorage struct {
+	mu      sync.Mutex
+	domains map[string]*dnsstorage.Domain
+}
+
+var _ dnsstorage.Storage = (*memStorage)(nil)
+
+func newMemStorage(domains ...*dnsstorage.Domain) *memStorage {
+	s := &memStorage{domains: make(map[string]*dnsstorage.Domain)}
+	for _, d := range domains {
+		s.Add(d)
+	}
+	return s
+}
+
+func (s *memStorage) Add(d *dnsstorage.Domain) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	dCopy := *d
+	s.domains[d.Name] = &dCopy
+	return nil
+}
+
+func (s *memStorage) Delete(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.domains, name)
+	return nil
+}
+
+func (s *memStorage) UpdateMachine(name, machine string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.domains[name]
+	if !ok {
+		return errors.New("not found")
+	}
+	d.MachineId = machine
+	return nil
+}
+
+func (s *memStorage) Get(name string) (*dnsstorage.Domain, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.domains[name]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	dCopy := *d
+	return &dCopy, nil
+}
+
+func (s *memStorage) GetByMachine(machine string) ([]*dnsstorage.Domain, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var domains []*dnsstorage.Domain
+	for _, d := range s.domains {
+		if d.MachineId == machine {
+			dCopy := *d
+			domains = append(domains, &dCopy)
+		}
+	}
+	return domains, nil
+}
+
+func (s *memStorage) UpdateChallenge(name string, c *dnsstorage.Challenge) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.domains[name]
+	if !ok {
+		return errors.New("not found")
+	}
+	d.Challenge = c
+	return nil
+}
+
+func (s *memStorage) UpdateCertificate(name string, c *dnsstorage.Certificate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.domains[name]
+	if !ok {
+		return errors.New("not found")
+	}
+	d.Certificate = c
+	d.Challenge = nil
+	d.ExpiresAt = time.Time{}
+	return nil
+}
+
+func (s *memStorage) GetExpiring(before time.Time) ([]*dnsstorage.Domain, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var domains []*dnsstorage.Domain
+	for _, d := range s.domains {
+		if d.Custom && (d.Certificate == nil || d.Certificate.NotAfter.Before(before)) && !d.Expired(time.Now()) {
+			dCopy := *d
+			domains = append(domains, &dCopy)
+		}
+	}
+	return domains, nil
+}
+
+func TestCheck(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/.well-known/acme-challenge/token" {
+			w.Write([]byte("token.thumb\n"))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	m := &certmanager.Manager{
+		LookupTXT: func(name string) ([]string, error) {
+			if name == "_acme-challenge.example.com" {
+				return []string{"other", "value"}, nil
+			}
+			return nil, errors.New("no such host")
+		},
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{
+				// Route all requests to the test server.
+				Dial: func(network, _ string) (net.Conn, error) {
+					return net.Dial(network, srv.Listener.Addr().String())
+				},
+			},
+		},
+	}
+
+	cases := map[string]struct {
+		challenge *dnsstorage.Challenge
+		ok        bool
+	}{
+		"dns-01 published": {
+			&dnsstorage.Challenge{Type: acme.ChallengeDNS01, RecordName: "_acme-challenge.example.com", RecordValue: "value"},
+			true,
+		},
+		"dns-01 wrong value": {
+			&dnsstorage.Challenge{Type: acme.ChallengeDNS01, RecordName: "_acme-challenge.example.com", RecordValue: "foo"},
+			false,
+		},
+		"dns-01 missing record": {
+			&dnsstorage.Challenge{Type: acme.ChallengeDNS01, RecordName: "_acme-challenge.example.org", RecordValue: "value"},
+			false,
+		},
+		"http-01 published": {
+			&dnsstorage.Challenge{Type: acme.ChallengeHTTP01, Path: "/.well-known/acme-challenge/token", Content: "token.thumb"},
+			true,
+		},
+		"http-01 wrong content": {
+			&dnsstorage.Challenge{Type: acme.ChallengeHTTP01, Path: "/.well-known/acme-challenge/token", Content: "token.other"},
+			false,
+		},
+		"http-01 not found": {
+			&dnsstorage.Challenge{Type: acme.ChallengeHTTP01, Path: "/.well-known/acme-challenge/other", Content: "other.thumb"},
+			false,
+		},
+		"unsupported type": {
+			&dnsstorage.Challenge{Type: "tls-alpn-01"},
+			false,
+		},
+	}
+
+	for name, cas := range cases {
+		t.Run(name, func(t *testing.T) {
+			d := &dnsstorage.Domain{Name: "example.com", Challenge: cas.challenge}
+
+			err := m.Check(context.Background(), d)
+
+			if ok := err == nil; ok != cas.ok {
+				t.Fatalf("got %v (%v), want %v", ok, err, cas.ok)
+			}
+		})
+	}
+}
+
+type fakeDNS struct {
+	dnsclient.Client
+	zone string
+}
+
+func (f *fakeDNS) HostedZone() string { return f.zone }
+
+func TestDelegation(t *testing.T) {
+	m := &certmanager.Manager{}
+
+	if got := m.Delegation(&dnsstorage.Domain{Name: "example.com"}); got != "" {
+		t.Fatalf("got %q, want empty delegation", got)
+	}
+
+	m.DNS = &fakeDNS{zone: "dev.koding.io"}
+
+	d1 := m.Delegation(&dnsstorage.Domain{Name: "example.com"})
+	d2 := m.Delegation(&dnsstorage.Domain{Name: "Example.com"})
+	d3 := m.Delegation(&dnsstorage.Domain{Name: "example.org"})
+
+	if d1 != d2 {
+		t.Fatalf("got %q != %q, want delegation to be case-insensitive", d1, d2)
+	}
+
+	if d1 == d3 {
+		t.Fatalf("got %q, want distinct delegations", d1)
+	}
+
+	if !strings.HasPrefix(d1, "_acme-") || !strings.HasSuffix(d1, ".dev.koding.io") {
+		t.Fatalf("unexpected delegation: %q", d1)
+	}
+}
+
+func TestRunOncePending(t *testing.T) {
+	d := &dnsstorage.Domain{
+		Name:   "example.com",
+		Custom: true,
+		Challenge: &dnsstorage.Challenge{
+			Type:        acme.ChallengeDNS01,
+			RecordName:  "_acme-challenge.example.com",
+			RecordValue: "value",
+		},
+	}
+
+	var lookups int
+
+	m := &certmanager.Manager{
+		// ACME client with no directory, any request to the CA fails.
+		ACME:    &acme.Client{DirectoryURL: "http://127.0.0.1:0/directory"},
+		Storage: newMemStorage(d),
+		LookupTXT: func(string) ([]string, error) {
+			lookups++
+			return nil, errors.New("no such host")
+		},
+		Install: func(*dnsstorage.Domain) error {
+			t.Fatal("unexpected install")
+			return nil
+		},
+	}
+
+	m.RunOnce(time.Now())
+
+	if lookups != 1 {
+		t.Fatalf("got %d lookups, want 1", lookups)
+	}
+
+	got, err := m.Storage.Get("example.com")
+	if err != nil {
+		t.Fatalf("Get()=%s", err)
+	}
+
+	if got.Challenge == nil || got.Certificate != nil {
+		t.Fatalf("got %+v, want the challenge to be still pending", got)
+	}
+}
+
+// TestLocalCA runs against a local ACME test server, e.g. pebble started
+// with PEBBLE_VA_ALWAYS_VALID=1:
+//
+//   ACME_DIRECTORY_URL=https://127.0.0.1:14000/dir go test -run TestLocalCA
+//
+func TestLocalCA(t *testing.T) {
+	dir := os.Getenv("ACME_DIRECTORY_URL")
+	if dir == "" {
+		t.Skip("ACME_DIRECTORY_URL is not set")
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey()=%s", err)
+	}
+
+	d := &dnsstorage.Domain{
+		Name:      "test.koding.example",
+		MachineId: "machine",
+		Custom:    true,
+	}
+
+	storage := newMemStorage(d)
+	installed := make(chan *dnsstorage.Domain, 1)
+	records := make(map[string]string)
+
+	m := &certmanager.Manager{
+		ACME: &acme.Client{
+			Key:          key,
+			DirectoryURL: dir,
+			PollInterval: 100 * time.Millisecond,
+			HTTPClient: &http.Client{
+				Transport: &http.Transport{
+					TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+				},
+			},
+		},
+		Storage: storage,
+		Install: func(d *dnsstorage.Domain) error {
+			installed <- d
+			return nil
+		},
+		LookupTXT: func(name string) ([]string, error) {
+			return []string{records[name]}, nil
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	c, err := m.Challenge(ctx, d, acme.ChallengeDNS01)
+	if err != nil {
+		t.Fatalf("Challenge()=%s", err)
+	}
+
+	if _, err := m.Verify(ctx, d.Name); err == nil {
+		t.Fatal("expected Verify to fail for unpublished challenge")
+	}
+
+	records[c.RecordName] = c.RecordValue
+
+	cert, err := m.Verify(ctx, d.Name)
+	if err != nil {
+		t.Fatalf("Verify()=%s", err)
+	}
+
+	if !cert.NotAfter.After(time.Now()) {
+		t.Fatalf("certificate is expired: %s", cert.NotAfter)
+	}
+
+	select {
+	case got := <-installed:
+		if got.Certificate == nil || got.Certificate.CertPEM != cert.CertPEM {
+			t.Fatalf("got %+v, want installed certificate", got.Certificate)
+		}
+	default:
+		t.Fatal("certificate was not installed")
+	}
+
+	if _, err := tls.X509KeyPair([]byte(cert.CertPEM), []byte(cert.KeyPEM)); err != nil {
+		t.Fatalf("X509KeyPair()=%s", err)
+	}
+}
@@ -1,5 +1,7 @@
 package dnsstorage
 
+import "time"
+
 // Domain represents a machines domain necessary information
 type Domain struct {
 	// Username defines a the owner of the machine
@@ -12,6 +14,76 @@ type Domain struct {
 	// Name is the domain name, such as "arslan.koding.io" or
 	// "fatih.arslan.koding.io"
 	Name string
+
+	// Custom is true when the domain is owned by the user and is not
+	// a subdomain of the kloud's hosted zone.
+	Custom bool
+
+	// Challenge is a pending ownership challenge of a custom domain.
+	Challenge *Challenge
+
+	// Certificate is a TLS certificate issued for the domain.
+	Certificate *Certificate
+
+	// ExpiresAt is set for custom domains which ownership was not
+	// verified yet. Such domains are released after that time.
+	ExpiresAt time.Time
+}
+
+// Expired returns true if the domain is a pending custom domain,
+// which was not verified before its expiration time.
+func (d *Domain) Expired(now time.Time) bool {
+	return !d.ExpiresAt.IsZero() && now.After(d.ExpiresAt)
+}
+
+// Challenge describes how the ownership of a custom domain is verified.
+type Challenge struct {
+	// Type is either "dns-01" or "http-01".
+	Type string `bson:"type"`
+
+	// Token is a challenge token issued by the CA.
+	Token string `bson:"token"`
+
+	// KeyAuth is a key authorization for the token.
+	KeyAuth string `bson:"keyAuth"`
+
+	// URL is a challenge URL.
+	URL string `bson:"url"`
+
+	// AuthzURL is an authorization URL the challenge belongs to.
+	AuthzURL string `bson:"authzURL"`
+
+	// OrderURL is an order URL the authorization belongs to.
+	OrderURL string `bson:"orderURL"`
+
+	// RecordName and RecordValue describe a TXT record that is
+	// required to be published for a dns-01 challenge.
+	RecordName  string `bson:"recordName,omitempty"`
+	RecordValue string `bson:"recordValue,omitempty"`
+
+	// Path and Content describe a response that is required to
+	// be served for a http-01 challenge.
+	Path    string `bson:"path,omitempty"`
+	Content string `bson:"content,omitempty"`
+
+	// Delegation is a name in the hosted zone the RecordName can be
+	// CNAME-delegated to, which allows for renewing the certificate
+	// without user's interaction.
+	Delegation string `bson:"delegation,omitempty"`
+
+	CreatedAt time.Time `bson:"createdAt"`
+}
+
+// Certificate is a TLS certificate of a custom domain.
+type Certificate struct {
+	// CertPEM is a PEM-encoded certificate chain.
+	CertPEM string `bson:"cert"`
+
+	// KeyPEM is a PEM-encoded private key of the certificate.
+	KeyPEM string `bson:"key"`
+
+	// NotAfter is the expiration time of the certificate.
+	NotAfter time.Time `bson:"notAfter"`
 }
 
 // Storage is responsible of managing domain specific storage actions
@@ -31,4 +103,17 @@ type Storage interface {
 
 	// GetByMachine returns the domains that belongs to the given machine
 	GetByMachine(machine string) ([]*Domain, error)
+
+	// UpdateChallenge sets the ownership challenge for the given domain
+	// name. Challenge can be nil.
+	UpdateChallenge(name string, c *Challenge) error
+
+	// UpdateCertificate sets the certificate for the given domain name
+	// and clears its challenge and expiration time.
+	UpdateCertificate(name string, c *Certificate) error
+
+	// GetExpiring returns custom domains which certificates expire
+	// before the given time or which have no certificate yet. Pending
+	// domains which have already expired are not returned.
+	GetExpiring(before time.Time) ([]*Domain, error)
 }
@@ -25,6 +25,23 @@ type DomainDocument struct {
 	DomainName string        `bson:"domain"`
 	CreatedAt  time.Time     `bson:"createdAt"`
 	ModifiedAt time.Time     `bson:"modifiedAt"`
+
+	Custom      bool         `bson:"custom,omitempty"`
+	Challenge   *Challenge   `bson:"challenge,omitempty"`
+	Certificate *Certificate `bson:"certificate,omitempty"`
+	ExpiresAt   time.Time    `bson:"expiresAt,omitempty"`
+}
+
+func (doc *DomainDocument) domain() *Domain {
+	return &Domain{
+		Username:    doc.OriginId.Hex(),
+		MachineId:   doc.MachineId.Hex(),
+		Name:        doc.DomainName,
+		Custom:      doc.Custom,
+		Challenge:   doc.Challenge,
+		Certificate: doc.Certificate,
+		ExpiresAt:   doc.ExpiresAt,
+	}
 }
 
 type MongodbStorage struct {
@@ -39,6 +56,16 @@ func NewMongodbStorage(db *mongodb.MongoDB) *MongodbStorage {
 	}
 }
 
+// EnsureIndexes creates an index which removes pending custom
+// domains once they expire.
+func (m *MongodbStorage) EnsureIndexes() error {
+	return m.DB.EnsureIndex(domainCollection, mgo.Index{
+		Key:         []string{"expiresAt"},
+		ExpireAfter: time.Second,
+		Background:  true,
+	})
+}
+
 func (m *MongodbStorage) Add(domain *Domain) error {
 	var account *models.Account
 	if err := m.DB.Run("jAccounts", func(c *mgo.Collection) error {
@@ -55,6 +82,9 @@ func (m *MongodbStorage) Add(domain *Domain) error {
 		DomainName: domain.Name,
 		CreatedAt:  time.Now().UTC(),
 		ModifiedAt: time.Now().UTC(),
+		Custom:     domain.Custom,
+		Challenge:  domain.Challenge,
+		ExpiresAt:  domain.ExpiresAt,
 	}
 
 	err := m.DB.Run(domainCollection, func(c *mgo.Collection) error {
@@ -92,10 +122,7 @@ func (m *MongodbStorage) Get(name string) (*Domain, error) {
 		return nil, err
 	}
 
-	return &Domain{
-		MachineId: doc.MachineId.Hex(),
-		Name:      doc.DomainName,
-	}, nil
+	return doc.domain(), nil
 }
 
 func (m *MongodbStorage) GetByMachine(machineId string) ([]*Domain, error) {
@@ -119,11 +146,7 @@ func (m *MongodbStorage) GetByMachine(machineId string) ([]*Domain, error) {
 	domains := make([]*Domain, len(domainDocuments))
 
 	for i, domain := range domainDocuments {
-		domains[i] = &Domain{
-			Username:  domain.OriginId.Hex(),
-			MachineId: machineId,
-			Name:      domain.DomainName,
-		}
+		domains[i] = domain.domain()
 	}
 
 	return domains, nil
@@ -156,3 +179,85 @@ func (m *MongodbStorage) UpdateMachine(name, machineId string) error {
 
 	return nil
 }
+
+func (m *MongodbStorage) UpdateChallenge(name string, c *Challenge) error {
+	updateData := bson.M{
+		"$set": bson.M{
+			"challenge":  c,
+			"modifiedAt": time.Now().UTC(),
+		},
+	}
+
+	if c == nil {
+		updateData = bson.M{
+			"$set":   bson.M{"modifiedAt": time.Now().UTC()},
+			"$unset": bson.M{"challenge": ""},
+		}
+	}
+
+	err := m.DB.Run(domainCollection, func(c *mgo.Collection) error {
+		return c.Update(bson.M{"domain": name}, updateData)
+	})
+
+	if err != nil {
+		m.Log.Error("Could not update challenge of %v: err: %v", name, err)
+		return errors.New("could not update domain challenge in DB")
+	}
+
+	return nil
+}
+
+func (m *MongodbStorage) UpdateCertificate(name string, c *Certificate) error {
+	err := m.DB.Run(domainCollection, func(col *mgo.Collection) error {
+		return col.Update(bson.M{"domain": name}, bson.M{
+			"$set": bson.M{
+				"certificate": c,
+				"modifiedAt":  time.Now().UTC(),
+			},
+			"$unset": bson.M{"challenge": "", "expiresAt": ""},
+		})
+	})
+
+	if err != nil {
+		m.Log.Error("Could not update certificate of %v: err: %v", name, err)
+		return errors.New("could not update domain certificate in DB")
+	}
+
+	return nil
+}
+
+func (m *MongodbStorage) GetExpiring(before time.Time) ([]*Domain, error) {
+	var domains []*Domain
+
+	query := func(c *mgo.Collection) error {
+		domain := DomainDocument{}
+
+		iter := c.Find(bson.M{
+			"custom": true,
+			"$and": []bson.M{{
+				"$or": []bson.M{
+					{"certificate": bson.M{"$exists": false}},
+					{"certificate.notAfter": bson.M{"$lt": before}},
+				},
+			}, {
+				"$or": []bson.M{
+					{"expiresAt": bson.M{"$exists": false}},
+					{"expiresAt": bson.M{"$gt": time.Now().UTC()}},
+				},
+			}},
+		}).Batch(20).Iter()
+
+		for iter.Next(&domain) {
+			domains = append(domains, domain.domain())
+			domain = DomainDocument{}
+		}
+
+		return iter.Close()
+	}
+
+	if err := m.DB.Run(domainCollection, query); err != nil {
+		return nil, err
+	}
+
+	return domains, nil
+}
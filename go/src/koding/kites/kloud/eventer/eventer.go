@@ -8,6 +8,8 @@ import (
 	"golang.org/x/net/context"
 
 	"koding/kites/kloud/machinestate"
+
+	"github.com/koding/logging"
 )
 
 type key int
@@ -49,6 +51,17 @@ type Event struct {
 	// EventId is the id of the whole proces.
 	EventId string `json:"eventId"`
 
+	// Seq is a sequence number of the event within the process, reserved
+	// in the Log when the event is pushed, so it keeps increasing across
+	// runs of the process. It is used as a cursor when reading events
+	// from a Log.
+	Seq int `json:"seq"`
+
+	// RunCursor is a sequence number of the last event of the previous
+	// run of the process. Reading events from a Log with it as a cursor
+	// gives all events of the run the event belongs to.
+	RunCursor int `json:"runCursor"`
+
 	// Message explains the current event's behaviour/content.
 	Message string `json:"message"`
 
@@ -64,6 +77,29 @@ type Event struct {
 	// Error is non empty if there is an error. It should be populated if there
 	// is an error, the eventer should stop sending any event and call Close()
 	Error string `json:"error"`
+
+	// Output is non-nil if the event carries a line of the process
+	// output, e.g. terraform progress of a single resource.
+	Output *Output `json:"output,omitempty"`
+}
+
+// Output is a single line of the process output.
+type Output struct {
+	// Resource is a name of the resource the line refers to, if any.
+	Resource string `json:"resource,omitempty" bson:"resource,omitempty"`
+
+	// Line is the output line.
+	Line string `json:"line" bson:"line"`
+
+	// Error is true if the line was written to the error output.
+	// It does not fail the process.
+	Error bool `json:"error,omitempty" bson:"error,omitempty"`
+}
+
+// Final tells whether the event is the last one of the process - it either
+// finished or failed.
+func (e *Event) Final() bool {
+	return e.Percentage == 100 || e.Error != ""
 }
 
 func (e *Event) String() string {
@@ -71,10 +107,33 @@ func (e *Event) String() string {
 		e.Message, e.Status, e.TimeStamp, e.Percentage)
 }
 
+// PushOutput pushes an event carrying the given output. The event repeats
+// message, status and percentage of the latest event, so clients that
+// only look at the latest event are not affected by the output.
+func PushOutput(e Eventer, out *Output) {
+	last := e.Show()
+
+	e.Push(&Event{
+		Message:    last.Message,
+		Status:     last.Status,
+		Percentage: last.Percentage,
+		Output:     out,
+	})
+}
+
 type Events struct {
 	events  []*Event
 	eventId string
 	closed  bool
+	seq     int
+	cursor  int // seq of the last event of the previous run
+	log     Log
+	logger  logging.Logger
+
+	pending  []*Event // events waiting to be written to the log
+	flushing bool
+	wg       sync.WaitGroup
+	reserve  sync.Mutex // orders pushes while sequence numbers are reserved
 
 	sync.Mutex
 }
@@ -86,7 +145,67 @@ func New(id string) *Events {
 	}
 }
 
+// NewWithLog creates new eventer, which persists each pushed event
+// in the given log. Errors writing to the log are reported with
+// the given logger.
+//
+// Sequence numbers are reserved in the log, so they do not collide
+// with events of other runs, even the ones not written yet, and
+// a cursor obtained from previous run stays valid.
+func NewWithLog(id string, log Log, logger logging.Logger) *Events {
+	e := New(id)
+	e.log = log
+	e.logger = logger
+
+	if seq, err := log.Reserve(id, 0); err == nil {
+		e.seq = seq
+		e.cursor = seq
+	} else {
+		logger.Error("[event] unable to read sequence number for %q: %s", id, err)
+	}
+
+	return e
+}
+
+// Cursor gives a sequence number of the last event of the previous run,
+// so events of the current one are read from the log with
+// Since(e.ID(), e.Cursor()).
+func (e *Events) Cursor() int {
+	e.Lock()
+	defer e.Unlock()
+
+	return e.cursor
+}
+
+// Cursor gives the run cursor of the given eventer, or 0 if the eventer
+// does not support it.
+func Cursor(e Eventer) int {
+	if c, ok := e.(interface {
+		Cursor() int
+	}); ok {
+		return c.Cursor()
+	}
+
+	return 0
+}
+
 func (e *Events) Push(ev *Event) {
+	// The sequence number is reserved outside of the lock,
+	// so Show does not wait for the storage.
+	e.reserve.Lock()
+	defer e.reserve.Unlock()
+
+	seq, persist := e.seq+1, false
+
+	if e.log != nil {
+		n, err := e.log.Reserve(e.eventId, 1)
+		if err == nil {
+			seq, persist = n, true
+		} else {
+			e.logger.Error("[event] unable to reserve sequence number for %q: %s", e.eventId, err)
+		}
+	}
+
 	e.Lock()
 	defer e.Unlock()
 
@@ -94,10 +213,54 @@ func (e *Events) Push(ev *Event) {
 		return
 	}
 
+	e.seq = seq
+
 	ev.EventId = e.eventId
+	ev.Seq = e.seq
+	ev.RunCursor = e.cursor
 	ev.TimeStamp = time.Now()
 
 	e.events = append(e.events, ev)
+
+	if persist {
+		// Events are written to the log in the background, in order,
+		// so pushing does not wait for the storage.
+		e.pending = append(e.pending, ev)
+
+		if !e.flushing {
+			e.flushing = true
+			e.wg.Add(1)
+			go e.flush()
+		}
+	}
+}
+
+// Flush waits until all pushed events are written to the log.
+func (e *Events) Flush() {
+	e.wg.Wait()
+}
+
+func (e *Events) flush() {
+	defer e.wg.Done()
+
+	for {
+		e.Lock()
+		pending := e.pending
+		e.pending = nil
+
+		if len(pending) == 0 {
+			e.flushing = false
+			e.Unlock()
+			return
+		}
+		e.Unlock()
+
+		for _, ev := range pending {
+			if err := e.log.Append(ev); err != nil {
+				e.logger.Error("[event] unable to persist event for %q: %s", e.eventId, err)
+			}
+		}
+	}
 }
 
 func (e *Events) Show() *Event {
@@ -0,0 +1,34 @@
+package eventer_test
+
+import (
+	"testing"
+
+	"koding/kites/kloud/eventer"
+	"koding/kites/kloud/machinestate"
+)
+
+func TestPushOutput(t *testing.T) {
+	ev := eventer.New("apply-123")
+	ev.Push(&eventer.Event{Message: "Building stack resources", Percentage: 50, Status: machinestate.Building})
+
+	out := &eventer.Output{Resource: "aws_instance.example", Line: "aws_instance.example: Creating..."}
+	eventer.PushOutput(ev, out)
+
+	got := ev.Show()
+
+	if got.Output != out {
+		t.Fatalf("got %+v, want %+v", got.Output, out)
+	}
+
+	if got.Message != "Building stack resources" || got.Percentage != 50 || got.Status != machinestate.Building {
+		t.Fatalf("got %s, want the previous event repeated", got)
+	}
+
+	if got.Final() {
+		t.Fatalf("got final event, want non-final one")
+	}
+
+	if got.Seq != 2 {
+		t.Fatalf("got %d, want 2", got.Seq)
+	}
+}
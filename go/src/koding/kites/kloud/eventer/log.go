@@ -0,0 +1,103 @@
+package eventer
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrNoEvents is returned by Log.Last when there are no events stored
+// for the given id.
+var ErrNoEvents = errors.New("no events found")
+
+// Log is a persistent, append-only storage of events.
+//
+// Events of a single process, identified by EventId, are ordered
+// by their Seq numbers, which are taken from the log with Reserve.
+type Log interface {
+	// Reserve atomically increments the sequence counter of the given
+	// process by n and returns its new value. Reserve with n equal to 0
+	// returns the current value, which is 0 for a new process.
+	Reserve(eventId string, n int) (int, error)
+
+	// Append stores the event.
+	Append(*Event) error
+
+	// Since returns events of the given process, which have sequence
+	// number greater than cursor, ordered by Seq. To fetch full
+	// history use cursor equal to 0.
+	Since(eventId string, cursor int) ([]*Event, error)
+
+	// Last returns the most recent event stored for the given process.
+	// If there are no events, it returns ErrNoEvents.
+	Last(eventId string) (*Event, error)
+}
+
+// MemoryLog is an in-memory event log, used by tests and when no
+// persistent storage is configured.
+type MemoryLog struct {
+	mu     sync.RWMutex
+	events map[string][]*Event
+	seqs   map[string]int
+}
+
+var _ Log = (*MemoryLog)(nil)
+
+// NewMemoryLog gives new empty in-memory log.
+func NewMemoryLog() *MemoryLog {
+	return &MemoryLog{
+		events: make(map[string][]*Event),
+		seqs:   make(map[string]int),
+	}
+}
+
+// Reserve implements the Log interface.
+func (m *MemoryLog) Reserve(eventId string, n int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.seqs[eventId] += n
+
+	return m.seqs[eventId], nil
+}
+
+// Append implements the Log interface.
+func (m *MemoryLog) Append(ev *Event) error {
+	evCopy := *ev
+
+	m.mu.Lock()
+	m.events[ev.EventId] = append(m.events[ev.EventId], &evCopy)
+	m.mu.Unlock()
+
+	return nil
+}
+
+// Since implements the Log interface.
+func (m *MemoryLog) Since(eventId string, cursor int) ([]*Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var events []*Event
+
+	for _, ev := range m.events[eventId] {
+		if ev.Seq > cursor {
+			evCopy := *ev
+			events = append(events, &evCopy)
+		}
+	}
+
+	return events, nil
+}
+
+// Last implements the Log interface.
+func (m *MemoryLog) Last(eventId string) (*Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := m.events[eventId]
+	if len(events) == 0 {
+		return nil, ErrNoEvents
+	}
+
+	evCopy := *events[len(events)-1]
+	return &evCopy, nil
+}
@@ -0,0 +1,102 @@
+package eventer_test
+
+import (
+	"testing"
+
+	"koding/kites/kloud/eventer"
+
+	"github.com/koding/logging"
+)
+
+func TestEventsWithLog(t *testing.T) {
+	log := eventer.NewMemoryLog()
+	logger := logging.NewLogger("test")
+
+	ev := eventer.NewWithLog("apply-123", log, logger)
+	ev.Push(&eventer.Event{Message: "apply started", Percentage: 10})
+	ev.Push(&eventer.Event{Message: "apply in progress", Percentage: 50})
+	ev.Flush()
+
+	// eventer recreated after kloud restart continues the sequence
+	ev = eventer.NewWithLog("apply-123", log, logger)
+	ev.Push(&eventer.Event{Message: "apply finished", Percentage: 100})
+	ev.Flush()
+
+	if cursor := ev.Cursor(); cursor != 2 {
+		t.Fatalf("got cursor %d, want 2", cursor)
+	}
+
+	events, err := log.Since("apply-123", 0)
+	if err != nil {
+		t.Fatalf("Since()=%s", err)
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3", len(events))
+	}
+
+	for i, ev := range events {
+		if ev.Seq != i+1 {
+			t.Errorf("%d: got seq %d, want %d", i, ev.Seq, i+1)
+		}
+
+		if want := 2 * (i / 2); ev.RunCursor != want {
+			t.Errorf("%d: got run cursor %d, want %d", i, ev.RunCursor, want)
+		}
+	}
+
+	events, err = log.Since("apply-123", 2)
+	if err != nil {
+		t.Fatalf("Since()=%s", err)
+	}
+
+	if len(events) != 1 || !events[0].Final() {
+		t.Fatalf("got %+v, want single final event", events)
+	}
+
+	if _, err := log.Last("apply-456"); err != eventer.ErrNoEvents {
+		t.Fatalf("got %v, want %v", err, eventer.ErrNoEvents)
+	}
+}
+
+func TestEventsConcurrentRuns(t *testing.T) {
+	log := eventer.NewMemoryLog()
+	logger := logging.NewLogger("test")
+
+	// previous run is still pushing events, which are not persisted yet,
+	// when the process is started again by other kloud instance
+	prev := eventer.NewWithLog("apply-123", log, logger)
+	prev.Push(&eventer.Event{Message: "apply started", Percentage: 10})
+
+	ev := eventer.NewWithLog("apply-123", log, logger)
+
+	if cursor := ev.Cursor(); cursor != 1 {
+		t.Fatalf("got cursor %d, want 1", cursor)
+	}
+
+	prev.Push(&eventer.Event{Message: "apply failed", Error: "timeout"})
+	ev.Push(&eventer.Event{Message: "apply started", Percentage: 10})
+	ev.Push(&eventer.Event{Message: "apply finished", Percentage: 100})
+
+	prev.Flush()
+	ev.Flush()
+
+	events, err := log.Since("apply-123", 0)
+	if err != nil {
+		t.Fatalf("Since()=%s", err)
+	}
+
+	seqs := make(map[int]bool)
+
+	for _, ev := range events {
+		if seqs[ev.Seq] {
+			t.Fatalf("duplicate seq %d: %+v", ev.Seq, events)
+		}
+
+		seqs[ev.Seq] = true
+	}
+
+	if len(seqs) != 4 {
+		t.Fatalf("got %d events, want 4", len(seqs))
+	}
+}
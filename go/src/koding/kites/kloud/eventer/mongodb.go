@@ -0,0 +1,212 @@
+package eventer
+
+import (
+	"time"
+
+	"koding/db/mongodb"
+	"koding/kites/kloud/machinestate"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// DefaultCollection is the collection used by MongoLog when none
+	// is configured.
+	DefaultCollection = "jKloudEvents"
+
+	// DefaultTTL is the time events are kept in the collection
+	// when MongoLog.TTL is zero.
+	DefaultTTL = 7 * 24 * time.Hour
+)
+
+// eventDocument defines a single MongoDB document in the events collection.
+type eventDocument struct {
+	Id         bson.ObjectId `bson:"_id"`
+	EventId    string        `bson:"eventId"`
+	Seq        int           `bson:"seq"`
+	RunCursor  int           `bson:"runCursor"`
+	Message    string        `bson:"message"`
+	Status     string        `bson:"status"`
+	Percentage int           `bson:"percentage"`
+	TimeStamp  time.Time     `bson:"timeStamp"`
+	Error      string        `bson:"error,omitempty"`
+	Output     *Output       `bson:"output,omitempty"`
+}
+
+// seqDocument defines a sequence counter of a single process, stored
+// in the sequence collection.
+type seqDocument struct {
+	EventId   string    `bson:"_id"`
+	Seq       int       `bson:"seq"`
+	TimeStamp time.Time `bson:"timeStamp"`
+}
+
+func (doc *eventDocument) event() *Event {
+	return &Event{
+		EventId:    doc.EventId,
+		Seq:        doc.Seq,
+		RunCursor:  doc.RunCursor,
+		Message:    doc.Message,
+		Status:     machinestate.States[doc.Status],
+		Percentage: doc.Percentage,
+		TimeStamp:  doc.TimeStamp,
+		Error:      doc.Error,
+		Output:     doc.Output,
+	}
+}
+
+// MongoLog is an event log backed by MongoDB.
+type MongoLog struct {
+	DB         *mongodb.MongoDB
+	Collection string        // if empty, DefaultCollection is used
+	TTL        time.Duration // if zero, DefaultTTL is used
+}
+
+var _ Log = (*MongoLog)(nil)
+
+// NewMongoLog gives new event log, which uses the default collection.
+func NewMongoLog(db *mongodb.MongoDB) *MongoLog {
+	return &MongoLog{
+		DB: db,
+	}
+}
+
+// EnsureIndexes creates indexes used for reading events of a process
+// and for expiring old events and sequence counters.
+//
+// A sequence counter is updated each time an event is pushed, so
+// it expires no sooner than the events of its process.
+func (m *MongoLog) EnsureIndexes() error {
+	ttl := m.TTL
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+
+	expire := mgo.Index{
+		Key:         []string{"timeStamp"},
+		ExpireAfter: ttl,
+		Background:  true,
+	}
+
+	indexes := []mgo.Index{{
+		Key:        []string{"eventId", "seq"},
+		Unique:     true,
+		Background: true,
+	}, expire}
+
+	for _, index := range indexes {
+		if err := m.DB.EnsureIndex(m.collection(), index); err != nil {
+			return err
+		}
+	}
+
+	return m.DB.EnsureIndex(m.seqCollection(), expire)
+}
+
+// Reserve implements the Log interface.
+func (m *MongoLog) Reserve(eventId string, n int) (int, error) {
+	var doc seqDocument
+
+	change := mgo.Change{
+		Update: bson.M{
+			"$inc": bson.M{"seq": n},
+			"$set": bson.M{"timeStamp": time.Now().UTC()},
+		},
+		Upsert:    true,
+		ReturnNew: true,
+	}
+
+	reserve := func(c *mgo.Collection) error {
+		_, err := c.FindId(eventId).Apply(change, &doc)
+		return err
+	}
+
+	err := m.DB.Run(m.seqCollection(), reserve)
+	if mgo.IsDup(err) {
+		// Concurrent upserts of a new counter may race on inserting it,
+		// the counter exists now so retrying updates it.
+		err = m.DB.Run(m.seqCollection(), reserve)
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return doc.Seq, nil
+}
+
+// Append implements the Log interface.
+func (m *MongoLog) Append(ev *Event) error {
+	doc := &eventDocument{
+		Id:         bson.NewObjectId(),
+		EventId:    ev.EventId,
+		Seq:        ev.Seq,
+		RunCursor:  ev.RunCursor,
+		Message:    ev.Message,
+		Status:     ev.Status.String(),
+		Percentage: ev.Percentage,
+		TimeStamp:  ev.TimeStamp.UTC(),
+		Error:      ev.Error,
+		Output:     ev.Output,
+	}
+
+	return m.DB.Run(m.collection(), func(c *mgo.Collection) error {
+		return c.Insert(doc)
+	})
+}
+
+// Since implements the Log interface.
+func (m *MongoLog) Since(eventId string, cursor int) ([]*Event, error) {
+	var docs []*eventDocument
+
+	query := func(c *mgo.Collection) error {
+		return c.Find(bson.M{
+			"eventId": eventId,
+			"seq":     bson.M{"$gt": cursor},
+		}).Sort("seq").All(&docs)
+	}
+
+	if err := m.DB.Run(m.collection(), query); err != nil {
+		return nil, err
+	}
+
+	events := make([]*Event, len(docs))
+	for i, doc := range docs {
+		events[i] = doc.event()
+	}
+
+	return events, nil
+}
+
+// Last implements the Log interface.
+func (m *MongoLog) Last(eventId string) (*Event, error) {
+	var doc eventDocument
+
+	query := func(c *mgo.Collection) error {
+		return c.Find(bson.M{"eventId": eventId}).Sort("-seq").One(&doc)
+	}
+
+	err := m.DB.Run(m.collection(), query)
+	if err == mgo.ErrNotFound {
+		return nil, ErrNoEvents
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return doc.event(), nil
+}
+
+func (m *MongoLog) collection() string {
+	if m.Collection != "" {
+		return m.Collection
+	}
+
+	return DefaultCollection
+}
+
+func (m *MongoLog) seqCollection() string {
+	return m.collection() + "Seq"
+}
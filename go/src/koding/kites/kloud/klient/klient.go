@@ -52,6 +52,17 @@ func (k *Klient) timeout() time.Duration {
 // ShareRequest is used for klient's klient.share,klient.unshare methods.
 type ShareRequest struct {
 	Username string
+
+	// Role is a klient role of the shared user, klient gives
+	// read-only access to users shared without a role.
+	Role string `json:"role,omitempty"`
+}
+
+// CertificateRequest is used for klient's tunnel.setCertificate method.
+type CertificateRequest struct {
+	Domain string `json:"domain"`
+	Cert   string `json:"cert,omitempty"`
+	Key    string `json:"key,omitempty"`
 }
 
 func NewPool(k *kite.Kite) *KlientPool {
@@ -262,7 +273,7 @@ func (k *Klient) PingTimeout(t time.Duration) (err error) {
 // AddUser adds the given username to the klient's permission list. Once added
 // the user is able to make requests to Klient
 func (k *Klient) AddUser(username string) error {
-	resp, err := k.Client.TellWithTimeout("klient.share", k.timeout(), &ShareRequest{username})
+	resp, err := k.Client.TellWithTimeout("klient.share", k.timeout(), &ShareRequest{Username: username, Role: "full"})
 	if err != nil {
 		return err
 	}
@@ -282,7 +293,7 @@ func (k *Klient) AddUser(username string) error {
 // RemoveUser removes the given username from the klient's permission list.
 // Once removed the user is not able to make requests to Klient anymore.
 func (k *Klient) RemoveUser(username string) error {
-	resp, err := k.Client.TellWithTimeout("klient.unshare", k.timeout(), &ShareRequest{username})
+	resp, err := k.Client.TellWithTimeout("klient.unshare", k.timeout(), &ShareRequest{Username: username})
 	if err != nil {
 		return err
 	}
@@ -298,3 +309,30 @@ func (k *Klient) RemoveUser(username string) error {
 
 	return fmt.Errorf("wrong response %s", out)
 }
+
+// SetCertificate configures klient's tlsproxy to serve the given PEM-encoded
+// certificate chain and private key for the domain. An empty cert removes
+// the certificate for the domain.
+func (k *Klient) SetCertificate(domain, cert, key string) error {
+	req := &CertificateRequest{
+		Domain: domain,
+		Cert:   cert,
+		Key:    key,
+	}
+
+	resp, err := k.Client.TellWithTimeout("tunnel.setCertificate", k.timeout(), req)
+	if err != nil {
+		return err
+	}
+
+	var ok bool
+	if err := resp.Unmarshal(&ok); err != nil {
+		return err
+	}
+
+	if !ok {
+		return fmt.Errorf("unable to set certificate for %q", domain)
+	}
+
+	return nil
+}
@@ -1,6 +1,8 @@
 package kloud
 
 import (
+	"crypto/x509"
+	"encoding/pem"
 	"errors"
 	_ "expvar"
 	"fmt"
@@ -19,14 +21,21 @@ import (
 	"koding/kites/common"
 	"koding/kites/keygen"
 	"koding/kites/kloud/api/amazon"
+	"koding/kites/kloud/certmanager"
 	"koding/kites/kloud/contexthelper/publickeys"
 	"koding/kites/kloud/contexthelper/session"
 	"koding/kites/kloud/dnsstorage"
+	"koding/kites/kloud/eventer"
 	"koding/kites/kloud/keycreator"
+	"koding/kites/kloud/pkg/acme"
 	"koding/kites/kloud/pkg/dnsclient"
+	"koding/kites/kloud/pkg/lease"
+	"koding/kites/kloud/pricing"
 	"koding/kites/kloud/provider"
 	awsprovider "koding/kites/kloud/provider/aws"
 	"koding/kites/kloud/queue"
+	"koding/kites/kloud/reconciler"
+	"koding/kites/kloud/scheduler"
 	"koding/kites/kloud/stack"
 	"koding/kites/kloud/stackplan"
 	"koding/kites/kloud/stackplan/stackcred"
@@ -66,6 +75,11 @@ type Config struct {
 	// CredentialEndpoint is an API for managing stack credentials.
 	CredentialEndpoint string
 
+	// CredentialKeyfile is a path to a keyfile used for encrypting
+	// stack credentials, see stackcred.Keyfile for details.
+	// If empty, credentials are stored unencrypted.
+	CredentialKeyfile string
+
 	// --- DEVELOPMENT CONFIG ---
 	// Show version and exit if enabled
 	Version bool
@@ -82,10 +96,60 @@ type Config struct {
 	// Defines the base domain for domain creation
 	HostedZone string `required:"true"`
 
+	// DNS backend configuration, see dnsclient.Options for details.
+	//
+	// The default "route53" backend is enabled only when AWS
+	// credentials are set.
+	DNSBackend       string
+	DNSServer        string
+	DNSTSIGKey       string
+	DNSTSIGSecret    string
+	DNSTSIGAlgorithm string
+	DNSPath          string
+
+	// ACME configuration used for obtaining TLS certificates for
+	// custom domains. Custom domains are disabled when ACMEAccountKey,
+	// a path to a PEM-encoded ECDSA P-256 private key, is empty.
+	ACMEDirectoryURL string
+	ACMEAccountKey   string
+	ACMEEmail        string
+
+	// CertRenewInterval is a time between certificate renewal runs.
+	CertRenewInterval time.Duration `default:"12h"`
+
 	// MaxResults limits the max items fetched per page for each
 	// AWS Describe* API calls.
 	MaxResults int `default:"500"`
 
+	// LeaseTTL is a duration after which a machine lock held by
+	// a crashed kloud expires.
+	LeaseTTL time.Duration `default:"2m"`
+
+	// ScheduleInterval is a time between checks for scheduled
+	// machine actions.
+	ScheduleInterval time.Duration `default:"1m"`
+
+	// ReconcileInterval is a time between machine state
+	// reconciliation runs.
+	ReconcileInterval time.Duration `default:"5m"`
+
+	// ReconcileThreshold is a time after which a machine in
+	// a transient state (e.g. Starting) is considered stuck.
+	ReconcileThreshold time.Duration `default:"30m"`
+
+	// PriceTable is a path to a JSON price table used for estimating
+	// stack costs. If empty, the built-in one is used.
+	PriceTable string
+
+	// Providers lists optional stack providers to enable, e.g. "docker"
+	// or "existing".
+	Providers []string
+
+	// DockerPrivateHosts allows docker credentials to use unix sockets,
+	// loopback and private hosts, and hosts without TLS. It is meant for
+	// local development and CI, where kloud and Docker share a host.
+	DockerPrivateHosts bool
+
 	// --- KLIENT DEVELOPMENT ---
 	// KontrolURL to connect and to de deployed with klient
 	KontrolURL string `required:"true"`
@@ -123,6 +187,18 @@ type Config struct {
 	AWSAccessKeyId     string
 	AWSSecretAccessKey string
 
+	// AssumeRoleDuration is an expiry duration of temporary credentials
+	// obtained for AssumeRole stack credentials. It must be longer than
+	// TerraformTimeout and must not exceed maximum session duration
+	// of the roles.
+	AssumeRoleDuration time.Duration `default:"1h"`
+
+	// TerraformTimeout is a maximum duration of a single terraform
+	// apply or destroy, which uses AssumeRole credentials, after which
+	// it is canceled. Temporary credentials passed to terraform are valid
+	// at least for it. Other runs are not limited.
+	TerraformTimeout time.Duration `default:"45m"`
+
 	SLUsername string
 	SLAPIKey   string
 
@@ -187,6 +263,30 @@ func New(conf *Config) (*Kloud, error) {
 		Client:  httputil.DefaultRestClient(conf.DebugMode),
 	}
 
+	if conf.CredentialKeyfile != "" {
+		kf, err := stackcred.ReadKeyfile(conf.CredentialKeyfile)
+		if err != nil {
+			return nil, err
+		}
+
+		storeOpts.KeyProvider = kf
+	}
+
+	locker := &lease.Locker{
+		Backend: lease.NewMongoDB(sess.DB),
+		TTL:     conf.LeaseTTL,
+		Log:     sess.Log.New("lease"),
+	}
+
+	prices := pricing.DefaultTable()
+
+	if conf.PriceTable != "" {
+		prices, err = pricing.ReadTableFile(conf.PriceTable)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	bp := &provider.BaseProvider{
 		DB:             sess.DB,
 		Log:            sess.Log,
@@ -196,6 +296,26 @@ func New(conf *Config) (*Kloud, error) {
 		KloudSecretKey: conf.KloudSecretKey,
 		CredStore:      stackcred.NewStore(storeOpts),
 		TunnelURL:      conf.TunnelURL,
+		Locker:         locker,
+		Prices:         prices,
+
+		DockerPrivateHosts: conf.DockerPrivateHosts,
+		RoleTimeout:        conf.TerraformTimeout,
+	}
+
+	// AssumeRole credentials are exchanged for temporary ones
+	// with the kloud's own AWS credentials.
+	if conf.AWSAccessKeyId != "" && conf.AWSSecretAccessKey != "" {
+		bp.Roles = amazon.NewRoleProvider(amazon.NewSession(&amazon.ClientOptions{
+			Credentials: credentials.NewStaticCredentials(conf.AWSAccessKeyId, conf.AWSSecretAccessKey, ""),
+			Log:         sess.Log.New("sts"),
+		}))
+		bp.Roles.Duration = conf.AssumeRoleDuration
+		bp.Roles.Validity = conf.TerraformTimeout
+
+		if err := bp.Roles.Valid(); err != nil {
+			return nil, err
+		}
 	}
 
 	// TODO(rjeczalik): refactor queue to work for any provider
@@ -203,7 +323,7 @@ func New(conf *Config) (*Kloud, error) {
 		BaseProvider: bp.New("aws"),
 	}
 
-	go runQueue(awsProvider, sess, conf)
+	go runQueue(awsProvider, bp, sess, conf)
 
 	stats := common.MustInitMetrics(Name)
 
@@ -222,13 +342,56 @@ func New(conf *Config) (*Kloud, error) {
 		PrivateKey: userPrivateKey,
 		PublicKey:  userPublicKey,
 	}
+	eventLog := eventer.NewMongoLog(sess.DB)
+
+	if err := eventLog.EnsureIndexes(); err != nil {
+		sess.Log.Warning("unable to create indexes for events: %s", err)
+	}
+
+	if err := modelhelper.EnsureStackTemplateRevisionIndex(); err != nil {
+		sess.Log.Warning("unable to create index for template revisions: %s", err)
+	}
+
+	kld.EventLog = eventLog
 	kld.DomainStorage = sess.DNSStorage
 	kld.Domainer = sess.DNSClient
 	kld.Locker = bp
 	kld.Log = sess.Log
 	kld.SecretKey = conf.KloudSecretKey
 
+	sched := &scheduler.Scheduler{
+		DB:       sess.DB,
+		Log:      sess.Log.New("scheduler"),
+		Caller:   kld,
+		Interval: conf.ScheduleInterval,
+	}
+
+	rec := &reconciler.Reconciler{
+		DB:             sess.DB,
+		Providers:      make(map[string]stack.Provider),
+		Locker:         bp,
+		Log:            sess.Log.New("reconciler"),
+		ContextCreator: kld.ContextCreator,
+		Interval:       conf.ReconcileInterval,
+		Threshold:      conf.ReconcileThreshold,
+	}
+
+	providers := make(map[string]func(*provider.BaseProvider) stack.Provider)
+
 	for name, fn := range provider.All {
+		providers[name] = fn
+	}
+
+	for _, name := range conf.Providers {
+		fn, ok := provider.Optional[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown optional provider: %q", name)
+		}
+
+		providers[name] = fn
+	}
+
+	for name, fn := range providers {
 		p := fn(bp.New(name))
 
 		err = kld.AddProvider(name, p)
@@ -237,6 +400,21 @@ func New(conf *Config) (*Kloud, error) {
 		}
 
 		stackplan.MetaFuncs[name] = p.Cred
+		rec.Providers[name] = p
+	}
+
+	go sched.Run()
+	go rec.Run()
+
+	if conf.ACMEAccountKey != "" {
+		certs, err := newCertManager(conf, sess)
+		if err != nil {
+			return nil, err
+		}
+
+		kld.CertManager = certs
+
+		go certs.Run()
 	}
 
 	var gwSrv *keygen.Server
@@ -259,6 +437,10 @@ func New(conf *Config) (*Kloud, error) {
 	// Teams/stack handling methods
 	k.HandleFunc("plan", kld.Plan)
 	k.HandleFunc("apply", kld.Apply)
+	k.HandleFunc("stack.rollback", kld.Rollback)
+	k.HandleFunc("stack.validate", kld.Validate)
+	k.HandleFunc("stack.cancel", kld.Cancel)
+	k.HandleFunc("stack.cancelLocal", kld.CancelLocal)
 	k.HandleFunc("migrate", kld.Migrate)
 	k.HandleFunc("describeStack", kld.Status)
 	k.HandleFunc("authenticate", kld.Authenticate)
@@ -273,17 +455,27 @@ func New(conf *Config) (*Kloud, error) {
 	k.HandleFunc("restart", kld.Restart)
 	k.HandleFunc("info", kld.Info)
 	k.HandleFunc("event", kld.Event)
+	k.HandleFunc("event.subscribe", kld.EventSubscribe)
 	k.HandleFunc("resize", kld.Resize)
 
+	// Machine schedules
+	k.HandleFunc("schedule.set", sched.Set)
+	k.HandleFunc("schedule.list", sched.List)
+	k.HandleFunc("schedule.clear", sched.Clear)
+
 	// Snapshot functionality
 	k.HandleFunc("createSnapshot", kld.CreateSnapshot)
 	k.HandleFunc("deleteSnapshot", kld.DeleteSnapshot)
+	k.HandleFunc("restoreSnapshot", kld.RestoreSnapshot)
 
 	// Domain records handling methods
 	k.HandleFunc("domain.set", kld.DomainSet)
 	k.HandleFunc("domain.unset", kld.DomainUnset)
 	k.HandleFunc("domain.add", kld.DomainAdd)
 	k.HandleFunc("domain.remove", kld.DomainRemove)
+	k.HandleFunc("domain.addCustom", kld.DomainAddCustom)
+	k.HandleFunc("domain.verify", kld.DomainVerify)
+	k.HandleFunc("domain.removeCustom", kld.DomainRemoveCustom)
 
 	// Klient proxy methods
 	k.HandleFunc("admin.add", kld.AdminAdd)
@@ -369,24 +561,40 @@ func newSession(conf *Config, k *kite.Kite) (*session.Session, error) {
 		Log: logging.NewCustom("kloud", conf.DebugMode),
 	}
 
-	sess.DNSStorage = dnsstorage.NewMongodbStorage(sess.DB)
+	dnsStorage := dnsstorage.NewMongodbStorage(sess.DB)
 
-	if conf.AWSAccessKeyId != "" && conf.AWSSecretAccessKey != "" {
+	if err := dnsStorage.EnsureIndexes(); err != nil {
+		sess.Log.Warning("unable to create indexes for domains: %s", err)
+	}
 
-		dnsOpts := &dnsclient.Options{
-			Creds:      c,
-			HostedZone: conf.HostedZone,
-			Log:        logging.NewCustom("kloud-dns", conf.DebugMode),
-			Debug:      conf.DebugMode,
-		}
+	sess.DNSStorage = dnsStorage
+
+	dnsOpts := &dnsclient.Options{
+		Backend:       conf.DNSBackend,
+		Creds:         c,
+		HostedZone:    conf.HostedZone,
+		Server:        conf.DNSServer,
+		TSIGKey:       conf.DNSTSIGKey,
+		TSIGSecret:    conf.DNSTSIGSecret,
+		TSIGAlgorithm: conf.DNSTSIGAlgorithm,
+		Path:          conf.DNSPath,
+		Log:           logging.NewCustom("kloud-dns", conf.DebugMode),
+		Debug:         conf.DebugMode,
+	}
+
+	hasAWS := conf.AWSAccessKeyId != "" && conf.AWSSecretAccessKey != ""
 
-		dns, err := dnsclient.NewRoute53Client(dnsOpts)
+	// The default route53 backend requires AWS credentials.
+	if hasAWS || (conf.DNSBackend != "" && conf.DNSBackend != "route53") {
+		dns, err := dnsclient.NewClient(dnsOpts)
 		if err != nil {
 			return nil, err
 		}
 
 		sess.DNSClient = dns
+	}
 
+	if hasAWS {
 		opts := &amazon.ClientOptions{
 			Credentials: c,
 			Regions:     amazon.ProductionRegions,
@@ -406,9 +614,45 @@ func newSession(conf *Config, k *kite.Kite) (*session.Session, error) {
 	return sess, nil
 }
 
-func runQueue(aws stack.Provider, sess *session.Session, conf *Config) {
+func newCertManager(conf *Config, sess *session.Session) (*certmanager.Manager, error) {
+	p, err := ioutil.ReadFile(conf.ACMEAccountKey)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(p)
+	if block == nil {
+		return nil, fmt.Errorf("unable to decode ACME account key %q", conf.ACMEAccountKey)
+	}
+
+	key, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse ACME account key %q: %s", conf.ACMEAccountKey, err)
+	}
+
+	m := &certmanager.Manager{
+		ACME: &acme.Client{
+			Key:          key,
+			DirectoryURL: conf.ACMEDirectoryURL,
+		},
+		Storage:  sess.DNSStorage,
+		DNS:      sess.DNSClient,
+		Kite:     sess.Kite,
+		Log:      sess.Log.New("certmanager"),
+		Interval: conf.CertRenewInterval,
+	}
+
+	if conf.ACMEEmail != "" {
+		m.Contact = []string{"mailto:" + conf.ACMEEmail}
+	}
+
+	return m, nil
+}
+
+func runQueue(aws stack.Provider, locker stack.Locker, sess *session.Session, conf *Config) {
 	q := &queue.Queue{
-		Log: sess.Log.New("queue"),
+		Locker: locker,
+		Log:    sess.Log.New("queue"),
 	}
 
 	if p, ok := aws.(*awsprovider.Provider); ok {
@@ -0,0 +1,145 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"koding/db/mongodb"
+	"koding/kites/kloud/stackplan/stackcred"
+
+	"github.com/koding/logging"
+	"github.com/mitchellh/cli"
+)
+
+const credentialRotateHelp = `Rotating the key is done in two phases, so no service fails to read
+credentials encrypted with the new key:
+
+  1. kloudctl credential-rotate -new-key -key-only
+
+     Adds new current key to the keyfile, without re-encrypting anything.
+
+  2. Deploy the keyfile to all kloud and social hosts (see credentialKeyfile
+     in the configuration). Running services reload the keyfile when they
+     read a credential encrypted with a key they do not know, so they do
+     not need to be restarted.
+
+  3. kloudctl credential-rotate
+
+     Re-encrypts all credentials with the current key. Credentials written
+     by services still using the old key are re-encrypted by running it
+     again. Old keys must be kept in the keyfile.
+
+Running with -new-key alone does both 1 and 3 at once - it is safe only when
+all services read the very same keyfile.`
+
+func NewCredentialRotate() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		f := NewFlag("credential-rotate", "Re-encrypt stack credentials with the current key")
+		f.help = credentialRotateHelp
+
+		r := &CredentialRotate{
+			Keyfile:  f.String("keyfile", os.Getenv("KLOUD_CREDENTIALKEYFILE"), "Path to the credential keyfile."),
+			MongoURL: f.String("mongourl", envMongoURL(), "Mongo URL of kloud database."),
+			CredURL:  f.String("credential-endpoint", os.Getenv("KLOUD_CREDENTIALENDPOINT"), "Credential endpoint of kloud, if it keeps credentials in socialapi."),
+			NewKey:   f.Bool("new-key", false, "Generate new current key before re-encrypting; creates the keyfile if it does not exist."),
+			KeyOnly:  f.Bool("key-only", false, "Only generate new current key, without re-encrypting; requires -new-key."),
+			DryRun:   f.Bool("dry-run", false, "Only report credentials that would be re-encrypted."),
+		}
+
+		f.action = r
+
+		return f, nil
+	}
+}
+
+type CredentialRotate struct {
+	Keyfile  *string
+	MongoURL *string
+	CredURL  *string
+	NewKey   *bool
+	KeyOnly  *bool
+	DryRun   *bool
+}
+
+func (r *CredentialRotate) Valid() error {
+	if *r.Keyfile == "" {
+		return errors.New("-keyfile is empty")
+	}
+
+	if *r.KeyOnly && !*r.NewKey {
+		return errors.New("-key-only requires -new-key")
+	}
+
+	if *r.MongoURL == "" && !*r.KeyOnly {
+		return errors.New("-mongourl is empty")
+	}
+
+	return nil
+}
+
+func (r *CredentialRotate) Action(args []string) error {
+	if err := r.Valid(); err != nil {
+		return err
+	}
+
+	kf, err := r.keyfile()
+	if err != nil {
+		return err
+	}
+
+	if *r.KeyOnly {
+		return nil
+	}
+
+	db := mongodb.NewMongoDB(*r.MongoURL)
+	defer db.Close()
+
+	log := logging.NewCustom("kloudctl", flagDebug)
+
+	res, err := stackcred.Reencrypt(&stackcred.ReencryptOptions{
+		MongoDB:     db,
+		KeyProvider: kf,
+		CredURL:     *r.CredURL,
+		Log:         log,
+		DryRun:      *r.DryRun,
+	})
+
+	if res != nil {
+		DefaultUi.Info(fmt.Sprintf("key=%s total=%d re-encrypted=%d encrypted=%d dry-run=%t",
+			kf.KeyID(), res.Total, res.Reencrypted, res.Encrypted, *r.DryRun))
+	}
+
+	return err
+}
+
+func (r *CredentialRotate) keyfile() (*stackcred.Keyfile, error) {
+	kf, err := stackcred.ReadKeyfile(*r.Keyfile)
+
+	switch {
+	case os.IsNotExist(err) && *r.NewKey:
+		if kf, err = stackcred.NewKeyfile(); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	case *r.NewKey:
+		if _, err := kf.Rotate(); err != nil {
+			return nil, err
+		}
+	default:
+		return kf, nil
+	}
+
+	if *r.DryRun {
+		return kf, nil
+	}
+
+	if err := kf.WriteFile(*r.Keyfile); err != nil {
+		return nil, err
+	}
+
+	DefaultUi.Info(fmt.Sprintf("current key is %q", kf.KeyID()))
+
+	return kf, nil
+}
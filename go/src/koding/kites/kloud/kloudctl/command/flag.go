@@ -18,6 +18,7 @@ type Flag struct {
 	*flag.FlagSet
 	name     string
 	synopsis string
+	help     string // optional, printed after the synopsis
 	action   Actioner
 
 	totalDefaultFlag int
@@ -59,6 +60,9 @@ func (f *Flag) Synopsis() string { return f.synopsis }
 func (f *Flag) Help() string {
 	help := fmt.Sprintf("usage: kloudctl %s [<args>]\n\n", f.name)
 	help += f.synopsis + "\n\n"
+	if f.help != "" {
+		help += f.help + "\n\n"
+	}
 	f.VisitAll(func(fl *flag.Flag) {
 		format := "  -%s=%s: %s\n"
 		help += fmt.Sprintf(format, fl.Name, fl.DefValue, fl.Usage)
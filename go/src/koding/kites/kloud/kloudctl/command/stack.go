@@ -0,0 +1,1116 @@
+package command
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"koding/db/models"
+	"koding/db/mongodb/modelhelper"
+	"koding/kites/kloud/eventer"
+	"koding/kites/kloud/machinestate"
+	"koding/kites/kloud/stack"
+	"koding/kites/kloud/utils/res"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+	"github.com/mitchellh/cli"
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// machineResources maps stack providers to Terraform resource types,
+// which are backed by jMachines documents.
+var machineResources = map[string]string{
+	"aws":      "aws_instance",
+	"vagrant":  "vagrant_instance",
+	"existing": "existing_instance",
+	"docker":   "docker_container",
+}
+
+// Stack provides an implementation for "stack" command.
+type Stack struct {
+	*res.Resource
+}
+
+// NewStack gives new Stack value.
+func NewStack() cli.CommandFactory {
+	return func() (cli.Command, error) {
+		f := NewFlag("stack", "Validates/plans/applies/destroys stacks from local templates")
+		f.action = &Stack{
+			Resource: &res.Resource{
+				Name:        "stack",
+				Description: "Validates/plans/applies/destroys stacks from local templates",
+				Commands: map[string]res.Command{
+					"validate": NewStackValidate(),
+					"plan":     NewStackPlan(),
+					"apply":    NewStackApply(),
+					"destroy":  NewStackDestroy(),
+					"status":   NewStackStatus(),
+					"events":   NewStackEvents(),
+				},
+			},
+		}
+		return f, nil
+	}
+}
+
+// Action is an entry point for "stack" subcommand.
+func (s *Stack) Action(args []string) error {
+	k, err := kloudClient()
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	ctx = context.WithValue(ctx, kiteKey, k)
+	s.Resource.ContextFunc = func([]string) context.Context { return ctx }
+	return s.Resource.Main(args)
+}
+
+// stackFlags are flags shared by all "stack" subcommands.
+//
+// Each stack is identified by the team, the user and the stack name,
+// which by default is the base name of the template file. The apply
+// command uploads the template to a jStackTemplate document of the same
+// title and keeps the jComputeStack built from it up-to-date; validate
+// and plan send the template to kloud without storing it.
+type stackFlags struct {
+	Provider  string
+	Team      string
+	Username  string
+	File      string
+	StackName string
+	Cred      string
+	JSON      bool
+
+	template bool   // whether -f and -cred are required
+	content  string // content of the template file
+}
+
+func (sf *stackFlags) register(f *flag.FlagSet) {
+	f.StringVar(&sf.Team, "team", "koding", "Team name.")
+	f.StringVar(&sf.Username, "u", defaultUsername, "Username for the kloud request.")
+	f.StringVar(&sf.File, "f", "", "Stack template file in JSON format; - reads from stdin.")
+	f.StringVar(&sf.StackName, "name", "", "Stack name. If empty, base name of the template file is used.")
+	f.BoolVar(&sf.JSON, "json", false, "Print output in JSON format.")
+
+	if sf.template {
+		f.StringVar(&sf.Cred, "cred", "", "Title or identifier of the credential to build the stack with.")
+		f.StringVar(&sf.Provider, "p", "", "Stack provider name. If empty, it is read from the template.")
+	}
+}
+
+func (sf *stackFlags) valid() error {
+	if envMongoURL() == "" {
+		return errors.New("KLOUDCTL_MONGODB_URL is not set")
+	}
+	if sf.Team == "" {
+		return errors.New("empty value for -team flag")
+	}
+	if sf.Username == "" {
+		return errors.New("empty value for -u flag")
+	}
+	if sf.StackName == "" {
+		if sf.File == "" || sf.File == "-" {
+			return errors.New("empty value for -name flag")
+		}
+		sf.StackName = strings.TrimSuffix(filepath.Base(sf.File), filepath.Ext(sf.File))
+	}
+	if !sf.template {
+		return nil
+	}
+	if sf.File == "" {
+		return errors.New("empty value for -f flag")
+	}
+	if sf.Cred == "" {
+		return errors.New("empty value for -cred flag")
+	}
+
+	var p []byte
+	var err error
+
+	if sf.File == "-" {
+		p, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		p, err = ioutil.ReadFile(sf.File)
+	}
+	if err != nil {
+		return err
+	}
+
+	sf.content = string(p)
+
+	return nil
+}
+
+func (sf *stackFlags) print(v interface{}) error {
+	p, err := json.MarshalIndent(v, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(p))
+	return nil
+}
+
+// stackTemplate is a part of the template needed to create jMachines.
+type stackTemplate struct {
+	Resource map[string]map[string]map[string]interface{} `json:"resource"`
+}
+
+// parseTemplate reads machine labels from the template content.
+//
+// If provider is empty, it is inferred from the template.
+func parseTemplate(content, provider string) (string, []string, error) {
+	var t stackTemplate
+
+	if err := json.Unmarshal([]byte(content), &t); err != nil {
+		return "", nil, errors.New("invalid template: " + err.Error())
+	}
+
+	if provider == "" {
+		var found []string
+		for p, typ := range machineResources {
+			if _, ok := t.Resource[typ]; ok {
+				found = append(found, p)
+			}
+		}
+		if len(found) != 1 {
+			return "", nil, errors.New("unable to read provider from the template, use -p flag")
+		}
+		provider = found[0]
+	}
+
+	typ, ok := machineResources[provider]
+	if !ok {
+		return "", nil, fmt.Errorf("unsupported provider: %q", provider)
+	}
+
+	var labels []string
+
+	for name, attrs := range t.Resource[typ] {
+		// Counts set with variables are evaluated by kloud,
+		// such resources are expected to have a single instance.
+		count, ok := attrs["count"].(float64)
+		if !ok {
+			labels = append(labels, name)
+			continue
+		}
+
+		for i := 0; i < int(count); i++ {
+			labels = append(labels, name+"."+strconv.Itoa(i))
+		}
+	}
+
+	if len(labels) == 0 {
+		return "", nil, fmt.Errorf("no %s resources found in the template", typ)
+	}
+
+	sort.Strings(labels)
+
+	return provider, labels, nil
+}
+
+// syncedStack represents a stack which documents were updated with
+// a local template.
+type syncedStack struct {
+	Provider   string                `json:"provider"`
+	Credential string                `json:"credential"`
+	Template   *models.StackTemplate `json:"-"`
+	Stack      *models.ComputeStack  `json:"-"`
+	Machines   map[string]string     `json:"machines"` // maps label to machine ID
+
+	TemplateID string `json:"stackTemplateId"`
+	StackID    string `json:"stackId"`
+
+	account *models.Account
+	user    *models.User
+	group   *models.Group
+	labels  []string
+}
+
+func (s *syncedStack) credentials() map[string][]string {
+	return map[string][]string{
+		s.Provider: {s.Credential},
+	}
+}
+
+// lookup parses the template read from the -f flag and looks up
+// documents the stack is built with. No document is modified.
+func (sf *stackFlags) lookup() (*syncedStack, error) {
+	provider, labels, err := parseTemplate(sf.content, sf.Provider)
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := modelhelper.GetAccount(sf.Username)
+	if err != nil {
+		return nil, errors.New("failure looking up jAccounts: " + err.Error())
+	}
+
+	user, err := modelhelper.GetUser(sf.Username)
+	if err != nil {
+		return nil, errors.New("failure looking up jUsers: " + err.Error())
+	}
+
+	group, err := modelhelper.GetGroup(sf.Team)
+	if err != nil {
+		return nil, errors.New("failure looking up jGroups: " + err.Error())
+	}
+
+	var cred models.Credential
+
+	err = modelhelper.Mongo.Run(modelhelper.CredentialsColl, func(c *mgo.Collection) error {
+		return c.Find(bson.M{
+			"originId": account.Id,
+			"provider": provider,
+			"$or": []bson.M{
+				{"identifier": sf.Cred},
+				{"title": sf.Cred},
+			},
+		}).One(&cred)
+	})
+	if err == mgo.ErrNotFound {
+		return nil, fmt.Errorf("%s credential %q not found", provider, sf.Cred)
+	}
+	if err != nil {
+		return nil, errors.New("failure looking up jCredentials: " + err.Error())
+	}
+
+	return &syncedStack{
+		Provider:   provider,
+		Credential: cred.Identifier,
+		Machines:   make(map[string]string),
+		account:    account,
+		user:       user,
+		group:      group,
+		labels:     labels,
+	}, nil
+}
+
+// sync creates or updates jStackTemplate, jComputeStack and jMachines
+// documents, so they reflect the template read from the -f flag.
+//
+// Machines which labels were removed from the template are removed
+// from the stack, their resources are destroyed by the next apply.
+func (sf *stackFlags) sync() (*syncedStack, error) {
+	s, err := sf.lookup()
+	if err != nil {
+		return nil, err
+	}
+
+	if s.Template, err = sf.syncTemplate(s.account, s); err != nil {
+		return nil, err
+	}
+
+	if s.Stack, err = sf.syncComputeStack(s.account, s); err != nil {
+		return nil, err
+	}
+
+	if err := sf.syncMachines(s.user, s.group, s, s.labels); err != nil {
+		return nil, err
+	}
+
+	s.TemplateID = s.Template.Id.Hex()
+	s.StackID = s.Stack.Id.Hex()
+
+	return s, nil
+}
+
+func (sf *stackFlags) syncTemplate(account *models.Account, s *syncedStack) (*models.StackTemplate, error) {
+	var tmpl models.StackTemplate
+
+	sum := modelhelper.StackTemplateSum(sf.content)
+
+	err := modelhelper.Mongo.Run(modelhelper.StackTemplateColl, func(c *mgo.Collection) error {
+		return c.Find(bson.M{
+			"originId": account.Id,
+			"group":    sf.Team,
+			"title":    sf.StackName,
+		}).One(&tmpl)
+	})
+
+	switch err {
+	case nil:
+		change := bson.M{
+			"$set": bson.M{
+				"template.content":    sf.content,
+				"template.rawContent": sf.content,
+				"template.sum":        sum,
+				"credentials":         s.credentials(),
+				"meta.modifiedAt":     time.Now().UTC(),
+			},
+		}
+
+		err = modelhelper.Mongo.Run(modelhelper.StackTemplateColl, func(c *mgo.Collection) error {
+			return c.UpdateId(tmpl.Id, change)
+		})
+		if err != nil {
+			return nil, errors.New("failure updating jStackTemplates: " + err.Error())
+		}
+
+		tmpl.Template.Content = sf.content
+		tmpl.Template.RawContent = sf.content
+		tmpl.Template.Sum = sum
+		tmpl.Credentials = s.credentials()
+
+		if _, err := modelhelper.AddStackTemplateRevision(&tmpl); err != nil {
+			return nil, errors.New("failure inserting jStackTemplateRevisions: " + err.Error())
+		}
+
+		return &tmpl, nil
+	case mgo.ErrNotFound:
+		t := models.NewStackTemplate(s.Provider, s.Credential)
+		t.Title = sf.StackName
+		t.Group = sf.Team
+		t.OriginID = account.Id
+		t.Template.Content = sf.content
+		t.Template.RawContent = sf.content
+		t.Template.Sum = sum
+
+		if err := modelhelper.CreateStackTemplate(t); err != nil {
+			return nil, errors.New("failure inserting jStackTemplates: " + err.Error())
+		}
+
+		return t, nil
+	default:
+		return nil, errors.New("failure looking up jStackTemplates: " + err.Error())
+	}
+}
+
+func (sf *stackFlags) syncComputeStack(account *models.Account, s *syncedStack) (*models.ComputeStack, error) {
+	var cs models.ComputeStack
+
+	err := modelhelper.Mongo.Run(modelhelper.ComputeStackColl, func(c *mgo.Collection) error {
+		return c.Find(bson.M{
+			"baseStackId": s.Template.Id,
+			"originId":    account.Id,
+		}).One(&cs)
+	})
+
+	switch err {
+	case nil:
+		change := bson.M{
+			"$set": bson.M{
+				"credentials":     s.credentials(),
+				"meta.modifiedAt": time.Now().UTC(),
+			},
+		}
+
+		if err := modelhelper.UpdateStack(cs.Id, change); err != nil {
+			return nil, errors.New("failure updating jComputeStacks: " + err.Error())
+		}
+
+		cs.Credentials = s.credentials()
+
+		return &cs, nil
+	case mgo.ErrNotFound:
+		stack := modelhelper.NewDefaultStack(s.Template.Id, account.Id, sf.Team)
+		stack.Title = sf.StackName
+		stack.Credentials = s.credentials()
+		delete(stack.Config, "groupStack")
+
+		if err := modelhelper.CreateComputeStack(stack); err != nil {
+			return nil, errors.New("failure inserting jComputeStacks: " + err.Error())
+		}
+
+		return stack, nil
+	default:
+		return nil, errors.New("failure looking up jComputeStacks: " + err.Error())
+	}
+}
+
+func (sf *stackFlags) syncMachines(user *models.User, group *models.Group, s *syncedStack, labels []string) error {
+	var machines []*models.Machine
+
+	if len(s.Stack.Machines) != 0 {
+		err := modelhelper.Mongo.Run(modelhelper.MachinesColl, func(c *mgo.Collection) error {
+			return c.Find(bson.M{"_id": bson.M{"$in": s.Stack.Machines}}).All(&machines)
+		})
+		if err != nil {
+			return errors.New("failure looking up jMachines: " + err.Error())
+		}
+	}
+
+	existing := make(map[string]*models.Machine, len(machines))
+	for _, m := range machines {
+		existing[m.Label] = m
+	}
+
+	var ids []bson.ObjectId
+
+	for _, label := range labels {
+		if m, ok := existing[label]; ok {
+			delete(existing, label)
+			ids = append(ids, m.ObjectId)
+			s.Machines[label] = m.ObjectId.Hex()
+			continue
+		}
+
+		m := &models.Machine{
+			ObjectId:   bson.NewObjectId(),
+			Label:      label,
+			Provider:   s.Provider,
+			CreatedAt:  time.Now().UTC(),
+			Users:      []models.MachineUser{{Id: user.ObjectId, Sudo: true, Owner: true}},
+			Meta:       make(bson.M, 0),
+			Groups:     []models.MachineGroup{{Id: group.Id}},
+			Credential: sf.Username,
+		}
+
+		m.Assignee.AssignedAt = time.Now().UTC()
+		m.Status.State = machinestate.NotInitialized.String()
+		m.Status.ModifiedAt = time.Now().UTC()
+
+		if err := modelhelper.CreateMachine(m); err != nil {
+			return errors.New("failure inserting jMachines: " + err.Error())
+		}
+
+		ids = append(ids, m.ObjectId)
+		s.Machines[label] = m.ObjectId.Hex()
+	}
+
+	for label, m := range existing {
+		if err := modelhelper.DeleteMachine(m.ObjectId); err != nil {
+			return errors.New("failure removing jMachines: " + err.Error())
+		}
+
+		if !sf.JSON {
+			DefaultUi.Info(fmt.Sprintf("Machine %q was removed from the template.", label))
+		}
+	}
+
+	if err := modelhelper.UpdateStack(s.Stack.Id, bson.M{"$set": bson.M{"machines": ids}}); err != nil {
+		return errors.New("failure updating jComputeStacks: " + err.Error())
+	}
+
+	s.Stack.Machines = ids
+
+	return nil
+}
+
+// findStack looks up the stack by its name.
+func (sf *stackFlags) findStack() (*models.ComputeStack, error) {
+	account, err := modelhelper.GetAccount(sf.Username)
+	if err != nil {
+		return nil, errors.New("failure looking up jAccounts: " + err.Error())
+	}
+
+	cs, err := sf.accountStack(account)
+	if err != nil {
+		return nil, err
+	}
+
+	if cs == nil {
+		return nil, fmt.Errorf("stack %q not found", sf.StackName)
+	}
+
+	return cs, nil
+}
+
+// accountStack looks up the stack of the given account by its name.
+// It returns nil stack if it does not exist.
+func (sf *stackFlags) accountStack(account *models.Account) (*models.ComputeStack, error) {
+	var tmpl models.StackTemplate
+
+	err := modelhelper.Mongo.Run(modelhelper.StackTemplateColl, func(c *mgo.Collection) error {
+		return c.Find(bson.M{
+			"originId": account.Id,
+			"group":    sf.Team,
+			"title":    sf.StackName,
+		}).One(&tmpl)
+	})
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.New("failure looking up jStackTemplates: " + err.Error())
+	}
+
+	var cs models.ComputeStack
+
+	err = modelhelper.Mongo.Run(modelhelper.ComputeStackColl, func(c *mgo.Collection) error {
+		return c.Find(bson.M{
+			"baseStackId": tmpl.Id,
+			"originId":    account.Id,
+		}).One(&cs)
+	})
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.New("failure looking up jComputeStacks: " + err.Error())
+	}
+
+	return &cs, nil
+}
+
+// streamEvents prints events of the given process until the final one
+// is received.
+//
+// If jsonOutput is true, each event is printed as a single line
+// of JSON.
+func streamEvents(k *kite.Client, eventType, eventID string, cursor int, jsonOutput bool) error {
+	events := make(chan *eventer.Event, 64)
+
+	req := &stack.EventSubscribeRequest{
+		Type:    eventType,
+		EventId: eventID,
+		Cursor:  cursor,
+		OnEvent: dnode.Callback(func(r *dnode.Partial) {
+			var ev eventer.Event
+
+			if err := r.One().Unmarshal(&ev); err != nil {
+				DefaultUi.Error("unable to read event: " + err.Error())
+				return
+			}
+
+			events <- &ev
+		}),
+	}
+
+	if _, err := k.TellWithTimeout("event.subscribe", defaultTellTimeout, req); err != nil {
+		return fmt.Errorf("%v %s kloud error: %s", k.Kite, k.Hostname, err)
+	}
+
+	for ev := range events {
+		if jsonOutput {
+			p, err := json.Marshal(ev)
+			if err != nil {
+				return err
+			}
+
+			fmt.Println(string(p))
+		} else {
+			printEvent(ev)
+		}
+
+		if ev.Error != "" {
+			return errors.New(ev.Error)
+		}
+
+		if ev.Final() {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func printEvent(ev *eventer.Event) {
+	ts := ev.TimeStamp.Local().Format("2006-01-02 15:04:05")
+
+	if o := ev.Output; o != nil {
+		line := o.Line
+		if o.Resource != "" {
+			line = o.Resource + ": " + line
+		}
+
+		if o.Error {
+			DefaultUi.Error(fmt.Sprintf("%s     %s", ts, line))
+		} else {
+			DefaultUi.Output(fmt.Sprintf("%s     %s", ts, line))
+		}
+
+		return
+	}
+
+	DefaultUi.Info(fmt.Sprintf("%s ==> %s [Status: %s Percentage: %d]",
+		ts, ev.Message, ev.Status, ev.Percentage))
+
+	if ev.Error != "" {
+		DefaultUi.Error(ev.Error)
+	}
+}
+
+/// STACK VALIDATE
+
+// StackValidate provides an implementation for "stack validate" subcommand.
+type StackValidate struct {
+	stackFlags
+}
+
+// NewStackValidate gives new StackValidate value.
+func NewStackValidate() *StackValidate {
+	return &StackValidate{
+		stackFlags: stackFlags{template: true},
+	}
+}
+
+// Name gives the name of the command, implements the res.Command interface.
+func (*StackValidate) Name() string {
+	return "validate"
+}
+
+// RegisterFlags sets the flags for the command - "stack validate <flags>".
+func (cmd *StackValidate) RegisterFlags(f *flag.FlagSet) {
+	cmd.register(f)
+}
+
+// Valid implements the kloud.Validator interface.
+func (cmd *StackValidate) Valid() error {
+	return cmd.valid()
+}
+
+// Run executes the "stack validate" subcommand.
+func (cmd *StackValidate) Run(ctx context.Context) error {
+	modelhelper.Initialize(envMongoURL())
+	defer modelhelper.Close()
+
+	k := kiteFromContext(ctx)
+
+	s, err := cmd.lookup()
+	if err != nil {
+		return err
+	}
+
+	req := impersonate(cmd.Username,
+		&stack.ValidateRequest{
+			Provider:    s.Provider,
+			GroupName:   cmd.Team,
+			Template:    cmd.content,
+			Credentials: s.credentials(),
+		},
+	)
+
+	resp, err := k.TellWithTimeout("stack.validate", defaultTellTimeout, req)
+	if err != nil {
+		return fmt.Errorf("%v %s kloud error: %s", k.Kite, k.Hostname, err)
+	}
+
+	var v stack.ValidateResponse
+	if err := resp.Unmarshal(&v); err != nil {
+		return err
+	}
+
+	if cmd.JSON {
+		return cmd.print(&v)
+	}
+
+	for _, violation := range v.Violations {
+		msg := violation.Message
+		if violation.Resource != "" {
+			msg = violation.Resource + ": " + msg
+		}
+
+		DefaultUi.Error(fmt.Sprintf("[%s] %s", violation.Rule, msg))
+	}
+
+	if !v.Valid {
+		return fmt.Errorf("stack template %q is not valid", cmd.StackName)
+	}
+
+	DefaultUi.Info(fmt.Sprintf("Stack template %q is valid.", cmd.StackName))
+	return nil
+}
+
+/// STACK PLAN
+
+// StackPlan provides an implementation for "stack plan" subcommand.
+type StackPlan struct {
+	stackFlags
+}
+
+// NewStackPlan gives new StackPlan value.
+func NewStackPlan() *StackPlan {
+	return &StackPlan{
+		stackFlags: stackFlags{template: true},
+	}
+}
+
+// Name gives the name of the command, implements the res.Command interface.
+func (*StackPlan) Name() string {
+	return "plan"
+}
+
+// RegisterFlags sets the flags for the command - "stack plan <flags>".
+func (cmd *StackPlan) RegisterFlags(f *flag.FlagSet) {
+	cmd.register(f)
+}
+
+// Valid implements the kloud.Validator interface.
+func (cmd *StackPlan) Valid() error {
+	return cmd.valid()
+}
+
+// Run executes the "stack plan" subcommand.
+func (cmd *StackPlan) Run(ctx context.Context) error {
+	modelhelper.Initialize(envMongoURL())
+	defer modelhelper.Close()
+
+	k := kiteFromContext(ctx)
+
+	s, err := cmd.lookup()
+	if err != nil {
+		return err
+	}
+
+	planReq := &stack.PlanRequest{
+		Provider:    s.Provider,
+		GroupName:   cmd.Team,
+		Template:    cmd.content,
+		Credentials: s.credentials(),
+	}
+
+	// If the stack was already applied, the template is planned
+	// against its current state.
+	cs, err := cmd.accountStack(s.account)
+	if err != nil {
+		return err
+	}
+
+	if cs != nil {
+		planReq.StackID = cs.Id.Hex()
+	}
+
+	req := impersonate(cmd.Username, planReq)
+
+	resp, err := k.TellWithTimeout("plan", defaultTellTimeout, req)
+	if err != nil {
+		return fmt.Errorf("%v %s kloud error: %s", k.Kite, k.Hostname, err)
+	}
+
+	var plan stack.PlanResponse
+	if err := resp.Unmarshal(&plan); err != nil {
+		return err
+	}
+
+	if cmd.JSON {
+		return cmd.print(&plan)
+	}
+
+	printPlan(&plan)
+	return nil
+}
+
+/// STACK APPLY
+
+// StackApply provides an implementation for "stack apply" subcommand.
+type StackApply struct {
+	stackFlags
+}
+
+// NewStackApply gives new StackApply value.
+func NewStackApply() *StackApply {
+	return &StackApply{
+		stackFlags: stackFlags{template: true},
+	}
+}
+
+// Name gives the name of the command, implements the res.Command interface.
+func (*StackApply) Name() string {
+	return "apply"
+}
+
+// RegisterFlags sets the flags for the command - "stack apply <flags>".
+func (cmd *StackApply) RegisterFlags(f *flag.FlagSet) {
+	cmd.register(f)
+}
+
+// Valid implements the kloud.Validator interface.
+func (cmd *StackApply) Valid() error {
+	return cmd.valid()
+}
+
+// Run executes the "stack apply" subcommand.
+func (cmd *StackApply) Run(ctx context.Context) error {
+	modelhelper.Initialize(envMongoURL())
+	defer modelhelper.Close()
+
+	s, err := cmd.sync()
+	if err != nil {
+		return err
+	}
+
+	if cmd.JSON {
+		if err := cmd.print(s); err != nil {
+			return err
+		}
+	} else {
+		DefaultUi.Info(fmt.Sprintf("Applying stack %q (%s).", cmd.StackName, s.StackID))
+	}
+
+	return applyStack(kiteFromContext(ctx), &cmd.stackFlags, &stack.ApplyRequest{
+		Provider:    s.Provider,
+		StackID:     s.StackID,
+		GroupName:   cmd.Team,
+		Credentials: s.credentials(),
+	})
+}
+
+func applyStack(k *kite.Client, sf *stackFlags, req *stack.ApplyRequest) error {
+	resp, err := k.TellWithTimeout("apply", defaultTellTimeout, impersonate(sf.Username, req))
+	if err != nil {
+		return fmt.Errorf("%v %s kloud error: %s", k.Kite, k.Hostname, err)
+	}
+
+	var result stack.ControlResult
+	if err := resp.Unmarshal(&result); err != nil {
+		return err
+	}
+
+	evID := result.EventId
+	if i := strings.IndexRune(evID, '-'); i != -1 {
+		evID = evID[i+1:]
+	}
+
+	// The cursor points before the first event of this apply, so
+	// events of previous applies of the stack are not replayed.
+	return streamEvents(k, "apply", evID, runCursor(result.EventCursor), sf.JSON)
+}
+
+// runCursor converts a cursor returned by kloud for event.subscribe method;
+// zero means there were no events before, so full history is requested.
+func runCursor(n int) int {
+	if n == 0 {
+		return -1
+	}
+
+	return n
+}
+
+/// STACK DESTROY
+
+// StackDestroy provides an implementation for "stack destroy" subcommand.
+type StackDestroy struct {
+	stackFlags
+}
+
+// NewStackDestroy gives new StackDestroy value.
+func NewStackDestroy() *StackDestroy {
+	return &StackDestroy{}
+}
+
+// Name gives the name of the command, implements the res.Command interface.
+func (*StackDestroy) Name() string {
+	return "destroy"
+}
+
+// RegisterFlags sets the flags for the command - "stack destroy <flags>".
+func (cmd *StackDestroy) RegisterFlags(f *flag.FlagSet) {
+	cmd.register(f)
+	f.StringVar(&cmd.Provider, "p", "", "Stack provider name. If empty, it is read from the stack credentials.")
+}
+
+// Valid implements the kloud.Validator interface.
+func (cmd *StackDestroy) Valid() error {
+	return cmd.valid()
+}
+
+// Run executes the "stack destroy" subcommand.
+func (cmd *StackDestroy) Run(ctx context.Context) error {
+	modelhelper.Initialize(envMongoURL())
+	defer modelhelper.Close()
+
+	cs, err := cmd.findStack()
+	if err != nil {
+		return err
+	}
+
+	provider := cmd.Provider
+	if provider == "" {
+		if provider, err = stackProvider(cs); err != nil {
+			return err
+		}
+	}
+
+	if !cmd.JSON {
+		DefaultUi.Info(fmt.Sprintf("Destroying stack %q (%s).", cmd.StackName, cs.Id.Hex()))
+	}
+
+	return applyStack(kiteFromContext(ctx), &cmd.stackFlags, &stack.ApplyRequest{
+		Provider:  provider,
+		StackID:   cs.Id.Hex(),
+		GroupName: cmd.Team,
+		Destroy:   true,
+	})
+}
+
+// stackProvider reads provider of the stack from its credentials.
+func stackProvider(cs *models.ComputeStack) (string, error) {
+	var found []string
+
+	for provider := range cs.Credentials {
+		if _, ok := machineResources[provider]; ok {
+			found = append(found, provider)
+		}
+	}
+
+	if len(found) != 1 {
+		return "", errors.New("unable to read provider from the stack credentials, use -p flag")
+	}
+
+	return found[0], nil
+}
+
+/// STACK STATUS
+
+// StackStatus provides an implementation for "stack status" subcommand.
+type StackStatus struct {
+	stackFlags
+}
+
+// NewStackStatus gives new StackStatus value.
+func NewStackStatus() *StackStatus {
+	return &StackStatus{}
+}
+
+// Name gives the name of the command, implements the res.Command interface.
+func (*StackStatus) Name() string {
+	return "status"
+}
+
+// RegisterFlags sets the flags for the command - "stack status <flags>".
+func (cmd *StackStatus) RegisterFlags(f *flag.FlagSet) {
+	cmd.register(f)
+}
+
+// Valid implements the kloud.Validator interface.
+func (cmd *StackStatus) Valid() error {
+	return cmd.valid()
+}
+
+// stackStatus is a JSON output of the "stack status" subcommand.
+type stackStatus struct {
+	*stack.StatusResponse
+
+	Name     string           `json:"name"`
+	Machines []*machineStatus `json:"machines"`
+}
+
+type machineStatus struct {
+	ID        string    `json:"id"`
+	Label     string    `json:"label"`
+	State     string    `json:"state"`
+	IPAddress string    `json:"ipAddress,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	Modified  time.Time `json:"modifiedAt"`
+}
+
+// Run executes the "stack status" subcommand.
+func (cmd *StackStatus) Run(ctx context.Context) error {
+	modelhelper.Initialize(envMongoURL())
+	defer modelhelper.Close()
+
+	k := kiteFromContext(ctx)
+
+	cs, err := cmd.findStack()
+	if err != nil {
+		return err
+	}
+
+	req := impersonate(cmd.Username,
+		&stack.StatusRequest{
+			StackID: cs.Id.Hex(),
+		},
+	)
+
+	resp, err := k.TellWithTimeout("describeStack", defaultTellTimeout, req)
+	if err != nil {
+		return fmt.Errorf("%v %s kloud error: %s", k.Kite, k.Hostname, err)
+	}
+
+	status := &stackStatus{
+		StatusResponse: &stack.StatusResponse{},
+		Name:           cmd.StackName,
+	}
+
+	if err := resp.Unmarshal(status.StatusResponse); err != nil {
+		return err
+	}
+
+	var machines []*models.Machine
+
+	err = modelhelper.Mongo.Run(modelhelper.MachinesColl, func(c *mgo.Collection) error {
+		return c.Find(bson.M{"_id": bson.M{"$in": cs.Machines}}).Sort("label").All(&machines)
+	})
+	if err != nil {
+		return errors.New("failure looking up jMachines: " + err.Error())
+	}
+
+	for _, m := range machines {
+		status.Machines = append(status.Machines, &machineStatus{
+			ID:        m.ObjectId.Hex(),
+			Label:     m.Label,
+			State:     m.Status.State,
+			IPAddress: m.IpAddress,
+			Reason:    m.Status.Reason,
+			Modified:  m.Status.ModifiedAt,
+		})
+	}
+
+	if cmd.JSON {
+		return cmd.print(status)
+	}
+
+	DefaultUi.Info(fmt.Sprintf("Stack %q (%s): %s, modified at %s", status.Name, status.StackID,
+		status.Status, status.ModifiedAt.Local().Format("2006-01-02 15:04:05")))
+
+	for _, m := range status.Machines {
+		line := fmt.Sprintf("    %s (%s): %s", m.Label, m.ID, m.State)
+		if m.IPAddress != "" {
+			line += " " + m.IPAddress
+		}
+		if m.Reason != "" {
+			line += " - " + m.Reason
+		}
+
+		DefaultUi.Output(line)
+	}
+
+	return nil
+}
+
+/// STACK EVENTS
+
+// StackEvents provides an implementation for "stack events" subcommand.
+type StackEvents struct {
+	stackFlags
+	Cursor int
+}
+
+// NewStackEvents gives new StackEvents value.
+func NewStackEvents() *StackEvents {
+	return &StackEvents{}
+}
+
+// Name gives the name of the command, implements the res.Command interface.
+func (*StackEvents) Name() string {
+	return "events"
+}
+
+// RegisterFlags sets the flags for the command - "stack events <flags>".
+func (cmd *StackEvents) RegisterFlags(f *flag.FlagSet) {
+	cmd.register(f)
+	f.IntVar(&cmd.Cursor, "cursor", 0, "Sequence number of the last seen event; 0 streams events of the latest apply, -1 replays all events.")
+}
+
+// Valid implements the kloud.Validator interface.
+func (cmd *StackEvents) Valid() error {
+	if cmd.Cursor < -1 {
+		return errors.New("invalid value for -cursor flag")
+	}
+	return cmd.valid()
+}
+
+// Run executes the "stack events" subcommand.
+func (cmd *StackEvents) Run(ctx context.Context) error {
+	modelhelper.Initialize(envMongoURL())
+	cs, err := cmd.findStack()
+	modelhelper.Close()
+
+	if err != nil {
+		return err
+	}
+
+	return streamEvents(kiteFromContext(ctx), "apply", cs.Id.Hex(), cmd.Cursor, cmd.JSON)
+}
@@ -199,6 +199,7 @@ type TeamPlan struct {
 	Provider        string
 	Team            string
 	StackTemplateID string
+	StackID         string
 	Username        string
 }
 
@@ -212,8 +213,8 @@ func (cmd *TeamPlan) Valid() error {
 	if cmd.Provider == "" {
 		return errors.New("empty value for -p flag")
 	}
-	if cmd.StackTemplateID == "" {
-		return errors.New("empty value for -tid flag")
+	if cmd.StackTemplateID == "" && cmd.StackID == "" {
+		return errors.New("empty value for -tid or -sid flag")
 	}
 	if cmd.Team == "" {
 		return errors.New("empty value for -team flag")
@@ -231,6 +232,7 @@ func (cmd *TeamPlan) RegisterFlags(f *flag.FlagSet) {
 	f.StringVar(&cmd.Provider, "p", "aws", "Team provider name.")
 	f.StringVar(&cmd.Team, "team", "koding", "Team name.")
 	f.StringVar(&cmd.StackTemplateID, "tid", "", "Stack template ID.")
+	f.StringVar(&cmd.StackID, "sid", "", "Compute stack ID - plans changes of applying the stack.")
 	f.StringVar(&cmd.Username, "u", defaultUsername, "Username for the kloud request.")
 }
 
@@ -243,6 +245,7 @@ func (cmd *TeamPlan) Run(ctx context.Context) error {
 			Provider:        cmd.Provider,
 			GroupName:       cmd.Team,
 			StackTemplateID: cmd.StackTemplateID,
+			StackID:         cmd.StackID,
 		},
 	)
 
@@ -251,10 +254,60 @@ func (cmd *TeamPlan) Run(ctx context.Context) error {
 		return fmt.Errorf("%v %s kloud error: %s", k.Kite, k.Hostname, err)
 	}
 
-	DefaultUi.Info("plan raw response: " + string(resp.Raw))
+	if cmd.StackID == "" {
+		DefaultUi.Info("plan raw response: " + string(resp.Raw))
+		return nil
+	}
+
+	var plan stack.PlanResponse
+	if err := resp.Unmarshal(&plan); err != nil {
+		return err
+	}
+
+	printPlan(&plan)
 	return nil
 }
 
+var planSymbols = map[string]string{
+	stack.ActionCreate:  "+",
+	stack.ActionUpdate:  "~",
+	stack.ActionReplace: "-/+",
+	stack.ActionDestroy: "-",
+}
+
+func printPlan(plan *stack.PlanResponse) {
+	if len(plan.Resources) == 0 {
+		DefaultUi.Info("No changes. Stack is up-to-date.")
+		return
+	}
+
+	for _, r := range plan.Resources {
+		DefaultUi.Output(fmt.Sprintf("%s %s", planSymbols[r.Action], r.Name))
+
+		for _, attr := range r.Attributes {
+			newValue := attr.New
+			switch {
+			case attr.Computed:
+				newValue = "<computed>"
+			case attr.Removed:
+				newValue = "<removed>"
+			}
+
+			var forces string
+			if attr.RequiresNew {
+				forces = " (forces new resource)"
+			}
+
+			DefaultUi.Output(fmt.Sprintf("    %s: %q => %q%s", attr.Name, attr.Old, newValue, forces))
+		}
+	}
+
+	if s := plan.Summary; s != nil {
+		DefaultUi.Info(fmt.Sprintf("Plan: %d to create, %d to update, %d to replace, %d to destroy.",
+			s.Create, s.Update, s.Replace, s.Destroy))
+	}
+}
+
 /// TEAM APPLY
 
 // TeamApply provides an implementation for "team apply" subcommand.
@@ -137,6 +137,7 @@ func (s State) ValidMethods() []string {
 			"reinit",
 			"createSnapshot",
 			"deleteSnapshot",
+			"restoreSnapshot",
 		}
 	case Stopped:
 		return []string{
@@ -146,6 +147,7 @@ func (s State) ValidMethods() []string {
 			"reinit",
 			"createSnapshot",
 			"deleteSnapshot",
+			"restoreSnapshot",
 		}
 	case Terminated:
 		return []string{"build"}
@@ -251,6 +251,7 @@ func init() {
 			Bucket: "koding-terraformer-state-dev",
 		},
 		LocalStorePath: filepath.Join(repoPath, filepath.FromSlash("go/data/terraformer")),
+		MongoURL:       os.Getenv("KLOUD_MONGODB_URL"),
 	}
 
 	t, err := terraformer.New(tConf, logging.NewCustom("terraformer", false))
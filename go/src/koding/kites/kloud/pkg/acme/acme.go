@@ -0,0 +1,678 @@
+// Package acme implements a minimal ACME (RFC 8555) client, which is used
+// by kloud to obtain TLS certificates for custom domains of machines.
+//
+// Only the subset of the protocol required for issuing certificates
+// is supported: account registration, orders, dns-01 and http-01
+// challenges, finalization and certificate download.
+package acme
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	"golang.org/x/net/context/ctxhttp"
+)
+
+// LetsEncryptURL is the directory URL of the Let's Encrypt production CA.
+const LetsEncryptURL = "https://acme-v02.api.letsencrypt.org/directory"
+
+// DefaultPollInterval is used when Client.PollInterval is zero.
+const DefaultPollInterval = 2 * time.Second
+
+// Status values of ACME objects.
+const (
+	StatusPending     = "pending"
+	StatusReady       = "ready"
+	StatusProcessing  = "processing"
+	StatusValid       = "valid"
+	StatusInvalid     = "invalid"
+	StatusDeactivated = "deactivated"
+	StatusExpired     = "expired"
+	StatusRevoked     = "revoked"
+)
+
+// Challenge types supported by the client.
+const (
+	ChallengeDNS01  = "dns-01"
+	ChallengeHTTP01 = "http-01"
+)
+
+// ErrNoAccount is returned by methods that require an account when
+// the client was neither registered nor configured with AccountURL.
+var ErrNoAccount = errors.New("acme: account is not registered")
+
+// Error is an ACME problem document (RFC 7807) returned by a CA.
+type Error struct {
+	StatusCode int    `json:"-"`
+	Type       string `json:"type"`
+	Detail     string `json:"detail"`
+}
+
+// Error implements the built-in error interface.
+func (e *Error) Error() string {
+	return fmt.Sprintf("acme: %d %s: %s", e.StatusCode, e.Type, e.Detail)
+}
+
+func (e *Error) isBadNonce() bool {
+	return strings.HasSuffix(e.Type, ":badNonce")
+}
+
+// Directory represents resource URLs of a CA.
+type Directory struct {
+	NewNonce   string `json:"newNonce"`
+	NewAccount string `json:"newAccount"`
+	NewOrder   string `json:"newOrder"`
+	RevokeCert string `json:"revokeCert"`
+	KeyChange  string `json:"keyChange"`
+}
+
+// Identifier is a domain name an order or an authorization is for.
+type Identifier struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+// Order represents a request for a certificate.
+type Order struct {
+	URL            string       `json:"-"`
+	Status         string       `json:"status"`
+	Expires        time.Time    `json:"expires,omitempty"`
+	Identifiers    []Identifier `json:"identifiers"`
+	Authorizations []string     `json:"authorizations"`
+	Finalize       string       `json:"finalize"`
+	Certificate    string       `json:"certificate,omitempty"`
+	Error          *Error       `json:"error,omitempty"`
+}
+
+// Authorization represents the server's authorization of an account
+// for an identifier.
+type Authorization struct {
+	URL        string       `json:"-"`
+	Status     string       `json:"status"`
+	Expires    time.Time    `json:"expires,omitempty"`
+	Identifier Identifier   `json:"identifier"`
+	Challenges []*Challenge `json:"challenges"`
+}
+
+// Challenge returns a challenge of the given type or nil if the
+// authorization does not offer it.
+func (a *Authorization) Challenge(typ string) *Challenge {
+	for _, c := range a.Challenges {
+		if c.Type == typ {
+			return c
+		}
+	}
+	return nil
+}
+
+// Challenge represents a method of proving control over an identifier.
+type Challenge struct {
+	Type   string `json:"type"`
+	URL    string `json:"url"`
+	Status string `json:"status"`
+	Token  string `json:"token"`
+	Error  *Error `json:"error,omitempty"`
+}
+
+// Client is an ACME client, which signs its requests with an
+// ECDSA P-256 account key.
+//
+// A Client is safe for concurrent use.
+type Client struct {
+	// Key is the account key. Required.
+	Key *ecdsa.PrivateKey
+
+	// DirectoryURL is the directory URL of a CA. If empty,
+	// LetsEncryptURL is used.
+	DirectoryURL string
+
+	// AccountURL is the account URL (key ID) of an already
+	// registered account. It is set by Register.
+	AccountURL string
+
+	// HTTPClient is used to communicate with a CA. If nil,
+	// http.DefaultClient is used.
+	HTTPClient *http.Client
+
+	// PollInterval is a time between status checks of pending
+	// authorizations and orders.
+	PollInterval time.Duration
+
+	mu     sync.Mutex
+	dir    *Directory
+	nonces []string
+}
+
+// Discover fetches the directory of a CA. The result is cached.
+func (c *Client) Discover(ctx context.Context) (*Directory, error) {
+	c.mu.Lock()
+	dir := c.dir
+	c.mu.Unlock()
+
+	if dir != nil {
+		return dir, nil
+	}
+
+	resp, err := ctxhttp.Get(ctx, c.httpClient(), c.directoryURL())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, responseError(resp)
+	}
+
+	dir = &Directory{}
+	if err := json.NewDecoder(resp.Body).Decode(dir); err != nil {
+		return nil, fmt.Errorf("acme: unable to decode directory: %s", err)
+	}
+
+	c.mu.Lock()
+	c.dir = dir
+	c.mu.Unlock()
+
+	c.addNonce(resp.Header)
+
+	return dir, nil
+}
+
+// Register creates a new account or looks up an existing one for the
+// client's key and accepts CA's terms of service. On success it sets
+// c.AccountURL and returns it.
+func (c *Client) Register(ctx context.Context, contact ...string) (string, error) {
+	dir, err := c.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	req := map[string]interface{}{
+		"termsOfServiceAgreed": true,
+	}
+
+	if len(contact) != 0 {
+		req["contact"] = contact
+	}
+
+	resp, err := c.post(ctx, dir.NewAccount, req, true, http.StatusOK, http.StatusCreated)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	u := resp.Header.Get("Location")
+	if u == "" {
+		return "", errors.New("acme: missing account URL in response")
+	}
+
+	c.mu.Lock()
+	c.AccountURL = u
+	c.mu.Unlock()
+
+	return u, nil
+}
+
+// NewOrder creates a new order for the given domains.
+func (c *Client) NewOrder(ctx context.Context, domains ...string) (*Order, error) {
+	dir, err := c.Discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	req := struct {
+		Identifiers []Identifier `json:"identifiers"`
+	}{}
+
+	for _, domain := range domains {
+		req.Identifiers = append(req.Identifiers, Identifier{Type: "dns", Value: domain})
+	}
+
+	resp, err := c.post(ctx, dir.NewOrder, req, false, http.StatusCreated)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeOrder(resp)
+}
+
+// GetOrder fetches an order from the given URL.
+func (c *Client) GetOrder(ctx context.Context, url string) (*Order, error) {
+	resp, err := c.post(ctx, url, nil, false, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	order, err := decodeOrder(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if order.URL == "" {
+		order.URL = url
+	}
+
+	return order, nil
+}
+
+// GetAuthorization fetches an authorization from the given URL.
+func (c *Client) GetAuthorization(ctx context.Context, url string) (*Authorization, error) {
+	resp, err := c.post(ctx, url, nil, false, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	authz := &Authorization{URL: url}
+	if err := json.NewDecoder(resp.Body).Decode(authz); err != nil {
+		return nil, fmt.Errorf("acme: unable to decode authorization: %s", err)
+	}
+
+	return authz, nil
+}
+
+// Accept informs the CA the challenge is ready to be validated.
+func (c *Client) Accept(ctx context.Context, chal *Challenge) (*Challenge, error) {
+	resp, err := c.post(ctx, chal.URL, struct{}{}, false, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	accepted := &Challenge{}
+	if err := json.NewDecoder(resp.Body).Decode(accepted); err != nil {
+		return nil, fmt.Errorf("acme: unable to decode challenge: %s", err)
+	}
+
+	return accepted, nil
+}
+
+// WaitAuthorization polls the authorization until it is valid or
+// the context is done. It returns an error if the authorization
+// becomes invalid.
+func (c *Client) WaitAuthorization(ctx context.Context, url string) (*Authorization, error) {
+	for {
+		authz, err := c.GetAuthorization(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+
+		switch authz.Status {
+		case StatusValid:
+			return authz, nil
+		case StatusInvalid, StatusDeactivated, StatusExpired, StatusRevoked:
+			return nil, authzError(authz)
+		}
+
+		if err := c.sleep(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Finalize requests a certificate for the order with the given DER
+// encoded CSR and polls the order until the certificate is issued.
+func (c *Client) Finalize(ctx context.Context, order *Order, csr []byte) (*Order, error) {
+	req := struct {
+		CSR string `json:"csr"`
+	}{
+		CSR: base64.RawURLEncoding.EncodeToString(csr),
+	}
+
+	resp, err := c.post(ctx, order.Finalize, req, false, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	finalized, err := decodeOrder(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	if finalized.URL == "" {
+		finalized.URL = order.URL
+	}
+
+	for {
+		switch finalized.Status {
+		case StatusValid:
+			return finalized, nil
+		case StatusInvalid:
+			if finalized.Error != nil {
+				return nil, finalized.Error
+			}
+			return nil, fmt.Errorf("acme: order %s is invalid", finalized.URL)
+		}
+
+		if err := c.sleep(ctx); err != nil {
+			return nil, err
+		}
+
+		if finalized, err = c.GetOrder(ctx, finalized.URL); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Certificate downloads a PEM encoded certificate chain from the given URL.
+func (c *Client) Certificate(ctx context.Context, url string) ([]byte, error) {
+	resp, err := c.post(ctx, url, nil, false, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	return ioutil.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// KeyAuthorization returns a key authorization for the given
+// challenge token.
+func (c *Client) KeyAuthorization(token string) (string, error) {
+	thumb, err := Thumbprint(&c.Key.PublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	return token + "." + thumb, nil
+}
+
+// DNS01Record returns a value of the _acme-challenge TXT record
+// for the given challenge token.
+func (c *Client) DNS01Record(token string) (string, error) {
+	keyAuth, err := c.KeyAuthorization(token)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(keyAuth))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// HTTP01Path returns a URL path the http-01 challenge response
+// for the given token is expected to be served at.
+func HTTP01Path(token string) string {
+	return "/.well-known/acme-challenge/" + token
+}
+
+// DNS01Name returns a name of the TXT record for the dns-01 challenge
+// of the given domain.
+func DNS01Name(domain string) string {
+	return "_acme-challenge." + strings.TrimSuffix(domain, ".")
+}
+
+// Thumbprint returns a JWK thumbprint (RFC 7638) of the given key.
+func Thumbprint(key *ecdsa.PublicKey) (string, error) {
+	jwk, err := jwkEncode(key)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(jwk))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// post sends a JWS signed request to the given url. If payload is nil,
+// the request is a POST-as-GET one. If useJWK is true, the request is
+// signed with the account key embedded instead of the account URL.
+//
+// A request rejected due to a bad nonce is retried once.
+func (c *Client) post(ctx context.Context, url string, payload interface{}, useJWK bool, codes ...int) (*http.Response, error) {
+	if c.Key == nil {
+		return nil, errors.New("acme: missing account key")
+	}
+
+	if !useJWK && c.accountURL() == "" {
+		return nil, ErrNoAccount
+	}
+
+	var retried bool
+
+	for {
+		nonce, err := c.nonce(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := c.sign(url, nonce, payload, useJWK)
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+
+		req.Header.Set("Content-Type", "application/jose+json")
+
+		resp, err := ctxhttp.Do(ctx, c.httpClient(), req)
+		if err != nil {
+			return nil, err
+		}
+
+		c.addNonce(resp.Header)
+
+		for _, code := range codes {
+			if resp.StatusCode == code {
+				return resp, nil
+			}
+		}
+
+		err = responseError(resp)
+		resp.Body.Close()
+
+		if e, ok := err.(*Error); ok && e.isBadNonce() && !retried {
+			retried = true
+			continue
+		}
+
+		return nil, err
+	}
+}
+
+func (c *Client) sign(url, nonce string, payload interface{}, useJWK bool) ([]byte, error) {
+	protected := map[string]interface{}{
+		"alg":   "ES256",
+		"nonce": nonce,
+		"url":   url,
+	}
+
+	if useJWK {
+		jwk, err := jwkEncode(&c.Key.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		protected["jwk"] = json.RawMessage(jwk)
+	} else {
+		protected["kid"] = c.accountURL()
+	}
+
+	p, err := json.Marshal(protected)
+	if err != nil {
+		return nil, err
+	}
+
+	var rawPayload []byte
+	if payload != nil {
+		if rawPayload, err = json.Marshal(payload); err != nil {
+			return nil, err
+		}
+	}
+
+	jws := struct {
+		Protected string `json:"protected"`
+		Payload   string `json:"payload"`
+		Signature string `json:"signature"`
+	}{
+		Protected: base64.RawURLEncoding.EncodeToString(p),
+		Payload:   base64.RawURLEncoding.EncodeToString(rawPayload),
+	}
+
+	sum := sha256.Sum256([]byte(jws.Protected + "." + jws.Payload))
+
+	r, s, err := ecdsa.Sign(rand.Reader, c.Key, sum[:])
+	if err != nil {
+		return nil, err
+	}
+
+	sig := make([]byte, 64)
+	copyPadded(sig[:32], r)
+	copyPadded(sig[32:], s)
+
+	jws.Signature = base64.RawURLEncoding.EncodeToString(sig)
+
+	return json.Marshal(jws)
+}
+
+func (c *Client) nonce(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	if n := len(c.nonces); n != 0 {
+		nonce := c.nonces[n-1]
+		c.nonces = c.nonces[:n-1]
+		c.mu.Unlock()
+		return nonce, nil
+	}
+	c.mu.Unlock()
+
+	dir, err := c.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest("HEAD", dir.NewNonce, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := ctxhttp.Do(ctx, c.httpClient(), req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	nonce := resp.Header.Get("Replay-Nonce")
+	if nonce == "" {
+		return "", errors.New("acme: missing nonce in response")
+	}
+
+	return nonce, nil
+}
+
+func (c *Client) addNonce(h http.Header) {
+	if nonce := h.Get("Replay-Nonce"); nonce != "" {
+		c.mu.Lock()
+		c.nonces = append(c.nonces, nonce)
+		c.mu.Unlock()
+	}
+}
+
+func (c *Client) sleep(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(c.pollInterval()):
+		return nil
+	}
+}
+
+func (c *Client) accountURL() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.AccountURL
+}
+
+func (c *Client) directoryURL() string {
+	if c.DirectoryURL != "" {
+		return c.DirectoryURL
+	}
+	return LetsEncryptURL
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+func (c *Client) pollInterval() time.Duration {
+	if c.PollInterval != 0 {
+		return c.PollInterval
+	}
+	return DefaultPollInterval
+}
+
+func decodeOrder(resp *http.Response) (*Order, error) {
+	defer resp.Body.Close()
+
+	order := &Order{
+		URL: resp.Header.Get("Location"),
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(order); err != nil {
+		return nil, fmt.Errorf("acme: unable to decode order: %s", err)
+	}
+
+	return order, nil
+}
+
+func responseError(resp *http.Response) error {
+	p, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1<<16))
+
+	e := &Error{StatusCode: resp.StatusCode}
+	if err := json.Unmarshal(p, e); err != nil || e.Type == "" {
+		e.Type = "urn:ietf:params:acme:error:serverInternal"
+		e.Detail = strings.TrimSpace(string(p))
+	}
+
+	return e
+}
+
+func authzError(authz *Authorization) error {
+	for _, chal := range authz.Challenges {
+		if chal.Error != nil {
+			return chal.Error
+		}
+	}
+
+	return fmt.Errorf("acme: authorization for %q is %s", authz.Identifier.Value, authz.Status)
+}
+
+// jwkEncode encodes the key with its required members in the
+// lexicographical order, which makes the output usable for thumbprints.
+func jwkEncode(key *ecdsa.PublicKey) (string, error) {
+	if key.Curve != elliptic.P256() {
+		return "", errors.New("acme: unsupported key curve, only P-256 is supported")
+	}
+
+	x := make([]byte, 32)
+	y := make([]byte, 32)
+	copyPadded(x, key.X)
+	copyPadded(y, key.Y)
+
+	return fmt.Sprintf(`{"crv":"P-256","kty":"EC","x":%q,"y":%q}`,
+		base64.RawURLEncoding.EncodeToString(x),
+		base64.RawURLEncoding.EncodeToString(y),
+	), nil
+}
+
+func copyPadded(dst []byte, n *big.Int) {
+	b := n.Bytes()
+	copy(dst[len(dst)-len(b):], b)
+}
@@ -0,0 +1,649 @@
+package acme_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"koding/kites/kloud/pkg/acme"
+
+	"golang.org/x/net/context"
+)
+
+// fakeCA is a minimal in-memory ACME server, which validates every
+// accepted challenge after the first status check.
+type fakeCA struct {
+	srv *httptest.Server
+
+	mu        sync.Mutex
+	nonce     int
+	nonces    map[string]bool
+	badNonce  bool
+	key       *ecdsa.PublicKey
+	status    string // authorization status
+	accepted  bool
+	finalized bool
+	csr       *x509.CertificateRequest
+}
+
+func newFakeCA() *fakeCA {
+	ca := &fakeCA{
+		nonces: make(map[string]bool),
+		status: acme.StatusPending,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/directory", ca.directory)
+	mux.HandleFunc("/nonce", ca.newNonce)
+	mux.HandleFunc("/account", ca.handle(ca.newAccount))
+	mux.HandleFunc("/order", ca.handle(ca.newOrder))
+	mux.HandleFunc("/order/1", ca.handle(ca.order))
+	mux.HandleFunc("/authz/1", ca.handle(ca.authz))
+	mux.HandleFunc("/chal/1", ca.handle(ca.chal))
+	mux.HandleFunc("/finalize/1", ca.handle(ca.finalize))
+	mux.HandleFunc("/cert/1", ca.handle(ca.cert))
+
+	ca.srv = httptest.NewServer(mux)
+
+	return ca
+}
+
+func (ca *fakeCA) url(path string) string {
+	return ca.srv.URL + path
+}
+
+func (ca *fakeCA) addNonce(w http.ResponseWriter) {
+	ca.mu.Lock()
+	ca.nonce++
+	nonce := fmt.Sprintf("nonce-%d", ca.nonce)
+	ca.nonces[nonce] = true
+	ca.mu.Unlock()
+
+	w.Header().Set("Replay-Nonce", nonce)
+}
+
+func (ca *fakeCA) directory(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(&acme.Directory{
+		NewNonce:   ca.url("/nonce"),
+		NewAccount: ca.url("/account"),
+		NewOrder:   ca.url("/order"),
+	})
+}
+
+func (ca *fakeCA) newNonce(w http.ResponseWriter, r *http.Request) {
+	ca.addNonce(w)
+}
+
+func problem(w http.ResponseWriter, code int, typ, detail string) {
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{
+		"type":   "urn:ietf:params:acme:error:" + typ,
+		"detail": detail,
+	})
+}
+
+type jwsHeader struct {
+	Alg   string          `json:"alg"`
+	Nonce string          `json:"nonce"`
+	URL   string          `json:"url"`
+	KID   string          `json:"kid"`
+	JWK   json.RawMessage `json:"jwk"`
+}
+
+type jwk struct {
+	X string `json:"x"`
+	Y string `json:"y"`
+}
+
+func decodeKey(p []byte) (*ecdsa.PublicKey, error) {
+	var k jwk
+	if err := json.Unmarshal(p, &k); err != nil {
+		return nil, err
+	}
+
+	x, err := base64.RawURLEncoding.DecodeString(k.X)
+	if err != nil {
+		return nil, err
+	}
+
+	y, err := base64.RawURLEncoding.DecodeString(k.Y)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     new(big.Int).SetBytes(x),
+		Y:     new(big.Int).SetBytes(y),
+	}, nil
+}
+
+// handle verifies the JWS of a request and passes its payload to fn.
+func (ca *fakeCA) handle(fn func(http.ResponseWriter, []byte)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ca.addNonce(w)
+
+		var jws struct {
+			Protected string `json:"protected"`
+			Payload   string `json:"payload"`
+			Signature string `json:"signature"`
+		}
+
+		if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+			problem(w, 400, "malformed", err.Error())
+			return
+		}
+
+		p, err := base64.RawURLEncoding.DecodeString(jws.Protected)
+		if err != nil {
+			problem(w, 400, "malformed", err.Error())
+			return
+		}
+
+		var hdr jwsHeader
+		if err := json.Unmarshal(p, &hdr); err != nil {
+			problem(w, 400, "malformed", err.Error())
+			return
+		}
+
+		if hdr.Alg != "ES256" {
+			problem(w, 400, "badSignatureAlgorithm", hdr.Alg)
+			return
+		}
+
+		if hdr.URL != ca.url(r.URL.Path) {
+			problem(w, 400, "unauthorized", "url mismatch: "+hdr.URL)
+			return
+		}
+
+		ca.mu.Lock()
+		ok := ca.nonces[hdr.Nonce] && !ca.badNonce
+		delete(ca.nonces, hdr.Nonce)
+		ca.badNonce = false
+		key := ca.key
+		ca.mu.Unlock()
+
+		if !ok {
+			problem(w, 400, "badNonce", hdr.Nonce)
+			return
+		}
+
+		switch {
+		case len(hdr.JWK) != 0:
+			if key, err = decodeKey(hdr.JWK); err != nil {
+				problem(w, 400, "malformed", err.Error())
+				return
+			}
+		case hdr.KID != ca.url("/account/1") || key == nil:
+			problem(w, 400, "accountDoesNotExist", hdr.KID)
+			return
+		}
+
+		sig, err := base64.RawURLEncoding.DecodeString(jws.Signature)
+		if err != nil || len(sig) != 64 {
+			problem(w, 400, "malformed", "bad signature encoding")
+			return
+		}
+
+		sum := sha256.Sum256([]byte(jws.Protected + "." + jws.Payload))
+		rr := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+
+		if !ecdsa.Verify(key, sum[:], rr, s) {
+			problem(w, 403, "unauthorized", "signature verification failed")
+			return
+		}
+
+		if len(hdr.JWK) != 0 {
+			ca.mu.Lock()
+			ca.key = key
+			ca.mu.Unlock()
+		}
+
+		payload, err := base64.RawURLEncoding.DecodeString(jws.Payload)
+		if err != nil {
+			problem(w, 400, "malformed", err.Error())
+			return
+		}
+
+		fn(w, payload)
+	}
+}
+
+func (ca *fakeCA) newAccount(w http.ResponseWriter, payload []byte) {
+	var req struct {
+		TermsOfServiceAgreed bool `json:"termsOfServiceAgreed"`
+	}
+
+	if err := json.Unmarshal(payload, &req); err != nil || !req.TermsOfServiceAgreed {
+		problem(w, 400, "malformed", "terms of service not agreed")
+		return
+	}
+
+	w.Header().Set("Location", ca.url("/account/1"))
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(`{"status":"valid"}`))
+}
+
+func (ca *fakeCA) orderJSON() *acme.Order {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	order := &acme.Order{
+		Status:         acme.StatusPending,
+		Identifiers:    []acme.Identifier{{Type: "dns", Value: "example.com"}},
+		Authorizations: []string{ca.url("/authz/1")},
+		Finalize:       ca.url("/finalize/1"),
+	}
+
+	switch {
+	case ca.finalized:
+		order.Status = acme.StatusValid
+		order.Certificate = ca.url("/cert/1")
+	case ca.status == acme.StatusValid:
+		order.Status = acme.StatusReady
+	}
+
+	return order
+}
+
+func (ca *fakeCA) newOrder(w http.ResponseWriter, payload []byte) {
+	var req struct {
+		Identifiers []acme.Identifier `json:"identifiers"`
+	}
+
+	if err := json.Unmarshal(payload, &req); err != nil {
+		problem(w, 400, "malformed", err.Error())
+		return
+	}
+
+	if len(req.Identifiers) != 1 || req.Identifiers[0].Value != "example.com" {
+		problem(w, 400, "rejectedIdentifier", fmt.Sprintf("%+v", req.Identifiers))
+		return
+	}
+
+	w.Header().Set("Location", ca.url("/order/1"))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ca.orderJSON())
+}
+
+func (ca *fakeCA) order(w http.ResponseWriter, payload []byte) {
+	json.NewEncoder(w).Encode(ca.orderJSON())
+}
+
+func (ca *fakeCA) authz(w http.ResponseWriter, payload []byte) {
+	if len(payload) != 0 {
+		problem(w, 400, "malformed", "expected POST-as-GET")
+		return
+	}
+
+	ca.mu.Lock()
+	// The challenge is validated on the first check after it was accepted.
+	status := ca.status
+	if ca.accepted {
+		ca.status = acme.StatusValid
+	}
+	ca.mu.Unlock()
+
+	json.NewEncoder(w).Encode(&acme.Authorization{
+		Status:     status,
+		Identifier: acme.Identifier{Type: "dns", Value: "example.com"},
+		Challenges: []*acme.Challenge{{
+			Type:   acme.ChallengeDNS01,
+			URL:    ca.url("/chal/1"),
+			Status: status,
+			Token:  "token-1",
+		}, {
+			Type:   acme.ChallengeHTTP01,
+			URL:    ca.url("/chal/2"),
+			Status: status,
+			Token:  "token-2",
+		}},
+	})
+}
+
+func (ca *fakeCA) chal(w http.ResponseWriter, payload []byte) {
+	if string(payload) != "{}" {
+		problem(w, 400, "malformed", "unexpected payload: "+string(payload))
+		return
+	}
+
+	ca.mu.Lock()
+	ca.accepted = true
+	ca.mu.Unlock()
+
+	json.NewEncoder(w).Encode(&acme.Challenge{
+		Type:   acme.ChallengeDNS01,
+		URL:    ca.url("/chal/1"),
+		Status: acme.StatusProcessing,
+		Token:  "token-1",
+	})
+}
+
+func (ca *fakeCA) finalize(w http.ResponseWriter, payload []byte) {
+	var req struct {
+		CSR string `json:"csr"`
+	}
+
+	if err := json.Unmarshal(payload, &req); err != nil {
+		problem(w, 400, "malformed", err.Error())
+		return
+	}
+
+	der, err := base64.RawURLEncoding.DecodeString(req.CSR)
+	if err != nil {
+		problem(w, 400, "badCSR", err.Error())
+		return
+	}
+
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		problem(w, 400, "badCSR", err.Error())
+		return
+	}
+
+	if ca.orderJSON().Status != acme.StatusReady {
+		problem(w, 403, "orderNotReady", "order is not ready")
+		return
+	}
+
+	ca.mu.Lock()
+	ca.csr = csr
+	ca.mu.Unlock()
+
+	order := ca.orderJSON()
+	order.Status = acme.StatusProcessing
+
+	ca.mu.Lock()
+	ca.finalized = true
+	ca.mu.Unlock()
+
+	json.NewEncoder(w).Encode(order)
+}
+
+func (ca *fakeCA) cert(w http.ResponseWriter, payload []byte) {
+	ca.mu.Lock()
+	csr := ca.csr
+	ca.mu.Unlock()
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: csr.DNSNames[0]},
+		DNSNames:     csr.DNSNames,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(90 * 24 * time.Hour),
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		problem(w, 500, "serverInternal", err.Error())
+		return
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, csr.PublicKey, key)
+	if err != nil {
+		problem(w, 500, "serverInternal", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pem-certificate-chain")
+	pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func newKey(t *testing.T) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey()=%s", err)
+	}
+	return key
+}
+
+func newCSR(t *testing.T, domain string) []byte {
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domain},
+		DNSNames: []string{domain},
+	}, newKey(t))
+	if err != nil {
+		t.Fatalf("CreateCertificateRequest()=%s", err)
+	}
+	return csr
+}
+
+func TestClient(t *testing.T) {
+	ca := newFakeCA()
+	defer ca.srv.Close()
+
+	c := &acme.Client{
+		Key:          newKey(t),
+		DirectoryURL: ca.url("/directory"),
+		PollInterval: time.Millisecond,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := c.NewOrder(ctx, "example.com"); err != acme.ErrNoAccount {
+		t.Fatalf("got %v, want %v", err, acme.ErrNoAccount)
+	}
+
+	u, err := c.Register(ctx, "mailto:admin@example.com")
+	if err != nil {
+		t.Fatalf("Register()=%s", err)
+	}
+
+	if want := ca.url("/account/1"); u != want {
+		t.Fatalf("got %q, want %q", u, want)
+	}
+
+	// The next request is rejected with badNonce, the client is
+	// expected to retry it transparently.
+	ca.mu.Lock()
+	ca.badNonce = true
+	ca.mu.Unlock()
+
+	order, err := c.NewOrder(ctx, "example.com")
+	if err != nil {
+		t.Fatalf("NewOrder()=%s", err)
+	}
+
+	if want := ca.url("/order/1"); order.URL != want {
+		t.Fatalf("got %q, want %q", order.URL, want)
+	}
+
+	if len(order.Authorizations) != 1 {
+		t.Fatalf("got %d authorizations, want 1", len(order.Authorizations))
+	}
+
+	authz, err := c.GetAuthorization(ctx, order.Authorizations[0])
+	if err != nil {
+		t.Fatalf("GetAuthorization()=%s", err)
+	}
+
+	chal := authz.Challenge(acme.ChallengeDNS01)
+	if chal == nil {
+		t.Fatalf("missing %s challenge", acme.ChallengeDNS01)
+	}
+
+	if _, err := c.Accept(ctx, chal); err != nil {
+		t.Fatalf("Accept()=%s", err)
+	}
+
+	if authz, err = c.WaitAuthorization(ctx, authz.URL); err != nil {
+		t.Fatalf("WaitAuthorization()=%s", err)
+	}
+
+	if authz.Status != acme.StatusValid {
+		t.Fatalf("got %q, want %q", authz.Status, acme.StatusValid)
+	}
+
+	order, err = c.Finalize(ctx, order, newCSR(t, "example.com"))
+	if err != nil {
+		t.Fatalf("Finalize()=%s", err)
+	}
+
+	if want := ca.url("/cert/1"); order.Certificate != want {
+		t.Fatalf("got %q, want %q", order.Certificate, want)
+	}
+
+	p, err := c.Certificate(ctx, order.Certificate)
+	if err != nil {
+		t.Fatalf("Certificate()=%s", err)
+	}
+
+	block, _ := pem.Decode(p)
+	if block == nil {
+		t.Fatalf("unable to decode certificate: %q", p)
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("ParseCertificate()=%s", err)
+	}
+
+	if err := cert.VerifyHostname("example.com"); err != nil {
+		t.Fatalf("VerifyHostname()=%s", err)
+	}
+}
+
+func TestClientError(t *testing.T) {
+	ca := newFakeCA()
+	defer ca.srv.Close()
+
+	c := &acme.Client{
+		Key:          newKey(t),
+		DirectoryURL: ca.url("/directory"),
+		AccountURL:   ca.url("/account/2"),
+	}
+
+	_, err := c.NewOrder(context.Background(), "example.com")
+
+	e, ok := err.(*acme.Error)
+	if !ok {
+		t.Fatalf("got %T, want *acme.Error", err)
+	}
+
+	if want := "urn:ietf:params:acme:error:accountDoesNotExist"; e.Type != want {
+		t.Fatalf("got %q, want %q", e.Type, want)
+	}
+}
+
+func TestDNS01Record(t *testing.T) {
+	c := &acme.Client{Key: newKey(t)}
+
+	thumb, err := acme.Thumbprint(&c.Key.PublicKey)
+	if err != nil {
+		t.Fatalf("Thumbprint()=%s", err)
+	}
+
+	keyAuth, err := c.KeyAuthorization("token")
+	if err != nil {
+		t.Fatalf("KeyAuthorization()=%s", err)
+	}
+
+	if want := "token." + thumb; keyAuth != want {
+		t.Fatalf("got %q, want %q", keyAuth, want)
+	}
+
+	rec, err := c.DNS01Record("token")
+	if err != nil {
+		t.Fatalf("DNS01Record()=%s", err)
+	}
+
+	sum := sha256.Sum256([]byte(keyAuth))
+	if want := base64.RawURLEncoding.EncodeToString(sum[:]); rec != want {
+		t.Fatalf("got %q, want %q", rec, want)
+	}
+
+	if got, want := acme.DNS01Name("example.com."), "_acme-challenge.example.com"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+// TestLocalCA runs against a local ACME test server, e.g. pebble started
+// with PEBBLE_VA_ALWAYS_VALID=1:
+//
+//	ACME_DIRECTORY_URL=https://127.0.0.1:14000/dir go test -run TestLocalCA
+func TestLocalCA(t *testing.T) {
+	dir := os.Getenv("ACME_DIRECTORY_URL")
+	if dir == "" {
+		t.Skip("ACME_DIRECTORY_URL is not set")
+	}
+
+	c := &acme.Client{
+		Key:          newKey(t),
+		DirectoryURL: dir,
+		PollInterval: 100 * time.Millisecond,
+		HTTPClient: &http.Client{
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if _, err := c.Register(ctx); err != nil {
+		t.Fatalf("Register()=%s", err)
+	}
+
+	const domain = "test.koding.example"
+
+	order, err := c.NewOrder(ctx, domain)
+	if err != nil {
+		t.Fatalf("NewOrder()=%s", err)
+	}
+
+	for _, u := range order.Authorizations {
+		authz, err := c.GetAuthorization(ctx, u)
+		if err != nil {
+			t.Fatalf("GetAuthorization()=%s", err)
+		}
+
+		if authz.Status == acme.StatusValid {
+			continue
+		}
+
+		chal := authz.Challenge(acme.ChallengeHTTP01)
+		if chal == nil {
+			t.Fatalf("missing %s challenge", acme.ChallengeHTTP01)
+		}
+
+		if _, err := c.Accept(ctx, chal); err != nil {
+			t.Fatalf("Accept()=%s", err)
+		}
+
+		if _, err := c.WaitAuthorization(ctx, u); err != nil {
+			t.Fatalf("WaitAuthorization()=%s", err)
+		}
+	}
+
+	if order, err = c.Finalize(ctx, order, newCSR(t, domain)); err != nil {
+		t.Fatalf("Finalize()=%s", err)
+	}
+
+	p, err := c.Certificate(ctx, order.Certificate)
+	if err != nil {
+		t.Fatalf("Certificate()=%s", err)
+	}
+
+	if !strings.Contains(string(p), "BEGIN CERTIFICATE") {
+		t.Fatalf("unexpected certificate: %q", p)
+	}
+}
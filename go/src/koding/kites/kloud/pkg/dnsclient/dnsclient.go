@@ -3,6 +3,7 @@ package dnsclient
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -12,7 +13,6 @@ import (
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/service/route53"
 	"github.com/cenkalti/backoff"
-	"github.com/dchest/validator"
 	"github.com/koding/logging"
 )
 
@@ -28,10 +28,34 @@ type Route53 struct {
 }
 
 type Options struct {
+	// Backend selects the DNS service used by NewClient, which is one of:
+	//
+	//   - "route53" (default) - Amazon Route53 hosted zone
+	//   - "rfc2136" - DNS server accepting dynamic updates
+	//   - "memory" - in-memory records, optionally persisted to a file
+	//
+	Backend string
+
 	Creds      *credentials.Credentials
 	HostedZone string
 	Log        logging.Logger
 
+	// Server is an address of the DNS server, e.g. ns1.example.com:53,
+	// used by the "rfc2136" backend.
+	Server string
+
+	// TSIGKey, TSIGSecret and TSIGAlgorithm are used by the "rfc2136" backend
+	// for signing update requests. TSIGSecret is base64-encoded and
+	// TSIGAlgorithm defaults to "hmac-sha256". The requests are not signed
+	// when TSIGKey is empty.
+	TSIGKey       string
+	TSIGSecret    string
+	TSIGAlgorithm string
+
+	// Path is a file used by the "memory" backend for persisting records.
+	// If empty, the records are kept in memory only.
+	Path string
+
 	// SyncTimeout tells at most how much time we're going to wait
 	// till DNS change is propageted on all Amazon servers.
 	//
@@ -47,6 +71,32 @@ func (opts *Options) log() logging.Logger {
 	return defaultLog
 }
 
+// NewClient gives new client for the backend selected by opts.Backend.
+func NewClient(opts *Options) (Client, error) {
+	switch opts.Backend {
+	case "", "route53":
+		r, err := NewRoute53Client(opts)
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	case "rfc2136":
+		r, err := NewRFC2136Client(opts)
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	case "memory":
+		m, err := NewMemoryClient(opts)
+		if err != nil {
+			return nil, err
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unsupported DNS backend: %q", opts.Backend)
+	}
+}
+
 // NewRoute53Client initializes a new DNSClient interface instance based on AWS Route53
 func NewRoute53Client(opts *Options) (*Route53, error) {
 	optsCopy := *opts
@@ -117,7 +167,7 @@ func (r *Route53) UpsertRecords(recs ...*Record) error {
 				Type: aws.String(recs[i].Type),
 				TTL:  aws.Int64(int64(recs[i].TTL)),
 				ResourceRecords: []*route53.ResourceRecord{{
-					Value: aws.String(recs[i].IP),
+					Value: aws.String(recordValue(recs[i])),
 				}},
 			},
 		}
@@ -317,7 +367,7 @@ func (r *Route53) DeleteRecord(rec *Record) error {
 					Type: aws.String(rec.Type),
 					TTL:  aws.Int64(int64(rec.TTL)),
 					ResourceRecords: []*route53.ResourceRecord{{
-						Value: aws.String(rec.IP),
+						Value: aws.String(recordValue(rec)),
 					}},
 				},
 			}},
@@ -329,36 +379,23 @@ func (r *Route53) DeleteRecord(rec *Record) error {
 	return nil
 }
 
+// recordValue returns a value of the record as expected by Route53,
+// which requires TXT values to be enclosed in quotes.
+func recordValue(rec *Record) string {
+	if rec.Type == "TXT" && !strings.HasPrefix(rec.IP, `"`) {
+		return strconv.Quote(rec.IP)
+	}
+
+	return rec.IP
+}
+
 func (r *Route53) HostedZone() string {
 	return r.opts.HostedZone
 }
 
 func (r *Route53) Validate(domain, username string) error {
-	hostedZone := r.HostedZone()
-
-	if domain == "" {
-		return r.errorf("Domain name argument is empty")
-	}
-
-	if domain == hostedZone {
-		return r.errorf("Domain %q can't be the same as top-level domain %q", domain, hostedZone)
-	}
-
-	if !strings.Contains(domain, hostedZone) {
-		return r.errorf("Domain %q doesn't contain hostedzone %q", domain, hostedZone)
-	}
-
-	rest := strings.TrimSuffix(domain, "."+hostedZone)
-	if rest == domain {
-		return r.errorf("Domain %q is invalid (1)", domain)
-	}
-
-	if split := strings.Split(rest, "."); split[len(split)-1] != username {
-		return r.errorf("Domain %q doesn't contain %q username (hostedZone=%q)", domain, username, hostedZone)
-	}
-
-	if !validator.IsValidDomain(domain) {
-		return r.errorf("Domain %q is invalid (2)", domain)
+	if err := validate(r.HostedZone(), domain, username); err != nil {
+		return r.errorf("%s", err)
 	}
 
 	return nil
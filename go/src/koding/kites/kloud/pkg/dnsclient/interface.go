@@ -14,6 +14,15 @@ type Client interface {
 	// new IP
 	Upsert(name, newIP string) error
 
+	// UpsertRecords updates or creates the given records.
+	UpsertRecords(recs ...*Record) error
+
+	// UpsertRecord updates or creates the given record.
+	UpsertRecord(rec *Record) error
+
+	// DeleteRecord deletes the given record.
+	DeleteRecord(rec *Record) error
+
 	// Delete deletes the given domain name.
 	Delete(name string) error
 
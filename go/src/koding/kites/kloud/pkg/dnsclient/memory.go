@@ -0,0 +1,271 @@
+package dnsclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Memory is a DNS client, which keeps the records in memory. It is meant
+// for tests and single-node installations, where the hosted zone is
+// served by other means.
+//
+// If Options.Path is non-empty, the records are persisted to the file
+// after each change.
+type Memory struct {
+	opts *Options
+
+	mu      sync.Mutex
+	records map[string]Records // maps normalized name to its records
+}
+
+var _ Client = (*Memory)(nil)
+
+// NewMemoryClient gives new in-memory client. If opts.Path points to
+// an existing file, records are read from it.
+func NewMemoryClient(opts *Options) (*Memory, error) {
+	optsCopy := *opts
+
+	m := &Memory{
+		opts:    &optsCopy,
+		records: make(map[string]Records),
+	}
+
+	if opts.Path == "" {
+		return m, nil
+	}
+
+	p, err := ioutil.ReadFile(opts.Path)
+	if os.IsNotExist(err) {
+		return m, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var recs Records
+	if err := json.Unmarshal(p, &recs); err != nil {
+		return nil, fmt.Errorf("reading %q: %s", opts.Path, err)
+	}
+
+	for _, rec := range recs {
+		m.upsert(rec)
+	}
+
+	return m, nil
+}
+
+// Upsert creates or updates the domain record with the given ip address.
+func (m *Memory) Upsert(domain, newIP string) error {
+	return m.UpsertRecord(&Record{
+		Name: domain,
+		Type: "A",
+		IP:   newIP,
+		TTL:  30,
+	})
+}
+
+// UpsertRecord creates or updates a DNS record.
+func (m *Memory) UpsertRecord(rec *Record) error {
+	return m.UpsertRecords(rec)
+}
+
+// UpsertRecords creates or updates the given DNS records.
+func (m *Memory) UpsertRecords(recs ...*Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, rec := range recs {
+		m.opts.log().Debug("upserting record: %# v", rec)
+
+		m.upsert(rec)
+	}
+
+	return m.save()
+}
+
+// Get gives the record for the given domain.
+func (m *Memory) Get(domain string) (*Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	recs := m.records[normalize(domain)]
+	if len(recs) == 0 {
+		return nil, ErrNoRecord
+	}
+
+	recCopy := *recs[0]
+	return &recCopy, nil
+}
+
+// GetAll gives all the records sorted by name, starting from the given one.
+func (m *Memory) GetAll(name string) ([]*Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	recs := m.all()
+	name = normalize(name)
+
+	i := sort.Search(len(recs), func(i int) bool {
+		return normalize(recs[i].Name) >= name
+	})
+
+	if i == len(recs) {
+		return nil, ErrNoRecord
+	}
+
+	return recs[i:], nil
+}
+
+// Rename changes the domain from oldDomain to newDomain.
+func (m *Memory) Rename(oldDomain, newDomain string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	recs, ok := m.records[normalize(oldDomain)]
+	if !ok {
+		return ErrNoRecord
+	}
+
+	delete(m.records, normalize(oldDomain))
+
+	for _, rec := range recs {
+		rec.Name = newDomain
+		m.upsert(rec)
+	}
+
+	return m.save()
+}
+
+// Delete deletes all records of the given domain.
+func (m *Memory) Delete(domain string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.records[normalize(domain)]; !ok {
+		return nil
+	}
+
+	delete(m.records, normalize(domain))
+
+	return m.save()
+}
+
+// DeleteRecord deletes the given record.
+func (m *Memory) DeleteRecord(rec *Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.opts.log().Debug("deleting record: %v", rec)
+
+	name := normalize(rec.Name)
+	recs := m.records[name]
+
+	for i, r := range recs {
+		if strings.EqualFold(r.Type, rec.Type) && r.IP == rec.IP {
+			recs = append(recs[:i], recs[i+1:]...)
+			break
+		}
+	}
+
+	if len(recs) == 0 {
+		delete(m.records, name)
+	} else {
+		m.records[name] = recs
+	}
+
+	return m.save()
+}
+
+func (m *Memory) HostedZone() string {
+	return m.opts.HostedZone
+}
+
+func (m *Memory) Validate(domain, username string) error {
+	return validate(m.opts.HostedZone, domain, username)
+}
+
+// upsert replaces a record of the same name and type, or adds a new one.
+func (m *Memory) upsert(rec *Record) {
+	recCopy := *rec
+	recCopy.Type = strings.ToUpper(rec.Type)
+
+	name := normalize(rec.Name)
+	recs := m.records[name]
+
+	for i, r := range recs {
+		if r.Type == recCopy.Type {
+			recs[i] = &recCopy
+			return
+		}
+	}
+
+	m.records[name] = append(recs, &recCopy)
+}
+
+func (m *Memory) all() []*Record {
+	var recs []*Record
+
+	for _, r := range m.records {
+		for _, rec := range r {
+			recCopy := *rec
+			recs = append(recs, &recCopy)
+		}
+	}
+
+	sort.Sort(byName(recs))
+
+	return recs
+}
+
+func (m *Memory) save() error {
+	if m.opts.Path == "" {
+		return nil
+	}
+
+	p, err := json.MarshalIndent(m.all(), "", "\t")
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(m.opts.Path), filepath.Base(m.opts.Path))
+	if err != nil {
+		return err
+	}
+
+	_, err = f.Write(p)
+
+	if e := f.Close(); e != nil && err == nil {
+		err = e
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	return os.Rename(f.Name(), m.opts.Path)
+}
+
+// normalize gives lowercased, relative form of the domain name.
+func normalize(name string) string {
+	return strings.TrimSuffix(strings.ToLower(name), ".")
+}
+
+type byName []*Record
+
+func (r byName) Len() int      { return len(r) }
+func (r byName) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+
+func (r byName) Less(i, j int) bool {
+	if ni, nj := normalize(r[i].Name), normalize(r[j].Name); ni != nj {
+		return ni < nj
+	}
+
+	return r[i].Type < r[j].Type
+}
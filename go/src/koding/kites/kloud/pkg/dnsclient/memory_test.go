@@ -0,0 +1,73 @@
+package dnsclient
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dnsclient")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := &Options{
+		HostedZone: "example.com",
+		Path:       filepath.Join(dir, "records.json"),
+	}
+
+	m, err := NewMemoryClient(opts)
+	if err != nil {
+		t.Fatalf("NewMemoryClient()=%s", err)
+	}
+
+	if err := m.Upsert("foo.user.example.com", "10.0.0.1"); err != nil {
+		t.Fatalf("Upsert()=%s", err)
+	}
+
+	if err := m.Upsert("foo.user.example.com", "10.0.0.2"); err != nil {
+		t.Fatalf("Upsert()=%s", err)
+	}
+
+	if err := m.Rename("foo.user.example.com", "bar.user.example.com"); err != nil {
+		t.Fatalf("Rename()=%s", err)
+	}
+
+	if _, err := m.Get("foo.user.example.com"); err != ErrNoRecord {
+		t.Fatalf("got %v, want %v", err, ErrNoRecord)
+	}
+
+	// Read the records from the file.
+	m, err = NewMemoryClient(opts)
+	if err != nil {
+		t.Fatalf("NewMemoryClient()=%s", err)
+	}
+
+	rec, err := m.Get("Bar.user.example.com.")
+	if err != nil {
+		t.Fatalf("Get()=%s", err)
+	}
+
+	if rec.IP != "10.0.0.2" {
+		t.Fatalf("got %q, want %q", rec.IP, "10.0.0.2")
+	}
+
+	if err := m.DeleteRecord(rec); err != nil {
+		t.Fatalf("DeleteRecord()=%s", err)
+	}
+
+	if _, err := m.Get("bar.user.example.com"); err != ErrNoRecord {
+		t.Fatalf("got %v, want %v", err, ErrNoRecord)
+	}
+
+	if err := m.Validate("bar.user.example.com", "user"); err != nil {
+		t.Fatalf("Validate()=%s", err)
+	}
+
+	if err := m.Validate("bar.other.example.com", "user"); err == nil {
+		t.Fatal("expected Validate() to fail")
+	}
+}
@@ -0,0 +1,464 @@
+package dnsclient
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DNS message constants used by the RFC2136 client, see RFC 1035,
+// RFC 2136 and RFC 2845 for details.
+const (
+	typeA     = 1
+	typeNS    = 2
+	typeCNAME = 5
+	typeSOA   = 6
+	typeTXT   = 16
+	typeAAAA  = 28
+	typeTSIG  = 250
+	typeANY   = 255
+
+	classINET = 1
+	classNONE = 254
+	classANY  = 255
+
+	opcodeQuery  = 0
+	opcodeUpdate = 5
+
+	headerLen = 12
+)
+
+var recordTypes = map[string]uint16{
+	"A":     typeA,
+	"NS":    typeNS,
+	"CNAME": typeCNAME,
+	"TXT":   typeTXT,
+	"AAAA":  typeAAAA,
+}
+
+var rcodes = map[int]string{
+	1:  "FORMERR",
+	2:  "SERVFAIL",
+	3:  "NXDOMAIN",
+	4:  "NOTIMP",
+	5:  "REFUSED",
+	6:  "YXDOMAIN",
+	7:  "YXRRSET",
+	8:  "NXRRSET",
+	9:  "NOTAUTH",
+	10: "NOTZONE",
+}
+
+var errMalformed = errors.New("dns: malformed message")
+
+// RcodeError is returned when DNS server responds with non-zero
+// response code.
+type RcodeError int
+
+// Error implements the built-in error interface.
+func (e RcodeError) Error() string {
+	if s, ok := rcodes[int(e)]; ok {
+		return "dns: server responded with " + s
+	}
+
+	return "dns: server responded with rcode " + strconv.Itoa(int(e))
+}
+
+// msg is a builder of a DNS message.
+type msg struct {
+	buf []byte
+	err error
+}
+
+func newMsg(id uint16, opcode int) *msg {
+	m := &msg{
+		buf: make([]byte, headerLen),
+	}
+
+	binary.BigEndian.PutUint16(m.buf[0:], id)
+	binary.BigEndian.PutUint16(m.buf[2:], uint16(opcode)<<11)
+
+	return m
+}
+
+// count increments the n-th section counter of the message header.
+func (m *msg) count(n int) {
+	i := 4 + 2*n
+	binary.BigEndian.PutUint16(m.buf[i:], binary.BigEndian.Uint16(m.buf[i:])+1)
+}
+
+func (m *msg) uint16(v uint16) {
+	m.buf = append(m.buf, byte(v>>8), byte(v))
+}
+
+func (m *msg) uint32(v uint32) {
+	m.buf = append(m.buf, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (m *msg) name(s string) {
+	p, err := packName(s)
+	if err != nil && m.err == nil {
+		m.err = err
+	}
+
+	m.buf = append(m.buf, p...)
+}
+
+// question adds an entry to the question (zone) section.
+func (m *msg) question(name string, typ, class uint16) {
+	m.name(name)
+	m.uint16(typ)
+	m.uint16(class)
+	m.count(0)
+}
+
+// rr adds a resource record to the n-th section.
+func (m *msg) rr(n int, name string, typ, class uint16, ttl uint32, rdata []byte) {
+	m.name(name)
+	m.uint16(typ)
+	m.uint16(class)
+	m.uint32(ttl)
+	m.uint16(uint16(len(rdata)))
+	m.buf = append(m.buf, rdata...)
+	m.count(n)
+}
+
+// packName encodes the domain name in uncompressed wire format. It
+// supports \X escapes and \DDD octal escapes within the labels, the
+// latter are used by Route53, e.g. "\052" for "*".
+func packName(s string) ([]byte, error) {
+	if s == "" || s == "." {
+		return []byte{0}, nil
+	}
+
+	name := s
+	if strings.HasSuffix(s, ".") && !strings.HasSuffix(s, "\\.") {
+		name = s[:len(s)-1]
+	}
+
+	var p, label []byte
+
+	flush := func() error {
+		if len(label) == 0 || len(label) > 63 {
+			return fmt.Errorf("dns: invalid label in %q", s)
+		}
+
+		p = append(p, byte(len(label)))
+		p = append(p, label...)
+		label = label[:0]
+
+		return nil
+	}
+
+	for i := 0; i < len(name); i++ {
+		switch c := name[i]; {
+		case c == '.':
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		case c != '\\':
+			label = append(label, c)
+		case i+3 < len(name) && isOctal(name[i+1:i+4]):
+			n, _ := strconv.ParseUint(name[i+1:i+4], 8, 8)
+			label = append(label, byte(n))
+			i += 3
+		case i+1 < len(name):
+			label = append(label, name[i+1])
+			i++
+		default:
+			return nil, fmt.Errorf("dns: invalid escape in %q", s)
+		}
+	}
+
+	if err := flush(); err != nil {
+		return nil, err
+	}
+
+	if len(p) > 254 {
+		return nil, fmt.Errorf("dns: name too long: %q", s)
+	}
+
+	return append(p, 0), nil
+}
+
+func isOctal(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '7' {
+			return false
+		}
+	}
+	return s[0] <= '3'
+}
+
+// packRdata encodes the value of the record.
+func packRdata(rec *Record) (uint16, []byte, error) {
+	typ, ok := recordTypes[strings.ToUpper(rec.Type)]
+	if !ok {
+		return 0, nil, fmt.Errorf("dns: unsupported record type: %q", rec.Type)
+	}
+
+	switch typ {
+	case typeA, typeAAAA:
+		ip := net.ParseIP(rec.IP)
+		if ip == nil {
+			return 0, nil, fmt.Errorf("dns: invalid IP address: %q", rec.IP)
+		}
+
+		if typ == typeAAAA {
+			return typ, []byte(ip.To16()), nil
+		}
+
+		if ip = ip.To4(); ip == nil {
+			return 0, nil, fmt.Errorf("dns: not an IPv4 address: %q", rec.IP)
+		}
+
+		return typ, []byte(ip), nil
+	case typeCNAME, typeNS:
+		p, err := packName(rec.IP)
+		return typ, p, err
+	default: // typeTXT
+		var p []byte
+
+		for s := rec.IP; ; s = s[255:] {
+			n := len(s)
+			if n > 255 {
+				n = 255
+			}
+
+			p = append(p, byte(n))
+			p = append(p, s[:n]...)
+
+			if len(s) <= 255 {
+				break
+			}
+		}
+
+		return typ, p, nil
+	}
+}
+
+// unpackName decodes possibly compressed domain name starting at off.
+// It returns the name and an offset just after the name.
+func unpackName(p []byte, off int) (string, int, error) {
+	var labels []string
+
+	end := -1
+
+	for jumps := 0; ; {
+		if off >= len(p) {
+			return "", 0, errMalformed
+		}
+
+		n := int(p[off])
+
+		switch {
+		case n == 0:
+			if end == -1 {
+				end = off + 1
+			}
+
+			return strings.Join(labels, ".") + ".", end, nil
+		case n&0xC0 == 0xC0:
+			if off+1 >= len(p) || jumps > 64 {
+				return "", 0, errMalformed
+			}
+
+			if end == -1 {
+				end = off + 2
+			}
+
+			off = int(binary.BigEndian.Uint16(p[off:]) & 0x3FFF)
+			jumps++
+		default:
+			if off+1+n > len(p) {
+				return "", 0, errMalformed
+			}
+
+			labels = append(labels, string(p[off+1:off+1+n]))
+			off += 1 + n
+		}
+	}
+}
+
+// unpackAnswers decodes records of the answer section of the response.
+func unpackAnswers(p []byte) ([]*Record, error) {
+	if len(p) < headerLen {
+		return nil, errMalformed
+	}
+
+	qdcount := int(binary.BigEndian.Uint16(p[4:]))
+	ancount := int(binary.BigEndian.Uint16(p[6:]))
+	off := headerLen
+
+	for i := 0; i < qdcount; i++ {
+		_, n, err := unpackName(p, off)
+		if err != nil {
+			return nil, err
+		}
+
+		off = n + 4
+	}
+
+	var recs []*Record
+
+	for i := 0; i < ancount; i++ {
+		name, n, err := unpackName(p, off)
+		if err != nil {
+			return nil, err
+		}
+
+		if n+10 > len(p) {
+			return nil, errMalformed
+		}
+
+		typ := binary.BigEndian.Uint16(p[n:])
+		ttl := binary.BigEndian.Uint32(p[n+4:])
+		rdlen := int(binary.BigEndian.Uint16(p[n+8:]))
+		off = n + 10
+
+		if off+rdlen > len(p) {
+			return nil, errMalformed
+		}
+
+		rdata := p[off : off+rdlen]
+		rec := &Record{
+			Name: name,
+			TTL:  int(ttl),
+		}
+
+		switch typ {
+		case typeA, typeAAAA:
+			rec.IP = net.IP(rdata).String()
+		case typeCNAME, typeNS:
+			if rec.IP, _, err = unpackName(p, off); err != nil {
+				return nil, err
+			}
+		case typeTXT:
+			var s []byte
+			for j := 0; j < len(rdata); j += 1 + int(rdata[j]) {
+				if j+1+int(rdata[j]) > len(rdata) {
+					return nil, errMalformed
+				}
+				s = append(s, rdata[j+1:j+1+int(rdata[j])]...)
+			}
+			rec.IP = string(s)
+		default:
+			off += rdlen
+			continue
+		}
+
+		for t, v := range recordTypes {
+			if v == typ {
+				rec.Type = t
+			}
+		}
+
+		recs = append(recs, rec)
+		off += rdlen
+	}
+
+	return recs, nil
+}
+
+// tsig signs DNS messages as described in RFC 2845.
+type tsig struct {
+	name      string
+	algorithm string
+	secret    []byte
+	hash      func() hash.Hash
+	fudge     uint16
+	now       func() time.Time
+}
+
+var tsigAlgorithms = map[string]func() hash.Hash{
+	"hmac-md5.sig-alg.reg.int.": md5.New,
+	"hmac-sha1.":                sha1.New,
+	"hmac-sha256.":              sha256.New,
+	"hmac-sha512.":              sha512.New,
+}
+
+func newTSIG(name, secret, algorithm string) (*tsig, error) {
+	switch algorithm = strings.ToLower(algorithm); algorithm {
+	case "":
+		algorithm = "hmac-sha256."
+	case "hmac-md5":
+		algorithm = "hmac-md5.sig-alg.reg.int."
+	default:
+		if !strings.HasSuffix(algorithm, ".") {
+			algorithm += "."
+		}
+	}
+
+	fn, ok := tsigAlgorithms[algorithm]
+	if !ok {
+		return nil, fmt.Errorf("dns: unsupported TSIG algorithm: %q", algorithm)
+	}
+
+	if _, err := packName(name); err != nil {
+		return nil, fmt.Errorf("dns: invalid TSIG key name: %s", err)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return nil, fmt.Errorf("dns: invalid TSIG secret: %s", err)
+	}
+
+	return &tsig{
+		name:      strings.ToLower(strings.TrimSuffix(name, ".") + "."),
+		algorithm: algorithm,
+		secret:    key,
+		hash:      fn,
+		fudge:     300,
+		now:       time.Now,
+	}, nil
+}
+
+// sign appends TSIG record to the additional section of the message.
+func (t *tsig) sign(m *msg) {
+	id := binary.BigEndian.Uint16(m.buf)
+	now := uint64(t.now().Unix())
+
+	timeSigned := []byte{
+		byte(now >> 40), byte(now >> 32), byte(now >> 24),
+		byte(now >> 16), byte(now >> 8), byte(now),
+	}
+
+	// TSIG variables, see RFC 2845, 3.4.2.
+	vars := &msg{}
+	vars.name(t.name)
+	vars.uint16(classANY)
+	vars.uint32(0)
+	vars.name(t.algorithm)
+	vars.buf = append(vars.buf, timeSigned...)
+	vars.uint16(t.fudge)
+	vars.uint16(0) // error
+	vars.uint16(0) // other len
+
+	h := hmac.New(t.hash, t.secret)
+	h.Write(m.buf)
+	h.Write(vars.buf)
+	mac := h.Sum(nil)
+
+	rdata := &msg{}
+	rdata.name(t.algorithm)
+	rdata.buf = append(rdata.buf, timeSigned...)
+	rdata.uint16(t.fudge)
+	rdata.uint16(uint16(len(mac)))
+	rdata.buf = append(rdata.buf, mac...)
+	rdata.uint16(id)
+	rdata.uint16(0) // error
+	rdata.uint16(0) // other len
+
+	m.rr(3, t.name, typeTSIG, classANY, 0, rdata.buf)
+}
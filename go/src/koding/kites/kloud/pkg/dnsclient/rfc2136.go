@@ -0,0 +1,326 @@
+package dnsclient
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// defaultDNSTimeout is a timeout for a single DNS exchange.
+const defaultDNSTimeout = 10 * time.Second
+
+// RFC2136 is a DNS client, which manages records of the hosted zone
+// with dynamic updates as described in RFC 2136. The updates are
+// signed with TSIG key, when one is configured.
+//
+// The records are read by querying the server directly, thus it must be
+// authoritative for the hosted zone.
+type RFC2136 struct {
+	// Timeout for a single DNS exchange. Defaults to 10s.
+	Timeout time.Duration
+
+	opts *Options
+	tsig *tsig
+}
+
+var _ Client = (*RFC2136)(nil)
+
+// NewRFC2136Client gives new client for the DNS server given by opts.Server.
+func NewRFC2136Client(opts *Options) (*RFC2136, error) {
+	optsCopy := *opts
+
+	if optsCopy.Server == "" {
+		return nil, errors.New("dns server address is empty")
+	}
+
+	if optsCopy.HostedZone == "" {
+		return nil, errors.New("hosted zone is empty")
+	}
+
+	if _, _, err := net.SplitHostPort(optsCopy.Server); err != nil {
+		optsCopy.Server = net.JoinHostPort(optsCopy.Server, "53")
+	}
+
+	r := &RFC2136{
+		Timeout: defaultDNSTimeout,
+		opts:    &optsCopy,
+	}
+
+	if optsCopy.TSIGKey != "" {
+		t, err := newTSIG(optsCopy.TSIGKey, optsCopy.TSIGSecret, optsCopy.TSIGAlgorithm)
+		if err != nil {
+			return nil, err
+		}
+
+		r.tsig = t
+	}
+
+	return r, nil
+}
+
+// Upsert creates or updates the domain record with the given ip address.
+func (r *RFC2136) Upsert(domain, newIP string) error {
+	return r.UpsertRecord(&Record{
+		Name: domain,
+		Type: "A",
+		IP:   newIP,
+		TTL:  30,
+	})
+}
+
+// UpsertRecord creates or updates a DNS record.
+func (r *RFC2136) UpsertRecord(rec *Record) error {
+	return r.UpsertRecords(rec)
+}
+
+// UpsertRecords replaces record sets of the given records in
+// a single update.
+func (r *RFC2136) UpsertRecords(recs ...*Record) error {
+	m := r.newUpdate()
+
+	for _, rec := range recs {
+		r.opts.log().Debug("upserting record: %# v", rec)
+
+		if err := upsert(m, rec); err != nil {
+			return r.errorf("upserting %v failed: %s", rec, err)
+		}
+	}
+
+	if err := r.update(m); err != nil {
+		return r.errorf("upserting domains failed: %s", err)
+	}
+
+	return nil
+}
+
+// Get gives the first record of the given domain.
+func (r *RFC2136) Get(domain string) (*Record, error) {
+	r.opts.log().Debug("fetching domain record for domain: %s", domain)
+
+	dnsName := fqdn(domain)
+
+	for _, typ := range []uint16{typeA, typeAAAA, typeCNAME, typeTXT} {
+		recs, err := r.query(dnsName, typ)
+		if err != nil {
+			return nil, r.error(err)
+		}
+
+		for _, rec := range recs {
+			if strings.EqualFold(rec.Name, dnsName) {
+				return rec, nil
+			}
+		}
+	}
+
+	return nil, r.error(ErrNoRecord)
+}
+
+// Rename changes the domain from oldDomain to newDomain in a single update.
+func (r *RFC2136) Rename(oldDomain, newDomain string) error {
+	rec, err := r.Get(oldDomain)
+	if err != nil {
+		return err
+	}
+
+	r.opts.log().Debug("updating domain name of IP %s from %q to %q", rec.IP, oldDomain, newDomain)
+
+	m := r.newUpdate()
+
+	if err := deleteRRset(m, oldDomain, rec.Type); err != nil {
+		return r.errorf("could not rename domain %q to %q: %s", oldDomain, newDomain, err)
+	}
+
+	rec.Name = newDomain
+
+	if err := upsert(m, rec); err != nil {
+		return r.errorf("could not rename domain %q to %q: %s", oldDomain, newDomain, err)
+	}
+
+	if err := r.update(m); err != nil {
+		return r.errorf("could not rename domain %q to %q: %s", oldDomain, newDomain, err)
+	}
+
+	return nil
+}
+
+// Delete deletes a domain record for the given domain.
+func (r *RFC2136) Delete(domain string) error {
+	rec, err := r.Get(domain)
+	if err != nil {
+		// domains can be removed via other bussiness logics, so this can
+		// happen
+		if err == ErrNoRecord {
+			return nil
+		}
+		return err
+	}
+
+	return r.DeleteRecord(rec)
+}
+
+// DeleteRecord deletes the given record.
+func (r *RFC2136) DeleteRecord(rec *Record) error {
+	r.opts.log().Debug("deleting record: %v", rec)
+
+	typ, rdata, err := packRdata(rec)
+	if err != nil {
+		return r.errorf("could not delete record %v: %s", rec, err)
+	}
+
+	m := r.newUpdate()
+	m.rr(2, fqdn(rec.Name), typ, classNONE, 0, rdata)
+
+	if err := r.update(m); err != nil {
+		return r.errorf("could not delete record %v: %s", rec, err)
+	}
+
+	return nil
+}
+
+func (r *RFC2136) HostedZone() string {
+	return r.opts.HostedZone
+}
+
+func (r *RFC2136) Validate(domain, username string) error {
+	if err := validate(r.opts.HostedZone, domain, username); err != nil {
+		return r.errorf("%s", err)
+	}
+
+	return nil
+}
+
+func (r *RFC2136) newUpdate() *msg {
+	m := newMsg(newID(), opcodeUpdate)
+	m.question(fqdn(r.opts.HostedZone), typeSOA, classINET)
+	return m
+}
+
+// upsert adds to the update section changes that replace the record set
+// of the record with the record.
+func upsert(m *msg, rec *Record) error {
+	typ, rdata, err := packRdata(rec)
+	if err != nil {
+		return err
+	}
+
+	m.rr(2, fqdn(rec.Name), typ, classANY, 0, nil)
+	m.rr(2, fqdn(rec.Name), typ, classINET, uint32(rec.TTL), rdata)
+
+	return nil
+}
+
+// deleteRRset adds to the update section a change that removes record set
+// of the given type.
+func deleteRRset(m *msg, name, recordType string) error {
+	typ, ok := recordTypes[strings.ToUpper(recordType)]
+	if !ok {
+		return fmt.Errorf("dns: unsupported record type: %q", recordType)
+	}
+
+	m.rr(2, fqdn(name), typ, classANY, 0, nil)
+
+	return nil
+}
+
+func (r *RFC2136) update(m *msg) error {
+	if r.tsig != nil {
+		r.tsig.sign(m)
+	}
+
+	_, err := r.exchange(m)
+	return err
+}
+
+func (r *RFC2136) query(name string, typ uint16) ([]*Record, error) {
+	m := newMsg(newID(), opcodeQuery)
+	m.question(name, typ, classINET)
+
+	p, err := r.exchange(m)
+	if err == RcodeError(3) { // NXDOMAIN
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return unpackAnswers(p)
+}
+
+// exchange sends the message to the server over TCP and reads
+// the response.
+func (r *RFC2136) exchange(m *msg) ([]byte, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	conn, err := net.DialTimeout("tcp", r.opts.Server, r.Timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(r.Timeout))
+
+	req := make([]byte, 2, 2+len(m.buf))
+	binary.BigEndian.PutUint16(req, uint16(len(m.buf)))
+	req = append(req, m.buf...)
+
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+
+	var n [2]byte
+	if _, err := io.ReadFull(conn, n[:]); err != nil {
+		return nil, err
+	}
+
+	resp := make([]byte, binary.BigEndian.Uint16(n[:]))
+	if _, err := io.ReadFull(conn, resp); err != nil {
+		return nil, err
+	}
+
+	if len(resp) < headerLen {
+		return nil, errMalformed
+	}
+
+	if binary.BigEndian.Uint16(resp) != binary.BigEndian.Uint16(m.buf) {
+		return nil, errors.New("dns: response id mismatch")
+	}
+
+	if rcode := int(resp[3] & 0x0F); rcode != 0 {
+		return nil, RcodeError(rcode)
+	}
+
+	return resp, nil
+}
+
+func (r *RFC2136) errorf(format string, v ...interface{}) error {
+	err := fmt.Errorf(format, v...)
+	r.opts.log().Error(err.Error())
+	return err
+}
+
+func (r *RFC2136) error(err error) error {
+	// Ignore ErrNoRecord errors, as they're expected
+	// and handled by the caller.
+	if err != ErrNoRecord {
+		r.opts.log().Error("%q", err)
+	}
+	return err
+}
+
+func newID() uint16 {
+	var p [2]byte
+	rand.Read(p[:])
+	return binary.BigEndian.Uint16(p[:])
+}
+
+// fqdn gives fully qualified form of the domain name.
+func fqdn(name string) string {
+	return strings.TrimSuffix(name, ".") + "."
+}
@@ -0,0 +1,271 @@
+package dnsclient
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+var testSecret = base64.StdEncoding.EncodeToString([]byte("secret"))
+
+// testServer is a fake DNS server, which answers each request
+// with the given handler.
+type testServer struct {
+	l    net.Listener
+	reqs chan []byte
+}
+
+func newTestServer(t *testing.T, handle func(req []byte) []byte) *testServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen()=%s", err)
+	}
+
+	s := &testServer{
+		l:    l,
+		reqs: make(chan []byte, 16),
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			var n [2]byte
+			if _, err := io.ReadFull(conn, n[:]); err != nil {
+				conn.Close()
+				continue
+			}
+
+			req := make([]byte, binary.BigEndian.Uint16(n[:]))
+			if _, err := io.ReadFull(conn, req); err != nil {
+				conn.Close()
+				continue
+			}
+
+			s.reqs <- req
+
+			resp := handle(req)
+			binary.BigEndian.PutUint16(n[:], uint16(len(resp)))
+			conn.Write(append(n[:], resp...))
+			conn.Close()
+		}
+	}()
+
+	return s
+}
+
+func (s *testServer) client(t *testing.T, tsigKey string) *RFC2136 {
+	r, err := NewRFC2136Client(&Options{
+		HostedZone: "example.com",
+		Server:     s.l.Addr().String(),
+		TSIGKey:    tsigKey,
+		TSIGSecret: testSecret,
+	})
+	if err != nil {
+		t.Fatalf("NewRFC2136Client()=%s", err)
+	}
+
+	return r
+}
+
+// reply gives a response header for the given request.
+func reply(req []byte, rcode byte, answers ...[]byte) []byte {
+	resp := make([]byte, headerLen)
+	copy(resp, req[:4])
+	resp[2] |= 0x80 // QR
+	resp[3] = rcode
+	binary.BigEndian.PutUint16(resp[6:], uint16(len(answers)))
+
+	for _, a := range answers {
+		resp = append(resp, a...)
+	}
+
+	return resp
+}
+
+// skipRR gives an offset just after the resource record starting at off.
+func skipRR(t *testing.T, p []byte, off int) int {
+	_, n, err := unpackName(p, off)
+	if err != nil {
+		t.Fatalf("unpackName()=%s", err)
+	}
+
+	return n + 10 + int(binary.BigEndian.Uint16(p[n+8:]))
+}
+
+func TestRFC2136UpsertRecords(t *testing.T) {
+	s := newTestServer(t, func(req []byte) []byte { return reply(req, 0) })
+	defer s.l.Close()
+
+	r := s.client(t, "kloud")
+
+	err := r.UpsertRecords(
+		&Record{Name: "foo.example.com", Type: "A", IP: "10.0.0.1", TTL: 300},
+		&Record{Name: `\052.foo.example.com`, Type: "CNAME", IP: "foo.example.com", TTL: 300},
+	)
+	if err != nil {
+		t.Fatalf("UpsertRecords()=%s", err)
+	}
+
+	req := <-s.reqs
+
+	if opcode := int(req[2]>>3) & 0xF; opcode != opcodeUpdate {
+		t.Fatalf("got %d opcode, want %d", opcode, opcodeUpdate)
+	}
+
+	counts := []uint16{1, 0, 4, 1}
+	for i, want := range counts {
+		if got := binary.BigEndian.Uint16(req[4+2*i:]); got != want {
+			t.Fatalf("section %d: got %d records, want %d", i, got, want)
+		}
+	}
+
+	zone, off, err := unpackName(req, headerLen)
+	if err != nil {
+		t.Fatalf("unpackName()=%s", err)
+	}
+
+	if zone != "example.com." {
+		t.Fatalf("got %q, want %q", zone, "example.com.")
+	}
+
+	off += 4
+	for i := 0; i < 4; i++ {
+		if i == 2 {
+			name, _, err := unpackName(req, off)
+			if err != nil {
+				t.Fatalf("unpackName()=%s", err)
+			}
+
+			if name != "*.foo.example.com." {
+				t.Fatalf("got %q, want %q", name, "*.foo.example.com.")
+			}
+		}
+
+		off = skipRR(t, req, off)
+	}
+
+	// Verify the TSIG record as described in RFC 2845, 3.4.
+	signed := append([]byte(nil), req[:off]...)
+	binary.BigEndian.PutUint16(signed[10:], 0)
+
+	name, n, err := unpackName(req, off)
+	if err != nil {
+		t.Fatalf("unpackName()=%s", err)
+	}
+
+	if name != "kloud." {
+		t.Fatalf("got %q, want %q", name, "kloud.")
+	}
+
+	rdata := req[n+10:]
+	alg, n, err := unpackName(rdata, 0)
+	if err != nil {
+		t.Fatalf("unpackName()=%s", err)
+	}
+
+	if alg != "hmac-sha256." {
+		t.Fatalf("got %q, want %q", alg, "hmac-sha256.")
+	}
+
+	timeSigned := rdata[n : n+8] // time signed and fudge
+	macSize := int(binary.BigEndian.Uint16(rdata[n+8:]))
+	mac := rdata[n+10 : n+10+macSize]
+
+	var vars bytes.Buffer
+	vars.Write([]byte("\x05kloud\x00\x00\xff\x00\x00\x00\x00"))
+	vars.Write([]byte("\x0bhmac-sha256\x00"))
+	vars.Write(timeSigned)
+	vars.Write([]byte{0, 0, 0, 0})
+
+	h := hmac.New(sha256.New, []byte("secret"))
+	h.Write(signed)
+	h.Write(vars.Bytes())
+
+	if !hmac.Equal(mac, h.Sum(nil)) {
+		t.Fatal("TSIG MAC mismatch")
+	}
+}
+
+func TestRFC2136Get(t *testing.T) {
+	s := newTestServer(t, func(req []byte) []byte {
+		if typ := binary.BigEndian.Uint16(req[len(req)-4:]); typ != typeA {
+			return reply(req, 3)
+		}
+
+		question := req[headerLen:]
+		answer := []byte{
+			0xC0, headerLen, // pointer to the question name
+			0, typeA, 0, classINET,
+			0, 0, 0, 30,
+			0, 4, 10, 0, 0, 1,
+		}
+
+		resp := reply(req, 0)
+		binary.BigEndian.PutUint16(resp[4:], 1)
+		resp = append(resp, question...)
+		binary.BigEndian.PutUint16(resp[6:], 1)
+
+		return append(resp, answer...)
+	})
+	defer s.l.Close()
+
+	r := s.client(t, "")
+
+	rec, err := r.Get("foo.example.com")
+	if err != nil {
+		t.Fatalf("Get()=%s", err)
+	}
+
+	want := &Record{Name: "foo.example.com.", Type: "A", IP: "10.0.0.1", TTL: 30}
+
+	if *rec != *want {
+		t.Fatalf("got %+v, want %+v", rec, want)
+	}
+}
+
+func TestRFC2136Refused(t *testing.T) {
+	s := newTestServer(t, func(req []byte) []byte { return reply(req, 5) })
+	defer s.l.Close()
+
+	r := s.client(t, "kloud")
+
+	err := r.Upsert("foo.example.com", "10.0.0.1")
+	if err == nil || !strings.Contains(err.Error(), "REFUSED") {
+		t.Fatalf("got %v, want REFUSED error", err)
+	}
+}
+
+func TestPackName(t *testing.T) {
+	cases := map[string]string{
+		"example.com":           "\x07example\x03com\x00",
+		"example.com.":          "\x07example\x03com\x00",
+		`\052.example.com`:      "\x01*\x07example\x03com\x00",
+		`foo\.bar.example.com.`: "\x07foo.bar\x07example\x03com\x00",
+	}
+
+	for name, want := range cases {
+		p, err := packName(name)
+		if err != nil {
+			t.Errorf("%s: packName()=%s", name, err)
+			continue
+		}
+
+		if string(p) != want {
+			t.Errorf("%s: got %q, want %q", name, p, want)
+		}
+	}
+
+	if _, err := packName("foo..example.com"); err == nil {
+		t.Error("expected packName() to fail on empty label")
+	}
+}
@@ -0,0 +1,51 @@
+// Package lease implements distributed, time-bounded locks.
+//
+// A lease is owned by a single owner (e.g. a kloud instance) and is valid
+// until its TTL elapses. An owner that wants to keep the lease must renew
+// it before it expires; if the owner dies, the lease expires on its own
+// and can be acquired by somebody else.
+package lease
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrLocked is returned by Acquire when the lease is held by
+	// other owner and it has not expired yet.
+	ErrLocked = errors.New("lease is held by other owner")
+
+	// ErrNotHeld is returned by Renew when the lease either expired
+	// or is held by other owner.
+	ErrNotHeld = errors.New("lease is not held by the owner")
+)
+
+// Lease describes a single lock.
+type Lease struct {
+	ID         string    `bson:"_id" json:"id"`
+	Owner      string    `bson:"owner" json:"owner"`
+	AcquiredAt time.Time `bson:"acquiredAt" json:"acquiredAt"`
+	ExpiresAt  time.Time `bson:"expiresAt" json:"expiresAt"`
+}
+
+// Expired tells whether the lease is expired at the given time.
+func (l *Lease) Expired(now time.Time) bool {
+	return !now.Before(l.ExpiresAt)
+}
+
+// Backend is a storage for leases.
+type Backend interface {
+	// Acquire acquires a lease with the given id for the given owner.
+	// If the lease is already held and not expired, it returns
+	// ErrLocked.
+	Acquire(id, owner string, ttl time.Duration) (*Lease, error)
+
+	// Renew extends the lease with the given id by the ttl. If the lease
+	// is not held by the owner, it returns ErrNotHeld.
+	Renew(id, owner string, ttl time.Duration) (*Lease, error)
+
+	// Release releases the lease. Releasing a lease that is not
+	// held by the owner is a nop.
+	Release(id, owner string) error
+}
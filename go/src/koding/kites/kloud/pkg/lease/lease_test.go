@@ -0,0 +1,170 @@
+package lease_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"koding/kites/kloud/pkg/lease"
+)
+
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) Add(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func TestMemory(t *testing.T) {
+	c := &clock{now: time.Date(2016, 1, 1, 0, 0, 0, 0, time.UTC)}
+	m := lease.NewMemory()
+	m.Now = c.Now
+
+	if _, err := m.Acquire("machine", "kloud1", time.Minute); err != nil {
+		t.Fatalf("Acquire()=%s", err)
+	}
+
+	if _, err := m.Acquire("machine", "kloud2", time.Minute); err != lease.ErrLocked {
+		t.Fatalf("got %v, want %v", err, lease.ErrLocked)
+	}
+
+	if _, err := m.Renew("machine", "kloud2", time.Minute); err != lease.ErrNotHeld {
+		t.Fatalf("got %v, want %v", err, lease.ErrNotHeld)
+	}
+
+	c.Add(30 * time.Second)
+
+	l, err := m.Renew("machine", "kloud1", time.Minute)
+	if err != nil {
+		t.Fatalf("Renew()=%s", err)
+	}
+
+	if want := c.Now().Add(time.Minute); !l.ExpiresAt.Equal(want) {
+		t.Fatalf("got %s, want %s", l.ExpiresAt, want)
+	}
+
+	// kloud1 crashed and has not renewed the lease
+	c.Add(time.Minute)
+
+	if _, err := m.Renew("machine", "kloud1", time.Minute); err != lease.ErrNotHeld {
+		t.Fatalf("got %v, want %v", err, lease.ErrNotHeld)
+	}
+
+	if _, err := m.Acquire("machine", "kloud2", time.Minute); err != nil {
+		t.Fatalf("Acquire()=%s", err)
+	}
+
+	// releasing by non-owner must not release the lease
+	if err := m.Release("machine", "kloud1"); err != nil {
+		t.Fatalf("Release()=%s", err)
+	}
+
+	if _, err := m.Acquire("machine", "kloud1", time.Minute); err != lease.ErrLocked {
+		t.Fatalf("got %v, want %v", err, lease.ErrLocked)
+	}
+
+	if err := m.Release("machine", "kloud2"); err != nil {
+		t.Fatalf("Release()=%s", err)
+	}
+
+	if _, err := m.Acquire("machine", "kloud1", time.Minute); err != nil {
+		t.Fatalf("Acquire()=%s", err)
+	}
+}
+
+func TestLocker(t *testing.T) {
+	backend := lease.NewMemory()
+
+	l1 := &lease.Locker{Backend: backend, Owner: "kloud1", TTL: 150 * time.Millisecond}
+	l2 := &lease.Locker{Backend: backend, Owner: "kloud2", TTL: 150 * time.Millisecond}
+
+	if err := l1.Lock("machine"); err != nil {
+		t.Fatalf("Lock()=%s", err)
+	}
+
+	if err := l1.Lock("machine"); err != lease.ErrLocked {
+		t.Fatalf("got %v, want %v", err, lease.ErrLocked)
+	}
+
+	// the lease must be kept alive by heartbeats
+	time.Sleep(500 * time.Millisecond)
+
+	if err := l2.Lock("machine"); err != lease.ErrLocked {
+		t.Fatalf("got %v, want %v", err, lease.ErrLocked)
+	}
+
+	l1.Unlock("machine")
+
+	if err := l2.Lock("machine"); err != nil {
+		t.Fatalf("Lock()=%s", err)
+	}
+
+	l2.Unlock("machine")
+}
+
+type slowBackend struct {
+	lease.Backend
+	slow    string
+	release chan struct{}
+}
+
+func (b *slowBackend) Acquire(id, owner string, ttl time.Duration) (*lease.Lease, error) {
+	if id == b.slow {
+		<-b.release
+	}
+
+	return b.Backend.Acquire(id, owner, ttl)
+}
+
+func TestLockerConcurrent(t *testing.T) {
+	backend := &slowBackend{
+		Backend: lease.NewMemory(),
+		slow:    "slow",
+		release: make(chan struct{}),
+	}
+
+	l := &lease.Locker{Backend: backend, Owner: "kloud1"}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- l.Lock("slow")
+	}()
+
+	// Lock of other id must not wait for the pending backend call.
+	fast := make(chan error, 1)
+	go func() {
+		fast <- l.Lock("fast")
+	}()
+
+	select {
+	case err := <-fast:
+		if err != nil {
+			t.Fatalf("Lock()=%s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Lock() is blocked by other pending lock")
+	}
+
+	close(backend.release)
+
+	if err := <-done; err != nil {
+		t.Fatalf("Lock()=%s", err)
+	}
+
+	if err := l.Lock("slow"); err != lease.ErrLocked {
+		t.Fatalf("got %v, want %v", err, lease.ErrLocked)
+	}
+
+	l.Unlock("slow")
+	l.Unlock("fast")
+}
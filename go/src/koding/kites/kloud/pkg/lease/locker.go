@@ -0,0 +1,147 @@
+package lease
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/koding/logging"
+	"github.com/satori/go.uuid"
+)
+
+// DefaultTTL is a default lease duration used by Locker.
+const DefaultTTL = 2 * time.Minute
+
+// Locker is a distributed locker built on top of a lease Backend.
+//
+// For every lock it holds, it runs a heartbeat goroutine that renews
+// the lease every TTL/3. If the process holding the lock dies,
+// the heartbeats stop and the lease expires after TTL.
+type Locker struct {
+	Backend Backend
+	Owner   string        // if empty, NewOwner() is used
+	TTL     time.Duration // if zero, DefaultTTL is used
+	Log     logging.Logger
+
+	once sync.Once
+	mu   sync.Mutex
+	held map[string]chan struct{}
+}
+
+// NewOwner gives an unique owner identity for the current process.
+func NewOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), uuid.NewV4().String())
+}
+
+// Lock acquires a lease with the given id and starts renewing it until
+// Unlock is called. If the lease is held by other owner, or it is already
+// held by this locker, it returns ErrLocked.
+func (l *Locker) Lock(id string) error {
+	l.init()
+
+	l.mu.Lock()
+	if _, ok := l.held[id]; ok {
+		l.mu.Unlock()
+		return ErrLocked
+	}
+
+	// The id is reserved before calling the backend, so concurrent
+	// locks of the same id fail fast, while locks of other ids
+	// do not wait for the backend call.
+	stop := make(chan struct{})
+	l.held[id] = stop
+	l.mu.Unlock()
+
+	if _, err := l.Backend.Acquire(id, l.Owner, l.TTL); err != nil {
+		l.mu.Lock()
+		if l.held[id] == stop {
+			delete(l.held, id)
+		}
+		l.mu.Unlock()
+
+		return err
+	}
+
+	go l.heartbeat(id, stop)
+
+	return nil
+}
+
+// Unlock stops renewing the lease with the given id and releases it.
+func (l *Locker) Unlock(id string) {
+	l.init()
+
+	l.mu.Lock()
+	stop, ok := l.held[id]
+	delete(l.held, id)
+	l.mu.Unlock()
+
+	if ok {
+		close(stop)
+	}
+
+	if err := l.Backend.Release(id, l.Owner); err != nil {
+		l.log().Error("unable to release lease %q: %s", id, err)
+	}
+}
+
+func (l *Locker) heartbeat(id string, stop <-chan struct{}) {
+	t := time.NewTicker(l.TTL / 3)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+			if _, err := l.Backend.Renew(id, l.Owner, l.TTL); err != nil {
+				// If renewing failed due to transient backend error,
+				// we still may make it before the lease expires.
+				if err != ErrNotHeld {
+					l.log().Warning("unable to renew lease %q: %s", id, err)
+					continue
+				}
+
+				l.log().Error("lease %q was lost", id)
+
+				l.mu.Lock()
+				if l.held[id] == stop {
+					delete(l.held, id)
+				}
+				l.mu.Unlock()
+
+				return
+			}
+		}
+	}
+}
+
+func (l *Locker) init() {
+	l.once.Do(func() {
+		if l.Owner == "" {
+			l.Owner = NewOwner()
+		}
+
+		if l.TTL == 0 {
+			l.TTL = DefaultTTL
+		}
+
+		l.held = make(map[string]chan struct{})
+	})
+}
+
+func (l *Locker) log() logging.Logger {
+	if l.Log != nil {
+		return l.Log
+	}
+
+	return defaultLog
+}
+
+var defaultLog = logging.NewLogger("lease")
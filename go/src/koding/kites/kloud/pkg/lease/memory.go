@@ -0,0 +1,87 @@
+package lease
+
+import (
+	"sync"
+	"time"
+)
+
+// Memory is an in-memory lease backend, used by tests and by
+// single-instance deployments.
+type Memory struct {
+	// Now returns current time. If nil, time.Now is used.
+	Now func() time.Time
+
+	mu     sync.Mutex
+	leases map[string]*Lease
+}
+
+var _ Backend = (*Memory)(nil)
+
+// NewMemory gives new, empty in-memory backend.
+func NewMemory() *Memory {
+	return &Memory{
+		leases: make(map[string]*Lease),
+	}
+}
+
+// Acquire implements the Backend interface.
+func (m *Memory) Acquire(id, owner string, ttl time.Duration) (*Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+
+	if l, ok := m.leases[id]; ok && !l.Expired(now) {
+		return nil, ErrLocked
+	}
+
+	l := &Lease{
+		ID:         id,
+		Owner:      owner,
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(ttl),
+	}
+
+	m.leases[id] = l
+
+	lCopy := *l
+	return &lCopy, nil
+}
+
+// Renew implements the Backend interface.
+func (m *Memory) Renew(id, owner string, ttl time.Duration) (*Lease, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+
+	l, ok := m.leases[id]
+	if !ok || l.Owner != owner || l.Expired(now) {
+		return nil, ErrNotHeld
+	}
+
+	l.ExpiresAt = now.Add(ttl)
+
+	lCopy := *l
+	return &lCopy, nil
+}
+
+// Release implements the Backend interface.
+func (m *Memory) Release(id, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if l, ok := m.leases[id]; ok && l.Owner == owner {
+		delete(m.leases, id)
+	}
+
+	return nil
+}
+
+func (m *Memory) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
+	}
+
+	return time.Now()
+}
@@ -0,0 +1,130 @@
+package lease
+
+import (
+	"time"
+
+	"koding/db/mongodb"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// DefaultCollection is the collection used by MongoDB backend when
+// none is configured.
+const DefaultCollection = "jLeases"
+
+// MongoDB is a lease backend that stores leases in a MongoDB collection,
+// one document per lease id.
+type MongoDB struct {
+	DB         *mongodb.MongoDB
+	Collection string // if empty, DefaultCollection is used
+}
+
+var _ Backend = (*MongoDB)(nil)
+
+// NewMongoDB gives new MongoDB backend that uses the default collection.
+func NewMongoDB(db *mongodb.MongoDB) *MongoDB {
+	return &MongoDB{
+		DB: db,
+	}
+}
+
+// Acquire implements the Backend interface.
+//
+// The lease document is upserted only if it does not exist or it
+// expired. When other owner holds the lease the query does not match,
+// the upsert tries to insert a document with already existing _id
+// and fails with duplicate key error, which is translated to ErrLocked.
+func (m *MongoDB) Acquire(id, owner string, ttl time.Duration) (*Lease, error) {
+	now := time.Now().UTC()
+	l := &Lease{}
+
+	err := m.DB.Run(m.collection(), func(c *mgo.Collection) error {
+		change := mgo.Change{
+			Update: bson.M{
+				"$set": bson.M{
+					"owner":      owner,
+					"acquiredAt": now,
+					"expiresAt":  now.Add(ttl),
+				},
+			},
+			Upsert:    true,
+			ReturnNew: true,
+		}
+
+		query := bson.M{
+			"_id":       id,
+			"expiresAt": bson.M{"$lte": now},
+		}
+
+		_, err := c.Find(query).Apply(change, l)
+		return err
+	})
+
+	if mgo.IsDup(err) {
+		return nil, ErrLocked
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Renew implements the Backend interface.
+func (m *MongoDB) Renew(id, owner string, ttl time.Duration) (*Lease, error) {
+	now := time.Now().UTC()
+	l := &Lease{}
+
+	err := m.DB.Run(m.collection(), func(c *mgo.Collection) error {
+		change := mgo.Change{
+			Update: bson.M{
+				"$set": bson.M{
+					"expiresAt": now.Add(ttl),
+				},
+			},
+			ReturnNew: true,
+		}
+
+		query := bson.M{
+			"_id":       id,
+			"owner":     owner,
+			"expiresAt": bson.M{"$gt": now},
+		}
+
+		_, err := c.Find(query).Apply(change, l)
+		return err
+	})
+
+	if err == mgo.ErrNotFound {
+		return nil, ErrNotHeld
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// Release implements the Backend interface.
+func (m *MongoDB) Release(id, owner string) error {
+	err := m.DB.Run(m.collection(), func(c *mgo.Collection) error {
+		return c.Remove(bson.M{"_id": id, "owner": owner})
+	})
+
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+
+	return err
+}
+
+func (m *MongoDB) collection() string {
+	if m.Collection != "" {
+		return m.Collection
+	}
+
+	return DefaultCollection
+}
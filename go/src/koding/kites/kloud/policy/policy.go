@@ -0,0 +1,441 @@
+// Package policy validates stack templates against group policies.
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"koding/db/models"
+)
+
+// Rules reported by violations.
+const (
+	RuleProvider     = "provider"
+	RuleInstanceType = "instanceType"
+	RuleRegion       = "region"
+	RuleCount        = "count"
+	RuleMaxInstances = "maxInstances"
+	RuleTags         = "tags"
+)
+
+// Template is a stack template validated by a policy, e.g. *stackplan.Template.
+type Template interface {
+	DecodeProvider(interface{}) error
+	DecodeResource(interface{}) error
+	DecodeVariable(interface{}) error
+}
+
+// Violation describes a single policy rule a template does not follow.
+type Violation struct {
+	// Rule is one of the Rule* constants.
+	Rule string `json:"rule"`
+
+	// Resource is a name of the offending resource or provider,
+	// e.g. "aws_instance.example" or "provider.aws".
+	Resource string `json:"resource,omitempty"`
+
+	// Message describes the violation.
+	Message string `json:"message"`
+}
+
+// Error is returned when a template violates a policy.
+type Error struct {
+	Violations []*Violation
+}
+
+// Error implements the built-in error interface.
+func (e *Error) Error() string {
+	msgs := make([]string, len(e.Violations))
+
+	for i, v := range e.Violations {
+		msgs[i] = v.Message
+	}
+
+	return "stack template violates group policy: " + strings.Join(msgs, "; ")
+}
+
+// Check returns non-nil *Error if the violations list is not empty.
+func Check(violations []*Violation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+
+	return &Error{Violations: violations}
+}
+
+// Policy validates templates against a group stack policy.
+type Policy struct {
+	*models.StackPolicy
+}
+
+// New gives a policy for the given group. If the group has no stack
+// policy configured, the returned policy allows everything.
+func New(group *models.Group) *Policy {
+	p := group.StackPolicy
+	if p == nil {
+		p = &models.StackPolicy{}
+	}
+
+	return &Policy{StackPolicy: p}
+}
+
+// ValidateProvider gives a violation if the provider is not allowed.
+func (p *Policy) ValidateProvider(resource, provider string) *Violation {
+	if len(p.Providers) == 0 || contains(p.Providers, provider) {
+		return nil
+	}
+
+	return &Violation{
+		Rule:     RuleProvider,
+		Resource: resource,
+		Message:  fmt.Sprintf("%s: provider %q is not allowed", resource, provider),
+	}
+}
+
+// ValidateRegion gives a violation if the region is not allowed.
+func (p *Policy) ValidateRegion(resource, region string) *Violation {
+	if len(p.Regions) == 0 || contains(p.Regions, region) {
+		return nil
+	}
+
+	return &Violation{
+		Rule:     RuleRegion,
+		Resource: resource,
+		Message:  fmt.Sprintf("%s: region %q is not allowed", resource, region),
+	}
+}
+
+// Validate evaluates all the policy rules for the template and
+// gives every violation found.
+//
+// Values set with a ${var.name} interpolation are read from
+// the variable default value. Values which can not be read,
+// are reported as violations only if the rule for the value
+// is configured.
+func (p *Policy) Validate(t Template) ([]*Violation, error) {
+	var (
+		providers map[string]interface{}
+		resources map[string]map[string]map[string]interface{}
+		variables map[string]map[string]interface{}
+	)
+
+	if err := t.DecodeProvider(&providers); err != nil {
+		return nil, err
+	}
+
+	if err := t.DecodeResource(&resources); err != nil {
+		return nil, err
+	}
+
+	if err := t.DecodeVariable(&variables); err != nil {
+		return nil, err
+	}
+
+	e := &evaluator{
+		Policy:    p,
+		variables: variables,
+	}
+
+	used := make(map[string]struct{})
+
+	for _, name := range sortedKeys(providers) {
+		used[name] = struct{}{}
+
+		e.add(p.ValidateProvider("provider."+name, name))
+	}
+
+	var instances int
+
+	for _, typ := range sortedKeys(resources) {
+		provider := typ
+		if i := strings.IndexRune(typ, '_'); i != -1 {
+			provider = typ[:i]
+		}
+
+		for _, name := range sortedKeys(resources[typ]) {
+			res := resources[typ][name]
+			resource := typ + "." + name
+
+			used[provider] = struct{}{}
+
+			e.add(p.ValidateProvider(resource, provider))
+
+			count := e.count(resource, res)
+
+			if strings.HasSuffix(typ, "_instance") {
+				instances += count
+			}
+
+			if typ == "aws_instance" {
+				e.instanceType(resource, res)
+				e.tags(resource, res)
+			}
+		}
+	}
+
+	if p.MaxInstances > 0 && instances > p.MaxInstances {
+		e.add(&Violation{
+			Rule:    RuleMaxInstances,
+			Message: fmt.Sprintf("stack has %d instances, maximum allowed is %d", instances, p.MaxInstances),
+		})
+	}
+
+	for _, name := range sortedKeys(used) {
+		e.region(name, providers[name])
+	}
+
+	return e.violations, nil
+}
+
+var varRe = regexp.MustCompile(`^\$\{var\.([^}]+)\}$`)
+
+type evaluator struct {
+	*Policy
+	variables  map[string]map[string]interface{}
+	violations []*Violation
+}
+
+func (e *evaluator) add(v *Violation) {
+	if v != nil {
+		e.violations = append(e.violations, v)
+	}
+}
+
+// resolve gives a value of v, reading variable default if v
+// is an interpolation.
+func (e *evaluator) resolve(v interface{}) (interface{}, bool) {
+	s, ok := v.(string)
+	if !ok {
+		return v, v != nil
+	}
+
+	if m := varRe.FindStringSubmatch(s); m != nil {
+		def, ok := e.variables[m[1]]["default"]
+		if !ok {
+			return nil, false
+		}
+
+		if s, ok := def.(string); ok && strings.Contains(s, "${") {
+			return nil, false
+		}
+
+		return def, true
+	}
+
+	if strings.Contains(s, "${") {
+		return nil, false
+	}
+
+	return s, true
+}
+
+func (e *evaluator) count(resource string, res map[string]interface{}) int {
+	v, ok := res["count"]
+	if !ok {
+		return 1
+	}
+
+	n, ok := e.resolveInt(v)
+	if !ok {
+		if e.MaxCount > 0 || e.MaxInstances > 0 {
+			e.add(&Violation{
+				Rule:     RuleCount,
+				Resource: resource,
+				Message:  fmt.Sprintf("%s: unable to read count: %v", resource, v),
+			})
+		}
+		return 1
+	}
+
+	if e.MaxCount > 0 && n > e.MaxCount {
+		e.add(&Violation{
+			Rule:     RuleCount,
+			Resource: resource,
+			Message:  fmt.Sprintf("%s: count %d exceeds maximum of %d", resource, n, e.MaxCount),
+		})
+	}
+
+	return n
+}
+
+func (e *evaluator) instanceType(resource string, res map[string]interface{}) {
+	if len(e.InstanceTypes) == 0 {
+		return
+	}
+
+	v, ok := e.resolve(res["instance_type"])
+	typ, isString := v.(string)
+
+	switch {
+	case !ok || !isString:
+		e.add(&Violation{
+			Rule:     RuleInstanceType,
+			Resource: resource,
+			Message:  fmt.Sprintf("%s: unable to read instance type: %v", resource, res["instance_type"]),
+		})
+	case !contains(e.InstanceTypes, typ):
+		e.add(&Violation{
+			Rule:     RuleInstanceType,
+			Resource: resource,
+			Message:  fmt.Sprintf("%s: instance type %q is not allowed", resource, typ),
+		})
+	}
+}
+
+func (e *evaluator) tags(resource string, res map[string]interface{}) {
+	if len(e.RequiredTags) == 0 {
+		return
+	}
+
+	tags := make(map[string]struct{})
+
+	for _, block := range blocks(res["tags"]) {
+		for k := range block {
+			tags[k] = struct{}{}
+		}
+	}
+
+	var missing []string
+
+	for _, tag := range e.RequiredTags {
+		if _, ok := tags[tag]; !ok {
+			missing = append(missing, tag)
+		}
+	}
+
+	if len(missing) != 0 {
+		e.add(&Violation{
+			Rule:     RuleTags,
+			Resource: resource,
+			Message:  fmt.Sprintf("%s: missing required tags: %s", resource, strings.Join(missing, ", ")),
+		})
+	}
+}
+
+// region validates regions of the given provider, which are read either
+// from the provider blocks or from the <provider>_region variable.
+//
+// Each aliased provider block is validated separately, as the
+// provider.<name>.<alias> resource.
+func (e *evaluator) region(provider string, block interface{}) {
+	if len(e.Regions) == 0 {
+		return
+	}
+
+	b := blocks(block)
+	if len(b) == 0 {
+		b = []map[string]interface{}{{}}
+	}
+
+	for _, block := range b {
+		resource := "provider." + provider
+
+		if alias, ok := block["alias"].(string); ok && alias != "" {
+			resource += "." + alias
+		}
+
+		v, ok := block["region"]
+		if !ok {
+			def, ok := e.variables[provider+"_region"]["default"]
+			if !ok {
+				continue // provider does not support regions
+			}
+
+			v = def
+		}
+
+		region, ok := e.resolve(v)
+		s, isString := region.(string)
+
+		if !ok || !isString {
+			e.add(&Violation{
+				Rule:     RuleRegion,
+				Resource: resource,
+				Message:  fmt.Sprintf("%s: unable to read region: %v", resource, v),
+			})
+			continue
+		}
+
+		e.add(e.ValidateRegion(resource, s))
+	}
+}
+
+func (e *evaluator) resolveInt(v interface{}) (int, bool) {
+	v, ok := e.resolve(v)
+	if !ok {
+		return 0, false
+	}
+
+	switch v := v.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	case string:
+		n, err := strconv.Atoi(v)
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// blocks gives a list of nested blocks, like tags of an aws_instance.
+func blocks(v interface{}) []map[string]interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{v}
+	case []map[string]interface{}:
+		return v
+	case []interface{}:
+		var m []map[string]interface{}
+		for _, v := range v {
+			if block, ok := v.(map[string]interface{}); ok {
+				m = append(m, block)
+			}
+		}
+		return m
+	default:
+		return nil
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+
+	switch m := m.(type) {
+	case map[string]interface{}:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]struct{}:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]map[string]interface{}:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]map[string]map[string]interface{}:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
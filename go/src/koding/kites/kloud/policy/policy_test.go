@@ -0,0 +1,197 @@
+package policy_test
+
+import (
+	"reflect"
+	"testing"
+
+	"koding/db/models"
+	"koding/kites/kloud/policy"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/json/parser"
+)
+
+// template mimics stackplan.Template, which can't be used here
+// due to terraform plugins failing to initialize in tests.
+type template struct {
+	node *ast.ObjectList
+}
+
+func parseTemplate(t *testing.T, content string) *template {
+	file, err := parser.Parse([]byte(content))
+	if err != nil {
+		t.Fatalf("Parse()=%s", err)
+	}
+
+	return &template{node: file.Node.(*ast.ObjectList)}
+}
+
+func (t *template) DecodeProvider(out interface{}) error {
+	return hcl.DecodeObject(out, t.filter("provider"))
+}
+
+func (t *template) DecodeResource(out interface{}) error {
+	return hcl.DecodeObject(out, t.filter("resource"))
+}
+
+func (t *template) DecodeVariable(out interface{}) error {
+	return hcl.DecodeObject(out, t.filter("variable"))
+}
+
+func (t *template) filter(key string) *ast.ObjectList {
+	list := &ast.ObjectList{}
+
+	for _, item := range t.node.Filter(key).Items {
+		if obj, ok := item.Val.(*ast.ObjectType); ok && len(item.Keys) == 0 {
+			list.Items = append(list.Items, obj.List.Items...)
+		} else {
+			list.Items = append(list.Items, item)
+		}
+	}
+
+	return list
+}
+
+const testTemplate = `{
+  "provider": {
+    "aws": {
+      "region": "${var.aws_region}"
+    }
+  },
+  "variable": {
+    "aws_region": {
+      "default": "eu-west-1"
+    },
+    "userInput_count": {
+      "default": "5"
+    }
+  },
+  "resource": {
+    "aws_instance": {
+      "web": {
+        "instance_type": "t2.micro",
+        "count": "${var.userInput_count}",
+        "tags": {
+          "Name": "web",
+          "team": "koding"
+        }
+      },
+      "db": {
+        "instance_type": "m4.xlarge",
+        "tags": {
+          "Name": "db"
+        }
+      }
+    },
+    "google_compute_instance": {
+      "vm": {}
+    }
+  }
+}`
+
+func TestValidate(t *testing.T) {
+	p := policy.New(&models.Group{
+		StackPolicy: &models.StackPolicy{
+			Providers:     []string{"aws"},
+			InstanceTypes: []string{"t2.micro", "t2.small"},
+			Regions:       []string{"us-east-1"},
+			MaxCount:      3,
+			MaxInstances:  4,
+			RequiredTags:  []string{"team"},
+		},
+	})
+
+	got, err := p.Validate(parseTemplate(t, testTemplate))
+	if err != nil {
+		t.Fatalf("Validate()=%s", err)
+	}
+
+	// Messages are checked to be non-empty only.
+	want := []*policy.Violation{
+		{Rule: policy.RuleInstanceType, Resource: "aws_instance.db"},
+		{Rule: policy.RuleTags, Resource: "aws_instance.db"},
+		{Rule: policy.RuleCount, Resource: "aws_instance.web"},
+		{Rule: policy.RuleProvider, Resource: "google_compute_instance.vm"},
+		{Rule: policy.RuleMaxInstances},
+		{Rule: policy.RuleRegion, Resource: "provider.aws"},
+	}
+
+	for _, v := range got {
+		if v.Message == "" {
+			t.Errorf("%+v: empty message", v)
+		}
+		v.Message = ""
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		for i, v := range got {
+			t.Logf("got[%d]: %+v", i, v)
+		}
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	if err := policy.Check(got); err == nil {
+		t.Fatal("want non-nil error")
+	}
+}
+
+func TestValidateNoPolicy(t *testing.T) {
+	p := policy.New(&models.Group{})
+
+	got, err := p.Validate(parseTemplate(t, testTemplate))
+	if err != nil {
+		t.Fatalf("Validate()=%s", err)
+	}
+
+	if err := policy.Check(got); err != nil {
+		t.Fatalf("Check()=%s", err)
+	}
+}
+
+func TestValidateRegions(t *testing.T) {
+	const content = `{
+  "provider": {
+    "aws": [{
+      "region": "${var.aws_region}"
+    }, {
+      "alias": "eu",
+      "region": "eu-west-1"
+    }, {
+      "alias": "west",
+      "region": "us-west-2"
+    }]
+  },
+  "variable": {
+    "aws_region": {
+      "default": "us-east-1"
+    }
+  },
+  "resource": {
+    "aws_instance": {
+      "web": {
+        "provider": "aws.eu"
+      }
+    }
+  }
+}`
+
+	p := policy.New(&models.Group{
+		StackPolicy: &models.StackPolicy{
+			Regions: []string{"us-east-1", "us-west-2"},
+		},
+	})
+
+	got, err := p.Validate(parseTemplate(t, content))
+	if err != nil {
+		t.Fatalf("Validate()=%s", err)
+	}
+
+	if len(got) != 1 {
+		t.Fatalf("got %d violations, want 1: %+v", len(got), got)
+	}
+
+	if got[0].Rule != policy.RuleRegion || got[0].Resource != "provider.aws.eu" {
+		t.Fatalf("got %+v, want region violation for provider.aws.eu", got[0])
+	}
+}
@@ -0,0 +1,41 @@
+package pricing
+
+import (
+	"fmt"
+
+	"koding/db/models"
+)
+
+// BudgetError is returned by CheckBudget when the estimated cost of
+// a stack exceeds the group budget.
+type BudgetError struct {
+	Group    string
+	Currency string
+	Limit    float64
+	Estimate float64
+}
+
+// Error implements the built-in error interface.
+func (e *BudgetError) Error() string {
+	return fmt.Sprintf("estimated monthly cost %.2f %s exceeds the budget of %q group: %.2f %s",
+		e.Estimate, e.Currency, e.Group, e.Limit, e.Currency)
+}
+
+// CheckBudget returns non-nil error when the estimate goes over the monthly
+// budget of the given group. Groups with no budget set are not limited.
+func CheckBudget(group *models.Group, e *Estimate) error {
+	if group.Budget == nil || group.Budget.MonthlyLimit <= 0 {
+		return nil
+	}
+
+	if e.Monthly <= group.Budget.MonthlyLimit {
+		return nil
+	}
+
+	return &BudgetError{
+		Group:    group.Slug,
+		Currency: e.Currency,
+		Limit:    group.Budget.MonthlyLimit,
+		Estimate: e.Monthly,
+	}
+}
@@ -0,0 +1,419 @@
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Template is a stack template which resources can be estimated,
+// e.g. *stackplan.Template.
+type Template interface {
+	DecodeResource(interface{}) error
+	DecodeVariable(interface{}) error
+}
+
+var varRe = regexp.MustCompile(`^\$\{var\.([^}]+)\}$`)
+
+// DefaultRootVolumeSize is a size in GB of the root volume of an instance,
+// which does not set it explicitly.
+const DefaultRootVolumeSize = 8
+
+// DefaultVolumeType is an EBS volume type used by terraform when
+// a volume does not set it explicitly.
+const DefaultVolumeType = "standard"
+
+// Estimate is an estimated monthly cost of a stack template.
+type Estimate struct {
+	Currency string  `json:"currency"`
+	Region   string  `json:"region"`
+	Monthly  float64 `json:"monthly"`
+
+	// Resources lists costs of each resource, sorted by name.
+	Resources []*ResourceCost `json:"resources,omitempty"`
+
+	// Incomplete is true when at least one of the resources could not
+	// be priced, e.g. its instance type is read from a variable.
+	Incomplete bool `json:"incomplete,omitempty"`
+}
+
+// ResourceCost is an estimated monthly cost of a single resource.
+type ResourceCost struct {
+	// Name is a full name of the resource, e.g. "aws_instance.example".
+	Name string `json:"name"`
+
+	// Count is a number of the resource instances.
+	Count int `json:"count"`
+
+	// Monthly is a total cost for all the resource instances.
+	Monthly float64 `json:"monthly"`
+
+	// Description tells what the cost is made of, e.g. "t2.micro, 8 GB standard".
+	Description string `json:"description,omitempty"`
+
+	// Region is set when the resource is priced in other region
+	// than the one of the estimate.
+	Region string `json:"region,omitempty"`
+
+	// Error is set when the resource could not be priced.
+	Error string `json:"error,omitempty"`
+}
+
+// RegionFunc gives a region of the given resource, e.g. the region of
+// the provider the resource is created with. Empty region means
+// the default one.
+type RegionFunc func(name string, resource map[string]interface{}) (string, error)
+
+// Estimate gives a monthly cost of aws_instance, aws_ebs_volume and aws_eip
+// resources of the given template, when created in the given region.
+//
+// Values read from variables are resolved to the variable defaults.
+// Resources which prices can not be determined, e.g. due to unknown
+// region, are reported with an error and do not count towards the
+// total cost.
+func (t *Table) Estimate(tmpl Template, region string) (*Estimate, error) {
+	return t.EstimateFunc(tmpl, region, nil)
+}
+
+// EstimateFunc works like Estimate, but it prices each resource in
+// the region given by fn. If fn is nil, or it returns empty region,
+// the given default region is used.
+func (t *Table) EstimateFunc(tmpl Template, region string, fn RegionFunc) (*Estimate, error) {
+	var resource struct {
+		AwsInstance  map[string]map[string]interface{} `hcl:"aws_instance"`
+		AwsEBSVolume map[string]map[string]interface{} `hcl:"aws_ebs_volume"`
+		AwsEIP       map[string]map[string]interface{} `hcl:"aws_eip"`
+	}
+
+	if err := tmpl.DecodeResource(&resource); err != nil {
+		return nil, err
+	}
+
+	var vars variables
+
+	if err := tmpl.DecodeVariable(&vars); err != nil {
+		return nil, err
+	}
+
+	e := &Estimate{
+		Currency: t.Currency,
+		Region:   region,
+	}
+
+	est := &estimator{
+		Table:      t,
+		variables:  vars,
+		region:     region,
+		regionFunc: fn,
+	}
+
+	for name, instance := range resource.AwsInstance {
+		e.add(est.price("aws_instance."+name, instance, est.instance))
+	}
+
+	for name, volume := range resource.AwsEBSVolume {
+		e.add(est.price("aws_ebs_volume."+name, volume, est.volume))
+	}
+
+	for name, eip := range resource.AwsEIP {
+		e.add(est.price("aws_eip."+name, eip, est.eip))
+	}
+
+	sort.Sort(byName(e.Resources))
+
+	e.Monthly = round(e.Monthly)
+
+	return e, nil
+}
+
+func (e *Estimate) add(rc *ResourceCost) {
+	if rc.Error != "" {
+		e.Incomplete = true
+	}
+
+	rc.Monthly = round(rc.Monthly)
+
+	e.Monthly += rc.Monthly
+	e.Resources = append(e.Resources, rc)
+}
+
+// variables maps variable names to their attributes, like "default".
+type variables map[string]map[string]interface{}
+
+// resolve gives the value with variable reference replaced by the
+// variable default. It returns false if the value can't be resolved.
+func (v variables) resolve(value interface{}) (interface{}, bool) {
+	s, ok := value.(string)
+	if !ok {
+		return value, true
+	}
+
+	if m := varRe.FindStringSubmatch(s); m != nil {
+		def, ok := v[m[1]]["default"]
+		if !ok {
+			return nil, false
+		}
+
+		if s, ok := def.(string); ok && isInterpolated(s) {
+			return nil, false
+		}
+
+		return def, true
+	}
+
+	return s, !isInterpolated(s)
+}
+
+// estimator prices resources of a single template.
+type estimator struct {
+	*Table
+
+	variables  variables
+	region     string     // default region
+	regionFunc RegionFunc // may be nil
+
+	prices *Region // of the priced resource, nil for unknown region
+	err    string  // reported for the priced resource when prices is nil
+}
+
+// priceFunc prices a single resource.
+type priceFunc func(name string, resource map[string]interface{}) *ResourceCost
+
+// price prices the given resource with fn, in the region of the resource.
+func (e *estimator) price(name string, resource map[string]interface{}, fn priceFunc) *ResourceCost {
+	region := e.region
+
+	if e.regionFunc != nil {
+		r, err := e.regionFunc(name, resource)
+		if err != nil {
+			return &ResourceCost{
+				Name:  name,
+				Error: err.Error(),
+			}
+		}
+
+		if r != "" {
+			region = r
+		}
+	}
+
+	if prices, ok := e.Regions[region]; ok {
+		e.prices, e.err = prices, ""
+	} else {
+		e.prices, e.err = nil, fmt.Sprintf("no prices for %q region", region)
+	}
+
+	rc := fn(name, resource)
+
+	if region != e.region {
+		rc.Region = region
+	}
+
+	return rc
+}
+
+func (e *estimator) instance(name string, instance map[string]interface{}) *ResourceCost {
+	rc := &ResourceCost{
+		Name: name,
+	}
+
+	if err := e.count(rc, instance); err != nil {
+		return rc
+	}
+
+	v, _ := e.variables.resolve(instance["instance_type"])
+	typ, ok := v.(string)
+	if !ok || typ == "" {
+		rc.Error = "unable to read instance type"
+		return rc
+	}
+
+	hourly, ok := e.prices.Instances[typ]
+	if !ok {
+		rc.Error = fmt.Sprintf("no price for %q instance type", typ)
+		return rc
+	}
+
+	var monthly float64
+	desc := []string{typ}
+
+	// Price the root volume and all the additional EBS volumes
+	// of the instance.
+	volumes := blocks(instance["root_block_device"])
+	if len(volumes) == 0 {
+		volumes = []map[string]interface{}{{}}
+	}
+
+	for i, vol := range volumes {
+		if i == 0 && vol["volume_size"] == nil {
+			vol["volume_size"] = DefaultRootVolumeSize
+		}
+
+		cost, d, err := e.volumeCost(vol, "volume_size", "volume_type")
+		if err != nil {
+			rc.Error = err.Error()
+			return rc
+		}
+
+		monthly += cost
+		desc = append(desc, d)
+	}
+
+	for _, vol := range blocks(instance["ebs_block_device"]) {
+		cost, d, err := e.volumeCost(vol, "volume_size", "volume_type")
+		if err != nil {
+			rc.Error = err.Error()
+			return rc
+		}
+
+		monthly += cost
+		desc = append(desc, d)
+	}
+
+	monthly += hourly * e.HoursPerMonth
+
+	rc.Monthly = monthly * float64(rc.Count)
+	rc.Description = strings.Join(desc, ", ")
+
+	return rc
+}
+
+func (e *estimator) volume(name string, volume map[string]interface{}) *ResourceCost {
+	rc := &ResourceCost{
+		Name: name,
+	}
+
+	if err := e.count(rc, volume); err != nil {
+		return rc
+	}
+
+	cost, desc, err := e.volumeCost(volume, "size", "type")
+	if err != nil {
+		rc.Error = err.Error()
+		return rc
+	}
+
+	rc.Monthly = cost * float64(rc.Count)
+	rc.Description = desc
+
+	return rc
+}
+
+func (e *estimator) eip(name string, eip map[string]interface{}) *ResourceCost {
+	rc := &ResourceCost{
+		Name:        name,
+		Description: "Elastic IP",
+	}
+
+	if err := e.count(rc, eip); err != nil {
+		return rc
+	}
+
+	rc.Monthly = e.prices.EIP * e.HoursPerMonth * float64(rc.Count)
+
+	return rc
+}
+
+func (e *estimator) volumeCost(vol map[string]interface{}, sizeKey, typeKey string) (float64, string, error) {
+	v, _ := e.variables.resolve(vol[sizeKey])
+	size, ok := toInt(v)
+	if !ok {
+		return 0, "", fmt.Errorf("unable to read volume size: %v", vol[sizeKey])
+	}
+
+	typ := DefaultVolumeType
+	if s, ok := vol[typeKey].(string); ok && s != "" {
+		v, _ := e.variables.resolve(s)
+		if typ, ok = v.(string); !ok || typ == "" {
+			return 0, "", fmt.Errorf("unable to read volume type: %s", s)
+		}
+	}
+
+	price, ok := e.prices.EBS[typ]
+	if !ok {
+		return 0, "", fmt.Errorf("no price for %q volume type", typ)
+	}
+
+	return price * float64(size), fmt.Sprintf("%d GB %s", size, typ), nil
+}
+
+// count reads the count of the resource, setting rc.Error on failure.
+// It also fails when there are no prices for the estimated region.
+func (e *estimator) count(rc *ResourceCost, resource map[string]interface{}) error {
+	rc.Count = 1
+
+	if v, ok := resource["count"]; ok {
+		resolved, _ := e.variables.resolve(v)
+
+		n, ok := toInt(resolved)
+		if !ok {
+			err := fmt.Errorf("unable to read count: %v", v)
+			rc.Error = err.Error()
+			return err
+		}
+
+		rc.Count = n
+	}
+
+	if e.prices == nil {
+		rc.Error = e.err
+		return errors.New(e.err)
+	}
+
+	return nil
+}
+
+// blocks gives a list of nested blocks of a resource, like
+// root_block_device of an aws_instance.
+func blocks(v interface{}) []map[string]interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{v}
+	case []map[string]interface{}:
+		return v
+	case []interface{}:
+		var m []map[string]interface{}
+		for _, v := range v {
+			if block, ok := v.(map[string]interface{}); ok {
+				m = append(m, block)
+			}
+		}
+		return m
+	default:
+		return nil
+	}
+}
+
+func toInt(v interface{}) (int, bool) {
+	switch v := v.(type) {
+	case int:
+		return v, true
+	case int64:
+		return int(v), true
+	case float64:
+		return int(v), true
+	case string:
+		n, err := strconv.Atoi(v)
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func isInterpolated(s string) bool {
+	return strings.Contains(s, "${")
+}
+
+func round(f float64) float64 {
+	return math.Floor(f*100+0.5) / 100
+}
+
+type byName []*ResourceCost
+
+func (r byName) Len() int           { return len(r) }
+func (r byName) Less(i, j int) bool { return r[i].Name < r[j].Name }
+func (r byName) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
@@ -0,0 +1,248 @@
+package pricing_test
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+
+	"koding/db/models"
+	"koding/kites/kloud/pricing"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	"github.com/hashicorp/hcl/json/parser"
+)
+
+// template mimics stackplan.Template, which can't be used here
+// due to terraform plugins failing to initialize in tests.
+type template struct {
+	node *ast.ObjectList
+}
+
+func parseTemplate(t *testing.T, content string) *template {
+	file, err := parser.Parse([]byte(content))
+	if err != nil {
+		t.Fatalf("Parse()=%s", err)
+	}
+
+	return &template{node: file.Node.(*ast.ObjectList)}
+}
+
+func (t *template) DecodeResource(out interface{}) error {
+	return hcl.DecodeObject(out, t.node.Filter("resource"))
+}
+
+func (t *template) DecodeVariable(out interface{}) error {
+	return hcl.DecodeObject(out, t.node.Filter("variable"))
+}
+
+const testTemplate = `{
+  "variable": {
+    "app_type": {
+      "default": "t2.micro"
+    },
+    "app_size": {
+      "default": "20"
+    }
+  },
+  "resource": {
+    "aws_instance": {
+      "web": {
+        "instance_type": "t2.micro",
+        "count": 2
+      },
+      "db": {
+        "instance_type": "m4.large",
+        "root_block_device": {
+          "volume_size": 50,
+          "volume_type": "gp2"
+        }
+      },
+      "custom": {
+        "instance_type": "${var.userInput_type}"
+      },
+      "app": {
+        "instance_type": "${var.app_type}",
+        "root_block_device": {
+          "volume_size": "${var.app_size}"
+        }
+      }
+    },
+    "aws_ebs_volume": {
+      "data": {
+        "size": 100,
+        "type": "gp2"
+      }
+    },
+    "aws_eip": {
+      "ip": {}
+    }
+  }
+}`
+
+func TestEstimate(t *testing.T) {
+	table := pricing.DefaultTable()
+
+	e, err := table.Estimate(parseTemplate(t, testTemplate), "us-east-1")
+	if err != nil {
+		t.Fatalf("Estimate()=%s", err)
+	}
+
+	want := []*pricing.ResourceCost{{
+		Name:        "aws_ebs_volume.data",
+		Count:       1,
+		Monthly:     10,
+		Description: "100 GB gp2",
+	}, {
+		Name:        "aws_eip.ip",
+		Count:       1,
+		Monthly:     3.65,
+		Description: "Elastic IP",
+	}, {
+		Name:        "aws_instance.app",
+		Count:       1,
+		Monthly:     10.49,
+		Description: "t2.micro, 20 GB standard",
+	}, {
+		Name:  "aws_instance.custom",
+		Count: 1,
+		Error: "unable to read instance type",
+	}, {
+		Name:        "aws_instance.db",
+		Count:       1,
+		Monthly:     92.6,
+		Description: "m4.large, 50 GB gp2",
+	}, {
+		Name:        "aws_instance.web",
+		Count:       2,
+		Monthly:     19.78,
+		Description: "t2.micro, 8 GB standard",
+	}}
+
+	if !reflect.DeepEqual(e.Resources, want) {
+		for i, rc := range e.Resources {
+			t.Logf("got[%d]: %+v", i, rc)
+		}
+		t.Fatalf("got %+v, want %+v", e.Resources, want)
+	}
+
+	if want := 136.52; e.Monthly != want {
+		t.Fatalf("got %v, want %v", e.Monthly, want)
+	}
+
+	if !e.Incomplete {
+		t.Fatal("want estimate to be incomplete")
+	}
+
+	e, err = table.Estimate(parseTemplate(t, testTemplate), "mars-north-1")
+	if err != nil {
+		t.Fatalf("Estimate()=%s", err)
+	}
+
+	if !e.Incomplete || e.Monthly != 0 {
+		t.Fatalf("got %+v, want incomplete estimate", e)
+	}
+
+	for _, rc := range e.Resources {
+		if rc.Error != `no prices for "mars-north-1" region` {
+			t.Errorf("%s: got %q error", rc.Name, rc.Error)
+		}
+	}
+}
+
+func TestEstimateFunc(t *testing.T) {
+	table := pricing.DefaultTable()
+
+	const tmpl = `{
+  "resource": {
+    "aws_instance": {
+      "us": {
+        "instance_type": "t2.micro"
+      },
+      "eu": {
+        "provider": "aws.eu",
+        "instance_type": "t2.micro"
+      },
+      "invalid": {
+        "provider": "aws.invalid",
+        "instance_type": "t2.micro"
+      }
+    }
+  }
+}`
+
+	region := func(name string, resource map[string]interface{}) (string, error) {
+		switch resource["provider"] {
+		case nil:
+			return "", nil
+		case "aws.eu":
+			return "eu-west-1", nil
+		default:
+			return "", errors.New("provider is not declared")
+		}
+	}
+
+	e, err := table.EstimateFunc(parseTemplate(t, tmpl), "us-east-1", region)
+	if err != nil {
+		t.Fatalf("EstimateFunc()=%s", err)
+	}
+
+	if len(e.Resources) != 3 {
+		t.Fatalf("got %+v, want 3 resources", e.Resources)
+	}
+
+	eu, invalid, us := e.Resources[0], e.Resources[1], e.Resources[2]
+
+	if eu.Region != "eu-west-1" || eu.Error != "" {
+		t.Errorf("got %+v, want resource priced in eu-west-1", eu)
+	}
+
+	if us.Region != "" || us.Error != "" {
+		t.Errorf("got %+v, want resource priced in default region", us)
+	}
+
+	if eu.Monthly == us.Monthly {
+		t.Errorf("want different prices in regions, got %v", eu.Monthly)
+	}
+
+	if invalid.Error != "provider is not declared" {
+		t.Errorf("got %+v, want provider error", invalid)
+	}
+
+	if want := round(eu.Monthly + us.Monthly); e.Monthly != want || !e.Incomplete {
+		t.Errorf("got %+v, want incomplete estimate of %v", e, want)
+	}
+}
+
+func TestCheckBudget(t *testing.T) {
+	e := &pricing.Estimate{Currency: "USD", Monthly: 120}
+
+	cases := map[string]struct {
+		budget *models.Budget
+		ok     bool
+	}{
+		"no budget":    {nil, true},
+		"no limit":     {&models.Budget{}, true},
+		"under budget": {&models.Budget{MonthlyLimit: 200}, true},
+		"over budget":  {&models.Budget{MonthlyLimit: 100}, false},
+	}
+
+	for name, cas := range cases {
+		group := &models.Group{Slug: "koding", Budget: cas.budget}
+
+		err := pricing.CheckBudget(group, e)
+		if cas.ok && err != nil {
+			t.Errorf("%s: CheckBudget()=%s", name, err)
+		}
+		if !cas.ok {
+			if _, ok := err.(*pricing.BudgetError); !ok {
+				t.Errorf("%s: got %v, want *BudgetError", name, err)
+			}
+		}
+	}
+}
+
+func round(f float64) float64 {
+	return math.Floor(f*100+0.5) / 100
+}
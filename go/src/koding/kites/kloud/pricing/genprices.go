@@ -0,0 +1,56 @@
+// +build ignore
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"text/template"
+)
+
+var (
+	input  = flag.String("i", "prices.json", "")
+	output = flag.String("o", "-", "")
+)
+
+var t = template.Must(template.New("").Parse(`// Code generated by genprices.go; DO NOT EDIT.
+
+package pricing
+
+// defaultTable is a content of prices.json file.
+const defaultTable = {{printf "%q" .}}
+`))
+
+func main() {
+	flag.Parse()
+
+	p, err := ioutil.ReadFile(*input)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+
+	// Ensure the table is valid before generating.
+	if err := json.Compact(&buf, p); err != nil {
+		log.Fatal(err)
+	}
+
+	f := os.Stdout
+
+	if *output != "-" {
+		f, err = os.Create(*output)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+	}
+
+	if err := t.Execute(f, buf.String()); err != nil {
+		log.Fatal(err)
+	}
+}
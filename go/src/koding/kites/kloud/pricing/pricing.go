@@ -0,0 +1,98 @@
+// Package pricing estimates monthly costs of stack templates.
+//
+// The prices are read from a price table, which by default is the one
+// generated from the prices.json file. The table can be updated without
+// rebuilding kloud by loading it from a file with ReadTableFile.
+package pricing
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+//go:generate go run genprices.go -i prices.json -o prices_data.go
+
+// DefaultHoursPerMonth is used when a price table does not specify
+// the number of hours in a month.
+const DefaultHoursPerMonth = 730
+
+// Table is a price table for AWS resources.
+type Table struct {
+	// Currency of the prices, e.g. "USD".
+	Currency string `json:"currency"`
+
+	// HoursPerMonth is used to convert hourly prices to monthly ones.
+	HoursPerMonth float64 `json:"hoursPerMonth"`
+
+	// Regions maps a region name to its prices.
+	Regions map[string]*Region `json:"regions"`
+}
+
+// Region represents prices of AWS resources in a single region.
+type Region struct {
+	// Instances maps an instance type to its hourly price.
+	Instances map[string]float64 `json:"instances"`
+
+	// EBS maps an EBS volume type to its price per GB-month.
+	EBS map[string]float64 `json:"ebs"`
+
+	// EIP is an hourly price of a single Elastic IP.
+	EIP float64 `json:"eip"`
+}
+
+var (
+	defaultOnce sync.Once
+	defaultTbl  *Table
+)
+
+// DefaultTable gives the price table built into kloud.
+func DefaultTable() *Table {
+	defaultOnce.Do(func() {
+		t, err := ReadTable(strings.NewReader(defaultTable))
+		if err != nil {
+			panic("pricing: invalid default price table: " + err.Error())
+		}
+
+		defaultTbl = t
+	})
+
+	return defaultTbl
+}
+
+// ReadTable reads JSON-encoded price table from the given reader.
+func ReadTable(r io.Reader) (*Table, error) {
+	var t Table
+
+	if err := json.NewDecoder(r).Decode(&t); err != nil {
+		return nil, err
+	}
+
+	if len(t.Regions) == 0 {
+		return nil, fmt.Errorf("price table has no regions")
+	}
+
+	if t.HoursPerMonth == 0 {
+		t.HoursPerMonth = DefaultHoursPerMonth
+	}
+
+	if t.Currency == "" {
+		t.Currency = "USD"
+	}
+
+	return &t, nil
+}
+
+// ReadTableFile reads JSON-encoded price table from the given file.
+func ReadTableFile(file string) (*Table, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ReadTable(f)
+}
@@ -0,0 +1,390 @@
+package awsprovider
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"koding/kites/kloud/stackplan"
+)
+
+// providerAlias represents a single aws provider block of a stack
+// template. A template may declare several aliased providers, each
+// for a different region or account, e.g.:
+//
+//   "provider": {
+//     "aws": [{
+//       "region": "us-east-1"
+//     }, {
+//       "alias": "eu",
+//       "region": "eu-west-1"
+//     }, {
+//       "alias": "prod",
+//       "region": "us-west-2",
+//       "credential": "production"
+//     }]
+//   }
+//
+// Resources select a provider with the "provider" attribute, e.g.
+// "aws.eu"; resources without it use the default, unaliased one.
+//
+// The "credential" attribute is a title or identifier of an aws
+// credential of the stack, which the provider uses. If empty,
+// the first aws credential of the stack is used. The attribute
+// is removed before the template is passed to Terraform.
+type providerAlias struct {
+	Alias      string // empty for the default provider
+	Region     string
+	Identifier string // jCredential identifier
+	Cred       *Cred
+}
+
+// Name gives the provider name, as it is referenced by resources.
+func (a *providerAlias) Name() string {
+	if a.Alias == "" {
+		return "aws"
+	}
+	return "aws." + a.Alias
+}
+
+// Bootstrap gives bootstrap metadata of the provider's region.
+func (a *providerAlias) Bootstrap() (*Bootstrap, error) {
+	b := a.Cred.Bootstrap(a.Region)
+
+	if err := b.Valid(); err != nil {
+		return nil, fmt.Errorf("invalid bootstrap metadata for %q in %s region: %s", a.Identifier, a.Region, err)
+	}
+
+	return b, nil
+}
+
+// credVariables are names of Terraform variables, which hold keys
+// of a single aws credential.
+type credVariables struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+}
+
+// awsCredentials gives aws credentials of the stack, in the order
+// they were attached to the stack. The first one is the default.
+func (s *Stack) awsCredentials() []*stackplan.Credential {
+	var creds []*stackplan.Credential
+
+	for _, cred := range s.Builder.Credentials {
+		if cred.Provider == "aws" {
+			creds = append(creds, cred)
+		}
+	}
+
+	return creds
+}
+
+// credVariables gives variable names for the given credential.
+//
+// Keys of the default credential are held by the variables, which
+// are injected for every template: aws_access_key, aws_secret_key and
+// aws_session_token. Other credentials use variables prefixed with
+// their identifiers.
+func (s *Stack) credVariables(ident string) *credVariables {
+	prefix := "aws_"
+
+	if creds := s.awsCredentials(); len(creds) != 0 && creds[0].Identifier != ident {
+		prefix = "aws_" + ident + "_"
+	}
+
+	return &credVariables{
+		AccessKey:    prefix + "access_key",
+		SecretKey:    prefix + "secret_key",
+		SessionToken: prefix + "session_token",
+	}
+}
+
+// providerAliases reads aws providers declared in the built template.
+//
+// If the template does not declare the default provider, the one using
+// the default credential and its region is added. It returns nil slice
+// if the stack has no aws credentials.
+func (s *Stack) providerAliases() ([]*providerAlias, error) {
+	creds := s.awsCredentials()
+	if len(creds) == 0 {
+		return nil, nil
+	}
+
+	blocks, err := providerBlocks(s.Builder.Template.Provider["aws"])
+	if err != nil {
+		return nil, err
+	}
+
+	var aliases []*providerAlias
+	seen := make(map[string]bool)
+
+	for _, block := range blocks {
+		alias, _ := block["alias"].(string)
+
+		if seen[alias] {
+			return nil, fmt.Errorf("aws provider %q is declared more than once", alias)
+		}
+
+		seen[alias] = true
+
+		cred := creds[0]
+
+		if name, _ := block["credential"].(string); name != "" {
+			if cred = findCredential(creds, name); cred == nil {
+				return nil, fmt.Errorf("aws credential %q of %q provider is not attached to the stack", name, alias)
+			}
+		}
+
+		meta := cred.Meta.(*Cred)
+
+		region, _ := block["region"].(string)
+		if region == "" {
+			region = meta.Region
+		} else if stackplan.IsVariable(region) {
+			if region, err = s.variableRegion(alias, region); err != nil {
+				return nil, err
+			}
+		}
+
+		if region == "" {
+			return nil, fmt.Errorf("region for identifer '%s' is not set", cred.Identifier)
+		}
+
+		aliases = append(aliases, &providerAlias{
+			Alias:      alias,
+			Region:     region,
+			Identifier: cred.Identifier,
+			Cred:       meta,
+		})
+	}
+
+	if !seen[""] {
+		meta := creds[0].Meta.(*Cred)
+
+		aliases = append([]*providerAlias{{
+			Region:     meta.Region,
+			Identifier: creds[0].Identifier,
+			Cred:       meta,
+		}}, aliases...)
+	}
+
+	return aliases, nil
+}
+
+var varRe = regexp.MustCompile(`^\$\{var\.([^}]+)\}$`)
+
+// variableRegion gives a region of the provider set with a variable,
+// e.g. "${var.eu_region}", which is the default value of the variable.
+//
+// The aws_region variable holds the region of the default credential.
+func (s *Stack) variableRegion(alias, region string) (string, error) {
+	m := varRe.FindStringSubmatch(region)
+	if m == nil {
+		return "", fmt.Errorf("region of %q aws provider must be either a string or a variable: %s", alias, region)
+	}
+
+	var variables map[string]map[string]interface{}
+
+	if err := s.Builder.Template.DecodeVariable(&variables); err != nil {
+		return "", err
+	}
+
+	def, _ := variables[m[1]]["default"].(string)
+	if def == "" || strings.Contains(def, "${") {
+		return "", fmt.Errorf("region of %q aws provider is read from %q variable, which has no default value", alias, m[1])
+	}
+
+	return def, nil
+}
+
+// buildProviders resolves aws providers of the built template and
+// configures them with regions and keys of their credentials.
+//
+// When nil error is returned, the s.aliases field is non-nil.
+func (s *Stack) buildProviders() error {
+	aliases, err := s.providerAliases()
+	if err != nil {
+		return err
+	}
+
+	for _, cred := range s.awsCredentials() {
+		if err := cred.Meta.(*Cred).AssumeRole(s.roles); err != nil {
+			return err
+		}
+	}
+
+	s.aliases = make(map[string]*providerAlias, len(aliases))
+
+	if len(aliases) == 0 {
+		return nil
+	}
+
+	t := s.Builder.Template
+
+	blocks, err := providerBlocks(t.Provider["aws"])
+	if err != nil {
+		return err
+	}
+
+	byAlias := make(map[string]map[string]interface{}, len(blocks))
+	for _, block := range blocks {
+		alias, _ := block["alias"].(string)
+		byAlias[alias] = block
+	}
+
+	var providers []interface{}
+
+	for _, a := range aliases {
+		s.aliases[a.Alias] = a
+
+		block, ok := byAlias[a.Alias]
+		if !ok {
+			block = make(map[string]interface{})
+		}
+
+		vars := s.credVariables(a.Identifier)
+
+		// Regions of aliased providers set with variables are
+		// replaced with the variable defaults they were resolved to.
+		if region, _ := block["region"].(string); region == "" || (a.Alias != "" && stackplan.IsVariable(region)) {
+			block["region"] = a.Region
+		}
+
+		// Keys of the explicitly set credential always take
+		// precedence over the ones set in the template.
+		if _, ok := block["credential"]; ok {
+			delete(block, "credential")
+
+			block["access_key"] = "${var." + vars.AccessKey + "}"
+			block["secret_key"] = "${var." + vars.SecretKey + "}"
+		}
+
+		if key, _ := block["access_key"].(string); key == "" {
+			block["access_key"] = "${var." + vars.AccessKey + "}"
+		}
+
+		if key, _ := block["secret_key"].(string); key == "" {
+			block["secret_key"] = "${var." + vars.SecretKey + "}"
+		}
+
+		if a.Cred.RoleARN != "" {
+			block["token"] = "${var." + vars.SessionToken + "}"
+		}
+
+		providers = append(providers, block)
+	}
+
+	if len(providers) == 1 {
+		t.Provider["aws"] = providers[0]
+	} else {
+		t.Provider["aws"] = providers
+	}
+
+	// Variables of the default credential are injected when the
+	// template is built, here the other ones are declared.
+	for _, cred := range s.awsCredentials() {
+		meta := cred.Meta.(*Cred)
+		vars := s.credVariables(cred.Identifier)
+
+		if vars.AccessKey != "aws_access_key" {
+			t.Variable[vars.AccessKey] = map[string]interface{}{
+				"default": meta.AccessKey,
+			}
+
+			t.Variable[vars.SecretKey] = map[string]interface{}{
+				"default": meta.SecretKey,
+			}
+		}
+
+		if meta.RoleARN != "" {
+			t.Variable[vars.SessionToken] = map[string]interface{}{
+				"default": "",
+			}
+		}
+	}
+
+	return t.Flush()
+}
+
+// shadowedVariables gives names of variables, which hold credential
+// keys and are not allowed to be used by resources.
+func (s *Stack) shadowedVariables() []string {
+	vars := []string{"aws_access_key", "aws_secret_key", "aws_session_token"}
+
+	for _, cred := range s.awsCredentials() {
+		v := s.credVariables(cred.Identifier)
+
+		if v.AccessKey != "aws_access_key" {
+			vars = append(vars, v.AccessKey, v.SecretKey, v.SessionToken)
+		}
+	}
+
+	return vars
+}
+
+// resourceAlias gives a provider of the given resource.
+func (s *Stack) resourceAlias(resourceName string, resource map[string]interface{}) (*providerAlias, error) {
+	name, _ := resource["provider"].(string)
+
+	var alias string
+
+	switch {
+	case name == "" || name == "aws":
+	case strings.HasPrefix(name, "aws."):
+		alias = name[len("aws."):]
+	default:
+		return nil, fmt.Errorf("%s: invalid provider %q", resourceName, name)
+	}
+
+	a, ok := s.aliases[alias]
+	if !ok {
+		return nil, fmt.Errorf("%s: provider %q is not declared", resourceName, name)
+	}
+
+	return a, nil
+}
+
+func findCredential(creds []*stackplan.Credential, name string) *stackplan.Credential {
+	for _, cred := range creds {
+		if cred.Identifier == name {
+			return cred
+		}
+	}
+
+	for _, cred := range creds {
+		if cred.Title == name {
+			return cred
+		}
+	}
+
+	return nil
+}
+
+// providerBlocks gives a list of provider blocks, which in a JSON
+// template is either a single object or a list of objects.
+func providerBlocks(v interface{}) ([]map[string]interface{}, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		return []map[string]interface{}{v}, nil
+	case []map[string]interface{}:
+		return v, nil
+	case []interface{}:
+		blocks := make([]map[string]interface{}, 0, len(v))
+
+		for _, v := range v {
+			block, ok := v.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid aws provider block: %v", v)
+			}
+
+			blocks = append(blocks, block)
+		}
+
+		return blocks, nil
+	default:
+		return nil, fmt.Errorf("invalid aws provider: %v", v)
+	}
+}
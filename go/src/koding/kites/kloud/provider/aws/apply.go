@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"koding/db/mongodb/modelhelper"
+	"koding/kites/kloud/pricing"
 	"koding/kites/kloud/stackplan"
 
 	"github.com/hashicorp/go-multierror"
@@ -15,40 +16,96 @@ import (
 )
 
 func (s *Stack) buildResources() error {
-	for _, cred := range s.Builder.Credentials {
-		// rest is aws related
-		if cred.Provider != "aws" {
-			continue
+	for _, cred := range s.awsCredentials() {
+		if cred.Meta.(*Cred).Region == "" {
+			return fmt.Errorf("region for identifer '%s' is not set", cred.Identifier)
 		}
+	}
+
+	if err := s.buildProviders(); err != nil {
+		return err
+	}
+
+	kiteIDs, err := s.InjectAWSData()
+	if err != nil {
+		return err
+	}
 
+	s.ids = kiteIDs
+
+	return nil
+}
+
+// terraformVariables gives current values of the stack's AWS
+// credentials for each Terraform operation, so temporary credentials
+// are refreshed even when the stack template was built long before.
+func (s *Stack) terraformVariables() (map[string]string, error) {
+	var vars map[string]string
+
+	for _, cred := range s.awsCredentials() {
 		meta := cred.Meta.(*Cred)
-		if meta.Region == "" {
-			return fmt.Errorf("region for identifer '%s' is not set", cred.Identifier)
+		if meta.RoleARN == "" {
+			continue
+		}
+
+		if err := meta.AssumeRole(s.roles); err != nil {
+			return nil, err
 		}
 
-		// check if this a second round and it's using a different region, we
-		// shouldn't allow it.
-		if s.cred != nil && s.cred.Region != meta.Region {
-			return fmt.Errorf("multiple credentials with multiple regions detected: %s and %s. Aborting",
-				s.cred.Region, meta.Region)
+		v, err := meta.Variables()
+		if err != nil {
+			return nil, fmt.Errorf("unable to assume role for %q: %s", cred.Identifier, err)
 		}
 
-		s.ident = cred.Identifier
-		s.cred = meta
+		if vars == nil {
+			vars = make(map[string]string)
+		}
+
+		names := s.credVariables(cred.Identifier)
+
+		vars[names.AccessKey] = v["aws_access_key"]
+		vars[names.SecretKey] = v["aws_secret_key"]
+		vars[names.SessionToken] = v["aws_session_token"]
+	}
+
+	return vars, nil
+}
 
-		if err := s.SetAwsRegion(s.cred.Region); err != nil {
-			return err
+// terraformTimeout limits Terraform operations, which use temporary
+// credentials, so they finish before the credentials expire.
+func (s *Stack) terraformTimeout() time.Duration {
+	for _, cred := range s.awsCredentials() {
+		if cred.Meta.(*Cred).RoleARN != "" {
+			return s.roleTimeout
 		}
 	}
 
-	kiteIDs, err := s.InjectAWSData()
+	return 0
+}
+
+// estimateCost estimates cost of the stack, pricing each resource
+// in the region of its provider.
+func (s *Stack) estimateCost() (*pricing.Estimate, error) {
+	var region string
+	if a, ok := s.aliases[""]; ok {
+		region = a.Region
+	}
+
+	return s.Prices.EstimateFunc(s.Builder.Template, region, s.resourceRegion)
+}
+
+// resourceRegion gives a region of the provider of the given resource.
+func (s *Stack) resourceRegion(name string, resource map[string]interface{}) (string, error) {
+	a, err := s.resourceAlias(name, resource)
 	if err != nil {
-		return err
+		return "", err
 	}
 
-	s.ids = kiteIDs
+	if a.Region == "" {
+		return "", fmt.Errorf("%s: region of %q provider is not set", name, a.Name())
+	}
 
-	return nil
+	return a.Region, nil
 }
 
 func (s *Stack) waitResources(ctx context.Context) (err error) {
@@ -78,7 +135,13 @@ func (s *Stack) updateResources(state *terraform.State) error {
 			continue
 		}
 
-		if e := s.updateMachine(m.ObjectId, machine, now); e != nil {
+		alias, ok := s.labels[label]
+		if !ok {
+			err = multierror.Append(err, fmt.Errorf("no provider found for machine %q", label))
+			continue
+		}
+
+		if e := s.updateMachine(m.ObjectId, machine, alias, now); e != nil {
 			err = multierror.Append(err, e)
 			continue
 		}
@@ -87,16 +150,16 @@ func (s *Stack) updateResources(state *terraform.State) error {
 	return err
 }
 
-func (s *Stack) updateMachine(id bson.ObjectId, m *stackplan.Machine, now time.Time) error {
+func (s *Stack) updateMachine(id bson.ObjectId, m *stackplan.Machine, a *providerAlias, now time.Time) error {
 	size, err := strconv.Atoi(m.Attributes["root_block_device.0.volume_size"])
 	if err != nil {
 		return err
 	}
 
 	return modelhelper.UpdateMachine(id, bson.M{"$set": bson.M{
-		"credential":         s.ident,
+		"credential":         a.Identifier,
 		"provider":           m.Provider,
-		"meta.region":        s.cred.Region,
+		"meta.region":        a.Region,
 		"queryString":        m.QueryString,
 		"ipAddress":          m.Attributes["public_ip"],
 		"meta.instanceId":    m.Attributes["id"],
@@ -7,7 +7,6 @@ import (
 	"koding/kites/kloud/api/amazon"
 	"koding/kites/kloud/stack"
 
-	"github.com/aws/aws-sdk-go/aws/credentials"
 	"golang.org/x/net/context"
 )
 
@@ -46,8 +45,13 @@ func (s *Stack) Authenticate(ctx context.Context) (interface{}, error) {
 			continue
 		}
 
+		if err := meta.AssumeRole(s.roles); err != nil {
+			res.Message = err.Error()
+			continue
+		}
+
 		opts := &amazon.ClientOptions{
-			Credentials: credentials.NewStaticCredentials(meta.AccessKey, meta.SecretKey, ""),
+			Credentials: meta.Credentials(),
 			Region:      meta.Region,
 			Log:         nil, // do not log warnings, as they're expected
 		}
@@ -7,8 +7,11 @@ import (
 	"text/template"
 	"time"
 
+	"koding/db/mongodb/modelhelper"
 	"koding/kites/kloud/api/amazon"
+	"koding/kites/kloud/policy"
 	"koding/kites/kloud/stack"
+	"koding/kites/kloud/stackplan"
 	"koding/kites/kloud/terraformer"
 	tf "koding/kites/terraformer"
 
@@ -40,6 +43,34 @@ func (s *Stack) bootstrap(arg *stack.BootstrapRequest) (interface{}, error) {
 		return nil, err
 	}
 
+	// regions maps credential identifiers to regions of aliased
+	// providers, which need to be bootstrapped as well
+	regions := make(map[string][]string)
+
+	if !arg.Destroy {
+		region := func(cred *stackplan.Credential) string {
+			if meta, ok := cred.Meta.(*Cred); ok {
+				return meta.Region
+			}
+			return ""
+		}
+
+		if err := s.CheckCredentialsPolicy(arg.GroupName, region); err != nil {
+			return nil, err
+		}
+
+		if arg.StackTemplateID != "" {
+			aliases, err := s.templateAliases(arg.GroupName, arg.StackTemplateID)
+			if err != nil {
+				return nil, err
+			}
+
+			for _, a := range aliases {
+				regions[a.Identifier] = append(regions[a.Identifier], a.Region)
+			}
+		}
+	}
+
 	s.Log.Debug("Connecting to terraformer kite")
 
 	tfKite, err := terraformer.Connect(s.Session.Terraformer)
@@ -58,111 +89,226 @@ func (s *Stack) bootstrap(arg *stack.BootstrapRequest) (interface{}, error) {
 
 		meta := cred.Meta.(*Cred)
 
+		if err := meta.AssumeRole(s.roles); err != nil {
+			return nil, err
+		}
+
 		awsAccountID, err := meta.AccountID()
 		if err != nil {
 			return nil, err
 		}
 
-		opts := meta.Options()
-		opts.Log = s.Log.New("amazon")
+		s.Log.Debug("Fetching the AWS user information to get the account ID: %s", awsAccountID)
 
-		availabilityZone := "${lookup(var.aws_availability_zones, var.aws_region)}"
+		credRegions := meta.BootstrapRegions()
 
-		if c, err := amazon.NewClient(opts); err == nil && len(c.Zones) != 0 {
-			availabilityZone = c.Zones[0]
-		} else {
-			s.Log.Warning("unable to guess availability zones for %q: %v", cred.Identifier, err)
+		if !arg.Destroy {
+			credRegions = append([]string{meta.Region}, regions[cred.Identifier]...)
 		}
 
-		s.Log.Debug("Fetching the AWS user information to get the account ID: %s", awsAccountID)
+		seen := make(map[string]bool)
 
-		contentID := fmt.Sprintf("%s-%s-%s", awsAccountID, arg.GroupName, cred.Identifier)
-		s.Log.Debug("Building template: %s", contentID)
+		for _, region := range credRegions {
+			if seen[region] {
+				continue
+			}
 
-		keyName := "koding-deployment-" + s.Req.Username + "-" + arg.GroupName + "-" + strconv.FormatInt(time.Now().UTC().UnixNano(), 10)
-		bootstrapTemplate, err := newTemplate(&awsTemplateData{
-			AvailabilityZone: availabilityZone,
-			KeyPairName:      keyName,
-			PublicKey:        s.Keys.PublicKey,
-			EnvironmentName:  fmt.Sprintf("Koding-%s-Bootstrap", arg.GroupName),
-		})
-		if err != nil {
-			return nil, err
+			seen[region] = true
+
+			if err := s.bootstrapRegion(tfKite, arg, cred, awsAccountID, region); err != nil {
+				return nil, err
+			}
 		}
 
-		s.Log.Debug("Bootstrap template:")
-		s.Log.Debug("%s", bootstrapTemplate)
+		s.Log.Debug("[%s] Bootstrap response: %+v", cred.Identifier, meta)
 
-		if err := s.Builder.BuildTemplate(bootstrapTemplate, contentID); err != nil {
-			return nil, err
+		datas := map[string]interface{}{
+			cred.Identifier: meta,
 		}
 
-		finalBootstrap, err := s.Builder.Template.JsonOutput()
-		if err != nil {
+		if err := s.Builder.CredStore.Put(s.Req.Username, datas); err != nil {
 			return nil, err
 		}
+	}
 
-		s.Log.Debug("Final bootstrap template:")
-		s.Log.Debug("%s", finalBootstrap)
+	return true, nil
+}
 
-		// Important so bootstraping is distributed amongs multiple users. If I
-		// use these keys to bootstrap, any other user should be not create
-		// again, instead they should be fetch and use the existing bootstrap
-		// data.
+// templateAliases gives aws providers declared in the given stack
+// template, checking their regions against the group stack policy.
+func (s *Stack) templateAliases(groupName, stackTemplateID string) ([]*providerAlias, error) {
+	stackTemplate, err := modelhelper.GetStackTemplate(stackTemplateID)
+	if err != nil {
+		return nil, stackplan.ResError(err, "jStackTemplate")
+	}
 
-		if arg.Destroy {
-			// TODO(rjeczalik): bootstrap destroy should use already existing
-			// terraform files and not build templates again.
+	contentID := s.Req.Username + "-" + stackTemplateID
 
-			s.Log.Info("Destroying bootstrap resources belonging to identifier '%s'", cred.Identifier)
+	if err := s.Builder.BuildTemplate(stackTemplate.Template.Content, contentID); err != nil {
+		return nil, err
+	}
 
-			_, err := tfKite.Destroy(&tf.TerraformRequest{
-				Content:   finalBootstrap,
-				ContentID: contentID,
-				TraceID:   s.TraceID,
-			})
-			if err != nil {
-				return nil, err
-			}
+	aliases, err := s.providerAliases()
+	if err != nil {
+		return nil, err
+	}
 
-			meta.ResetBootstrap()
-		} else {
-			s.Log.Info("Creating bootstrap resources belonging to identifier '%s'", cred.Identifier)
+	p, err := s.Policy(groupName)
+	if err != nil {
+		return nil, err
+	}
 
-			state, err := tfKite.Apply(&tf.TerraformRequest{
-				Content:   finalBootstrap,
-				ContentID: contentID,
-				TraceID:   s.TraceID,
-			})
-			if err != nil {
-				return nil, err
-			}
+	var violations []*policy.Violation
 
-			s.Log.Debug("[%s] state.RootModule().Outputs = %+v\n", cred.Identifier, state.RootModule().Outputs)
+	for _, a := range aliases {
+		if v := p.ValidateRegion("provider."+a.Name(), a.Region); v != nil {
+			violations = append(violations, v)
+		}
+	}
 
-			if err := s.Builder.Object.Decode(state.RootModule().Outputs, meta); err != nil {
-				return nil, err
-			}
+	if err := policy.Check(violations); err != nil {
+		return nil, err
+	}
+
+	return aliases, nil
+}
 
-			s.Log.Debug("[%s] resp = %+v\n", cred.Identifier, meta)
+// bootstrapRegion creates or destroys bootstrap resources of the given
+// credential in the given region.
+//
+// Resources of the credential region are identified by the credential,
+// the ones of other regions also by the region name.
+func (s *Stack) bootstrapRegion(tfKite *terraformer.Terraformer, arg *stack.BootstrapRequest, cred *stackplan.Credential, awsAccountID, region string) error {
+	meta := cred.Meta.(*Cred)
 
-			if err := meta.BootstrapValid(); err != nil {
-				return nil, fmt.Errorf("invalid bootstrap metadata for %q: %s", cred.Identifier, err)
-			}
+	opts := meta.Options()
+	opts.Region = region
+	opts.Log = s.Log.New("amazon")
+
+	availabilityZone := "${lookup(var.aws_availability_zones, var.aws_region)}"
+
+	if c, err := amazon.NewClient(opts); err == nil && len(c.Zones) != 0 {
+		availabilityZone = c.Zones[0]
+	} else {
+		s.Log.Warning("unable to guess availability zones for %q in %s: %v", cred.Identifier, region, err)
+	}
+
+	contentID := fmt.Sprintf("%s-%s-%s", awsAccountID, arg.GroupName, cred.Identifier)
+	if region != meta.Region {
+		contentID += "-" + region
+	}
+
+	s.Log.Debug("Building template: %s", contentID)
+
+	keyName := "koding-deployment-" + s.Req.Username + "-" + arg.GroupName + "-" + strconv.FormatInt(time.Now().UTC().UnixNano(), 10)
+	bootstrapTemplate, err := newTemplate(&awsTemplateData{
+		AvailabilityZone: availabilityZone,
+		KeyPairName:      keyName,
+		PublicKey:        s.Keys.PublicKey,
+		EnvironmentName:  fmt.Sprintf("Koding-%s-Bootstrap", arg.GroupName),
+	})
+	if err != nil {
+		return err
+	}
+
+	s.Log.Debug("Bootstrap template:")
+	s.Log.Debug("%s", bootstrapTemplate)
+
+	if err := s.Builder.BuildTemplate(bootstrapTemplate, contentID); err != nil {
+		return err
+	}
+
+	// With several aws credentials, the injected variables hold values
+	// of the first one, make them hold values of the given credential.
+	if err := s.Builder.Template.InjectVariables("aws", meta); err != nil {
+		return err
+	}
+
+	if region != meta.Region {
+		s.Builder.Template.Variable["aws_region"] = map[string]interface{}{
+			"default": region,
 		}
 
-		s.Log.Debug("[%s] Bootstrap response: %+v", cred.Identifier, meta)
+		if err := s.Builder.Template.Flush(); err != nil {
+			return err
+		}
+	}
 
-		datas := map[string]interface{}{
-			cred.Identifier: meta,
+	finalBootstrap, err := s.Builder.Template.JsonOutput()
+	if err != nil {
+		return err
+	}
+
+	s.Log.Debug("Final bootstrap template:")
+	s.Log.Debug("%s", finalBootstrap)
+
+	var vars map[string]string
+
+	tfKite.Timeout = 0
+
+	if meta.RoleARN != "" {
+		if vars, err = meta.Variables(); err != nil {
+			return fmt.Errorf("unable to assume role for %q: %s", cred.Identifier, err)
 		}
 
-		if err := s.Builder.CredStore.Put(s.Req.Username, datas); err != nil {
-			return nil, err
+		tfKite.Timeout = s.roleTimeout
+	}
+
+	// Important so bootstraping is distributed amongs multiple users. If I
+	// use these keys to bootstrap, any other user should be not create
+	// again, instead they should be fetch and use the existing bootstrap
+	// data.
+
+	if arg.Destroy {
+		// TODO(rjeczalik): bootstrap destroy should use already existing
+		// terraform files and not build templates again.
+
+		s.Log.Info("Destroying bootstrap resources belonging to identifier '%s' in %s", cred.Identifier, region)
+
+		_, err := tfKite.Destroy(&tf.TerraformRequest{
+			Content:   finalBootstrap,
+			Variables: vars,
+			ContentID: contentID,
+			TraceID:   s.TraceID,
+		})
+		if err != nil {
+			return err
 		}
+
+		meta.SetBootstrap(region, nil)
+
+		return nil
 	}
 
-	return true, nil
+	s.Log.Info("Creating bootstrap resources belonging to identifier '%s' in %s", cred.Identifier, region)
+
+	state, err := tfKite.Apply(&tf.TerraformRequest{
+		Content:   finalBootstrap,
+		Variables: vars,
+		ContentID: contentID,
+		TraceID:   s.TraceID,
+	})
+	if err != nil {
+		return err
+	}
+
+	s.Log.Debug("[%s] state.RootModule().Outputs = %+v\n", cred.Identifier, state.RootModule().Outputs)
+
+	var b Bootstrap
+
+	if err := s.Builder.Object.Decode(state.RootModule().Outputs, &b); err != nil {
+		return err
+	}
+
+	s.Log.Debug("[%s] resp = %+v\n", cred.Identifier, &b)
+
+	if err := b.Valid(); err != nil {
+		return fmt.Errorf("invalid bootstrap metadata for %q in %s: %s", cred.Identifier, region, err)
+	}
+
+	meta.SetBootstrap(region, &b)
+
+	return nil
 }
 
 func newTemplate(awsData *awsTemplateData) (string, error) {
@@ -189,6 +335,7 @@ var awsBootstrap = template.Must(template.New("").Parse(`{
         "aws": {
             "access_key": "${var.aws_access_key}",
             "secret_key": "${var.aws_secret_key}",
+            "token": "${var.aws_session_token}",
             "region": "${var.aws_region}"
         }
     },
@@ -302,6 +449,9 @@ var awsBootstrap = template.Must(template.New("").Parse(`{
         }
     },
     "variable": {
+        "aws_session_token": {
+            "default": ""
+        },
         "cidr_block": {
             "default": "10.0.0.0/16"
         },
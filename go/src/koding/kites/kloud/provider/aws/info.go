@@ -87,7 +87,7 @@ func (m *Machine) Info(ctx context.Context) (*stack.InfoResponse, error) {
 			// XXX: AWS call reduction workaround.
 			if dbState == machinestate.Stopped {
 				m.Log.Debug("Info result: Returning db state '%s' because the klient is not available. Username: %s",
-					dbState, m.User.Name)
+					dbState, m.Username())
 				return &stack.InfoResponse{
 					State: machinestate.Stopped,
 				}, nil
@@ -95,7 +95,7 @@ func (m *Machine) Info(ctx context.Context) (*stack.InfoResponse, error) {
 		}
 	}
 
-	m.Log.Debug("Info result: '%s'. Username: %s", resultState, m.User.Name)
+	m.Log.Debug("Info result: '%s'. Username: %s", resultState, m.Username())
 	return &stack.InfoResponse{
 		State: resultState,
 	}, nil
@@ -1,12 +1,9 @@
 package awsprovider
 
 import (
-	"errors"
 	"fmt"
 
-	"koding/db/mongodb/modelhelper"
 	"koding/kites/kloud/stack"
-	"koding/kites/kloud/stackplan"
 	"koding/kites/kloud/terraformer"
 	tf "koding/kites/terraformer"
 
@@ -14,7 +11,7 @@ import (
 )
 
 // Plan
-func (s *Stack) Plan(ctx context.Context) (interface{}, error) {
+func (s *Stack) Plan(ctx context.Context) (*stack.PlanResponse, error) {
 	var arg stack.PlanRequest
 	if err := s.Req.Args.One().Unmarshal(&arg); err != nil {
 		return nil, err
@@ -24,21 +21,18 @@ func (s *Stack) Plan(ctx context.Context) (interface{}, error) {
 		return nil, err
 	}
 
-	s.Log.Debug("Fetching template for id %s", arg.StackTemplateID)
-	stackTemplate, err := modelhelper.GetStackTemplate(arg.StackTemplateID)
-	if err != nil {
-		return nil, stackplan.ResError(err, "jStackTemplate")
+	if arg.StackID != "" {
+		return s.DryRun(ctx, &arg)
 	}
 
-	if stackTemplate.Template.Content == "" {
-		return nil, errors.New("Stack template content is empty")
+	tmpl, err := s.PlanTemplate(&arg)
+	if err != nil {
+		return nil, err
 	}
 
-	s.Log.Debug("Fetching credentials for id %v", stackTemplate.Credentials)
+	s.Log.Debug("Fetching credentials for id %v", tmpl.CredIDs)
 
-	credIDs := stackplan.FlattenValues(stackTemplate.Credentials)
-
-	if err := s.Builder.BuildCredentials(s.Req.Method, s.Req.Username, arg.GroupName, credIDs); err != nil {
+	if err := s.Builder.BuildCredentials(s.Req.Method, s.Req.Username, arg.GroupName, tmpl.CredIDs); err != nil {
 		return nil, err
 	}
 
@@ -52,32 +46,26 @@ func (s *Stack) Plan(ctx context.Context) (interface{}, error) {
 	}
 	defer tfKite.Close()
 
-	contentID := s.Req.Username + "-" + arg.StackTemplateID
-	s.Log.Debug("Parsing template (%s):\n%s", contentID, stackTemplate.Template.Content)
+	contentID := tmpl.ContentID
+	s.Log.Debug("Parsing template (%s):\n%s", contentID, tmpl.Content)
 
-	if err := s.Builder.BuildTemplate(stackTemplate.Template.Content, contentID); err != nil {
+	if err := s.Builder.BuildTemplate(tmpl.Content, contentID); err != nil {
 		return nil, err
 	}
 
-	var region string
-	for _, cred := range s.Builder.Credentials {
-		// rest is aws related
-		if cred.Provider != "aws" {
-			continue
-		}
-
-		meta := cred.Meta.(*Cred)
-		if meta.Region == "" {
+	for _, cred := range s.awsCredentials() {
+		if cred.Meta.(*Cred).Region == "" {
 			return nil, fmt.Errorf("region for identifer '%s' is not set", cred.Identifier)
 		}
+	}
 
-		if err := s.SetAwsRegion(meta.Region); err != nil {
-			return nil, err
-		}
-
-		region = meta.Region
+	if err := s.buildProviders(); err != nil {
+		return nil, err
+	}
 
-		break
+	var region string
+	if a, ok := s.aliases[""]; ok {
+		region = a.Region
 	}
 
 	s.Log.Debug("Plan: stack template before injecting Koding data")
@@ -107,17 +95,21 @@ func (s *Stack) Plan(ctx context.Context) (interface{}, error) {
 		return nil, err
 	}
 
-	stackTemplate.Template.Content = out
-
+	// Templates sent with the request are not stored by terraformer.
 	tfReq := &tf.TerraformRequest{
-		Content:   stackTemplate.Template.Content,
+		Content:   out,
 		ContentID: contentID,
 		TraceID:   s.TraceID,
+		DryRun:    tmpl.Draft,
 	}
 
 	s.Log.Debug("Calling plan with content")
 	s.Log.Debug("%+v", tfReq)
 
+	if tfReq.Variables, err = s.terraformVariables(); err != nil {
+		return nil, err
+	}
+
 	plan, err := tfKite.Plan(tfReq)
 	if err != nil {
 		return nil, err
@@ -130,7 +122,13 @@ func (s *Stack) Plan(ctx context.Context) (interface{}, error) {
 
 	s.Log.Debug("Machines planned to be created: %+v", machines)
 
-	return &stack.PlanResponse{
+	resp := &stack.PlanResponse{
 		Machines: machines.Slice(),
-	}, nil
+	}
+
+	if resp.Cost, err = s.estimateCost(); err != nil {
+		s.Log.Warning("unable to estimate stack cost: %s", err)
+	}
+
+	return resp, nil
 }
@@ -8,7 +8,6 @@ import (
 	"koding/kites/kloud/provider"
 	"koding/kites/kloud/stack"
 
-	"github.com/aws/aws-sdk-go/aws/credentials"
 	"golang.org/x/net/context"
 )
 
@@ -48,13 +47,13 @@ func (p *Provider) Machine(ctx context.Context, id string) (stack.Machine, error
 
 	p.Log.Debug("aws credential: %+v", cred)
 
-	if mt.Region != cred.Region {
-		return nil, fmt.Errorf("region mismatch: machine is %q, credential is %q", mt.Region, cred.Region)
+	if err := cred.AssumeRole(p.Roles); err != nil {
+		return nil, err
 	}
 
 	opts := &amazon.ClientOptions{
-		Credentials: credentials.NewStaticCredentials(cred.AccessKey, cred.SecretKey, ""),
-		Region:      cred.Region,
+		Credentials: cred.Credentials(),
+		Region:      mt.Region, // machine may be in other region than credential's
 		Log:         bm.Log.New("awsapi"),
 	}
 
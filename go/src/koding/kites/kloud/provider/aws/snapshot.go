@@ -0,0 +1,322 @@
+package awsprovider
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"koding/db/models"
+	"koding/db/mongodb/modelhelper"
+	"koding/kites/kloud/machinestate"
+	"koding/kites/kloud/stack"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/cenkalti/backoff"
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (m *Machine) CreateSnapshot(ctx context.Context) error {
+	err := m.createSnapshot(ctx)
+	if err != nil {
+		return stack.NewEventerError(err)
+	}
+
+	return nil
+}
+
+func (m *Machine) DeleteSnapshot(ctx context.Context) error {
+	err := m.deleteSnapshot(ctx)
+	if err != nil {
+		return stack.NewEventerError(err)
+	}
+
+	return nil
+}
+
+func (m *Machine) RestoreSnapshot(ctx context.Context) error {
+	err := m.restoreSnapshot(ctx)
+	if err != nil {
+		return stack.NewEventerError(err)
+	}
+
+	return nil
+}
+
+func (m *Machine) createSnapshot(ctx context.Context) (err error) {
+	args, err := m.SnapshotArgs()
+	if err != nil {
+		return err
+	}
+
+	latestState := m.State()
+
+	if err := modelhelper.ChangeMachineState(m.ObjectId, "Machine is creating snapshot", machinestate.Snapshotting); err != nil {
+		return err
+	}
+
+	defer modelhelper.ChangeMachineState(m.ObjectId, "Machine is marked as "+latestState.String(), latestState)
+
+	a := m.Session.AWSClient
+
+	m.PushEvent("Creating snapshot initialized", 10, machinestate.Snapshotting)
+
+	instance, err := a.Instance()
+	if err != nil {
+		return err
+	}
+
+	volumeID, err := rootVolumeID(instance)
+	if err != nil {
+		return err
+	}
+
+	desc := fmt.Sprintf("user-%s-%s", m.Username(), m.ObjectId.Hex())
+
+	m.PushEvent("Creating snapshot", 50, machinestate.Snapshotting)
+
+	snapshot, err := a.CreateSnapshot(volumeID, desc)
+	if err != nil {
+		return err
+	}
+
+	snapshotID := aws.StringValue(snapshot.SnapshotId)
+
+	m.Log.Debug("snapshot created successfully: %+v", snapshot)
+
+	err = m.AddSnapshot(&models.Snapshot{
+		SnapshotId:  snapshotID,
+		Region:      a.Region,
+		StorageSize: strconv.FormatInt(aws.Int64Value(snapshot.VolumeSize), 10),
+		Label:       args.Label,
+	})
+	if err != nil {
+		if e := a.DeleteSnapshot(snapshotID); e != nil {
+			m.Log.Warning("failed to delete orphaned snapshot %q: %s", snapshotID, e)
+		}
+
+		return err
+	}
+
+	tags := map[string]string{
+		"Name":             desc,
+		"koding-user":      m.Username(),
+		"koding-machineId": m.ObjectId.Hex(),
+	}
+
+	if err := a.AddTags(snapshotID, tags); err != nil {
+		// don't return for a snapshot tag problem
+		m.Log.Warning("failed to tag the new snapshot: %s", err)
+	}
+
+	m.PushEvent("Snapshot creation finished successfully", 80, machinestate.Snapshotting)
+
+	return nil
+}
+
+func (m *Machine) deleteSnapshot(ctx context.Context) error {
+	args, err := m.SnapshotArgs()
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := m.Snapshot(args.SnapshotId)
+	if err != nil {
+		return err
+	}
+
+	if snapshot.Region != m.Session.AWSClient.Region {
+		return fmt.Errorf("snapshot region %q does not match machine region %q", snapshot.Region, m.Session.AWSClient.Region)
+	}
+
+	m.Log.Info("deleting snapshot from AWS %s", snapshot.SnapshotId)
+
+	if err := m.Session.AWSClient.DeleteSnapshot(snapshot.SnapshotId); err != nil {
+		return err
+	}
+
+	return m.DeleteSnapshotData(snapshot.SnapshotId)
+}
+
+// restoreSnapshot replaces the root volume of the machine with a new one
+// created from the requested snapshot.
+//
+// The machine is stopped for the time of restoring and started
+// afterwards. The old root volume is deleted on success.
+func (m *Machine) restoreSnapshot(ctx context.Context) (err error) {
+	args, err := m.SnapshotArgs()
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := m.Snapshot(args.SnapshotId)
+	if err != nil {
+		return err
+	}
+
+	a := m.Session.AWSClient
+
+	if snapshot.Region != a.Region {
+		return fmt.Errorf("snapshot region %q does not match machine region %q", snapshot.Region, a.Region)
+	}
+
+	latestState := m.State()
+
+	if err := modelhelper.ChangeMachineState(m.ObjectId, "Machine is restoring snapshot", machinestate.Building); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			modelhelper.ChangeMachineState(m.ObjectId, "Machine is marked as "+latestState.String(), latestState)
+		}
+	}()
+
+	m.PushEvent("Restoring snapshot initialized", 10, machinestate.Building)
+
+	instance, err := a.Instance()
+	if err != nil {
+		return err
+	}
+
+	oldVolumeID, err := rootVolumeID(instance)
+	if err != nil {
+		return err
+	}
+
+	oldVol, err := a.ExistingVolume(oldVolumeID)
+	if err != nil {
+		return fmt.Errorf("couldn't retrieve existing volume %q: %s", oldVolumeID, err)
+	}
+
+	if latestState != machinestate.Stopped {
+		m.PushEvent("Stopping machine", 20, machinestate.Building)
+
+		if err := a.Stop(ctx); err != nil {
+			return err
+		}
+
+		latestState = machinestate.Stopped
+	}
+
+	m.PushEvent("Creating volume from snapshot", 40, machinestate.Building)
+
+	volType := aws.StringValue(oldVol.VolumeType)
+	availZone := aws.StringValue(instance.Placement.AvailabilityZone)
+	size := int(aws.Int64Value(oldVol.Size))
+
+	if n, e := strconv.Atoi(snapshot.StorageSize); e == nil && n > size {
+		size = n
+	}
+
+	volume, err := a.CreateVolume(snapshot.SnapshotId, availZone, volType, size)
+	if err != nil {
+		return err
+	}
+
+	newVolumeID := aws.StringValue(volume.VolumeId)
+	devicePath := aws.StringValue(instance.RootDeviceName)
+
+	m.Log.Info("new volume was created with id %s", newVolumeID)
+
+	defer func() {
+		if err != nil {
+			m.Log.Info("(an error occurred) deleting new volume %s", newVolumeID)
+
+			if e := a.DeleteVolume(newVolumeID); e != nil {
+				m.Log.Error("couldn't delete: %s", e)
+			}
+		}
+	}()
+
+	m.PushEvent("Detaching old volume", 60, machinestate.Building)
+
+	if err := a.DetachVolume(oldVolumeID); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			m.Log.Info("(an error occurred) detaching new volume %s", newVolumeID)
+
+			if e := a.DetachVolume(newVolumeID); e != nil {
+				m.Log.Error("couldn't detach: %s", e)
+			}
+
+			m.Log.Info("(an error occurred) attaching back old volume %s", oldVolumeID)
+
+			if e := a.AttachVolume(oldVolumeID, a.Id(), devicePath); e != nil {
+				m.Log.Error("couldn't attach: %s", e)
+			}
+		} else {
+			m.Log.Info("deleting old volume %s (not needed anymore)", oldVolumeID)
+
+			// The restore has already succeeded, so failing to delete
+			// the old volume is not fatal - it is retried for a while
+			// and logged, so it can be cleaned up manually if needed.
+			opts := backoff.NewExponentialBackOff()
+			opts.InitialInterval = 2 * time.Second
+			opts.MaxElapsedTime = 2 * time.Minute
+
+			e := backoff.Retry(func() error {
+				err := a.DeleteVolume(oldVolumeID)
+				if err != nil {
+					m.Log.Warning("failed to delete old volume %s, retrying: %s", oldVolumeID, err)
+				}
+				return err
+			}, opts)
+
+			if e != nil {
+				m.Log.Error("couldn't delete old volume %s: %s", oldVolumeID, e)
+			}
+		}
+	}()
+
+	m.PushEvent("Attaching new volume", 70, machinestate.Building)
+
+	if err := a.AttachVolume(newVolumeID, a.Id(), devicePath); err != nil {
+		return err
+	}
+
+	m.PushEvent("Starting machine", 80, machinestate.Building)
+
+	instance, err = a.Start(ctx)
+	if err != nil {
+		return err
+	}
+
+	m.IpAddress = aws.StringValue(instance.PublicIpAddress)
+
+	m.PushEvent("Checking remote machine", 90, machinestate.Building)
+
+	if err := m.WaitKlientReady(); err != nil {
+		return err
+	}
+
+	return m.Session.DB.Run("jMachines", func(c *mgo.Collection) error {
+		return c.UpdateId(
+			m.ObjectId,
+			bson.M{"$set": bson.M{
+				"ipAddress":         m.IpAddress,
+				"meta.storage_size": size,
+				"status.state":      machinestate.Running.String(),
+				"status.modifiedAt": time.Now().UTC(),
+				"status.reason":     "Machine is running",
+			}},
+		)
+	})
+}
+
+func rootVolumeID(instance *ec2.Instance) (string, error) {
+	root := aws.StringValue(instance.RootDeviceName)
+
+	for _, bd := range instance.BlockDeviceMappings {
+		if bd.Ebs != nil && aws.StringValue(bd.DeviceName) == root {
+			return aws.StringValue(bd.Ebs.VolumeId), nil
+		}
+	}
+
+	return "", fmt.Errorf("no root block device available for %q", aws.StringValue(instance.InstanceId))
+}
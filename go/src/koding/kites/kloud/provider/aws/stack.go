@@ -3,7 +3,9 @@ package awsprovider
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -19,12 +21,20 @@ import (
 )
 
 // Cred represents jCredentialDatas.meta for "aws" provider.
+//
+// The credential either holds static access and secret keys,
+// or an ARN of a role kloud is allowed to assume, in which case
+// temporary credentials are obtained with STS AssumeRole.
 type Cred struct {
 	Region    string `json:"region" bson:"region" hcl:"region"`
 	AccessKey string `json:"access_key" bson:"access_key" hcl:"access_key"`
 	SecretKey string `json:"secret_key" bson:"secret_key" hcl:"secret_key"`
 
-	// Bootstrap metadata.
+	// AssumeRole credential.
+	RoleARN    string `json:"role_arn,omitempty" bson:"role_arn,omitempty" hcl:"role_arn"`
+	ExternalID string `json:"external_id,omitempty" bson:"external_id,omitempty" hcl:"external_id"`
+
+	// Bootstrap metadata of the credential region.
 	ACL       string `json:"acl,omitempty" bson:"acl,omitempty" hcl:"acl"`
 	CidrBlock string `json:"cidr_block,omitempty" bson:"cidr_block,omitempty" hcl:"cidr_block"`
 	IGW       string `json:"igw,omitempty" bson:"igw,omitempty" hcl:"igw"`
@@ -34,46 +44,194 @@ type Cred struct {
 	Subnet    string `json:"subnet,omitempty" bson:"subnet,omitempty" hcl:"subnet"`
 	VPC       string `json:"vpc,omitempty" bson:"vpc,omitempty" hcl:"vpc"`
 	AMI       string `json:"ami,omitempty" bson:"ami,omitempty" hcl:"ami"`
+
+	// Regions maps other regions, used by aliased aws providers
+	// of stack templates, to their bootstrap metadata.
+	Regions map[string]*Bootstrap `json:"regions,omitempty" bson:"regions,omitempty" hcl:"-"`
+
+	// creds are temporary credentials of the role, set by AssumeRole.
+	creds *credentials.Credentials
 }
 
 var _ stack.Validator = (*Cred)(nil)
 
-func (meta *Cred) BootstrapValid() error {
-	if meta.ACL == "" {
+// Bootstrap represents resources created by bootstrap in a single
+// region of an aws account, which are used by default by instances
+// of stacks.
+type Bootstrap struct {
+	ACL       string `json:"acl,omitempty" bson:"acl,omitempty" hcl:"acl"`
+	CidrBlock string `json:"cidr_block,omitempty" bson:"cidr_block,omitempty" hcl:"cidr_block"`
+	IGW       string `json:"igw,omitempty" bson:"igw,omitempty" hcl:"igw"`
+	KeyPair   string `json:"key_pair,omitempty" bson:"key_pair,omitempty" hcl:"key_pair"`
+	RTB       string `json:"rtb,omitempty" bson:"rtb,omitempty" hcl:"rtb"`
+	SG        string `json:"sg,omitempty" bson:"sg,omitempty" hcl:"sg"`
+	Subnet    string `json:"subnet,omitempty" bson:"subnet,omitempty" hcl:"subnet"`
+	VPC       string `json:"vpc,omitempty" bson:"vpc,omitempty" hcl:"vpc"`
+	AMI       string `json:"ami,omitempty" bson:"ami,omitempty" hcl:"ami"`
+}
+
+// Valid implements the kloud.Validator interface.
+func (b *Bootstrap) Valid() error {
+	if b == nil {
+		return errors.New("region is not bootstrapped")
+	}
+	if b.ACL == "" {
 		return errors.New("acl is empty or missing")
 	}
-	if meta.CidrBlock == "" {
+	if b.CidrBlock == "" {
 		return errors.New("CIDR block is empty or missing")
 	}
-	if meta.IGW == "" {
+	if b.IGW == "" {
 		return errors.New("IGW is empty or missing")
 	}
-	if meta.KeyPair == "" {
+	if b.KeyPair == "" {
 		return errors.New("key pair is empty or missing")
 	}
-	if meta.RTB == "" {
+	if b.RTB == "" {
 		return errors.New("RTB is empty or missing")
 	}
-	if meta.SG == "" {
+	if b.SG == "" {
 		return errors.New("SG is empty or missing")
 	}
-	if meta.Subnet == "" {
+	if b.Subnet == "" {
 		return errors.New("subnet is empty or missing")
 	}
-	if meta.VPC == "" {
+	if b.VPC == "" {
 		return errors.New("VPC is empty or missing")
 	}
-	if meta.AMI == "" {
+	if b.AMI == "" {
 		return errors.New("AMI is empty or missing")
 	}
 	return nil
 }
 
+// BootstrapValid checks whether the credential region was bootstrapped.
+func (meta *Cred) BootstrapValid() error {
+	return meta.Bootstrap(meta.Region).Valid()
+}
+
+// Bootstrap gives bootstrap metadata for the given region.
+//
+// It returns nil if the region was not bootstrapped.
+func (meta *Cred) Bootstrap(region string) *Bootstrap {
+	if region == meta.Region {
+		return &Bootstrap{
+			ACL:       meta.ACL,
+			CidrBlock: meta.CidrBlock,
+			IGW:       meta.IGW,
+			KeyPair:   meta.KeyPair,
+			RTB:       meta.RTB,
+			SG:        meta.SG,
+			Subnet:    meta.Subnet,
+			VPC:       meta.VPC,
+			AMI:       meta.AMI,
+		}
+	}
+
+	return meta.Regions[region]
+}
+
+// SetBootstrap sets bootstrap metadata for the given region.
+//
+// If b is nil, the metadata of the region is removed.
+func (meta *Cred) SetBootstrap(region string, b *Bootstrap) {
+	if region == meta.Region {
+		if b == nil {
+			b = &Bootstrap{}
+		}
+
+		meta.ACL = b.ACL
+		meta.CidrBlock = b.CidrBlock
+		meta.IGW = b.IGW
+		meta.KeyPair = b.KeyPair
+		meta.RTB = b.RTB
+		meta.SG = b.SG
+		meta.Subnet = b.Subnet
+		meta.VPC = b.VPC
+		meta.AMI = b.AMI
+
+		return
+	}
+
+	if b == nil {
+		delete(meta.Regions, region)
+
+		if len(meta.Regions) == 0 {
+			meta.Regions = nil
+		}
+
+		return
+	}
+
+	if meta.Regions == nil {
+		meta.Regions = make(map[string]*Bootstrap)
+	}
+
+	meta.Regions[region] = b
+}
+
+// BootstrapRegions gives the credential region followed by other
+// bootstrapped regions, sorted.
+func (meta *Cred) BootstrapRegions() []string {
+	regions := make([]string, 0, len(meta.Regions))
+
+	for region := range meta.Regions {
+		if region != meta.Region {
+			regions = append(regions, region)
+		}
+	}
+
+	sort.Strings(regions)
+
+	return append([]string{meta.Region}, regions...)
+}
+
+// AssumeRole makes the credential use temporary credentials
+// of its role, obtained from the given role provider.
+//
+// It is a nop for credentials with static keys.
+func (meta *Cred) AssumeRole(roles *amazon.RoleProvider) error {
+	if meta.RoleARN == "" {
+		return nil
+	}
+
+	if roles == nil {
+		return errors.New("aws meta: assuming roles is not supported")
+	}
+
+	meta.creds = roles.Credentials(meta.RoleARN, meta.ExternalID)
+
+	return nil
+}
+
 // Credentials creates new AWS credentials value from the given meta.
 func (meta *Cred) Credentials() *credentials.Credentials {
+	if meta.creds != nil {
+		return meta.creds
+	}
+
 	return credentials.NewStaticCredentials(meta.AccessKey, meta.SecretKey, "")
 }
 
+// Variables gives Terraform variables, which hold current values
+// of the credentials.
+//
+// Temporary credentials are refreshed before they expire, thus
+// the variables are expected to be built right before each
+// Terraform operation.
+func (meta *Cred) Variables() (map[string]string, error) {
+	v, err := meta.Credentials().Get()
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]string{
+		"aws_access_key":    v.AccessKeyID,
+		"aws_secret_key":    v.SecretAccessKey,
+		"aws_session_token": v.SessionToken,
+	}, nil
+}
+
 // Options creates new amazon client options.
 func (meta *Cred) Options() *amazon.ClientOptions {
 	return &amazon.ClientOptions{
@@ -90,6 +248,10 @@ const arnPrefix = "arn:aws:iam::"
 
 // AccountID parses an AWS arn string to get the Account ID.
 func (meta *Cred) AccountID() (string, error) {
+	if meta.RoleARN != "" {
+		return parseAccountID(meta.RoleARN)
+	}
+
 	user, err := iam.New(meta.session()).GetUser(nil)
 	if err == nil {
 		return parseAccountID(aws.StringValue(user.User.Arn))
@@ -145,16 +307,10 @@ func parseAccountID(arn string) (string, error) {
 	return accountID, nil
 }
 
+// ResetBootstrap removes bootstrap metadata of all regions.
 func (meta *Cred) ResetBootstrap() {
-	meta.ACL = ""
-	meta.CidrBlock = ""
-	meta.IGW = ""
-	meta.KeyPair = ""
-	meta.RTB = ""
-	meta.SG = ""
-	meta.Subnet = ""
-	meta.VPC = ""
-	meta.AMI = ""
+	meta.SetBootstrap(meta.Region, nil)
+	meta.Regions = nil
 }
 
 // Valid implements the kloud.Validator interface.
@@ -162,6 +318,15 @@ func (meta *Cred) Valid() error {
 	if meta.Region == "" {
 		return errors.New("aws meta: region is empty")
 	}
+	if meta.RoleARN != "" {
+		if !strings.HasPrefix(meta.RoleARN, arnPrefix) || !strings.Contains(meta.RoleARN, ":role/") {
+			return fmt.Errorf("aws meta: invalid role ARN: %q", meta.RoleARN)
+		}
+		if meta.ExternalID == "" {
+			return errors.New("aws meta: external ID is empty")
+		}
+		return nil
+	}
 	if meta.AccessKey == "" {
 		return errors.New("aws meta: access key is empty")
 	}
@@ -180,8 +345,11 @@ type Stack struct {
 	// The following fields are set by buildResources method:
 	ids     stackplan.KiteMap
 	klients map[string]*stackplan.DialState
-	ident   string
-	cred    *Cred
+	aliases map[string]*providerAlias // maps alias name to provider
+	labels  map[string]*providerAlias // maps machine label to provider
+
+	roles       *amazon.RoleProvider
+	roleTimeout time.Duration
 }
 
 // Ensure Provider implements the kloud.StackProvider interface.
@@ -203,11 +371,16 @@ func (p *Provider) Stack(ctx context.Context) (stack.Stack, error) {
 			Provider:     "aws",
 			ResourceType: "instance",
 		},
+		roles:       p.Roles,
+		roleTimeout: p.RoleTimeout,
 	}
 
 	bs.BuildResources = s.buildResources
 	bs.WaitResources = s.waitResources
 	bs.UpdateResources = s.updateResources
+	bs.EstimateCost = s.estimateCost
+	bs.TerraformVariables = s.terraformVariables
+	bs.TerraformTimeout = s.terraformTimeout
 
 	return s, nil
 }
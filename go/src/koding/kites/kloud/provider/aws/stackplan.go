@@ -39,25 +39,16 @@ func (s *Stack) SetAwsRegion(region string) error {
 	return t.Flush()
 }
 
+// InjectAWSData injects bootstrap metadata and Koding user data into
+// each aws_instance of the template.
+//
+// Bootstrap metadata is read for the region and credential of the
+// provider the instance uses, thus s.buildProviders is expected
+// to be called first.
 func (s *Stack) InjectAWSData() (stackplan.KiteMap, error) {
 	t := s.Builder.Template
 
-	var meta *Cred
-	for _, cred := range s.Builder.Credentials {
-		if cred.Provider != "aws" {
-			continue
-		}
-
-		meta = cred.Meta.(*Cred)
-
-		if err := meta.BootstrapValid(); err != nil {
-			return nil, fmt.Errorf("invalid bootstrap metadata for %q: %s", cred.Identifier, err)
-		}
-
-		break
-	}
-
-	if meta == nil {
+	if len(s.aliases) == 0 {
 		s.Log.Debug("No AWS data found to be injected")
 		return nil, nil
 	}
@@ -75,8 +66,19 @@ func (s *Stack) InjectAWSData() (stackplan.KiteMap, error) {
 	}
 
 	kiteIDs := make(stackplan.KiteMap)
+	s.labels = make(map[string]*providerAlias)
 
 	for resourceName, instance := range resource.AwsInstance {
+		alias, err := s.resourceAlias("aws_instance."+resourceName, instance)
+		if err != nil {
+			return nil, err
+		}
+
+		meta, err := alias.Bootstrap()
+		if err != nil {
+			return nil, err
+		}
+
 		// Do not overwrite SSH key pair with the bootstrap one
 		// when user sets it explicitly in a template.
 		if s, ok := instance["key_name"]; !ok || s == "" {
@@ -158,12 +160,14 @@ func (s *Stack) InjectAWSData() (stackplan.KiteMap, error) {
 
 			// if the count is greater than 1, terraform will change the labels
 			// and append a number(starting with index 0) to each label
+			label := resourceName
 			if count != 1 {
-				kiteIDs[resourceName+"."+strconv.Itoa(i)] = kiteId
-			} else {
-				kiteIDs[resourceName] = kiteId
+				label = resourceName + "." + strconv.Itoa(i)
 			}
 
+			kiteIDs[label] = kiteId
+			s.labels[label] = alias
+
 			countKeys[strconv.Itoa(i)] = kiteKey
 		}
 
@@ -180,7 +184,7 @@ func (s *Stack) InjectAWSData() (stackplan.KiteMap, error) {
 		return nil, err
 	}
 
-	if err := t.ShadowVariables("FORBIDDEN", "aws_access_key", "aws_secret_key"); err != nil {
+	if err := t.ShadowVariables("FORBIDDEN", s.shadowedVariables()...); err != nil {
 		return nil, err
 	}
 
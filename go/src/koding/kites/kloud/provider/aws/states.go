@@ -0,0 +1,124 @@
+package awsprovider
+
+import (
+	"fmt"
+	"net/url"
+
+	"koding/db/models"
+	"koding/db/mongodb/modelhelper"
+	"koding/kites/kloud/api/amazon"
+	"koding/kites/kloud/machinestate"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/hashicorp/go-multierror"
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// instanceGroup groups instances which can be described with
+// a single EC2 call.
+type instanceGroup struct {
+	username   string
+	credential string
+	region     string
+}
+
+// States gives actual states of the given machines, as reported by EC2.
+// The instances are described with a single call per each credential
+// and region, klient is not queried.
+//
+// Machines without an instance are not included in the result. On error
+// the states read so far are returned together with the error.
+func (p *Provider) States(ctx context.Context, machines []*models.Machine) (map[bson.ObjectId]machinestate.State, error) {
+	groups := make(map[instanceGroup]map[string]bson.ObjectId)
+
+	for _, m := range machines {
+		var mt Meta
+		if err := modelhelper.BsonDecode(m.Meta, &mt); err != nil || mt.InstanceId == "" || mt.Region == "" {
+			continue
+		}
+
+		g := instanceGroup{
+			credential: m.Credential,
+			region:     mt.Region,
+		}
+
+		if owner := m.Owner(); owner != nil {
+			g.username = owner.Username
+		}
+
+		if groups[g] == nil {
+			groups[g] = make(map[string]bson.ObjectId)
+		}
+
+		groups[g][mt.InstanceId] = m.ObjectId
+	}
+
+	var err error
+	states := make(map[bson.ObjectId]machinestate.State)
+
+	for g, ids := range groups {
+		if e := p.instanceStates(g, ids, states); e != nil {
+			err = multierror.Append(err, e)
+		}
+	}
+
+	return states, err
+}
+
+func (p *Provider) instanceStates(g instanceGroup, ids map[string]bson.ObjectId, states map[bson.ObjectId]machinestate.State) error {
+	var cred Cred
+	if err := p.CredStore.Fetch(g.username, map[string]interface{}{g.credential: &cred}); err != nil {
+		return fmt.Errorf("unable to fetch %q credential: %s", g.credential, err)
+	}
+
+	if err := cred.AssumeRole(p.Roles); err != nil {
+		return err
+	}
+
+	c, err := amazon.NewClient(&amazon.ClientOptions{
+		Credentials: cred.Credentials(),
+		Region:      g.region, // machine may be in other region than credential's
+		Log:         p.Log.New("awsapi"),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to create AWS client for %q credential: %s", g.credential, err)
+	}
+
+	filters := make(url.Values)
+	for id := range ids {
+		filters.Add("instance-id", id)
+	}
+
+	// Filtering by instance IDs, contrary to passing them explicitly,
+	// does not fail the whole call when some of the instances are gone.
+	instances, err := c.InstancesByFilters(filters)
+	if err != nil && !amazon.IsNotFound(err) {
+		return err
+	}
+
+	found := make(map[string]machinestate.State, len(instances))
+
+	for _, instance := range instances {
+		state := amazon.StatusToState(aws.StringValue(instance.State.Name))
+
+		// Same as for Info, terminating instances are treated
+		// as already terminated ones.
+		if state == machinestate.Terminating {
+			state = machinestate.Terminated
+		}
+
+		found[aws.StringValue(instance.InstanceId)] = state
+	}
+
+	for instanceID, id := range ids {
+		state, ok := found[instanceID]
+		if !ok {
+			state = machinestate.NotInitialized
+		}
+
+		states[id] = state
+	}
+
+	return nil
+}
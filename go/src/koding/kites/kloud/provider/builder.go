@@ -3,6 +3,7 @@ package provider
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"koding/db/mongodb/modelhelper"
@@ -13,8 +14,13 @@ import (
 	"koding/kites/kloud/stackstate"
 	"koding/kites/kloud/terraformer"
 	tf "koding/kites/terraformer"
+	"koding/kites/terraformer/kodingcontext"
 
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/koding/kite"
+	"github.com/koding/kite/protocol"
 	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2/bson"
 )
 
 // Apply builds and expands compute stack template for the given ID and
@@ -38,12 +44,37 @@ func (bs *BaseStack) Apply(ctx context.Context) (interface{}, error) {
 		return nil, err
 	}
 
+	return bs.applyStack(ctx, &arg, nil)
+}
+
+// Rollback re-applies the stack with the requested revision of its
+// template. The stack's resources are updated from their current state,
+// which is kept by terraformer.
+func (bs *BaseStack) Rollback(ctx context.Context, req *stack.RollbackRequest) (interface{}, error) {
+	arg := &stack.ApplyRequest{
+		Provider:  req.Provider,
+		StackID:   req.StackID,
+		GroupName: req.GroupName,
+	}
+
+	return bs.applyStack(ctx, arg, req)
+}
+
+// applyStack applies the stack; if rb is non-nil, the stack template
+// is replaced with the requested revision before applying.
+func (bs *BaseStack) applyStack(ctx context.Context, arg *stack.ApplyRequest, rb *stack.RollbackRequest) (interface{}, error) {
 	err := bs.Builder.BuildStack(arg.StackID, arg.Credentials)
 
 	if err != nil && !(arg.Destroy && stackplan.IsNotFound(err, "jStackTemplate")) {
 		return nil, err
 	}
 
+	if rb != nil {
+		if err := bs.Builder.BuildRevision(rb.Revision); err != nil {
+			return nil, err
+		}
+	}
+
 	if state := bs.Builder.Stack.Stack.State(); state.InProgress() {
 		return nil, fmt.Errorf("State is currently %s. Please try again later", state)
 	}
@@ -53,9 +84,9 @@ func (bs *BaseStack) Apply(ctx context.Context) (interface{}, error) {
 	}
 
 	if arg.Destroy {
-		err = bs.destroy(ctx, &arg)
+		err = bs.destroy(ctx, arg)
 	} else {
-		err = bs.apply(ctx, &arg)
+		err = bs.apply(ctx, arg)
 	}
 
 	if err != nil {
@@ -63,7 +94,8 @@ func (bs *BaseStack) Apply(ctx context.Context) (interface{}, error) {
 	}
 
 	return stack.ControlResult{
-		EventId: bs.Eventer.ID(),
+		EventId:     bs.Eventer.ID(),
+		EventCursor: eventer.Cursor(bs.Eventer),
 	}, nil
 }
 
@@ -87,7 +119,13 @@ func (bs *BaseStack) apply(ctx context.Context, req *stack.ApplyRequest) error {
 		modelhelper.SetStackState(req.StackID, "Stack building started", stackstate.Building)
 		log.Info("======> %s started <======", strings.ToUpper(bs.Req.Method))
 
-		if err := bs.applyAsync(ctx, req); err != nil {
+		if err := bs.applyAsync(ctx, req); err == kodingcontext.ErrCanceled {
+			// stack state was already set by applyCanceled
+			finalEvent.Message = bs.Req.Method + " canceled"
+			finalEvent.Status = machinestate.NotInitialized
+			finalEvent.Error = err.Error()
+			log.Info("======> %s canceled (time: %s) <======", strings.ToUpper(bs.Req.Method), time.Since(start))
+		} else if err != nil {
 			modelhelper.SetStackState(req.StackID, "Stack building failed", stackstate.NotInitialized)
 			finalEvent.Status = machinestate.NotInitialized
 
@@ -130,12 +168,20 @@ func (bs *BaseStack) destroy(ctx context.Context, req *stack.ApplyRequest) error
 		return err
 	}
 
+	unlock, err := bs.lockMachines()
+	if err != nil {
+		return err
+	}
+
 	if err := bs.Builder.Database.Detach(); err != nil {
+		unlock()
 		return err
 	}
 
 	// This part is done asynchronously.
 	go func() {
+		defer unlock()
+
 		finalEvent := &eventer.Event{
 			Message:    bs.Req.Method + " finished",
 			Percentage: 100,
@@ -143,7 +189,15 @@ func (bs *BaseStack) destroy(ctx context.Context, req *stack.ApplyRequest) error
 		}
 
 		err := bs.destroyAsync(ctx, req)
-		if err != nil {
+		if err == kodingcontext.ErrCanceled {
+			// Machines are already detached, leave the stack in a state
+			// that allows for destroying it again.
+			modelhelper.SetStackState(req.StackID, "Stack destroying was canceled", stackstate.Unknown)
+
+			finalEvent.Message = bs.Req.Method + " canceled"
+			finalEvent.Error = err.Error()
+			log.Info("======> %s canceled (time: %s) <======", strings.ToUpper(bs.Req.Method), time.Since(start))
+		} else if err != nil {
 			// don't pass the error directly to the eventer, mask it to avoid
 			// error leaking to the client. We just log it here.
 			finalEvent.Error = err.Error()
@@ -180,10 +234,14 @@ func (bs *BaseStack) destroyAsync(ctx context.Context, req *stack.ApplyRequest)
 
 	bs.Log.Debug("Fetched terraform data: koding=%+v, template=%+v", bs.Builder.Koding, bs.Builder.Template)
 
-	if bs.Builder.Stack.Stack.State() != stackstate.NotInitialized {
+	if bs.DestroyResources != nil {
+		if err := bs.DestroyResources(ctx); err != nil {
+			return err
+		}
+	} else if bs.Builder.Stack.Stack.State() != stackstate.NotInitialized {
 		bs.Log.Debug("Connection to Terraformer")
 
-		tfKite, err := terraformer.Connect(bs.Session.Terraformer)
+		tfKite, err := bs.connectTerraformer()
 		if err != nil {
 			return err
 		}
@@ -192,11 +250,16 @@ func (bs *BaseStack) destroyAsync(ctx context.Context, req *stack.ApplyRequest)
 		tfReq := &tf.TerraformRequest{
 			ContentID: req.GroupName + "-" + req.StackID,
 			TraceID:   bs.TraceID,
+			Output:    terraformer.OutputCallback(bs.pushOutput),
 		}
 
 		bs.Log.Debug("Calling terraform.destroy method with context:")
 		bs.Log.Debug("%+v", tfReq)
 
+		if tfReq.Variables, err = bs.terraformVariables(); err != nil {
+			return err
+		}
+
 		_, err = tfKite.Destroy(tfReq)
 		if err != nil {
 			return err
@@ -221,6 +284,12 @@ func (bs *BaseStack) applyAsync(ctx context.Context, req *stack.ApplyRequest) er
 		return err
 	}
 
+	unlock, err := bs.lockMachines()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
 	bs.Eventer.Push(&eventer.Event{
 		Message:    "Fetching and validating credentials",
 		Percentage: 30,
@@ -236,13 +305,6 @@ func (bs *BaseStack) applyAsync(ctx context.Context, req *stack.ApplyRequest) er
 	}
 
 	bs.Log.Debug("Fetched terraform data: koding=%+v, template=%+v", bs.Builder.Koding, bs.Builder.Template)
-	bs.Log.Debug("Connection to Terraformer")
-
-	tfKite, err := terraformer.Connect(bs.Session.Terraformer)
-	if err != nil {
-		return err
-	}
-	defer tfKite.Close()
 
 	contentID := req.GroupName + "-" + req.StackID
 	bs.Log.Debug("Building template: %s", contentID)
@@ -260,6 +322,14 @@ func (bs *BaseStack) applyAsync(ctx context.Context, req *stack.ApplyRequest) er
 		return err
 	}
 
+	if err := bs.checkPolicy(req.GroupName); err != nil {
+		return err
+	}
+
+	if err := bs.checkBudget(req.GroupName); err != nil {
+		return err
+	}
+
 	out, err := bs.Builder.Template.JsonOutput()
 	if err != nil {
 		return err
@@ -267,6 +337,58 @@ func (bs *BaseStack) applyAsync(ctx context.Context, req *stack.ApplyRequest) er
 
 	bs.Builder.Stack.Template = out
 
+	var state *terraform.State
+
+	if bs.ApplyResources != nil {
+		state, err = bs.ApplyResources(ctx)
+	} else {
+		state, err = bs.applyTerraform(req, contentID)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	bs.Eventer.Push(&eventer.Event{
+		Message:    "Checking VM connections",
+		Percentage: 70,
+		Status:     machinestate.Building,
+	})
+
+	if err := bs.WaitResources(ctx); err != nil {
+		return err
+	}
+
+	bs.Eventer.Push(&eventer.Event{
+		Message:    "Updating machine settings",
+		Percentage: 90,
+		Status:     machinestate.Building,
+	})
+
+	err = bs.UpdateResources(state)
+
+	if e := bs.Builder.UpdateStack(); e != nil && err == nil {
+		err = e
+	}
+
+	return err
+}
+
+// applyTerraform applies the stack template with terraformer.
+func (bs *BaseStack) applyTerraform(req *stack.ApplyRequest, contentID string) (*terraform.State, error) {
+	bs.Log.Debug("Connection to Terraformer")
+
+	tfKite, err := bs.connectTerraformer()
+	if err != nil {
+		return nil, err
+	}
+	defer tfKite.Close()
+
+	vars, err := bs.terraformVariables()
+	if err != nil {
+		return nil, err
+	}
+
 	done := make(chan struct{})
 
 	// because apply can last long, we are going to increment the eventer's
@@ -298,40 +420,293 @@ func (bs *BaseStack) applyAsync(ctx context.Context, req *stack.ApplyRequest) er
 		Content:   bs.Builder.Stack.Template,
 		ContentID: contentID,
 		TraceID:   bs.TraceID,
+		Output:    terraformer.OutputCallback(bs.pushOutput),
 	}
 
 	bs.Log.Debug("Final stack template. Calling terraform.apply method:")
 	bs.Log.Debug("%+v", tfReq)
 
+	tfReq.Variables = vars
+
 	state, err := tfKite.Apply(tfReq)
 
 	close(done)
 
+	if err == kodingcontext.ErrCanceled {
+		bs.applyCanceled(tfKite, contentID, req.StackID)
+	}
+
+	return state, err
+}
+
+// connectTerraformer connects to terraformer for apply or destroy
+// operation, limiting its duration with TerraformTimeout.
+func (bs *BaseStack) connectTerraformer() (*terraformer.Terraformer, error) {
+	tfKite, err := terraformer.Connect(bs.Session.Terraformer)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	bs.Eventer.Push(&eventer.Event{
-		Message:    "Checking VM connections",
-		Percentage: 70,
-		Status:     machinestate.Building,
+	if bs.TerraformTimeout != nil {
+		tfKite.Timeout = bs.TerraformTimeout()
+	}
+
+	return tfKite, nil
+}
+
+// terraformVariables gives variables for a terraformer request.
+//
+// Callers must not log the variables, as they may hold credentials.
+func (bs *BaseStack) terraformVariables() (map[string]string, error) {
+	if bs.TerraformVariables == nil {
+		return nil, nil
+	}
+
+	return bs.TerraformVariables()
+}
+
+// pushOutput attaches a line of terraform output to the stack's
+// event stream.
+func (bs *BaseStack) pushOutput(out *tf.Output) {
+	eventer.PushOutput(bs.Eventer, &eventer.Output{
+		Resource: out.Resource,
+		Line:     out.Line,
+		Error:    out.Error,
 	})
+}
 
-	if err := bs.WaitResources(ctx); err != nil {
-		return err
+// CancelTimeout is a maximum time other kloud instance is given
+// for canceling an operation.
+var CancelTimeout = 30 * time.Second
+
+// Cancel stops the ongoing apply or destroy operation of the stack.
+//
+// The operation is stopped gracefully by terraformer, the apply or
+// destroy call ends with kodingcontext.ErrCanceled error. If the operation
+// is not run by this kloud, the request is passed to all other kloud
+// instances and an error is returned if none of them acknowledged it.
+func (bs *BaseStack) Cancel(ctx context.Context, req *stack.CancelRequest) (interface{}, error) {
+	computeStack, err := modelhelper.GetComputeStack(req.StackID)
+	if err != nil {
+		return nil, stackplan.ResError(err, "jComputeStack")
 	}
 
-	bs.Eventer.Push(&eventer.Event{
-		Message:    "Updating machine settings",
-		Percentage: 90,
-		Status:     machinestate.Building,
+	if computeStack.Group != req.GroupName {
+		return nil, fmt.Errorf("stack %q does not belong to %q team", req.StackID, req.GroupName)
+	}
+
+	if err := bs.checkStackOwner(computeStack.OriginId, req.GroupName); err != nil {
+		return nil, err
+	}
+
+	if state := computeStack.State(); !state.InProgress() {
+		return nil, fmt.Errorf("State is currently %s. There is no operation to cancel", state)
+	}
+
+	contentID := req.GroupName + "-" + req.StackID
+
+	canceled, err := bs.cancelLocal(contentID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The operation may be run by other kloud instance, each of
+	// them uses its own terraformer.
+	if !canceled {
+		canceled = bs.cancelRemote(contentID)
+	}
+
+	if !canceled {
+		return nil, fmt.Errorf("no kloud instance acknowledged canceling operation of stack %q", req.StackID)
+	}
+
+	return stack.ControlResult{
+		EventId: req.EventID,
+	}, nil
+}
+
+// cancelLocal cancels the operation of the given content run by
+// the terraformer of this kloud. It returns false if there is
+// no such operation.
+func (bs *BaseStack) cancelLocal(contentID string) (bool, error) {
+	tfKite, err := terraformer.Connect(bs.Session.Terraformer)
+	if err != nil {
+		return false, err
+	}
+	defer tfKite.Close()
+
+	switch err := tfKite.Cancel(contentID); err {
+	case nil:
+		return true, nil
+	case kodingcontext.ErrNotRunning:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// cancelRemote asks all other kloud instances to cancel the operation
+// of the given content. It returns true if any of them acknowledged it.
+func (bs *BaseStack) cancelRemote(contentID string) bool {
+	self := bs.Session.Kite.Kite()
+
+	klouds, err := bs.Session.Kite.GetKites(&protocol.KontrolQuery{
+		Username:    self.Username,
+		Environment: self.Environment,
+		Name:        self.Name,
 	})
+	if err != nil {
+		bs.Log.Warning("unable to look up kloud instances: %s", err)
+		return false
+	}
 
-	err = bs.UpdateResources(state)
+	var wg sync.WaitGroup
+	acks := make(chan bool, len(klouds))
 
-	if e := bs.Builder.UpdateStack(); e != nil && err == nil {
-		err = e
+	for _, k := range klouds {
+		if k.ID == self.ID {
+			continue
+		}
+
+		wg.Add(1)
+
+		go func(k *kite.Client) {
+			defer wg.Done()
+			defer k.Close()
+
+			ok, err := bs.cancelKloud(k, contentID)
+			if err != nil {
+				bs.Log.Warning("unable to cancel %q on kloud %s: %s", contentID, k.ID, err)
+			}
+
+			acks <- ok
+		}(k)
 	}
 
-	return err
+	wg.Wait()
+	close(acks)
+
+	canceled := false
+	for ok := range acks {
+		canceled = canceled || ok
+	}
+
+	return canceled
+}
+
+func (bs *BaseStack) cancelKloud(k *kite.Client, contentID string) (bool, error) {
+	k.Auth = &kite.Auth{
+		Type: "kloudctl",
+		Key:  bs.SecretKey,
+	}
+
+	if err := k.DialTimeout(CancelTimeout); err != nil {
+		return false, err
+	}
+
+	resp, err := k.TellWithTimeout("stack.cancelLocal", CancelTimeout, &stack.CancelLocalRequest{
+		ContentID: contentID,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	var canceled bool
+	if err := resp.Unmarshal(&canceled); err != nil {
+		return false, err
+	}
+
+	return canceled, nil
+}
+
+// checkStackOwner ensures the requesting user owns the stack or is
+// an admin of the team.
+func (bs *BaseStack) checkStackOwner(originID bson.ObjectId, groupName string) error {
+	account, err := modelhelper.GetAccount(bs.Req.Username)
+	if err != nil {
+		return stackplan.ResError(err, "jAccount")
+	}
+
+	if account.Id == originID {
+		return nil
+	}
+
+	isAdmin, err := modelhelper.IsAdmin(bs.Req.Username, groupName)
+	if err != nil {
+		return err
+	}
+
+	if !isAdmin {
+		return fmt.Errorf("user %q is not allowed to access the stack", bs.Req.Username)
+	}
+
+	return nil
+}
+
+// lockMachines locks machines of the stack, so no machine operation
+// can run for the time of apply or destroy. The returned func
+// unlocks them.
+func (bs *BaseStack) lockMachines() (func(), error) {
+	var locked []string
+
+	unlock := func() {
+		for _, id := range locked {
+			bs.Locker.Unlock(id)
+		}
+	}
+
+	if bs.Locker == nil {
+		return unlock, nil
+	}
+
+	for _, m := range bs.Builder.Machines {
+		id := m.ObjectId.Hex()
+
+		if err := bs.Locker.Lock(id); err != nil {
+			unlock()
+			return nil, fmt.Errorf("machine %q is busy: %s", m.Label, err)
+		}
+
+		locked = append(locked, id)
+	}
+
+	return unlock, nil
+}
+
+// applyCanceled brings the stack and its machines into a consistent
+// state after the apply was canceled.
+//
+// Machines, which resources are present in the partial state, are
+// marked as Unknown, so they are resolved by the state reconciler.
+// The remaining ones are marked as NotInitialized. The stack is left
+// in a state that allows for applying or destroying it again.
+func (bs *BaseStack) applyCanceled(tfKite *terraformer.Terraformer, contentID, stackID string) {
+	const reason = "Stack building was canceled"
+
+	var labels map[string]bool
+
+	if state, err := tfKite.State(contentID, 0); err == nil {
+		labels = stackplan.ResourceLabels(state)
+	} else {
+		bs.Log.Warning("unable to read partial state of %q: %s", contentID, err)
+	}
+
+	stackState := stackstate.NotInitialized
+
+	for label, m := range bs.Builder.Machines {
+		state := machinestate.NotInitialized
+
+		if labels == nil || labels[label] {
+			state = machinestate.Unknown
+			stackState = stackstate.Unknown
+		}
+
+		if err := modelhelper.ChangeMachineState(m.ObjectId, reason, state); err != nil {
+			bs.Log.Error("unable to update state of %q machine: %s", label, err)
+		}
+	}
+
+	if err := modelhelper.SetStackState(stackID, reason, stackState); err != nil {
+		bs.Log.Error("unable to update state of %q stack: %s", stackID, err)
+	}
 }
@@ -0,0 +1,79 @@
+package docker
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/terraform/terraform"
+
+	"golang.org/x/net/context"
+)
+
+func (s *Stack) buildResources() (err error) {
+	s.Log.Debug("Injecting variables from credential data identifiers, such as docker, custom, etc..")
+
+	s.ids, err = s.InjectDockerData()
+	if err != nil {
+		return err
+	}
+
+	meta := s.Credential.Meta.(*Cred)
+
+	if err := meta.BootstrapValid(); err != nil {
+		return err
+	}
+
+	c, err := newClient(meta, s.PrivateHosts)
+	if err != nil {
+		return err
+	}
+
+	return pullImages(c, s.Builder.Template, s.Log)
+}
+
+// terraformVariables writes TLS certificates of the stack's docker
+// credential for each Terraform operation and gives their path.
+func (s *Stack) terraformVariables() (map[string]string, error) {
+	cred := s.Credential
+
+	if cred == nil {
+		for _, c := range s.Builder.Credentials {
+			if c.Provider == "docker" {
+				cred = c
+				break
+			}
+		}
+	}
+
+	if cred == nil {
+		return nil, nil
+	}
+
+	path, err := writeCerts(cred.Identifier, cred.Meta.(*Cred))
+	if err != nil {
+		return nil, fmt.Errorf("unable to write certificates of %q credential: %s", cred.Identifier, err)
+	}
+
+	return map[string]string{
+		"docker_cert_path": path,
+	}, nil
+}
+
+func (s *Stack) waitResources(ctx context.Context) (err error) {
+	s.Log.Debug("Checking total '%d' klients", len(s.ids))
+
+	s.klients, err = s.p.DialKlients(ctx, s.ids)
+
+	return err
+}
+
+func (s *Stack) updateResources(state *terraform.State) error {
+	machines, err := s.p.MachinesFromState(state, s.klients)
+	if err != nil {
+		return err
+	}
+
+	s.Log.Debug("Machines from state: %+v", machines)
+	s.Log.Debug("Build data kiteIDS: %+v", s.ids)
+
+	return s.updateMachines(machines, s.Builder.Machines)
+}
@@ -0,0 +1,118 @@
+package docker
+
+import (
+	"fmt"
+
+	"koding/kites/kloud/api/dockerapi"
+	"koding/kites/kloud/policy"
+	"koding/kites/kloud/stack"
+
+	"golang.org/x/net/context"
+)
+
+// Bootstrap creates a network for containers of each docker credential,
+// or removes it when destroy is requested.
+func (s *Stack) Bootstrap(ctx context.Context) (interface{}, error) {
+	var arg stack.BootstrapRequest
+	if err := s.Req.Args.One().Unmarshal(&arg); err != nil {
+		return nil, err
+	}
+
+	if err := arg.Valid(); err != nil {
+		return nil, err
+	}
+
+	if !arg.Destroy {
+		p, err := s.Policy(arg.GroupName)
+		if err != nil {
+			return nil, err
+		}
+
+		if v := p.ValidateProvider("provider.docker", "docker"); v != nil {
+			return nil, policy.Check([]*policy.Violation{v})
+		}
+	}
+
+	if err := s.Builder.BuildCredentials(s.Req.Method, s.Req.Username, arg.GroupName, arg.Identifiers); err != nil {
+		return nil, err
+	}
+
+	for _, cred := range s.Builder.Credentials {
+		if cred.Provider != "docker" {
+			return nil, fmt.Errorf("unable to bootstrap non-docker credential: %s", cred.Provider)
+		}
+
+		meta := cred.Meta.(*Cred)
+
+		if err := meta.Valid(); err != nil {
+			return nil, fmt.Errorf("validating %q credential: %s", cred.Identifier, err)
+		}
+
+		c, err := newClient(meta, s.PrivateHosts)
+		if err != nil {
+			return nil, err
+		}
+
+		if arg.Destroy {
+			err = s.destroyNetwork(c, meta)
+		} else {
+			err = s.createNetwork(c, meta, arg.GroupName, cred.Identifier)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		s.Log.Debug("[%s] Bootstrap response: %+v", cred.Identifier, meta)
+
+		datas := map[string]interface{}{
+			cred.Identifier: meta,
+		}
+
+		if err := s.Builder.CredStore.Put(s.Req.Username, datas); err != nil {
+			return nil, err
+		}
+	}
+
+	return true, nil
+}
+
+func (s *Stack) createNetwork(c *dockerapi.Client, meta *Cred, group, identifier string) error {
+	name := "koding-" + identifier
+
+	_, err := c.Network(name)
+	if err == dockerapi.ErrNotFound {
+		s.Log.Info("Creating %q network belonging to identifier '%s'", name, identifier)
+
+		labels := map[string]string{
+			"koding-group":      group,
+			"koding-credential": identifier,
+		}
+
+		_, err = c.CreateNetwork(name, labels)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	meta.Network = name
+
+	return nil
+}
+
+func (s *Stack) destroyNetwork(c *dockerapi.Client, meta *Cred) error {
+	if meta.Network == "" {
+		return nil
+	}
+
+	s.Log.Info("Removing %q network", meta.Network)
+
+	if err := c.RemoveNetwork(meta.Network); err != nil && err != dockerapi.ErrNotFound {
+		return err
+	}
+
+	meta.Network = ""
+
+	return nil
+}
@@ -0,0 +1,5 @@
+# Terraform provider used by the docker kloud provider for managing
+# docker_container resources.
+TERRAFORM_COMMANDS+=(
+	vendor/github.com/hashicorp/terraform/builtin/bins/provider-docker
+)
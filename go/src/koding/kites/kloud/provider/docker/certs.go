@@ -0,0 +1,74 @@
+package docker
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CertDir is a directory where TLS certificates of docker credentials
+// are written for the docker Terraform provider. Terraformer runs
+// on the same host as kloud, so it reads them from there.
+var CertDir = filepath.Join(os.TempDir(), "kloud-docker")
+
+// writeCerts writes TLS certificates of the given credential in the
+// layout expected by the cert_path setting of the docker Terraform
+// provider and returns the path.
+//
+// It returns empty path for credentials without TLS certificates.
+func writeCerts(identifier string, meta *Cred) (string, error) {
+	if !meta.hasTLS() {
+		return "", nil
+	}
+
+	if identifier == "" || strings.ContainsAny(identifier, `/\.`) {
+		return "", errors.New("invalid credential identifier: " + identifier)
+	}
+
+	dir := filepath.Join(CertDir, identifier)
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+
+	files := map[string]string{
+		"ca.pem":   meta.CACert,
+		"cert.pem": meta.Cert,
+		"key.pem":  meta.Key,
+	}
+
+	for name, content := range files {
+		if err := writeFile(filepath.Join(dir, name), content); err != nil {
+			return "", err
+		}
+	}
+
+	return dir, nil
+}
+
+// writeFile replaces the file atomically, so concurrent operations
+// of the same credential never read a partially written one.
+func writeFile(path, content string) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return err
+	}
+
+	_, err = f.WriteString(content)
+
+	if e := f.Close(); e != nil && err == nil {
+		err = e
+	}
+
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+
+	if err != nil {
+		os.Remove(f.Name())
+	}
+
+	return err
+}
@@ -0,0 +1,83 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteCerts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kloud-docker")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	orig := CertDir
+	CertDir = dir
+	defer func() { CertDir = orig }()
+
+	cert, key := newCertPEM(t)
+
+	if path, err := writeCerts("ident", &Cred{Host: "unix:///var/run/docker.sock"}); err != nil || path != "" {
+		t.Fatalf("got %q, %v; want empty path for credential without TLS", path, err)
+	}
+
+	meta := &Cred{
+		Host:   "tcp://docker.example.com:2376",
+		CACert: cert,
+		Cert:   cert,
+		Key:    key,
+	}
+
+	if _, err := writeCerts("../ident", meta); err == nil {
+		t.Fatal("want error for invalid identifier")
+	}
+
+	path, err := writeCerts("ident", meta)
+	if err != nil {
+		t.Fatalf("writeCerts()=%s", err)
+	}
+
+	if want := filepath.Join(dir, "ident"); path != want {
+		t.Fatalf("got %q, want %q", path, want)
+	}
+
+	want := map[string]string{
+		"ca.pem":   cert,
+		"cert.pem": cert,
+		"key.pem":  key,
+	}
+
+	for name, content := range want {
+		file := filepath.Join(path, name)
+
+		p, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatalf("ReadFile()=%s", err)
+		}
+
+		if string(p) != content {
+			t.Fatalf("%s: got %q, want %q", name, p, content)
+		}
+
+		fi, err := os.Stat(file)
+		if err != nil {
+			t.Fatalf("Stat()=%s", err)
+		}
+
+		if perm := fi.Mode().Perm(); perm != 0600 {
+			t.Fatalf("%s: got %o permissions, want 0600", name, perm)
+		}
+	}
+
+	files, err := ioutil.ReadDir(path)
+	if err != nil {
+		t.Fatalf("ReadDir()=%s", err)
+	}
+
+	if len(files) != len(want) {
+		t.Fatalf("got %d files, want %d", len(files), len(want))
+	}
+}
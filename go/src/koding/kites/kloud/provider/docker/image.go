@@ -0,0 +1,93 @@
+package docker
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"koding/kites/kloud/api/dockerapi"
+	"koding/kites/kloud/stackplan"
+
+	"github.com/koding/logging"
+)
+
+var varRe = regexp.MustCompile(`^\$\{var\.([^}]+)\}$`)
+
+// pullImages pulls images of the template's containers, which are
+// missing on the Docker host. The docker_container resource does not
+// pull images by itself, it fails to create a container instead.
+func pullImages(c *dockerapi.Client, t *stackplan.Template, log logging.Logger) error {
+	images, err := containerImages(t, log)
+	if err != nil {
+		return err
+	}
+
+	for _, image := range images {
+		_, err := c.Image(image)
+		if err == nil {
+			continue
+		}
+
+		if err != dockerapi.ErrNotFound {
+			return fmt.Errorf("unable to inspect %q image: %s", image, err)
+		}
+
+		log.Info("Pulling %q image", image)
+
+		if err := c.PullImage(image); err != nil {
+			return fmt.Errorf("unable to pull %q image: %s", image, err)
+		}
+	}
+
+	return nil
+}
+
+// containerImages gives distinct images of the template's containers,
+// with variable references replaced by variable defaults.
+//
+// Images which can't be resolved before applying, e.g. referencing
+// a docker_image resource, are skipped.
+func containerImages(t *stackplan.Template, log logging.Logger) ([]string, error) {
+	var res DockerResource
+
+	if err := t.DecodeResource(&res); err != nil {
+		return nil, err
+	}
+
+	var vars map[string]map[string]interface{}
+
+	if err := t.DecodeVariable(&vars); err != nil {
+		return nil, err
+	}
+
+	uniq := make(map[string]struct{})
+
+	for name, container := range res.Build {
+		image, ok := container["image"].(string)
+		if !ok {
+			continue
+		}
+
+		if m := varRe.FindStringSubmatch(image); m != nil {
+			image, _ = vars[m[1]]["default"].(string)
+		}
+
+		if image == "" || strings.Contains(image, "${") {
+			log.Debug("Not pulling unresolved image of %q container: %v", name, container["image"])
+			continue
+		}
+
+		uniq[image] = struct{}{}
+	}
+
+	images := make([]string, 0, len(uniq))
+
+	for image := range uniq {
+		images = append(images, image)
+	}
+
+	sort.Strings(images)
+
+	return images, nil
+}
@@ -0,0 +1,130 @@
+package docker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"koding/kites/kloud/api/dockerapi"
+	"koding/kites/kloud/stackplan"
+
+	"github.com/koding/logging"
+)
+
+const imageTemplate = `{
+	"variable": {
+		"docker_image": {
+			"default": "ubuntu:14.04"
+		}
+	},
+	"resource": {
+		"docker_container": {
+			"default": {
+				"image": "${var.docker_image}"
+			},
+			"same": {
+				"image": "ubuntu:14.04"
+			},
+			"web": {
+				"image": "nginx"
+			},
+			"managed": {
+				"image": "${docker_image.custom.latest}"
+			}
+		}
+	}
+}`
+
+// fakeDaemon is a Docker host, which initially has no images.
+type fakeDaemon struct {
+	mu     sync.Mutex
+	images map[string]bool
+	pulls  []string
+}
+
+func (d *fakeDaemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/v1.24/images/create":
+		image := r.URL.Query().Get("fromImage") + ":" + r.URL.Query().Get("tag")
+
+		d.pulls = append(d.pulls, image)
+		d.images[image] = true
+
+		w.Write([]byte(`{"status":"Download complete"}`))
+	case strings.HasPrefix(r.URL.Path, "/v1.24/images/"):
+		name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/v1.24/images/"), "/json")
+
+		if !d.images[name] && !d.images[name+":latest"] {
+			http.Error(w, `{"message":"No such image"}`, http.StatusNotFound)
+			return
+		}
+
+		w.Write([]byte(`{"Id":"sha256:abc"}`))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestContainerImages(t *testing.T) {
+	tmpl, err := stackplan.ParseTemplate(imageTemplate, logging.NewCustom("test", false))
+	if err != nil {
+		t.Fatalf("ParseTemplate()=%s", err)
+	}
+
+	images, err := containerImages(tmpl, logging.NewCustom("test", false))
+	if err != nil {
+		t.Fatalf("containerImages()=%s", err)
+	}
+
+	want := []string{"nginx", "ubuntu:14.04"}
+
+	if !reflect.DeepEqual(images, want) {
+		t.Fatalf("got %v, want %v", images, want)
+	}
+}
+
+func TestPullImagesMissing(t *testing.T) {
+	d := &fakeDaemon{
+		images: make(map[string]bool),
+	}
+
+	s := httptest.NewServer(d)
+	defer s.Close()
+
+	c, err := dockerapi.New("tcp://" + strings.TrimPrefix(s.URL, "http://"))
+	if err != nil {
+		t.Fatalf("New()=%s", err)
+	}
+
+	tmpl, err := stackplan.ParseTemplate(imageTemplate, logging.NewCustom("test", false))
+	if err != nil {
+		t.Fatalf("ParseTemplate()=%s", err)
+	}
+
+	log := logging.NewCustom("test", false)
+
+	if err := pullImages(c, tmpl, log); err != nil {
+		t.Fatalf("pullImages()=%s", err)
+	}
+
+	want := []string{"nginx:latest", "ubuntu:14.04"}
+
+	if !reflect.DeepEqual(d.pulls, want) {
+		t.Fatalf("got %v pulls, want %v", d.pulls, want)
+	}
+
+	// Images already present on the host are not pulled again.
+	if err := pullImages(c, tmpl, log); err != nil {
+		t.Fatalf("pullImages()=%s", err)
+	}
+
+	if !reflect.DeepEqual(d.pulls, want) {
+		t.Fatalf("got %v pulls, want %v", d.pulls, want)
+	}
+}
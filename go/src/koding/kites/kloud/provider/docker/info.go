@@ -0,0 +1,53 @@
+package docker
+
+import (
+	"koding/db/mongodb/modelhelper"
+	"koding/kites/kloud/api/dockerapi"
+	"koding/kites/kloud/machinestate"
+	"koding/kites/kloud/stack"
+
+	"golang.org/x/net/context"
+)
+
+func (m *Machine) Info(ctx context.Context) (*stack.InfoResponse, error) {
+	dbState := m.State()
+
+	if dbState.InProgress() {
+		return &stack.InfoResponse{
+			State: dbState,
+		}, nil
+	}
+
+	resultState, err := m.status()
+	if err != nil {
+		return nil, err
+	}
+
+	// Update db state if the up-to-date state is different than the db.
+	if resultState != dbState {
+		m.Log.Info("Info decision: Inconsistent state between the machine and db document."+
+			" Updating state from %q to %q.", dbState, resultState)
+
+		if err := modelhelper.CheckAndUpdateState(m.ObjectId, resultState); err != nil {
+			m.Log.Warning("Info decision: Error while updating the machine %q state. Err: %s", m.ObjectId, err)
+		}
+	}
+
+	return &stack.InfoResponse{
+		State: resultState,
+	}, nil
+}
+
+// status gives the state of the machine's container.
+func (m *Machine) status() (machinestate.State, error) {
+	container, err := m.Docker.Container(m.Meta.ContainerID)
+	if err == dockerapi.ErrNotFound {
+		return machinestate.Terminated, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	return container.State.Status.MachineState(), nil
+}
@@ -0,0 +1,40 @@
+package docker
+
+import (
+	"errors"
+
+	"koding/db/mongodb/modelhelper"
+	"koding/kites/kloud/api/dockerapi"
+	"koding/kites/kloud/machinestate"
+	"koding/kites/kloud/provider"
+)
+
+// Meta represents jMachine.meta for "docker" provider.
+type Meta struct {
+	AlwaysOn    bool   `bson:"alwaysOn"`
+	StorageSize int    `bson:"storage_size"`
+	ContainerID string `bson:"containerId"`
+	Image       string `bson:"image"`
+	Memory      int    `bson:"memory"`
+	Network     string `bson:"network"`
+}
+
+func (meta *Meta) Valid() error {
+	if meta.ContainerID == "" {
+		return errors.New("docker's ContainerID metadata is empty")
+	}
+
+	return nil
+}
+
+type Machine struct {
+	*provider.BaseMachine
+
+	Meta   *Meta             `bson:"-"`
+	Cred   *Cred             `bson:"-"`
+	Docker *dockerapi.Client `bson:"-"`
+}
+
+func (m *Machine) updateState(s machinestate.State) error {
+	return modelhelper.ChangeMachineState(m.ObjectId, "Machine is marked as "+s.String(), s)
+}
@@ -0,0 +1,277 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"koding/db/mongodb/modelhelper"
+	"koding/kites/kloud/api/dockerapi"
+	"koding/kites/kloud/provider"
+	"koding/kites/kloud/stack"
+
+	"golang.org/x/net/context"
+)
+
+func init() {
+	// The provider lets users point kloud to Docker hosts of their
+	// choice, thus it needs to be explicitly enabled.
+	provider.Optional["docker"] = func(bp *provider.BaseProvider) stack.Provider {
+		return &Provider{
+			BaseProvider: bp,
+		}
+	}
+}
+
+// Provider implements machine management operations for containers
+// running on a Docker host.
+type Provider struct {
+	*provider.BaseProvider
+}
+
+func (p *Provider) Machine(ctx context.Context, id string) (stack.Machine, error) {
+	bm, err := p.BaseMachine(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var mt Meta
+	if err := modelhelper.BsonDecode(bm.Meta, &mt); err != nil {
+		return nil, err
+	}
+
+	if err := mt.Valid(); err != nil {
+		return nil, err
+	}
+
+	var cred Cred
+	if err := p.FetchCredData(bm, &cred); err != nil {
+		return nil, err
+	}
+
+	if err := cred.Valid(); err != nil {
+		return nil, err
+	}
+
+	client, err := newClient(&cred, p.DockerPrivateHosts)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Machine{
+		BaseMachine: bm,
+		Meta:        &mt,
+		Cred:        &cred,
+		Docker:      client,
+	}, nil
+}
+
+func (*Provider) Cred() interface{} {
+	return &Cred{}
+}
+
+// tunnelURL gives the URL of a tunnel server, which klients running
+// inside containers connect to. It returns nil if no tunnel
+// is configured - in that case klients are expected to be reachable
+// directly.
+func (p *Provider) tunnelURL() (*url.URL, error) {
+	if p.TunnelURL == "" {
+		return nil, nil
+	}
+
+	u, err := url.Parse(p.TunnelURL)
+	if err != nil {
+		return nil, errors.New("invalid tunnel URL: " + err.Error())
+	}
+
+	u.Path = "/kite"
+
+	return u, nil
+}
+
+// dialTimeout is a timeout for connecting to a Docker host.
+const dialTimeout = 30 * time.Second
+
+// lookupIP is used to resolve Docker hosts, it is replaced in tests.
+var lookupIP = net.LookupIP
+
+// newClient gives a Docker client for the given credential.
+//
+// Unless private hosts are allowed, the client talks to the host over
+// TLS and refuses to connect to non-public addresses, even when the host
+// name resolves to a different address than it did during validation.
+func newClient(cred *Cred, private bool) (*dockerapi.Client, error) {
+	u, err := hostAddr(cred.Host, private)
+	if err != nil {
+		return nil, err
+	}
+
+	if !cred.hasTLS() {
+		if !private {
+			return nil, errors.New("CA certificate, client certificate and key are required")
+		}
+
+		return dockerapi.New(cred.Host)
+	}
+
+	if u.Scheme == "unix" {
+		return nil, errors.New("TLS is not supported for unix sockets")
+	}
+
+	tlsConfig, err := cred.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := dockerapi.New("https://" + u.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	dial := dialPublic
+	if private {
+		dial = (&net.Dialer{Timeout: dialTimeout}).Dial
+	}
+
+	c.Client = &http.Client{
+		Timeout: dialTimeout,
+		Transport: &http.Transport{
+			Dial:            dial,
+			TLSClientConfig: tlsConfig,
+		},
+	}
+
+	return c, nil
+}
+
+// hostAddr parses the given Docker host.
+//
+// If private is false, only tcp:// and https:// hosts, which resolve
+// to public addresses, are accepted. Otherwise unix:// and http://
+// hosts and hosts with non-public addresses are accepted as well.
+func hostAddr(host string, private bool) (*url.URL, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "tcp", "https":
+	case "unix", "http":
+		if !private {
+			return nil, fmt.Errorf("unsupported host scheme %q, only tcp hosts with TLS are supported", u.Scheme)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported host scheme %q", u.Scheme)
+	}
+
+	if u.Scheme == "unix" {
+		if u.Path == "" {
+			return nil, fmt.Errorf("invalid host %q: empty socket path", host)
+		}
+
+		return u, nil
+	}
+
+	h, port, err := net.SplitHostPort(u.Host)
+	if err != nil {
+		return nil, fmt.Errorf("invalid host %q: %s", u.Host, err)
+	}
+
+	if h == "" || port == "" {
+		return nil, fmt.Errorf("invalid host %q", u.Host)
+	}
+
+	if private {
+		return u, nil
+	}
+
+	if _, err := publicIPs(h); err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// publicIPs resolves the given host, failing if any of its addresses
+// is not a public one.
+func publicIPs(host string) ([]net.IP, error) {
+	ips, err := lookupIP(host)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("host %q has no addresses", host)
+	}
+
+	for _, ip := range ips {
+		if !isPublic(ip) {
+			return nil, fmt.Errorf("host %q resolves to non-public address %s", host, ip)
+		}
+	}
+
+	return ips, nil
+}
+
+// dialPublic connects to the given address only if it is a public one.
+func dialPublic(network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	ips, err := publicIPs(host)
+	if err != nil {
+		return nil, err
+	}
+
+	// Dial the verified address, so it is not resolved again.
+	return net.DialTimeout(network, net.JoinHostPort(ips[0].String(), port), dialTimeout)
+}
+
+var privateNets = mustParseCIDRs(
+	"0.0.0.0/8",      // current network
+	"10.0.0.0/8",     // private
+	"100.64.0.0/10",  // carrier-grade NAT
+	"127.0.0.0/8",    // loopback
+	"169.254.0.0/16", // link-local, e.g. EC2 metadata
+	"172.16.0.0/12",  // private
+	"192.0.0.0/24",   // IETF protocol assignments
+	"192.168.0.0/16", // private
+	"198.18.0.0/15",  // benchmarking
+	"fc00::/7",       // unique local
+)
+
+func isPublic(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+		return false
+	}
+
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+
+	for i, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+
+		nets[i] = n
+	}
+
+	return nets
+}
@@ -0,0 +1,324 @@
+package docker
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"koding/kites/kloud/provider"
+)
+
+var hosts = map[string][]string{
+	"docker.example.com": {"203.0.113.10"},
+	"local.example.com":  {"127.0.0.1"},
+	"mixed.example.com":  {"203.0.113.10", "10.0.0.1"},
+}
+
+func fakeLookupIP(host string) ([]net.IP, error) {
+	if ip := net.ParseIP(host); ip != nil {
+		return []net.IP{ip}, nil
+	}
+
+	var ips []net.IP
+	for _, s := range hosts[host] {
+		ips = append(ips, net.ParseIP(s))
+	}
+
+	if len(ips) == 0 {
+		return nil, &net.DNSError{Err: "no such host", Name: host}
+	}
+
+	return ips, nil
+}
+
+func withLookupIP(fn func(string) ([]net.IP, error)) func() {
+	orig := lookupIP
+	lookupIP = fn
+	return func() { lookupIP = orig }
+}
+
+func newCertPEM(t *testing.T) (cert, key string) {
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey()=%s", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "docker"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatalf("CreateCertificate()=%s", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(priv)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey()=%s", err)
+	}
+
+	cert = string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}))
+	key = string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}))
+
+	return cert, key
+}
+
+func TestProviderOptional(t *testing.T) {
+	if _, ok := provider.All["docker"]; ok {
+		t.Fatal("docker provider must not be enabled by default")
+	}
+
+	if _, ok := provider.Optional["docker"]; !ok {
+		t.Fatal("docker provider is not registered as optional one")
+	}
+}
+
+func TestHostAddr(t *testing.T) {
+	defer withLookupIP(fakeLookupIP)()
+
+	cases := map[string]struct {
+		public  bool
+		private bool
+	}{
+		"tcp://docker.example.com:2376":   {true, true},
+		"https://docker.example.com:2376": {true, true},
+		"tcp://203.0.113.10:2376":         {true, true},
+		"unix:///var/run/docker.sock":     {false, true},
+		"http://docker.example.com:2375":  {false, true},
+		"tcp://localhost:2375":            {false, true},
+		"tcp://127.0.0.1:2376":            {false, true},
+		"tcp://[::1]:2376":                {false, true},
+		"tcp://0.0.0.0:2376":              {false, true},
+		"tcp://10.0.0.1:2376":             {false, true},
+		"tcp://172.17.0.1:2376":           {false, true},
+		"tcp://192.168.1.1:2376":          {false, true},
+		"tcp://169.254.169.254:80":        {false, true},
+		"tcp://[fd00::1]:2376":            {false, true},
+		"tcp://local.example.com:2376":    {false, true},
+		"tcp://mixed.example.com:2376":    {false, true},
+		"tcp://unknown.example.com:2376":  {false, true},
+		"tcp://docker.example.com":        {false, false},
+		"unix://":                         {false, false},
+		"ftp://docker.example.com:21":     {false, false},
+	}
+
+	for host, cas := range cases {
+		for _, private := range []bool{false, true} {
+			ok := cas.public
+			if private {
+				ok = cas.private
+			}
+
+			_, err := hostAddr(host, private)
+
+			if ok && err != nil {
+				t.Errorf("%s (private=%t): hostAddr()=%s", host, private, err)
+			}
+
+			if !ok && err == nil {
+				t.Errorf("%s (private=%t): want error", host, private)
+			}
+		}
+	}
+}
+
+func TestCredValid(t *testing.T) {
+	defer withLookupIP(fakeLookupIP)()
+
+	cert, key := newCertPEM(t)
+	_, otherKey := newCertPEM(t)
+
+	cases := map[string]struct {
+		cred *Cred
+		ok   bool
+	}{
+		"valid": {
+			&Cred{Host: "tcp://docker.example.com:2376", CACert: cert, Cert: cert, Key: key},
+			true,
+		},
+		"no tls": {
+			&Cred{Host: "tcp://docker.example.com:2376"},
+			true,
+		},
+		"unix socket": {
+			&Cred{Host: "unix:///var/run/docker.sock"},
+			true,
+		},
+		"no CA": {
+			&Cred{Host: "tcp://docker.example.com:2376", Cert: cert, Key: key},
+			false,
+		},
+		"invalid CA": {
+			&Cred{Host: "tcp://docker.example.com:2376", CACert: "ca", Cert: cert, Key: key},
+			false,
+		},
+		"mismatched key": {
+			&Cred{Host: "tcp://docker.example.com:2376", CACert: cert, Cert: cert, Key: otherKey},
+			false,
+		},
+		"invalid scheme": {
+			&Cred{Host: "ftp://docker.example.com:21"},
+			false,
+		},
+	}
+
+	for name, cas := range cases {
+		err := cas.cred.Valid()
+
+		if cas.ok && err != nil {
+			t.Errorf("%s: Valid()=%s", name, err)
+		}
+
+		if !cas.ok && err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	defer withLookupIP(fakeLookupIP)()
+
+	cert, key := newCertPEM(t)
+
+	cases := map[string]struct {
+		cred    *Cred
+		public  bool
+		private bool
+	}{
+		"tls": {
+			&Cred{Host: "tcp://docker.example.com:2376", CACert: cert, Cert: cert, Key: key},
+			true, true,
+		},
+		"no tls": {
+			&Cred{Host: "tcp://docker.example.com:2376"},
+			false, true,
+		},
+		"private host": {
+			&Cred{Host: "tcp://10.0.0.1:2376", CACert: cert, Cert: cert, Key: key},
+			false, true,
+		},
+		"localhost": {
+			&Cred{Host: "tcp://localhost:2375"},
+			false, true,
+		},
+		"unix socket": {
+			&Cred{Host: "unix:///var/run/docker.sock"},
+			false, true,
+		},
+		"unix socket with tls": {
+			&Cred{Host: "unix:///var/run/docker.sock", CACert: cert, Cert: cert, Key: key},
+			false, false,
+		},
+	}
+
+	for name, cas := range cases {
+		for _, private := range []bool{false, true} {
+			ok := cas.public
+			if private {
+				ok = cas.private
+			}
+
+			_, err := newClient(cas.cred, private)
+
+			if ok && err != nil {
+				t.Errorf("%s (private=%t): newClient()=%s", name, private, err)
+			}
+
+			if !ok && err == nil {
+				t.Errorf("%s (private=%t): want error", name, private)
+			}
+		}
+	}
+}
+
+func TestClientPrivateHost(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Version":"1.12.0"}`))
+	}))
+	defer s.Close()
+
+	cred := &Cred{
+		Host: "tcp://" + strings.TrimPrefix(s.URL, "http://"),
+	}
+
+	if _, err := newClient(cred, false); err == nil {
+		t.Fatal("want error for non-TLS loopback host")
+	}
+
+	c, err := newClient(cred, true)
+	if err != nil {
+		t.Fatalf("newClient()=%s", err)
+	}
+
+	v, err := c.Version()
+	if err != nil {
+		t.Fatalf("Version()=%s", err)
+	}
+
+	if v != "1.12.0" {
+		t.Fatalf("got %q, want %q", v, "1.12.0")
+	}
+}
+
+func TestClientRefusesPrivateAddr(t *testing.T) {
+	s := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Version":"1.12.0"}`))
+	}))
+	defer s.Close()
+
+	_, port, err := net.SplitHostPort(strings.TrimPrefix(s.URL, "https://"))
+	if err != nil {
+		t.Fatalf("SplitHostPort()=%s", err)
+	}
+
+	// The host resolves to a public address during validation and
+	// to the loopback one afterwards.
+	resolved := false
+	defer withLookupIP(func(host string) ([]net.IP, error) {
+		if resolved {
+			return []net.IP{net.ParseIP("127.0.0.1")}, nil
+		}
+		resolved = true
+		return []net.IP{net.ParseIP("203.0.113.10")}, nil
+	})()
+
+	cert, key := newCertPEM(t)
+
+	cred := &Cred{
+		Host:   "tcp://docker.example.com:" + port,
+		CACert: cert,
+		Cert:   cert,
+		Key:    key,
+	}
+
+	c, err := newClient(cred, false)
+	if err != nil {
+		t.Fatalf("newClient()=%s", err)
+	}
+
+	if !strings.HasPrefix(c.Host, "https://") {
+		t.Fatalf("got %q host, want TLS one", c.Host)
+	}
+
+	_, err = c.Version()
+	if err == nil || !strings.Contains(err.Error(), "non-public address") {
+		t.Fatalf("got %v, want non-public address error", err)
+	}
+}
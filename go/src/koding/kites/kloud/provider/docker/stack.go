@@ -0,0 +1,170 @@
+package docker
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/url"
+
+	"koding/kites/kloud/provider"
+	"koding/kites/kloud/stack"
+	"koding/kites/kloud/stackplan"
+
+	"github.com/fatih/structs"
+	"golang.org/x/net/context"
+)
+
+// Cred represents jCredentialDatas.meta for "docker" provider.
+type Cred struct {
+	// Host is an address of the Docker daemon, e.g. tcp://1.2.3.4:2376.
+	//
+	// Unless the kloud allows private Docker hosts, the daemon must be
+	// reachable on a public address and secured with TLS.
+	Host   string `json:"host" bson:"host" hcl:"host"`
+	Image  string `json:"image" bson:"image" hcl:"image"`
+	Memory int    `json:"memory" bson:"memory" hcl:"memory"`
+
+	// CACert, Cert and Key are PEM-encoded CA certificate of the Docker
+	// daemon, client certificate and client private key. They are either
+	// all set or all empty.
+	CACert string `json:"caCert" bson:"caCert" hcl:"ca_cert"`
+	Cert   string `json:"cert" bson:"cert" hcl:"cert"`
+	Key    string `json:"key" bson:"key" hcl:"key"`
+
+	// Network is a name of the network the containers are attached to,
+	// it is created during bootstrap.
+	Network string `json:"network,omitempty" bson:"network,omitempty" hcl:"network"`
+}
+
+var _ stack.Validator = (*Cred)(nil)
+
+// Valid implements the kloud.Validator interface.
+//
+// Whether the host is allowed to be used is checked when connecting
+// to it, as it depends on the kloud configuration.
+func (meta *Cred) Valid() error {
+	if meta.Host == "" {
+		return errors.New("docker meta: host is empty")
+	}
+
+	if _, err := hostAddr(meta.Host, true); err != nil {
+		return errors.New("docker meta: " + err.Error())
+	}
+
+	if !meta.hasTLS() {
+		if meta.CACert != "" || meta.Cert != "" || meta.Key != "" {
+			return errors.New("docker meta: CA certificate, client certificate and key must be set together")
+		}
+
+		return nil
+	}
+
+	if _, err := meta.tlsConfig(); err != nil {
+		return errors.New("docker meta: " + err.Error())
+	}
+
+	return nil
+}
+
+// hasTLS tells whether the credential holds TLS certificates.
+func (meta *Cred) hasTLS() bool {
+	return meta.CACert != "" && meta.Cert != "" && meta.Key != ""
+}
+
+// tlsConfig gives TLS configuration for connecting to the host.
+func (meta *Cred) tlsConfig() (*tls.Config, error) {
+	cert, err := tls.X509KeyPair([]byte(meta.Cert), []byte(meta.Key))
+	if err != nil {
+		return nil, errors.New("invalid client certificate: " + err.Error())
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM([]byte(meta.CACert)) {
+		return nil, errors.New("invalid CA certificate")
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+	}, nil
+}
+
+// BootstrapValid checks whether the credential was bootstrapped.
+func (meta *Cred) BootstrapValid() error {
+	if meta.Network == "" {
+		return errors.New("docker meta: network is empty, was the credential bootstrapped?")
+	}
+	return nil
+}
+
+// SetDefaults sets default values for docker credential metadata.
+func (meta *Cred) SetDefaults() (updated bool) {
+	if !structs.HasZero(meta) {
+		return false
+	}
+	if meta.Image == "" {
+		meta.Image = "ubuntu:14.04"
+	}
+	if meta.Memory == 0 {
+		meta.Memory = 1024
+	}
+	return true
+}
+
+// Stack provides an implementation for the kloud.Stacker interface.
+type Stack struct {
+	*provider.BaseStack
+
+	// TunnelURL for klient connection inside containers. It is
+	// nil if klients are not tunneled.
+	TunnelURL *url.URL
+
+	// PrivateHosts allows connecting to unix sockets, loopback
+	// and private hosts, and hosts without TLS.
+	PrivateHosts bool
+
+	// Credential represents Docker credential value.
+	//
+	// The Meta field is of *Cred type.
+	// The field is set during injecting variables to a template.
+	Credential *stackplan.Credential
+
+	// The following fields are set by buildResources method:
+	ids     stackplan.KiteMap
+	klients map[string]*stackplan.DialState
+
+	p *stackplan.Planner
+}
+
+// Ensure Provider implements the kloud.StackProvider interface.
+var _ stack.Provider = (*Provider)(nil)
+
+// Stack
+func (p *Provider) Stack(ctx context.Context) (stack.Stack, error) {
+	bs, err := p.BaseStack(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tunnelURL, err := p.tunnelURL()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Stack{
+		BaseStack:    bs,
+		TunnelURL:    tunnelURL,
+		PrivateHosts: p.DockerPrivateHosts,
+		p: &stackplan.Planner{
+			Provider:     "docker",
+			ResourceType: "container",
+		},
+	}
+
+	bs.BuildResources = s.buildResources
+	bs.WaitResources = s.waitResources
+	bs.UpdateResources = s.updateResources
+	bs.TerraformVariables = s.terraformVariables
+
+	return s, nil
+}
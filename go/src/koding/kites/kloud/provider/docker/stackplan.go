@@ -0,0 +1,279 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"koding/db/models"
+	"koding/db/mongodb/modelhelper"
+	"koding/kites/kloud/stackplan"
+	"koding/kites/kloud/utils"
+
+	"github.com/satori/go.uuid"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// provisionScript is a command of each container, it installs klient
+// on the first start and runs it in the foreground.
+//
+// The script is configured with environment variables set by
+// InjectDockerData.
+const provisionScript = `set -e
+if ! which wget >/dev/null 2>&1; then
+	apt-get update -q && apt-get install -qy wget
+fi
+id -u "$KODING_USERNAME" >/dev/null 2>&1 || adduser --disabled-password --shell /bin/bash --gecos Koding --force-badname "$KODING_USERNAME"
+mkdir -p /etc/kite
+printf '%s' "$KODING_KITE_KEY" > /etc/kite/kite.key
+if [ ! -x /opt/kite/klient/klient ]; then
+	wget -q --tries 5 -O /tmp/klient.deb "$KODING_KLIENT_URL"
+	dpkg -i /tmp/klient.deb
+	rm -f /tmp/klient.deb
+fi
+set -- -kontrol-url "$KODING_KONTROL_URL"
+if [ -n "$KODING_TUNNEL_NAME" ]; then
+	set -- "$@" -tunnel-name "$KODING_TUNNEL_NAME" -tunnel-kite-url "$KODING_TUNNEL_KITE_URL"
+fi
+export KITE_HOME=/etc/kite
+exec /opt/kite/klient/klient "$@"
+`
+
+// DockerResource represents docker_container Terraform resource.
+type DockerResource struct {
+	Build map[string]map[string]interface{} `hcl:"docker_container"`
+}
+
+func (s *Stack) updateCredential(cred *stackplan.Credential) {
+	meta := cred.Meta.(*Cred)
+	meta.SetDefaults()
+}
+
+// InjectDockerData sets default properties for docker_container Terraform template.
+func (s *Stack) InjectDockerData() (stackplan.KiteMap, error) {
+	for _, c := range s.Builder.Credentials {
+		if c.Provider == "docker" {
+			s.Credential = c
+			break
+		}
+	}
+
+	if s.Credential == nil {
+		return nil, errors.New("docker credential not found")
+	}
+
+	s.updateCredential(s.Credential)
+
+	t := s.Builder.Template
+	meta := s.Credential.Meta.(*Cred)
+
+	s.Log.Debug("Injecting docker credentials: %# v", meta)
+
+	if err := t.InjectVariables(s.Credential.Provider, s.Credential.Meta); err != nil {
+		return nil, err
+	}
+
+	// TLS certificates are passed to terraformer as files, see
+	// terraformVariables, they are not kept in the template.
+	for _, name := range []string{"docker_ca_cert", "docker_cert", "docker_key"} {
+		delete(t.Variable, name)
+	}
+
+	t.Variable["docker_cert_path"] = map[string]interface{}{
+		"default": "",
+	}
+
+	// The provider is always configured with the credential, so the
+	// template is not able to point terraformer to other hosts.
+	t.Provider["docker"] = map[string]interface{}{
+		"host":      "${var.docker_host}",
+		"cert_path": "${var.docker_cert_path}",
+	}
+
+	var res DockerResource
+
+	if err := t.DecodeResource(&res); err != nil {
+		return nil, err
+	}
+
+	if len(res.Build) == 0 {
+		return nil, errors.New("no docker containers specified")
+	}
+
+	kiteIDs := make(stackplan.KiteMap)
+
+	uids := s.Builder.MachineUIDs()
+
+	s.Log.Debug("machine uids (%d): %v", len(uids), uids)
+
+	klientURL, err := s.Session.Userdata.LookupKlientURL()
+	if err != nil {
+		return nil, err
+	}
+
+	for resourceName, container := range res.Build {
+		kiteID := uuid.NewV4().String()
+
+		kiteKey, err := s.Session.Userdata.Keycreator.Create(s.Req.Username, kiteID)
+		if err != nil {
+			return nil, err
+		}
+
+		uid, ok := uids[resourceName]
+		if !ok {
+			// For Plan call we return random uid as it won't be returned
+			// as a part of meta.
+			uid = resourceName + "-" + utils.RandString(6)
+		}
+
+		// set kontrolURL if not provided via template
+		kontrolURL := s.Session.Userdata.Keycreator.KontrolURL
+		if k, ok := container["kontrolURL"].(string); ok {
+			kontrolURL = k
+			delete(container, "kontrolURL")
+		}
+
+		if _, ok := container["name"]; !ok {
+			container["name"] = "koding-" + uid
+		}
+
+		if _, ok := container["image"]; !ok {
+			container["image"] = "${var.docker_image}"
+		}
+
+		// set default RAM in MiB
+		if _, ok := container["memory"]; !ok {
+			container["memory"] = "${var.docker_memory}"
+		}
+
+		if _, ok := container["hostname"]; !ok {
+			container["hostname"] = s.Req.Username // no typo here. hostname = username
+		}
+
+		if _, ok := container["networks"]; !ok {
+			container["networks"] = []interface{}{"${var.docker_network}"}
+		}
+
+		if _, ok := container["restart"]; !ok {
+			container["restart"] = "unless-stopped"
+		}
+
+		env := []interface{}{
+			"KODING_USERNAME=" + s.Req.Username,
+			"KODING_KITE_KEY=" + kiteKey,
+			"KODING_KLIENT_URL=" + klientURL,
+			"KODING_KONTROL_URL=" + kontrolURL,
+		}
+
+		if s.TunnelURL != nil {
+			name := utils.RandString(12)
+			if m, ok := s.Builder.Machines[resourceName]; ok {
+				name = m.Uid
+			}
+
+			env = append(env,
+				"KODING_TUNNEL_NAME="+name,
+				"KODING_TUNNEL_KITE_URL="+s.TunnelURL.String(),
+			)
+		}
+
+		if e, ok := container["env"].([]interface{}); ok {
+			env = append(e, env...)
+		}
+
+		container["env"] = env
+		container["command"] = []interface{}{"/bin/sh", "-c", provisionScript}
+		container["must_run"] = true
+
+		kiteIDs[resourceName] = kiteID
+		res.Build[resourceName] = container
+	}
+
+	t.Resource["docker_container"] = res.Build
+
+	if err := t.Flush(); err != nil {
+		return nil, err
+	}
+
+	return kiteIDs, nil
+}
+
+func (s *Stack) machinesFromTemplate(t *stackplan.Template) (stackplan.Machines, error) {
+	var res DockerResource
+	if err := t.DecodeResource(&res); err != nil {
+		return nil, err
+	}
+
+	machines := make(stackplan.Machines, len(res.Build))
+
+	for label, container := range res.Build {
+		m := &stackplan.Machine{
+			Provider:   "docker",
+			Label:      label,
+			Attributes: make(map[string]string),
+		}
+
+		if image, ok := container["image"].(string); ok && !stackplan.IsVariable(image) {
+			m.Attributes["image"] = image
+		}
+		if mem, ok := container["memory"].(string); ok && !stackplan.IsVariable(mem) {
+			m.Attributes["memory"] = mem
+		}
+
+		if _, ok := machines[label]; ok {
+			return nil, errors.New("duplicate container labels: " + label)
+		}
+
+		machines[label] = m
+	}
+
+	return machines, nil
+}
+
+func (s *Stack) updateMachines(machines stackplan.Machines, jMachines map[string]*models.Machine) error {
+	meta := s.Credential.Meta.(*Cred)
+
+	for label, machine := range jMachines {
+		s.Log.Debug("Updating machine with %q label and %q provider", label, machine.Provider)
+
+		tf, ok := machines[label]
+		if !ok {
+			return fmt.Errorf("machine label '%s' doesn't exist in terraform output", label)
+		}
+
+		if tf.Provider == "docker" {
+			if err := updateDocker(tf, machine.ObjectId, s.Credential.Identifier, meta.Network); err != nil {
+				return stackplan.ResError(err, "jMachine")
+			}
+		}
+	}
+
+	return nil
+}
+
+func updateDocker(tf *stackplan.Machine, machineId bson.ObjectId, credential, network string) error {
+	machine := bson.M{
+		"provider":          tf.Provider,
+		"queryString":       tf.QueryString,
+		"credential":        credential,
+		"ipAddress":         tf.Attributes["ip_address"],
+		"meta.containerId":  tf.Attributes["id"],
+		"meta.image":        tf.Attributes["image"],
+		"meta.network":      network,
+		"status.modifiedAt": time.Now().UTC(),
+		"status.state":      tf.State.String(),
+		"status.reason":     tf.StateReason,
+	}
+
+	if u, err := url.Parse(tf.RegisterURL); tf.RegisterURL != "" && err == nil {
+		machine["domain"] = u.Host
+	}
+
+	if n, err := strconv.Atoi(tf.Attributes["memory"]); err == nil {
+		machine["meta.memory"] = n
+	}
+
+	return modelhelper.UpdateMachine(machineId, bson.M{"$set": machine})
+}
@@ -0,0 +1,66 @@
+package docker
+
+import (
+	"errors"
+	"time"
+
+	"koding/kites/kloud/api/dockerapi"
+	"koding/kites/kloud/machinestate"
+	"koding/kites/kloud/stack"
+
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func (m *Machine) Start(ctx context.Context) error {
+	err := m.start(ctx)
+	if err != nil {
+		return stack.NewEventerError(err)
+	}
+
+	return nil
+}
+
+func (m *Machine) start(ctx context.Context) (err error) {
+	origState := m.State()
+
+	if err = m.updateState(machinestate.Starting); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			// bring back original state in case of error
+			m.updateState(origState)
+		}
+	}()
+
+	m.PushEvent("Starting machine", 25, machinestate.Starting)
+
+	err = m.Docker.StartContainer(m.Meta.ContainerID)
+	if err == dockerapi.ErrNotFound {
+		return errors.New("container is not available anymore")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	m.PushEvent("Checking remote machine", 75, machinestate.Starting)
+
+	if err := m.WaitKlientReady(); err != nil {
+		return err
+	}
+
+	return m.Session.DB.Run("jMachines", func(c *mgo.Collection) error {
+		return c.UpdateId(
+			m.ObjectId,
+			bson.M{"$set": bson.M{
+				"status.state":      machinestate.Running.String(),
+				"status.modifiedAt": time.Now().UTC(),
+				"status.reason":     "Machine is running",
+			}},
+		)
+	})
+}
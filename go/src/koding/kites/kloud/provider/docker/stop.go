@@ -0,0 +1,64 @@
+package docker
+
+import (
+	"errors"
+	"time"
+
+	"koding/kites/kloud/api/dockerapi"
+	"koding/kites/kloud/machinestate"
+	"koding/kites/kloud/stack"
+
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// stopTimeout is a time after which a container that does not
+// stop gracefully is killed.
+const stopTimeout = 30 * time.Second
+
+func (m *Machine) Stop(ctx context.Context) error {
+	err := m.stop(ctx)
+	if err != nil {
+		return stack.NewEventerError(err)
+	}
+
+	return nil
+}
+
+func (m *Machine) stop(ctx context.Context) (err error) {
+	origState := m.State()
+
+	if err = m.updateState(machinestate.Stopping); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			// bring back original state in case of error
+			m.updateState(origState)
+		}
+	}()
+
+	m.PushEvent("Stopping machine", 50, machinestate.Stopping)
+
+	err = m.Docker.StopContainer(m.Meta.ContainerID, stopTimeout)
+	if err == dockerapi.ErrNotFound {
+		return errors.New("container is not available anymore")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return m.Session.DB.Run("jMachines", func(c *mgo.Collection) error {
+		return c.UpdateId(
+			m.ObjectId,
+			bson.M{"$set": bson.M{
+				"status.state":      machinestate.Stopped.String(),
+				"status.modifiedAt": time.Now().UTC(),
+				"status.reason":     "Machine is stopped",
+			}},
+		)
+	})
+}
@@ -0,0 +1,187 @@
+package existing
+
+import (
+	"fmt"
+	"net"
+
+	"koding/db/mongodb/modelhelper"
+	"koding/kites/kloud/stackplan"
+
+	"github.com/hashicorp/terraform/terraform"
+	"github.com/satori/go.uuid"
+	"golang.org/x/net/context"
+)
+
+func (s *Stack) buildResources() (err error) {
+	s.Log.Debug("Injecting variables from credential data identifiers, such as existing, custom, etc..")
+
+	s.hosts, err = s.InjectExistingData()
+	if err != nil {
+		return err
+	}
+
+	for label, h := range s.hosts {
+		if h.Host == "" {
+			return fmt.Errorf("no host specified for %q instance", label)
+		}
+	}
+
+	return s.Credential.Meta.(*Cred).BootstrapValid()
+}
+
+// applyResources installs klient on each of the existing hosts. It returns
+// a state, which resembles the one Terraform would create, so the machines
+// can be read with stackplan.Planner.
+func (s *Stack) applyResources(ctx context.Context) (*terraform.State, error) {
+	klientURL, err := s.Session.Userdata.LookupKlientURL()
+	if err != nil {
+		return nil, err
+	}
+
+	module := &terraform.ModuleState{
+		Path:      terraform.RootModulePath,
+		Resources: make(map[string]*terraform.ResourceState, len(s.hosts)),
+	}
+
+	s.ids = make(stackplan.KiteMap, len(s.hosts))
+
+	for label, h := range s.hosts {
+		kiteID := uuid.NewV4().String()
+
+		kiteKey, err := s.Session.Userdata.Keycreator.Create(s.Req.Username, kiteID)
+		if err != nil {
+			return nil, err
+		}
+
+		hostKey, err := s.install(h, &installData{
+			Username:  h.Username,
+			KiteKey:   kiteKey,
+			KlientURL: klientURL,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("installing klient on %q instance: %s", label, err)
+		}
+
+		s.ids[label] = kiteID
+
+		attrs := map[string]string{
+			"id":       h.Host,
+			"host":     h.Host,
+			"username": h.Username,
+			"host_key": hostKey,
+		}
+
+		if host, _, err := net.SplitHostPort(Addr(h.Host)); err == nil {
+			attrs["ip_address"] = host
+		}
+
+		module.Resources["existing_instance."+label] = &terraform.ResourceState{
+			Type: "existing_instance",
+			Primary: &terraform.InstanceState{
+				ID:         h.Host,
+				Attributes: attrs,
+			},
+		}
+	}
+
+	return &terraform.State{
+		Modules: []*terraform.ModuleState{module},
+	}, nil
+}
+
+// install installs klient on the given host, it returns the fingerprint
+// of the host's key.
+func (s *Stack) install(h *Host, data *installData) (string, error) {
+	script, err := newInstallScript(data)
+	if err != nil {
+		return "", err
+	}
+
+	meta := s.Credential.Meta.(*Cred)
+
+	s.Log.Debug("Installing klient on %q (%s@%s)", h.Label, h.Username, h.Host)
+
+	client, hostKey, err := dial(h.Host, h.Username, meta.PrivateKey, h.HostKey)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	out, err := client.RunScript("sudo sh -s", script)
+	if err != nil {
+		s.Log.Debug("Install output for %q:\n%s", h.Label, out)
+		return "", err
+	}
+
+	return hostKey, nil
+}
+
+func (s *Stack) waitResources(ctx context.Context) (err error) {
+	s.Log.Debug("Checking total '%d' klients", len(s.ids))
+
+	s.klients, err = s.p.DialKlients(ctx, s.ids)
+
+	return err
+}
+
+func (s *Stack) updateResources(state *terraform.State) error {
+	machines, err := s.p.MachinesFromState(state, s.klients)
+	if err != nil {
+		return err
+	}
+
+	s.Log.Debug("Machines from state: %+v", machines)
+	s.Log.Debug("Build data kiteIDS: %+v", s.ids)
+
+	return s.updateMachines(machines, s.Builder.Machines)
+}
+
+// destroyResources uninstalls klient from the stack machines. The hosts
+// themselves are left intact. Unreachable hosts are ignored.
+func (s *Stack) destroyResources(ctx context.Context) error {
+	var cred *Cred
+
+	for _, c := range s.Builder.Credentials {
+		if c.Provider == "existing" {
+			cred = c.Meta.(*Cred)
+			break
+		}
+	}
+
+	if cred == nil {
+		return nil
+	}
+
+	cred.SetDefaults()
+
+	for label, machine := range s.Builder.Machines {
+		if machine.Provider != "existing" {
+			continue
+		}
+
+		var meta Meta
+		if err := modelhelper.BsonDecode(machine.Meta, &meta); err != nil || meta.Valid() != nil {
+			s.Log.Warning("Ignoring %q machine with invalid metadata", label)
+			continue
+		}
+
+		m := &Machine{
+			Meta: &meta,
+			Cred: cred,
+		}
+
+		client, err := m.dial()
+		if err != nil {
+			s.Log.Warning("Unable to uninstall klient from %q: %s", label, err)
+			continue
+		}
+
+		if out, err := client.RunScript("sudo sh -s", uninstallScript); err != nil {
+			s.Log.Warning("Unable to uninstall klient from %q: %s\n%s", label, err, out)
+		}
+
+		client.Close()
+	}
+
+	return nil
+}
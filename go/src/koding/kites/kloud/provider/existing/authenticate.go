@@ -0,0 +1,63 @@
+package existing
+
+import (
+	"fmt"
+
+	"koding/db/mongodb/modelhelper"
+	"koding/kites/kloud/stack"
+
+	"golang.org/x/net/context"
+)
+
+// Authenticate
+func (s *Stack) Authenticate(ctx context.Context) (interface{}, error) {
+	var arg stack.AuthenticateRequest
+	if err := s.Req.Args.One().Unmarshal(&arg); err != nil {
+		return nil, err
+	}
+
+	if err := arg.Valid(); err != nil {
+		return nil, err
+	}
+
+	if err := s.Builder.BuildCredentials(s.Req.Method, s.Req.Username, arg.GroupName, arg.Identifiers); err != nil {
+		return nil, err
+	}
+
+	resp := make(stack.AuthenticateResponse)
+
+	for _, cred := range s.Builder.Credentials {
+		res := &stack.AuthenticateResult{}
+		resp[cred.Identifier] = res
+
+		if cred.Provider != "existing" {
+			res.Message = "unable to authenticate non-existing credential: " + cred.Provider
+			continue
+		}
+
+		meta := cred.Meta.(*Cred)
+
+		if err := meta.Valid(); err != nil {
+			res.Message = fmt.Sprintf("validating %q credential: %s", cred.Identifier, err)
+			continue
+		}
+
+		meta.SetDefaults()
+
+		if _, err := s.checkHost(meta); err != nil {
+			res.Message = err.Error()
+			continue
+		}
+
+		if err := modelhelper.SetCredentialVerified(cred.Identifier, true); err != nil {
+			res.Message = err.Error()
+			continue
+		}
+
+		res.Verified = true
+	}
+
+	s.Log.Debug("authenticate response: %v", resp)
+
+	return resp, nil
+}
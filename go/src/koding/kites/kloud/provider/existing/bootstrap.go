@@ -0,0 +1,97 @@
+package existing
+
+import (
+	"fmt"
+	"strings"
+
+	"koding/kites/kloud/policy"
+	"koding/kites/kloud/stack"
+
+	"golang.org/x/net/context"
+)
+
+// Bootstrap verifies each existing credential can be used to log in
+// to its host over SSH and records the host key, or forgets it
+// when destroy is requested.
+func (s *Stack) Bootstrap(ctx context.Context) (interface{}, error) {
+	var arg stack.BootstrapRequest
+	if err := s.Req.Args.One().Unmarshal(&arg); err != nil {
+		return nil, err
+	}
+
+	if err := arg.Valid(); err != nil {
+		return nil, err
+	}
+
+	if !arg.Destroy {
+		p, err := s.Policy(arg.GroupName)
+		if err != nil {
+			return nil, err
+		}
+
+		if v := p.ValidateProvider("provider.existing", "existing"); v != nil {
+			return nil, policy.Check([]*policy.Violation{v})
+		}
+	}
+
+	if err := s.Builder.BuildCredentials(s.Req.Method, s.Req.Username, arg.GroupName, arg.Identifiers); err != nil {
+		return nil, err
+	}
+
+	for _, cred := range s.Builder.Credentials {
+		if cred.Provider != "existing" {
+			return nil, fmt.Errorf("unable to bootstrap non-existing credential: %s", cred.Provider)
+		}
+
+		meta := cred.Meta.(*Cred)
+
+		if err := meta.Valid(); err != nil {
+			return nil, fmt.Errorf("validating %q credential: %s", cred.Identifier, err)
+		}
+
+		meta.SetDefaults()
+
+		if arg.Destroy {
+			meta.HostKey = ""
+		} else {
+			hostKey, err := s.checkHost(meta)
+			if err != nil {
+				return nil, fmt.Errorf("connecting to %q: %s", meta.Host, err)
+			}
+
+			meta.HostKey = hostKey
+		}
+
+		s.Log.Debug("[%s] Bootstrap response: host=%q, hostKey=%q", cred.Identifier, meta.Host, meta.HostKey)
+
+		datas := map[string]interface{}{
+			cred.Identifier: meta,
+		}
+
+		if err := s.Builder.CredStore.Put(s.Req.Username, datas); err != nil {
+			return nil, err
+		}
+	}
+
+	return true, nil
+}
+
+// checkHost logs in to the credential's host and runs a trivial
+// command to ensure the user is able to run commands. It returns
+// the fingerprint of the host's key.
+func (s *Stack) checkHost(meta *Cred) (string, error) {
+	client, hostKey, err := dial(meta.Host, meta.Username, meta.PrivateKey, meta.HostKey)
+	if err != nil {
+		return "", err
+	}
+	defer client.Close()
+
+	out, err := client.StartCommand("sudo -n uname -a")
+	if err != nil {
+		return "", fmt.Errorf("%s: %s", err, strings.TrimSpace(out))
+	}
+
+	s.Log.Debug("Host %q: %s", meta.Host, strings.TrimSpace(out))
+
+	return hostKey, nil
+}
@@ -0,0 +1,75 @@
+package existing
+
+import (
+	"net"
+	"time"
+
+	"koding/db/mongodb/modelhelper"
+	"koding/kites/kloud/klient"
+	"koding/kites/kloud/machinestate"
+	"koding/kites/kloud/stack"
+
+	"golang.org/x/net/context"
+)
+
+// Info reports the machine as running when its klient is connectable,
+// and as stopped otherwise. Since kloud does not manage the host itself,
+// the host reachability is only recorded as the reason.
+func (m *Machine) Info(ctx context.Context) (*stack.InfoResponse, error) {
+	dbState := m.State()
+
+	if dbState.InProgress() {
+		return &stack.InfoResponse{
+			State: dbState,
+		}, nil
+	}
+
+	resultState := machinestate.Running
+	reason := "Klient is active and healthy."
+
+	kref, err := klient.ConnectTimeout(m.Session.Kite, m.QueryString, time.Second*10)
+	if err == nil {
+		kref.Close()
+	} else {
+		m.Log.Debug("Klient is not reachable. Err: %s", err)
+
+		resultState = machinestate.Stopped
+		reason = "Klient is stopped."
+
+		if !m.reachable() {
+			reason = "Host is not reachable."
+		}
+	}
+
+	m.fixInconsistentState(resultState, dbState, reason)
+
+	return &stack.InfoResponse{
+		State: resultState,
+	}, nil
+}
+
+// reachable tests whether SSH port of the machine accepts connections.
+func (m *Machine) reachable() bool {
+	conn, err := net.DialTimeout("tcp", Addr(m.Meta.Host), 5*time.Second)
+	if err != nil {
+		return false
+	}
+
+	conn.Close()
+
+	return true
+}
+
+func (m *Machine) fixInconsistentState(actual, db machinestate.State, reason string) {
+	m.Log.Debug("%s: fixing inconsistent state: %s vs %s, reason: %s", m.QueryString, actual, db, reason)
+
+	// Update db state if the up-to-date state is different than the db.
+	if actual != db {
+		m.Log.Info("Info decision: Inconsistent state between the machine and db document."+
+			" Updating state from %q to %q. Reason: %s", db, actual, reason)
+
+		if err := modelhelper.CheckAndUpdateState(m.ObjectId, actual); err != nil {
+			m.Log.Warning("Info decision: Error while updating the machine %q state. Err: %s", m.ObjectId, err)
+		}
+	}
+}
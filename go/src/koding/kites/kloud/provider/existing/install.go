@@ -0,0 +1,58 @@
+package existing
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+)
+
+// installScript installs klient on an existing host, it mirrors
+// the runcmd section of the cloud-init userdata. The script
+// is run with root privileges.
+var installScript = template.Must(template.New("install").Funcs(template.FuncMap{
+	"quote": quote,
+}).Parse(`set -e
+mkdir -p /etc/kite
+cat > /etc/kite/kite.key <<'KITE_KEY'
+{{.KiteKey}}
+KITE_KEY
+chmod 600 /etc/kite/kite.key
+chown {{quote .Username}} /etc/kite/kite.key
+wget -q {{quote .KlientURL}} --retry-connrefused --tries 5 -O /tmp/latest-klient.deb
+dpkg -i /tmp/latest-klient.deb
+rm -f /tmp/latest-klient.deb
+chown -R {{quote .Username}} /opt/kite/klient
+service klient stop || true
+if ! grep -q 'sudo -E -u' /etc/init/klient.conf; then
+	sed -i 's/\.\/klient/sudo -E -u {{.Username}} \.\/klient/g' /etc/init/klient.conf
+fi
+service klient start
+`))
+
+// uninstallScript stops klient and removes its kite key, so the host
+// no longer registers to Kontrol.
+const uninstallScript = `service klient stop || true
+rm -f /etc/kite/kite.key
+`
+
+// installData is used to execute the installScript template.
+type installData struct {
+	Username  string
+	KiteKey   string
+	KlientURL string
+}
+
+// quote quotes the given value for use in a shell script.
+func quote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+func newInstallScript(data *installData) (string, error) {
+	var buf bytes.Buffer
+
+	if err := installScript.Execute(&buf, data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
@@ -0,0 +1,58 @@
+package existing
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestQuote(t *testing.T) {
+	cases := map[string]string{
+		"":                    "''",
+		"root":                "'root'",
+		"a b":                 "'a b'",
+		"it's":                `'it'\''s'`,
+		"$(reboot)":           "'$(reboot)'",
+		"`reboot`; rm -rf /":  "'`reboot`; rm -rf /'",
+		"https://x/k.deb?a&b": "'https://x/k.deb?a&b'",
+	}
+
+	for s, want := range cases {
+		if got := quote(s); got != want {
+			t.Errorf("%q: got %s, want %s", s, got, want)
+		}
+	}
+}
+
+func TestInstallScript(t *testing.T) {
+	data := &installData{
+		Username:  "deploy",
+		KiteKey:   "kite.key.content",
+		KlientURL: "https://example.com/klient.deb?v=1&x='y'",
+	}
+
+	script, err := newInstallScript(data)
+	if err != nil {
+		t.Fatalf("newInstallScript()=%s", err)
+	}
+
+	want := []string{
+		"set -e\n",
+		"<<'KITE_KEY'\nkite.key.content\nKITE_KEY\n",
+		"chown 'deploy' /etc/kite/kite.key\n",
+		`wget -q 'https://example.com/klient.deb?v=1&x='\''y'\''' --retry-connrefused`,
+		"chown -R 'deploy' /opt/kite/klient\n",
+		`sudo -E -u deploy \.\/klient`,
+		"service klient start\n",
+	}
+
+	for _, s := range want {
+		if !strings.Contains(script, s) {
+			t.Errorf("script does not contain %q:\n%s", s, script)
+		}
+	}
+
+	// text/template must not escape the values as HTML does.
+	if strings.Contains(script, "&amp;") || strings.Contains(script, "&#39;") {
+		t.Errorf("script contains escaped values:\n%s", script)
+	}
+}
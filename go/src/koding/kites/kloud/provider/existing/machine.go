@@ -0,0 +1,55 @@
+package existing
+
+import (
+	"errors"
+
+	"koding/db/mongodb/modelhelper"
+	"koding/kites/kloud/machinestate"
+	"koding/kites/kloud/provider"
+	"koding/kites/kloud/sshutil"
+)
+
+// Meta represents jMachine.meta for "existing" provider.
+type Meta struct {
+	AlwaysOn    bool   `bson:"alwaysOn"`
+	StorageSize int    `bson:"storage_size"`
+	Host        string `bson:"host"`
+	Username    string `bson:"username"`
+	HostKey     string `bson:"hostKey"`
+}
+
+func (meta *Meta) Valid() error {
+	if meta.Host == "" {
+		return errors.New("existing's Host metadata is empty")
+	}
+
+	return nil
+}
+
+type Machine struct {
+	*provider.BaseMachine
+
+	Meta *Meta `bson:"-"`
+	Cred *Cred `bson:"-"`
+}
+
+func (m *Machine) updateState(s machinestate.State) error {
+	return modelhelper.ChangeMachineState(m.ObjectId, "Machine is marked as "+s.String(), s)
+}
+
+// dial connects to the machine over SSH, verifying its host key
+// against the one recorded during apply.
+func (m *Machine) dial() (*sshutil.SSHClient, error) {
+	username := m.Meta.Username
+	if username == "" {
+		username = m.Cred.Username
+	}
+
+	hostKey := m.Meta.HostKey
+	if hostKey == "" {
+		hostKey = m.Cred.HostKey
+	}
+
+	client, _, err := dial(m.Meta.Host, username, m.Cred.PrivateKey, hostKey)
+	return client, err
+}
@@ -0,0 +1,65 @@
+package existing
+
+import (
+	"errors"
+
+	"koding/kites/kloud/stack"
+
+	"golang.org/x/net/context"
+)
+
+// Plan
+func (s *Stack) Plan(ctx context.Context) (*stack.PlanResponse, error) {
+	var arg stack.PlanRequest
+	if err := s.Req.Args.One().Unmarshal(&arg); err != nil {
+		return nil, err
+	}
+
+	if err := arg.Valid(); err != nil {
+		return nil, err
+	}
+
+	if arg.StackID != "" {
+		return nil, errors.New("dry-run plan is not supported for existing hosts")
+	}
+
+	tmpl, err := s.PlanTemplate(&arg)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Log.Debug("Fetching credentials for id %v", tmpl.CredIDs)
+
+	if err := s.Builder.BuildCredentials(s.Req.Method, s.Req.Username, arg.GroupName, tmpl.CredIDs); err != nil {
+		return nil, err
+	}
+
+	contentID := tmpl.ContentID
+
+	s.Log.Debug("Parsing template (%s):\n%s", contentID, tmpl.Content)
+
+	if err := s.Builder.BuildTemplate(tmpl.Content, contentID); err != nil {
+		return nil, err
+	}
+
+	if err := s.Builder.Template.FillVariables("userInput_"); err != nil {
+		return nil, err
+	}
+
+	s.Log.Debug("Injecting existing data")
+
+	if _, err := s.InjectExistingData(); err != nil {
+		return nil, err
+	}
+
+	machines, err := s.machinesFromTemplate(s.Builder.Template)
+	if err != nil {
+		return nil, errors.New("failure reading machines: " + err.Error())
+	}
+
+	s.Log.Debug("Machines planned to be created: %+v", machines)
+
+	return &stack.PlanResponse{
+		Machines: machines.Slice(),
+	}, nil
+}
@@ -0,0 +1,61 @@
+package existing
+
+import (
+	"koding/db/mongodb/modelhelper"
+	"koding/kites/kloud/provider"
+	"koding/kites/kloud/stack"
+
+	"golang.org/x/net/context"
+)
+
+func init() {
+	// The provider lets users point kloud to hosts of their choice,
+	// thus it needs to be explicitly enabled.
+	provider.Optional["existing"] = func(bp *provider.BaseProvider) stack.Provider {
+		return &Provider{
+			BaseProvider: bp,
+		}
+	}
+}
+
+// Provider implements machine management operations for existing
+// hosts, which are reachable over SSH. Kloud does not create nor
+// terminate such machines, it only installs klient on them.
+type Provider struct {
+	*provider.BaseProvider
+}
+
+func (p *Provider) Machine(ctx context.Context, id string) (stack.Machine, error) {
+	bm, err := p.BaseMachine(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var mt Meta
+	if err := modelhelper.BsonDecode(bm.Meta, &mt); err != nil {
+		return nil, err
+	}
+
+	if err := mt.Valid(); err != nil {
+		return nil, err
+	}
+
+	var cred Cred
+	if err := p.FetchCredData(bm, &cred); err != nil {
+		return nil, err
+	}
+
+	if err := cred.Valid(); err != nil {
+		return nil, err
+	}
+
+	return &Machine{
+		BaseMachine: bm,
+		Meta:        &mt,
+		Cred:        &cred,
+	}, nil
+}
+
+func (*Provider) Cred() interface{} {
+	return &Cred{}
+}
@@ -0,0 +1,72 @@
+package existing
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+
+	"koding/kites/kloud/sshutil"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// defaultPort is used when host address has no port specified.
+const defaultPort = "22"
+
+var usernameRe = regexp.MustCompile(`^[a-z_][a-z0-9_.-]*$`)
+
+// Fingerprint gives SHA256 fingerprint of the given host key, in the
+// same format as OpenSSH does, e.g. "SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8".
+func Fingerprint(key ssh.PublicKey) string {
+	sum := sha256.Sum256(key.Marshal())
+	return "SHA256:" + strings.TrimRight(base64.StdEncoding.EncodeToString(sum[:]), "=")
+}
+
+// Addr adds default SSH port to the given host address, if it has none.
+func Addr(host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+
+	return net.JoinHostPort(host, defaultPort)
+}
+
+// dial connects to the given host over SSH. If hostKey is non-empty,
+// the host's key fingerprint must match it.
+//
+// It returns the fingerprint of the host's key.
+func dial(host, username, privateKey, hostKey string) (*sshutil.SSHClient, string, error) {
+	cfg, err := sshutil.SshConfig(username, privateKey)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var fingerprint string
+
+	cfg.HostKeyCallback = hostKeyCallback(host, hostKey, &fingerprint)
+
+	client, err := sshutil.ConnectSSH(Addr(host), cfg)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return client, fingerprint, nil
+}
+
+// hostKeyCallback verifies the host's key fingerprint matches hostKey.
+// If hostKey is empty, any key is trusted on first use. The fingerprint
+// of the host's key is stored in the given value.
+func hostKeyCallback(host, hostKey string, fingerprint *string) func(string, net.Addr, ssh.PublicKey) error {
+	return func(_ string, _ net.Addr, key ssh.PublicKey) error {
+		*fingerprint = Fingerprint(key)
+
+		if hostKey != "" && hostKey != *fingerprint {
+			return fmt.Errorf("host key mismatch for %q: got %s, want %s", host, *fingerprint, hostKey)
+		}
+
+		return nil
+	}
+}
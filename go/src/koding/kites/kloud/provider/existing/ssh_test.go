@@ -0,0 +1,90 @@
+package existing
+
+import (
+	"strings"
+	"testing"
+
+	"koding/kites/kloud/sshutil"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func newHostKey(t *testing.T) ssh.PublicKey {
+	_, pub, err := sshutil.TemporaryKey()
+	if err != nil {
+		t.Fatalf("TemporaryKey()=%s", err)
+	}
+
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pub))
+	if err != nil {
+		t.Fatalf("ParseAuthorizedKey()=%s", err)
+	}
+
+	return key
+}
+
+func TestFingerprint(t *testing.T) {
+	// Host key and fingerprint as printed by ssh-keygen -lf.
+	const pub = "ecdsa-sha2-nistp256 AAAAE2VjZHNhLXNoYTItbmlzdHAyNTYAAAAIbmlzdHAyNTYAAABBBONagh3i3DpF1N1ufK5likcZ3Phqm9SCxn4a4HBcLX49RhXqvhttX9lqgzwuj8LE348bRUJh2d3t7hBZ5K7s2Q0="
+	const want = "SHA256:UYCANNylpHFCpFnmETJdnU+gFiZjpFVfe35C6fqdHmo"
+
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pub))
+	if err != nil {
+		t.Fatalf("ParseAuthorizedKey()=%s", err)
+	}
+
+	if got := Fingerprint(key); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestHostKeyCallback(t *testing.T) {
+	key := newHostKey(t)
+	other := newHostKey(t)
+
+	// The key is trusted on first use.
+	var fingerprint string
+
+	if err := hostKeyCallback("example.com", "", &fingerprint)("", nil, key); err != nil {
+		t.Fatalf("callback()=%s", err)
+	}
+
+	if want := Fingerprint(key); fingerprint != want {
+		t.Fatalf("got %q fingerprint, want %q", fingerprint, want)
+	}
+
+	// Once recorded, the same key is accepted.
+	hostKey := fingerprint
+	fingerprint = ""
+
+	if err := hostKeyCallback("example.com", hostKey, &fingerprint)("", nil, key); err != nil {
+		t.Fatalf("callback()=%s", err)
+	}
+
+	if fingerprint != hostKey {
+		t.Fatalf("got %q fingerprint, want %q", fingerprint, hostKey)
+	}
+
+	// Any other key is rejected.
+	err := hostKeyCallback("example.com", hostKey, &fingerprint)("", nil, other)
+	if err == nil || !strings.Contains(err.Error(), "host key mismatch") {
+		t.Fatalf("got %v, want host key mismatch error", err)
+	}
+}
+
+func TestAddr(t *testing.T) {
+	cases := map[string]string{
+		"example.com":       "example.com:22",
+		"example.com:2222":  "example.com:2222",
+		"10.0.0.2":          "10.0.0.2:22",
+		"10.0.0.2:2222":     "10.0.0.2:2222",
+		"::1":               "[::1]:22",
+		"[2001:db8::1]:222": "[2001:db8::1]:222",
+	}
+
+	for host, want := range cases {
+		if got := Addr(host); got != want {
+			t.Errorf("%s: got %q, want %q", host, got, want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package existing
+
+import (
+	"errors"
+
+	"koding/kites/kloud/provider"
+	"koding/kites/kloud/stack"
+	"koding/kites/kloud/stackplan"
+
+	"golang.org/x/net/context"
+)
+
+// Cred represents jCredentialDatas.meta for "existing" provider.
+type Cred struct {
+	// Host is an address of the machine, e.g. 10.0.0.2 or example.com:2222.
+	Host     string `json:"host" bson:"host" hcl:"host"`
+	Username string `json:"username" bson:"username" hcl:"username"`
+
+	// PrivateKey is never injected into the stack template.
+	PrivateKey string `json:"privateKey" bson:"privateKey" hcl:"-"`
+
+	// HostKey is a fingerprint of the host's key, it is recorded
+	// during bootstrap.
+	HostKey string `json:"hostKey,omitempty" bson:"hostKey,omitempty" hcl:"host_key"`
+}
+
+var _ stack.Validator = (*Cred)(nil)
+
+// Valid implements the kloud.Validator interface.
+func (meta *Cred) Valid() error {
+	if meta.Host == "" {
+		return errors.New("existing meta: host is empty")
+	}
+	if meta.PrivateKey == "" {
+		return errors.New("existing meta: private key is empty")
+	}
+	if meta.Username != "" && !usernameRe.MatchString(meta.Username) {
+		return errors.New("existing meta: invalid username: " + meta.Username)
+	}
+	return nil
+}
+
+// BootstrapValid checks whether the credential was bootstrapped.
+func (meta *Cred) BootstrapValid() error {
+	if meta.HostKey == "" {
+		return errors.New("existing meta: host key is empty, was the credential bootstrapped?")
+	}
+	return nil
+}
+
+// SetDefaults sets default values for existing credential metadata.
+func (meta *Cred) SetDefaults() (updated bool) {
+	if meta.Username == "" {
+		meta.Username = "root"
+		return true
+	}
+	return false
+}
+
+// Stack provides an implementation for the kloud.Stacker interface.
+type Stack struct {
+	*provider.BaseStack
+
+	// Credential represents existing host credential value.
+	//
+	// The Meta field is of *Cred type.
+	// The field is set during injecting variables to a template.
+	Credential *stackplan.Credential
+
+	// The following fields are set by buildResources method:
+	hosts   map[string]*Host
+	ids     stackplan.KiteMap
+	klients map[string]*stackplan.DialState
+
+	p *stackplan.Planner
+}
+
+// Ensure Provider implements the kloud.StackProvider interface.
+var _ stack.Provider = (*Provider)(nil)
+
+// Stack
+func (p *Provider) Stack(ctx context.Context) (stack.Stack, error) {
+	bs, err := p.BaseStack(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Stack{
+		BaseStack: bs,
+		p: &stackplan.Planner{
+			Provider:     "existing",
+			ResourceType: "instance",
+		},
+	}
+
+	bs.BuildResources = s.buildResources
+	bs.WaitResources = s.waitResources
+	bs.UpdateResources = s.updateResources
+	bs.ApplyResources = s.applyResources
+	bs.DestroyResources = s.destroyResources
+
+	return s, nil
+}
@@ -0,0 +1,220 @@
+package existing
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"koding/db/models"
+	"koding/db/mongodb/modelhelper"
+	"koding/kites/kloud/stackplan"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+var variableRe = regexp.MustCompile(`^\$\{var\.([^}]+)\}$`)
+
+// ExistingResource represents existing_instance resource of
+// the stack template.
+type ExistingResource struct {
+	Build map[string]map[string]interface{} `hcl:"existing_instance"`
+}
+
+// Host represents a single existing_instance resource.
+type Host struct {
+	Label    string
+	Host     string
+	Username string
+
+	// HostKey is a fingerprint of the host's key, when empty the key
+	// is recorded on the first connection.
+	HostKey string
+}
+
+// InjectExistingData reads existing_instance resources from the stack
+// template. Unlike other providers, the template is not applied by
+// Terraform, thus every value must be either a literal or a reference
+// to a single variable.
+func (s *Stack) InjectExistingData() (map[string]*Host, error) {
+	for _, c := range s.Builder.Credentials {
+		if c.Provider == "existing" {
+			s.Credential = c
+			break
+		}
+	}
+
+	if s.Credential == nil {
+		return nil, errors.New("existing credential not found")
+	}
+
+	meta := s.Credential.Meta.(*Cred)
+	meta.SetDefaults()
+
+	t := s.Builder.Template
+
+	s.Log.Debug("Injecting existing credentials: host=%q, username=%q", meta.Host, meta.Username)
+
+	if err := t.InjectVariables(s.Credential.Provider, s.Credential.Meta); err != nil {
+		return nil, err
+	}
+
+	var res ExistingResource
+
+	if err := t.DecodeResource(&res); err != nil {
+		return nil, err
+	}
+
+	if len(res.Build) == 0 {
+		return nil, errors.New("no existing instances specified")
+	}
+
+	hosts := make(map[string]*Host, len(res.Build))
+
+	for label, instance := range res.Build {
+		h := &Host{
+			Label:    label,
+			Host:     meta.Host,
+			Username: meta.Username,
+		}
+
+		if v, ok := instance["host"].(string); ok {
+			host, err := s.value(v)
+			if err != nil {
+				return nil, err
+			}
+
+			h.Host = host
+		}
+
+		if v, ok := instance["username"].(string); ok {
+			username, err := s.value(v)
+			if err != nil {
+				return nil, err
+			}
+
+			if username != "" && !usernameRe.MatchString(username) {
+				return nil, fmt.Errorf("invalid username for %q instance: %q", label, username)
+			}
+
+			if username != "" {
+				h.Username = username
+			}
+		}
+
+		switch m, ok := s.Builder.Machines[label]; {
+		case h.Host == meta.Host:
+			h.HostKey = meta.HostKey
+		case ok && m.Meta["host"] == h.Host:
+			h.HostKey, _ = m.Meta["hostKey"].(string)
+		}
+
+		if h.Host != "" {
+			instance["host"] = h.Host
+		}
+
+		instance["username"] = h.Username
+
+		hosts[label] = h
+	}
+
+	t.Resource["existing_instance"] = res.Build
+
+	if err := t.Flush(); err != nil {
+		return nil, err
+	}
+
+	return hosts, nil
+}
+
+// value resolves the given template value, which is either a literal
+// or a reference to a single variable.
+func (s *Stack) value(v string) (string, error) {
+	if !stackplan.IsVariable(v) {
+		return v, nil
+	}
+
+	m := variableRe.FindStringSubmatch(v)
+	if m == nil {
+		return "", fmt.Errorf("unsupported interpolation: %q", v)
+	}
+
+	var variables map[string]map[string]interface{}
+
+	if err := s.Builder.Template.DecodeVariable(&variables); err != nil {
+		return "", err
+	}
+
+	variable, ok := variables[m[1]]
+	if !ok {
+		return "", fmt.Errorf("undefined variable: %q", m[1])
+	}
+
+	value, _ := variable["default"].(string)
+
+	return value, nil
+}
+
+func (s *Stack) machinesFromTemplate(t *stackplan.Template) (stackplan.Machines, error) {
+	var res ExistingResource
+	if err := t.DecodeResource(&res); err != nil {
+		return nil, err
+	}
+
+	machines := make(stackplan.Machines, len(res.Build))
+
+	for label, instance := range res.Build {
+		m := &stackplan.Machine{
+			Provider:   "existing",
+			Label:      label,
+			Attributes: make(map[string]string),
+		}
+
+		if host, ok := instance["host"].(string); ok && !stackplan.IsVariable(host) {
+			m.Attributes["host"] = host
+		}
+		if username, ok := instance["username"].(string); ok && !stackplan.IsVariable(username) {
+			m.Attributes["username"] = username
+		}
+
+		machines[label] = m
+	}
+
+	return machines, nil
+}
+
+func (s *Stack) updateMachines(machines stackplan.Machines, jMachines map[string]*models.Machine) error {
+	for label, machine := range jMachines {
+		s.Log.Debug("Updating machine with %q label and %q provider", label, machine.Provider)
+
+		m, ok := machines[label]
+		if !ok {
+			return fmt.Errorf("machine label '%s' doesn't exist in apply output", label)
+		}
+
+		if m.Provider == "existing" {
+			if err := updateExisting(m, machine.ObjectId, s.Credential.Identifier); err != nil {
+				return stackplan.ResError(err, "jMachine")
+			}
+		}
+	}
+
+	return nil
+}
+
+func updateExisting(m *stackplan.Machine, machineId bson.ObjectId, credential string) error {
+	machine := bson.M{
+		"provider":          m.Provider,
+		"queryString":       m.QueryString,
+		"credential":        credential,
+		"ipAddress":         m.Attributes["ip_address"],
+		"meta.host":         m.Attributes["host"],
+		"meta.username":     m.Attributes["username"],
+		"meta.hostKey":      m.Attributes["host_key"],
+		"status.modifiedAt": time.Now().UTC(),
+		"status.state":      m.State.String(),
+		"status.reason":     m.StateReason,
+	}
+
+	return modelhelper.UpdateMachine(machineId, bson.M{"$set": machine})
+}
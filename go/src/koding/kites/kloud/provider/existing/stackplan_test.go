@@ -0,0 +1,144 @@
+package existing
+
+import (
+	"reflect"
+	"testing"
+
+	"koding/db/models"
+	"koding/kites/kloud/provider"
+	"koding/kites/kloud/stackplan"
+
+	"github.com/koding/logging"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const testTemplate = `{
+  "variable": {
+    "web_host": {
+      "default": "web.example.com"
+    }
+  },
+  "resource": {
+    "existing_instance": {
+      "default": {},
+      "cred": {
+        "host": "${var.existing_host}"
+      },
+      "web": {
+        "host": "${var.web_host}",
+        "username": "deploy"
+      },
+      "db": {
+        "host": "db.example.com"
+      }
+    }
+  }
+}`
+
+func newTestStack(t *testing.T, content string, machines map[string]*models.Machine) *Stack {
+	log := logging.NewCustom("existing", false)
+
+	tmpl, err := stackplan.ParseTemplate(content, log)
+	if err != nil {
+		t.Fatalf("ParseTemplate()=%s", err)
+	}
+
+	return &Stack{
+		BaseStack: &provider.BaseStack{
+			Log: log,
+			Builder: &stackplan.Builder{
+				Template: tmpl,
+				Machines: machines,
+				Credentials: []*stackplan.Credential{{
+					Provider:   "existing",
+					Identifier: "identifier",
+					Meta: &Cred{
+						Host:       "cred.example.com:2222",
+						PrivateKey: "private key",
+						HostKey:    "SHA256:cred",
+					},
+				}},
+			},
+		},
+	}
+}
+
+func TestInjectExistingData(t *testing.T) {
+	machines := map[string]*models.Machine{
+		"db": {
+			ObjectId: bson.NewObjectId(),
+			Meta: bson.M{
+				"host":    "db.example.com",
+				"hostKey": "SHA256:db",
+			},
+		},
+		// Host key of a machine is not used when its host changes.
+		"web": {
+			ObjectId: bson.NewObjectId(),
+			Meta: bson.M{
+				"host":    "old.example.com",
+				"hostKey": "SHA256:old",
+			},
+		},
+	}
+
+	s := newTestStack(t, testTemplate, machines)
+
+	hosts, err := s.InjectExistingData()
+	if err != nil {
+		t.Fatalf("InjectExistingData()=%s", err)
+	}
+
+	want := map[string]*Host{
+		"default": {Label: "default", Host: "cred.example.com:2222", Username: "root", HostKey: "SHA256:cred"},
+		"cred":    {Label: "cred", Host: "cred.example.com:2222", Username: "root", HostKey: "SHA256:cred"},
+		"web":     {Label: "web", Host: "web.example.com", Username: "deploy"},
+		"db":      {Label: "db", Host: "db.example.com", Username: "root", HostKey: "SHA256:db"},
+	}
+
+	if !reflect.DeepEqual(hosts, want) {
+		t.Fatalf("got %+v, want %+v", hosts, want)
+	}
+
+	// The resolved values must be written back to the template.
+	var res ExistingResource
+
+	if err := s.Builder.Template.DecodeResource(&res); err != nil {
+		t.Fatalf("DecodeResource()=%s", err)
+	}
+
+	for label, h := range want {
+		instance := res.Build[label]
+
+		if instance["host"] != h.Host || instance["username"] != h.Username {
+			t.Errorf("%s: got %v, want host=%q, username=%q", label, instance, h.Host, h.Username)
+		}
+	}
+}
+
+func TestInjectExistingDataInvalid(t *testing.T) {
+	cases := map[string]string{
+		"interpolation": `{"resource": {"existing_instance": {"web": {"host": "${var.existing_host}:22"}}}}`,
+		"undefined":     `{"resource": {"existing_instance": {"web": {"host": "${var.undefined}"}}}}`,
+		"username":      `{"resource": {"existing_instance": {"web": {"username": "root; reboot"}}}}`,
+		"no instances":  `{"resource": {"aws_instance": {"web": {}}}}`,
+	}
+
+	for name, content := range cases {
+		s := newTestStack(t, content, nil)
+
+		if _, err := s.InjectExistingData(); err == nil {
+			t.Errorf("%s: want error", name)
+		}
+	}
+}
+
+func TestProviderOptional(t *testing.T) {
+	if _, ok := provider.All["existing"]; ok {
+		t.Fatal("existing provider must not be enabled by default")
+	}
+
+	if _, ok := provider.Optional["existing"]; !ok {
+		t.Fatal("existing provider is not registered as optional one")
+	}
+}
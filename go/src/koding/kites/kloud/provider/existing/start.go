@@ -0,0 +1,78 @@
+package existing
+
+import (
+	"fmt"
+	"time"
+
+	"koding/kites/kloud/machinestate"
+	"koding/kites/kloud/stack"
+
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Start starts klient on the machine, the host itself is expected
+// to be already running.
+func (m *Machine) Start(ctx context.Context) error {
+	err := m.start(ctx)
+	if err != nil {
+		return stack.NewEventerError(err)
+	}
+
+	return nil
+}
+
+func (m *Machine) start(ctx context.Context) (err error) {
+	origState := m.State()
+
+	if err = m.updateState(machinestate.Starting); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			// bring back original state in case of error
+			m.updateState(origState)
+		}
+	}()
+
+	m.PushEvent("Starting machine", 25, machinestate.Starting)
+
+	if err := m.service("start"); err != nil {
+		return err
+	}
+
+	m.PushEvent("Checking remote machine", 75, machinestate.Starting)
+
+	if err := m.WaitKlientReady(); err != nil {
+		return err
+	}
+
+	return m.Session.DB.Run("jMachines", func(c *mgo.Collection) error {
+		return c.UpdateId(
+			m.ObjectId,
+			bson.M{"$set": bson.M{
+				"status.state":      machinestate.Running.String(),
+				"status.modifiedAt": time.Now().UTC(),
+				"status.reason":     "Machine is running",
+			}},
+		)
+	})
+}
+
+// service runs the given klient service command on the machine.
+func (m *Machine) service(command string) error {
+	client, err := m.dial()
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	out, err := client.StartCommand("sudo -n service klient " + command)
+	if err != nil {
+		return fmt.Errorf("%s: %s", err, out)
+	}
+
+	return nil
+}
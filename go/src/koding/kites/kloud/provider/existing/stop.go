@@ -0,0 +1,54 @@
+package existing
+
+import (
+	"time"
+
+	"koding/kites/kloud/machinestate"
+	"koding/kites/kloud/stack"
+
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Stop stops klient on the machine, the host itself is left running.
+func (m *Machine) Stop(ctx context.Context) error {
+	err := m.stop(ctx)
+	if err != nil {
+		return stack.NewEventerError(err)
+	}
+
+	return nil
+}
+
+func (m *Machine) stop(ctx context.Context) (err error) {
+	origState := m.State()
+
+	if err = m.updateState(machinestate.Stopping); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			// bring back original state in case of error
+			m.updateState(origState)
+		}
+	}()
+
+	m.PushEvent("Stopping machine", 50, machinestate.Stopping)
+
+	if err := m.service("stop"); err != nil {
+		return err
+	}
+
+	return m.Session.DB.Run("jMachines", func(c *mgo.Collection) error {
+		return c.UpdateId(
+			m.ObjectId,
+			bson.M{"$set": bson.M{
+				"status.state":      machinestate.Stopped.String(),
+				"status.modifiedAt": time.Now().UTC(),
+				"status.reason":     "Machine is stopped",
+			}},
+		)
+	})
+}
@@ -1,63 +1,32 @@
 package provider
 
 import (
-	"time"
-
-	"koding/db/models"
+	"koding/kites/kloud/pkg/lease"
 	"koding/kites/kloud/stack"
-
-	"gopkg.in/mgo.v2"
-	"gopkg.in/mgo.v2/bson"
 )
 
+// Lock acquires a lease for the given machine id. The lease is renewed
+// until Unlock is called; if the kloud process dies meanwhile,
+// the lease expires and the machine can be locked by other kloud.
 func (bp *BaseProvider) Lock(id string) error {
-	err := bp.DB.Run("jMachines", func(c *mgo.Collection) error {
-		// we use findAndModify() to get a unique lock from the DB. That means only
-		// one instance should be responsible for this action. We will update the
-		// assignee if none else is doing stuff with it.
-		change := mgo.Change{
-			Update: bson.M{
-				"$set": bson.M{
-					"assignee.inProgress": true,
-					"assignee.assignedAt": time.Now().UTC(),
-				},
-			},
-			ReturnNew: true,
-		}
-
-		// if Find() is successful the Update() above will be applied (which
-		// set's us as assignee by marking the inProgress to true). If not, it
-		// means someone else is working on this document and we should return
-		// with an error. The whole process is atomic and a single transaction.
-		_, err := c.Find(
-			bson.M{
-				"_id": bson.ObjectIdHex(id),
-				"assignee.inProgress": bson.M{"$ne": true},
-			},
-		).Apply(change, &models.Machine{}) // machine is used just used for prevent nil unmarshalling
-		return err
-	})
+	err := bp.Locker.Lock(id)
 
-	// query didn't matched, means it's assigned to some other Kloud
-	// instances and an ongoing event is in process.
-	if err == mgo.ErrNotFound {
+	// lease is held by other kloud instance, or by other
+	// ongoing operation of this one
+	if err == lease.ErrLocked {
 		return stack.ErrLockAcquired
 	}
 
 	// some other error, this shouldn't be happed
 	if err != nil {
-		bp.Log.Error("Storage get error: %s", err)
+		bp.Log.Error("Lease acquire error: %s", err)
 		return stack.NewError(stack.ErrBadState)
 	}
 
 	return nil
 }
 
+// Unlock releases the lease for the given machine id.
 func (bp *BaseProvider) Unlock(id string) {
-	bp.DB.Run("jMachines", func(c *mgo.Collection) error {
-		return c.UpdateId(
-			bson.ObjectIdHex(id),
-			bson.M{"$set": bson.M{"assignee.inProgress": false}},
-		)
-	})
+	bp.Locker.Unlock(id)
 }
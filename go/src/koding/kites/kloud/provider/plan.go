@@ -0,0 +1,226 @@
+package provider
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"koding/db/mongodb/modelhelper"
+	"koding/kites/kloud/stack"
+	"koding/kites/kloud/stackplan"
+	"koding/kites/kloud/terraformer"
+	tf "koding/kites/terraformer"
+
+	"github.com/hashicorp/terraform/terraform"
+	"golang.org/x/net/context"
+)
+
+// PlanTemplate is a stack template requested to be planned.
+type PlanTemplate struct {
+	Content   string
+	ContentID string
+	CredIDs   []string
+
+	// Draft is true for templates sent with the request, which
+	// must not be stored.
+	Draft bool
+}
+
+// PlanTemplate gives the template to plan for the given request - either
+// the one sent with the request or the jStackTemplate document.
+func (bs *BaseStack) PlanTemplate(req *stack.PlanRequest) (*PlanTemplate, error) {
+	if req.Template != "" {
+		return &PlanTemplate{
+			Content:   req.Template,
+			ContentID: bs.Req.Username + "-" + modelhelper.StackTemplateSum(req.Template),
+			CredIDs:   stackplan.FlattenValues(req.Credentials),
+			Draft:     true,
+		}, nil
+	}
+
+	bs.Log.Debug("Fetching template for id %s", req.StackTemplateID)
+
+	stackTemplate, err := modelhelper.GetStackTemplate(req.StackTemplateID)
+	if err != nil {
+		return nil, stackplan.ResError(err, "jStackTemplate")
+	}
+
+	if stackTemplate.Template.Content == "" {
+		return nil, errors.New("Stack template content is empty")
+	}
+
+	return &PlanTemplate{
+		Content:   stackTemplate.Template.Content,
+		ContentID: bs.Req.Username + "-" + req.StackTemplateID,
+		CredIDs:   stackplan.FlattenValues(stackTemplate.Credentials),
+	}, nil
+}
+
+// DryRun builds the compute stack template for the given ID the same way
+// Apply does, and asks terraformer to plan it against the stored state
+// of the stack. Neither the state nor the stack template are modified.
+//
+// If the request carries a template, it is planned instead of the one
+// the stack was built from.
+func (bs *BaseStack) DryRun(ctx context.Context, req *stack.PlanRequest) (*stack.PlanResponse, error) {
+	if err := bs.Builder.BuildStack(req.StackID, req.Credentials); err != nil {
+		return nil, err
+	}
+
+	if err := bs.Builder.BuildMachines(ctx); err != nil {
+		return nil, err
+	}
+
+	credIDs := stackplan.FlattenValues(bs.Builder.Stack.Credentials)
+
+	bs.Log.Debug("Fetching '%d' credentials from user '%s'", len(credIDs), bs.Req.Username)
+
+	if err := bs.Builder.BuildCredentials(bs.Req.Method, bs.Req.Username, req.GroupName, credIDs); err != nil {
+		return nil, err
+	}
+
+	contentID := req.GroupName + "-" + req.StackID
+	bs.Log.Debug("Building template: %s", contentID)
+
+	content := bs.Builder.Stack.Template
+	if req.Template != "" {
+		content = req.Template
+	}
+
+	if err := bs.Builder.BuildTemplate(content, contentID); err != nil {
+		return nil, err
+	}
+
+	if err := bs.BuildResources(); err != nil {
+		return nil, err
+	}
+
+	out, err := bs.Builder.Template.JsonOutput()
+	if err != nil {
+		return nil, err
+	}
+
+	tfKite, err := terraformer.Connect(bs.Session.Terraformer)
+	if err != nil {
+		return nil, err
+	}
+	defer tfKite.Close()
+
+	tfReq := &tf.TerraformRequest{
+		Content:   out,
+		ContentID: contentID,
+		TraceID:   bs.TraceID,
+		DryRun:    true,
+	}
+
+	bs.Log.Debug("Calling dry-run plan with content")
+	bs.Log.Debug("%+v", tfReq)
+
+	if tfReq.Variables, err = bs.terraformVariables(); err != nil {
+		return nil, err
+	}
+
+	plan, err := tfKite.Plan(tfReq)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := ResourceDiffs(plan)
+
+	resp := &stack.PlanResponse{
+		Resources: resources,
+		Summary:   stack.NewPlanSummary(resources),
+	}
+
+	if resp.Cost, err = bs.Estimate(); err != nil {
+		bs.Log.Warning("unable to estimate stack cost: %s", err)
+	}
+
+	return resp, nil
+}
+
+// ResourceDiffs converts the terraform plan to a list of resource
+// changes, sorted by resource name.
+func ResourceDiffs(plan *terraform.Plan) []*stack.ResourceDiff {
+	if plan == nil || plan.Diff == nil {
+		return nil
+	}
+
+	var resources []*stack.ResourceDiff
+
+	for _, module := range plan.Diff.Modules {
+		prefix := ""
+		if !module.IsRoot() {
+			prefix = "module." + strings.Join(module.Path[1:], ".module.") + "."
+		}
+
+		for name, diff := range module.Resources {
+			action := diffAction(diff.ChangeType())
+			if action == "" {
+				continue
+			}
+
+			r := &stack.ResourceDiff{
+				Name:   prefix + name,
+				Type:   resourceType(name),
+				Action: action,
+			}
+
+			for attr, d := range diff.Attributes {
+				r.Attributes = append(r.Attributes, &stack.AttributeDiff{
+					Name:        attr,
+					Old:         d.Old,
+					New:         d.New,
+					Computed:    d.NewComputed,
+					Removed:     d.NewRemoved,
+					RequiresNew: d.RequiresNew,
+				})
+			}
+
+			sort.Sort(byAttrName(r.Attributes))
+
+			resources = append(resources, r)
+		}
+	}
+
+	sort.Sort(byResourceName(resources))
+
+	return resources
+}
+
+func diffAction(typ terraform.DiffChangeType) string {
+	switch typ {
+	case terraform.DiffCreate:
+		return stack.ActionCreate
+	case terraform.DiffUpdate:
+		return stack.ActionUpdate
+	case terraform.DiffDestroyCreate:
+		return stack.ActionReplace
+	case terraform.DiffDestroy:
+		return stack.ActionDestroy
+	default:
+		return ""
+	}
+}
+
+// resourceType gives a resource type for the given resource name,
+// e.g. "aws_instance" for "aws_instance.example.0".
+func resourceType(name string) string {
+	if i := strings.IndexRune(name, '.'); i != -1 {
+		return name[:i]
+	}
+
+	return name
+}
+
+type byAttrName []*stack.AttributeDiff
+
+func (a byAttrName) Len() int           { return len(a) }
+func (a byAttrName) Less(i, j int) bool { return a[i].Name < a[j].Name }
+func (a byAttrName) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+type byResourceName []*stack.ResourceDiff
+
+func (r byResourceName) Len() int           { return len(r) }
+func (r byResourceName) Less(i, j int) bool { return r[i].Name < r[j].Name }
+func (r byResourceName) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
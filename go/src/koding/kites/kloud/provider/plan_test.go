@@ -0,0 +1,85 @@
+package provider_test
+
+import (
+	"reflect"
+	"testing"
+
+	"koding/kites/kloud/provider"
+	"koding/kites/kloud/stack"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestResourceDiffs(t *testing.T) {
+	plan := &terraform.Plan{
+		Diff: &terraform.Diff{
+			Modules: []*terraform.ModuleDiff{{
+				Path: []string{"root"},
+				Resources: map[string]*terraform.InstanceDiff{
+					"aws_instance.web": {
+						Attributes: map[string]*terraform.ResourceAttrDiff{
+							"instance_type": {Old: "t2.micro", New: "t2.small"},
+						},
+					},
+					"aws_instance.db": {
+						Attributes: map[string]*terraform.ResourceAttrDiff{
+							"ami": {Old: "ami-1", New: "ami-2", RequiresNew: true},
+							"id":  {Old: "i-1", NewComputed: true},
+						},
+						Destroy: true,
+					},
+					"aws_eip.ip": {
+						Attributes: map[string]*terraform.ResourceAttrDiff{
+							"id": {NewComputed: true, RequiresNew: true},
+						},
+					},
+					"aws_ebs_volume.data": {
+						Destroy: true,
+					},
+				},
+			}},
+		},
+	}
+
+	want := []*stack.ResourceDiff{{
+		Name:   "aws_ebs_volume.data",
+		Type:   "aws_ebs_volume",
+		Action: stack.ActionDestroy,
+	}, {
+		Name:   "aws_eip.ip",
+		Type:   "aws_eip",
+		Action: stack.ActionCreate,
+		Attributes: []*stack.AttributeDiff{
+			{Name: "id", Computed: true, RequiresNew: true},
+		},
+	}, {
+		Name:   "aws_instance.db",
+		Type:   "aws_instance",
+		Action: stack.ActionReplace,
+		Attributes: []*stack.AttributeDiff{
+			{Name: "ami", Old: "ami-1", New: "ami-2", RequiresNew: true},
+			{Name: "id", Old: "i-1", Computed: true},
+		},
+	}, {
+		Name:   "aws_instance.web",
+		Type:   "aws_instance",
+		Action: stack.ActionUpdate,
+		Attributes: []*stack.AttributeDiff{
+			{Name: "instance_type", Old: "t2.micro", New: "t2.small"},
+		},
+	}}
+
+	got := provider.ResourceDiffs(plan)
+
+	if !reflect.DeepEqual(got, want) {
+		for i := range got {
+			t.Logf("got[%d]: %+v", i, got[i])
+		}
+		t.Fatalf("got %+v; want %+v", got, want)
+	}
+
+	summary := stack.NewPlanSummary(got)
+	if want := (&stack.PlanSummary{Create: 1, Update: 1, Replace: 1, Destroy: 1}); !reflect.DeepEqual(summary, want) {
+		t.Fatalf("got %+v; want %+v", summary, want)
+	}
+}
@@ -0,0 +1,196 @@
+package provider
+
+import (
+	"fmt"
+
+	"koding/db/models"
+	"koding/db/mongodb/modelhelper"
+	"koding/kites/kloud/policy"
+	"koding/kites/kloud/stack"
+	"koding/kites/kloud/stackplan"
+
+	"golang.org/x/net/context"
+)
+
+// Validate builds the stack template together with its resources, the
+// same way Apply does, and evaluates it against the stack policy of the
+// group. The template sent with the request is validated without
+// being stored.
+func (bs *BaseStack) Validate(ctx context.Context, req *stack.ValidateRequest) (*stack.ValidateResponse, error) {
+	var content, contentID string
+	var credIDs []string
+
+	switch {
+	case req.Template != "":
+		content = req.Template
+		contentID = bs.Req.Username + "-" + modelhelper.StackTemplateSum(req.Template)
+		credIDs = stackplan.FlattenValues(req.Credentials)
+	case req.StackID != "":
+		if err := bs.Builder.BuildStack(req.StackID, nil); err != nil {
+			return nil, err
+		}
+
+		computeStack := bs.Builder.Stack.Stack
+
+		if computeStack.Group != req.GroupName {
+			return nil, fmt.Errorf("stack %q does not belong to %q team", req.StackID, req.GroupName)
+		}
+
+		if err := bs.checkStackOwner(computeStack.OriginId, req.GroupName); err != nil {
+			return nil, err
+		}
+
+		if err := bs.Builder.BuildMachines(ctx); err != nil {
+			return nil, err
+		}
+
+		content = bs.Builder.Stack.Template
+		contentID = req.GroupName + "-" + req.StackID
+		credIDs = stackplan.FlattenValues(bs.Builder.Stack.Credentials)
+	default:
+		stackTemplate, err := modelhelper.GetStackTemplate(req.StackTemplateID)
+		if err != nil {
+			return nil, stackplan.ResError(err, "jStackTemplate")
+		}
+
+		if err := bs.checkTemplateAccess(stackTemplate, req.GroupName); err != nil {
+			return nil, err
+		}
+
+		content = stackTemplate.Template.Content
+		contentID = bs.Req.Username + "-" + req.StackTemplateID
+		credIDs = stackplan.FlattenValues(stackTemplate.Credentials)
+	}
+
+	bs.Log.Debug("Fetching '%d' credentials from user '%s'", len(credIDs), bs.Req.Username)
+
+	if err := bs.Builder.BuildCredentials(bs.Req.Method, bs.Req.Username, req.GroupName, credIDs); err != nil {
+		return nil, err
+	}
+
+	if err := bs.Builder.BuildTemplate(content, contentID); err != nil {
+		return nil, err
+	}
+
+	// Resources are built before validation, as providers inject
+	// default values (e.g. instance types or regions) which the
+	// policy must see.
+	if err := bs.BuildResources(); err != nil {
+		return nil, err
+	}
+
+	p, err := bs.Policy(req.GroupName)
+	if err != nil {
+		return nil, err
+	}
+
+	violations, err := p.Validate(bs.Builder.Template)
+	if err != nil {
+		return nil, err
+	}
+
+	return &stack.ValidateResponse{
+		Valid:      len(violations) == 0,
+		Violations: violations,
+	}, nil
+}
+
+// checkTemplateAccess ensures the requesting user can read the stack
+// template from within the given group. The access rules follow the ones
+// of JStackTemplate: the owner can read any template, public ones are
+// readable by everyone, group ones by members of the group. Admins of
+// the template's group can read any template of the group.
+func (bs *BaseStack) checkTemplateAccess(t *models.StackTemplate, groupName string) error {
+	account, err := modelhelper.GetAccount(bs.Req.Username)
+	if err != nil {
+		return stackplan.ResError(err, "jAccount")
+	}
+
+	if account.Id == t.OriginID || t.AccessLevel == "public" {
+		return nil
+	}
+
+	if t.Group != groupName {
+		return fmt.Errorf("stack template %q does not belong to %q team", t.Id.Hex(), groupName)
+	}
+
+	if t.AccessLevel == "group" {
+		groups, err := modelhelper.FetchAccountGroups(bs.Req.Username)
+		if err != nil {
+			return err
+		}
+
+		for _, group := range groups {
+			if group == groupName {
+				return nil
+			}
+		}
+	}
+
+	isAdmin, err := modelhelper.IsAdmin(bs.Req.Username, groupName)
+	if err != nil {
+		return err
+	}
+
+	if !isAdmin {
+		return fmt.Errorf("user %q is not allowed to access the stack template", bs.Req.Username)
+	}
+
+	return nil
+}
+
+// Policy gives a stack policy of the given group.
+func (bs *BaseStack) Policy(groupName string) (*policy.Policy, error) {
+	group, err := modelhelper.GetGroup(groupName)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read stack policy of %q group: %s", groupName, err)
+	}
+
+	return policy.New(group), nil
+}
+
+// CheckCredentialsPolicy returns non-nil error if providers of the built
+// credentials are not allowed by the group stack policy. The region func,
+// if non-nil, is used to read a region of each credential.
+func (bs *BaseStack) CheckCredentialsPolicy(groupName string, region func(*stackplan.Credential) string) error {
+	p, err := bs.Policy(groupName)
+	if err != nil {
+		return err
+	}
+
+	var violations []*policy.Violation
+
+	for _, cred := range bs.Builder.Credentials {
+		resource := "credential." + cred.Identifier
+
+		if v := p.ValidateProvider(resource, cred.Provider); v != nil {
+			violations = append(violations, v)
+		}
+
+		if region == nil {
+			continue
+		}
+
+		if v := p.ValidateRegion(resource, region(cred)); v != nil {
+			violations = append(violations, v)
+		}
+	}
+
+	return policy.Check(violations)
+}
+
+// checkPolicy returns non-nil error if the built template violates
+// the group stack policy.
+func (bs *BaseStack) checkPolicy(groupName string) error {
+	p, err := bs.Policy(groupName)
+	if err != nil {
+		return err
+	}
+
+	violations, err := p.Validate(bs.Builder.Template)
+	if err != nil {
+		return err
+	}
+
+	return policy.Check(violations)
+}
@@ -0,0 +1,58 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+
+	"koding/db/mongodb/modelhelper"
+	"koding/kites/kloud/pricing"
+)
+
+// Estimate gives an estimated monthly cost of the built stack. It returns
+// nil estimate if the provider does not support cost estimation.
+func (bs *BaseStack) Estimate() (*pricing.Estimate, error) {
+	if bs.EstimateCost == nil {
+		return nil, nil
+	}
+
+	return bs.EstimateCost()
+}
+
+// checkBudget returns non-nil error if the estimated cost of the built
+// stack exceeds the budget of the given group. Stacks which cost can't
+// be fully estimated are refused when the group has a budget configured.
+func (bs *BaseStack) checkBudget(groupName string) error {
+	if bs.EstimateCost == nil {
+		return nil
+	}
+
+	group, err := modelhelper.GetGroup(groupName)
+	if err != nil {
+		return fmt.Errorf("unable to read budget of %q group: %s", groupName, err)
+	}
+
+	if group.Budget == nil || group.Budget.MonthlyLimit <= 0 {
+		return nil
+	}
+
+	e, err := bs.EstimateCost()
+	if err != nil {
+		return fmt.Errorf("unable to estimate stack cost for %q group budget: %s", groupName, err)
+	}
+
+	if e.Incomplete {
+		var unpriced []string
+		for _, rc := range e.Resources {
+			if rc.Error != "" {
+				unpriced = append(unpriced, rc.Name+": "+rc.Error)
+			}
+		}
+
+		return fmt.Errorf("unable to check %q group budget, cost of the following resources can't be estimated: %s",
+			groupName, strings.Join(unpriced, "; "))
+	}
+
+	bs.Log.Debug("estimated monthly cost: %.2f %s, budget: %.2f", e.Monthly, e.Currency, group.Budget.MonthlyLimit)
+
+	return pricing.CheckBudget(group, e)
+}
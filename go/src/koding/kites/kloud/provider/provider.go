@@ -3,13 +3,17 @@ package provider
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"koding/db/models"
 	"koding/db/mongodb"
 	"koding/db/mongodb/modelhelper"
+	"koding/kites/kloud/api/amazon"
 	"koding/kites/kloud/contexthelper/request"
 	"koding/kites/kloud/contexthelper/session"
 	"koding/kites/kloud/eventer"
+	"koding/kites/kloud/pkg/lease"
+	"koding/kites/kloud/pricing"
 	"koding/kites/kloud/stack"
 	"koding/kites/kloud/stackplan/stackcred"
 	"koding/kites/kloud/userdata"
@@ -25,6 +29,10 @@ import (
 // available stack providers.
 var All = make(map[string]func(*BaseProvider) stack.Provider)
 
+// Optional is a global lookup map of stack providers, which kloud
+// registers only when they are explicitly enabled.
+var Optional = make(map[string]func(*BaseProvider) stack.Provider)
+
 // BaseProvider implements common functionality for stack providers (aws, vagrant).
 //
 // In longer term kloud controllers should be refactored and this functionality
@@ -47,6 +55,25 @@ type BaseProvider struct {
 
 	Userdata  *userdata.Userdata
 	CredStore stackcred.Store
+	Locker    *lease.Locker
+
+	// Prices is used for estimating stack costs. If nil,
+	// pricing.DefaultTable is used.
+	Prices *pricing.Table
+
+	// Roles is used by the aws provider for obtaining temporary
+	// credentials of AssumeRole credentials. If nil, such
+	// credentials are not supported.
+	Roles *amazon.RoleProvider
+
+	// RoleTimeout is a maximum duration of Terraform apply and destroy
+	// runs, which use temporary credentials obtained with Roles.
+	// If zero, the runs are not limited.
+	RoleTimeout time.Duration
+
+	// DockerPrivateHosts makes the docker provider accept unix sockets,
+	// loopback and private hosts, and hosts without TLS.
+	DockerPrivateHosts bool
 }
 
 func (bp *BaseProvider) New(name string) *BaseProvider {
@@ -0,0 +1,90 @@
+package provider
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"koding/db/models"
+	"koding/db/mongodb/modelhelper"
+	"koding/kites/kloud/stack"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// SnapshotArgs represents arguments of the createSnapshot,
+// deleteSnapshot and restoreSnapshot requests.
+type SnapshotArgs struct {
+	SnapshotId string
+	Label      string
+}
+
+// SnapshotArgs decodes snapshot arguments from the machine's request.
+func (bm *BaseMachine) SnapshotArgs() (*SnapshotArgs, error) {
+	if bm.Req == nil || bm.Req.Args == nil {
+		return nil, stack.NewError(stack.ErrNoArguments)
+	}
+
+	var args SnapshotArgs
+	if err := bm.Req.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	return &args, nil
+}
+
+// Snapshot fetches the snapshot with the given id. It returns an error
+// if the snapshot does not belong to the machine.
+func (bm *BaseMachine) Snapshot(snapshotID string) (*models.Snapshot, error) {
+	if snapshotID == "" {
+		return nil, stack.NewError(stack.ErrSnapshotIdMissing)
+	}
+
+	s, err := modelhelper.GetSnapshot(snapshotID)
+	if err == mgo.ErrNotFound {
+		return nil, fmt.Errorf("snapshot %q does not exist", snapshotID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if s.MachineId != bm.ObjectId {
+		return nil, fmt.Errorf("snapshot %q does not belong to machine %q", snapshotID, bm.ObjectId.Hex())
+	}
+
+	return s, nil
+}
+
+// AddSnapshot stores the given snapshot in jSnapshots collection.
+//
+// The snapshot is owned by the account of the machine's user.
+func (bm *BaseMachine) AddSnapshot(s *models.Snapshot) error {
+	account, err := modelhelper.GetAccount(bm.Username())
+	if err != nil {
+		bm.Log.Error("Could not fetch account %v: err: %v", bm.Username(), err)
+		return errors.New("could not fetch account from DB")
+	}
+
+	s.Id = bson.NewObjectId()
+	s.OriginId = account.Id
+	s.MachineId = bm.ObjectId
+	s.CreatedAt = time.Now().UTC()
+
+	if err := modelhelper.CreateSnapshot(s); err != nil {
+		bm.Log.Error("Could not add snapshot %q: err: %v", s.SnapshotId, err)
+		return errors.New("could not add snapshot to DB")
+	}
+
+	return nil
+}
+
+// DeleteSnapshotData removes the snapshot from jSnapshots collection.
+func (bm *BaseMachine) DeleteSnapshotData(snapshotID string) error {
+	if err := modelhelper.DeleteSnapshot(snapshotID); err != nil {
+		bm.Log.Error("Could not delete snapshot %q: err: %v", snapshotID, err)
+		return errors.New("could not delete snapshot from DB")
+	}
+
+	return nil
+}
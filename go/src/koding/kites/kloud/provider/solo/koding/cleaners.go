@@ -2,6 +2,7 @@ package koding
 
 import (
 	"koding/db/models"
+	"koding/db/mongodb/modelhelper"
 	"koding/kites/kloud/machinestate"
 	"koding/kites/kloud/pkg/multierrors"
 	"sync"
@@ -101,52 +102,76 @@ func (p *Provider) CleanDeletedVMs() error {
 	return nil
 }
 
-// CleanLocks resets documents that where locked by workers who died and left
-// the documents untouched/unlocked. These documents are *ghost* documents,
-// because they have an assignee that is not nil no worker will pick it up. The
-// given timeout specificies to look up documents from now on.
+// CleanLocks removes leases of workers who died and left the machines
+// locked. Such leases are not renewed and expire on their own, so they
+// do not prevent other workers from locking the machine; the given
+// timeout specifies how long expired leases are kept before removal.
 func (p *Provider) CleanLocks(timeout time.Duration) error {
 	query := func(c *mgo.Collection) error {
-		// machines that can't be updated because they seems to be in progress
-		ghostMachines := bson.M{
-			"assignee.inProgress": true,
-			"assignee.assignedAt": bson.M{"$lt": time.Now().UTC().Add(-timeout)},
+		expiredLeases := bson.M{
+			"expiresAt": bson.M{"$lt": time.Now().UTC().Add(-timeout)},
 		}
 
-		cleanMachines := bson.M{
-			"assignee.inProgress": false,
-			"assignee.assignedAt": time.Now().UTC(),
-		}
-
-		// reset all machines
-		info, err := c.UpdateAll(ghostMachines, bson.M{"$set": cleanMachines})
+		info, err := c.RemoveAll(expiredLeases)
 		if err != nil {
 			return err
 		}
 
 		// only show if there is something, that will prevent spamming the
 		// output with the same content over and over
-		if info.Updated != 0 {
-			p.Log.Info("[checker] cleaned up %d documents", info.Updated)
+		if info.Removed != 0 {
+			p.Log.Info("[checker] cleaned up %d expired leases", info.Removed)
 		}
 
 		return nil
 	}
 
-	return p.DB.Run("jMachines", query)
+	return p.DB.Run(modelhelper.LeasesColl, query)
+}
+
+// leasedMachines gives ids of machines, which are locked by ongoing
+// operations.
+func (p *Provider) leasedMachines() ([]bson.ObjectId, error) {
+	var leases []struct {
+		ID string `bson:"_id"`
+	}
+
+	err := p.DB.Run(modelhelper.LeasesColl, func(c *mgo.Collection) error {
+		return c.Find(bson.M{
+			"expiresAt": bson.M{"$gt": time.Now().UTC()},
+		}).Select(bson.M{"_id": 1}).All(&leases)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]bson.ObjectId, 0, len(leases))
+
+	for _, l := range leases {
+		if bson.IsObjectIdHex(l.ID) {
+			ids = append(ids, bson.ObjectIdHex(l.ID))
+		}
+	}
+
+	return ids, nil
 }
 
 // CleanStates resets documents that has machine states in progress mode
 // (building, stopping, etc..) which weren't updated since 10 minutes. This
 // could be caused because of Kloud restarts or panics.
 func (p *Provider) CleanStates(timeout time.Duration) error {
+	leased, err := p.leasedMachines()
+	if err != nil {
+		return err
+	}
+
 	cleanstateFunc := func(badstate, goodstate string) error {
 		return p.DB.Run("jMachines", func(c *mgo.Collection) error {
 			// machines that can't be updated because they seems to be in progress
 			badstateMachines := bson.M{
-				"assignee.inProgress": false, // never update during a onging process :)
-				"status.state":        badstate,
-				"status.modifiedAt":   bson.M{"$lt": time.Now().UTC().Add(-timeout)},
+				"_id":               bson.M{"$nin": leased}, // never update during a onging process :)
+				"status.state":      badstate,
+				"status.modifiedAt": bson.M{"$lt": time.Now().UTC().Add(-timeout)},
 			}
 
 			cleanMachines := bson.M{
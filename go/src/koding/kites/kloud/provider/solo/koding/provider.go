@@ -3,6 +3,7 @@ package koding
 import (
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"koding/db/models"
@@ -15,6 +16,7 @@ import (
 	"koding/kites/kloud/eventer"
 	"koding/kites/kloud/machinestate"
 	"koding/kites/kloud/pkg/dnsclient"
+	"koding/kites/kloud/pkg/lease"
 	"koding/kites/kloud/plans"
 	"koding/kites/kloud/stack"
 	"koding/kites/kloud/userdata"
@@ -35,11 +37,14 @@ type Provider struct {
 	DNSStorage *dnsstorage.MongodbStorage
 	EC2Clients *amazon.Clients
 	Userdata   *userdata.Userdata
+	Locker     *lease.Locker // if nil, a locker backed by DB is used
 
 	PaymentFetcher plans.PaymentFetcher
 	CheckerFetcher plans.CheckerFetcher
 
 	AuthorizedUsers map[string]string
+
+	lockerOnce sync.Once
 }
 
 func (p *Provider) Machine(ctx context.Context, id string) (interface{}, error) {
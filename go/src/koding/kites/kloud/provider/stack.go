@@ -2,11 +2,13 @@ package provider
 
 import (
 	"errors"
+	"time"
 
 	"koding/kites/kloud/contexthelper/publickeys"
 	"koding/kites/kloud/contexthelper/request"
 	"koding/kites/kloud/contexthelper/session"
 	"koding/kites/kloud/eventer"
+	"koding/kites/kloud/pricing"
 	"koding/kites/kloud/stack"
 	"koding/kites/kloud/stackplan"
 
@@ -34,6 +36,39 @@ type BaseStack struct {
 	WaitResources   func(context.Context) error
 	UpdateResources func(*terraform.State) error
 
+	// ApplyResources and DestroyResources, when non-nil, are called
+	// instead of Terraform apply and destroy. They are used by providers,
+	// which manage resources on their own.
+	//
+	// The state returned by ApplyResources is passed to UpdateResources.
+	ApplyResources   func(context.Context) (*terraform.State, error)
+	DestroyResources func(context.Context) error
+
+	// EstimateCost, when non-nil, is called after BuildResources
+	// to estimate monthly cost of the stack.
+	EstimateCost func() (*pricing.Estimate, error)
+
+	// Prices is a price table used by EstimateCost.
+	Prices *pricing.Table
+
+	// TerraformVariables, when non-nil, is called before each Terraform
+	// operation. The variables are passed to terraformer with the request
+	// and are not stored in the stack template, so they can hold
+	// short-lived credentials.
+	TerraformVariables func() (map[string]string, error)
+
+	// TerraformTimeout, when non-nil, is called before each Terraform
+	// apply and destroy. It gives a maximum duration of the operation,
+	// zero means no timeout.
+	TerraformTimeout func() time.Duration
+
+	// Locker is used to lock machines of the stack for the time
+	// of apply and destroy operations.
+	Locker stack.Locker
+
+	// SecretKey is used to authenticate with other kloud instances.
+	SecretKey string
+
 	// Keys and Eventer may be nil, it depends on the context used
 	// to initialize the Stack.
 	Keys    *publickeys.Keys
@@ -82,6 +117,13 @@ func (bp *BaseProvider) BaseStack(ctx context.Context) (*BaseStack, error) {
 	}
 
 	bs.Builder = stackplan.NewBuilder(builderOpts)
+	bs.Locker = bp
+	bs.SecretKey = bp.KloudSecretKey
+
+	bs.Prices = bp.Prices
+	if bs.Prices == nil {
+		bs.Prices = pricing.DefaultTable()
+	}
 
 	return bs, nil
 }
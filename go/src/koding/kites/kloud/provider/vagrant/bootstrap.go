@@ -1,6 +1,7 @@
 package vagrant
 
 import (
+	"koding/kites/kloud/policy"
 	"koding/kites/kloud/stack"
 
 	"golang.org/x/net/context"
@@ -17,6 +18,17 @@ func (s *Stack) Bootstrap(ctx context.Context) (interface{}, error) {
 		return nil, err
 	}
 
+	if !arg.Destroy {
+		p, err := s.Policy(arg.GroupName)
+		if err != nil {
+			return nil, err
+		}
+
+		if v := p.ValidateProvider("provider.vagrant", "vagrant"); v != nil {
+			return nil, policy.Check([]*policy.Violation{v})
+		}
+	}
+
 	// Vagrant currently requires no bootstrap.
 	return true, nil
 }
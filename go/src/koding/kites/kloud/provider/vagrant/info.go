@@ -51,7 +51,7 @@ func (m *Machine) Info(ctx context.Context) (*stack.InfoResponse, error) {
 		resultState = machinestate.Stopped
 
 		m.Log.Debug("Info result: Returning db state '%s' because the klient"+
-			" is not available. Username: %s", dbState, m.User.Name)
+			" is not available. Username: %s", dbState, m.Username())
 
 		return &stack.InfoResponse{
 			State: resultState,
@@ -2,15 +2,13 @@ package vagrant
 
 import (
 	"errors"
-	"koding/db/mongodb/modelhelper"
 	"koding/kites/kloud/stack"
-	"koding/kites/kloud/stackplan"
 
 	"golang.org/x/net/context"
 )
 
 // Plan
-func (s *Stack) Plan(ctx context.Context) (interface{}, error) {
+func (s *Stack) Plan(ctx context.Context) (*stack.PlanResponse, error) {
 	var arg stack.PlanRequest
 	if err := s.Req.Args.One().Unmarshal(&arg); err != nil {
 		return nil, err
@@ -18,32 +16,28 @@ func (s *Stack) Plan(ctx context.Context) (interface{}, error) {
 
 	if err := arg.Valid(); err != nil {
 		return nil, err
+	}
 
+	if arg.StackID != "" {
+		return s.DryRun(ctx, &arg)
 	}
-	s.Log.Debug("Fetching template for id %s", arg.StackTemplateID)
-	stackTemplate, err := modelhelper.GetStackTemplate(arg.StackTemplateID)
+	tmpl, err := s.PlanTemplate(&arg)
 	if err != nil {
-		return nil, stackplan.ResError(err, "jStackTemplate")
-	}
-
-	if stackTemplate.Template.Content == "" {
-		return nil, errors.New("Stack template content is empty")
+		return nil, err
 	}
 
-	s.Log.Debug("Fetching credentials for id %v", stackTemplate.Credentials)
-
-	credIDs := stackplan.FlattenValues(stackTemplate.Credentials)
+	s.Log.Debug("Fetching credentials for id %v", tmpl.CredIDs)
 
-	if err := s.Builder.BuildCredentials(s.Req.Method, s.Req.Username, arg.GroupName, credIDs); err != nil {
+	if err := s.Builder.BuildCredentials(s.Req.Method, s.Req.Username, arg.GroupName, tmpl.CredIDs); err != nil {
 		return nil, err
 	}
 
-	contentID := s.Req.Username + "-" + arg.StackTemplateID
+	contentID := tmpl.ContentID
 
 	s.Log.Debug("Fetched terraform data: koding=%+v, template=%+v", s.Builder.Koding, s.Builder.Template)
-	s.Log.Debug("Parsing template (%s):\n%s", contentID, stackTemplate.Template.Content)
+	s.Log.Debug("Parsing template (%s):\n%s", contentID, tmpl.Content)
 
-	if err := s.Builder.BuildTemplate(stackTemplate.Template.Content, contentID); err != nil {
+	if err := s.Builder.BuildTemplate(tmpl.Content, contentID); err != nil {
 		return nil, err
 	}
 
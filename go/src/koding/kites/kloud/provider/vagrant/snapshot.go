@@ -0,0 +1,163 @@
+package vagrant
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"koding/db/models"
+	"koding/kites/kloud/klient"
+	"koding/kites/kloud/machinestate"
+	"koding/kites/kloud/stack"
+
+	"github.com/koding/kite"
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Snapshots of vagrant boxes are VirtualBox snapshots, which are kept
+// on the host machine. The snapshot name is used as a snapshot ID.
+
+func (m *Machine) CreateSnapshot(ctx context.Context) error {
+	err := m.createSnapshot(ctx)
+	if err != nil {
+		return stack.NewEventerError(err)
+	}
+
+	return nil
+}
+
+func (m *Machine) DeleteSnapshot(ctx context.Context) error {
+	err := m.deleteSnapshot(ctx)
+	if err != nil {
+		return stack.NewEventerError(err)
+	}
+
+	return nil
+}
+
+func (m *Machine) RestoreSnapshot(ctx context.Context) error {
+	err := m.restoreSnapshot(ctx)
+	if err != nil {
+		return stack.NewEventerError(err)
+	}
+
+	return nil
+}
+
+func (m *Machine) createSnapshot(ctx context.Context) error {
+	args, err := m.SnapshotArgs()
+	if err != nil {
+		return err
+	}
+
+	origState := m.State()
+
+	if err := m.updateState(machinestate.Snapshotting); err != nil {
+		return err
+	}
+
+	defer m.updateState(origState)
+
+	name := "koding-" + m.ObjectId.Hex() + "-" + strconv.FormatInt(time.Now().UTC().Unix(), 10)
+
+	m.PushEvent("Creating snapshot", 50, machinestate.Snapshotting)
+
+	if err := m.vagrantErr(m.Vagrant.SnapshotSave(m.Cred.QueryString, m.Meta.FilePath, name)); err != nil {
+		return err
+	}
+
+	err = m.AddSnapshot(&models.Snapshot{
+		SnapshotId:  name,
+		StorageSize: strconv.Itoa(m.Meta.StorageSize),
+		Label:       args.Label,
+	})
+	if err != nil {
+		if e := m.Vagrant.SnapshotDelete(m.Cred.QueryString, m.Meta.FilePath, name); e != nil {
+			m.Log.Warning("failed to delete orphaned snapshot %q: %s", name, e)
+		}
+
+		return err
+	}
+
+	m.PushEvent("Snapshot creation finished successfully", 80, machinestate.Snapshotting)
+
+	return nil
+}
+
+func (m *Machine) deleteSnapshot(ctx context.Context) error {
+	args, err := m.SnapshotArgs()
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := m.Snapshot(args.SnapshotId)
+	if err != nil {
+		return err
+	}
+
+	err = m.vagrantErr(m.Vagrant.SnapshotDelete(m.Cred.QueryString, m.Meta.FilePath, snapshot.SnapshotId))
+	if err != nil {
+		return err
+	}
+
+	return m.DeleteSnapshotData(snapshot.SnapshotId)
+}
+
+func (m *Machine) restoreSnapshot(ctx context.Context) (err error) {
+	args, err := m.SnapshotArgs()
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := m.Snapshot(args.SnapshotId)
+	if err != nil {
+		return err
+	}
+
+	origState := m.State()
+
+	if err := m.updateState(machinestate.Building); err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			m.updateState(origState)
+		}
+	}()
+
+	m.PushEvent("Restoring snapshot", 25, machinestate.Building)
+
+	// "vagrant snapshot restore" boots the box after restoring.
+	err = m.vagrantErr(m.Vagrant.SnapshotRestore(m.Cred.QueryString, m.Meta.FilePath, snapshot.SnapshotId))
+	if err != nil {
+		return err
+	}
+
+	m.PushEvent("Checking remote machine", 75, machinestate.Building)
+
+	if err := m.WaitKlientReady(); err != nil {
+		return err
+	}
+
+	return m.Session.DB.Run("jMachines", func(c *mgo.Collection) error {
+		return c.UpdateId(
+			m.ObjectId,
+			bson.M{"$set": bson.M{
+				"status.state":      machinestate.Running.String(),
+				"status.modifiedAt": time.Now().UTC(),
+				"status.reason":     "Machine is running",
+			}},
+		)
+	})
+}
+
+func (m *Machine) vagrantErr(err error) error {
+	if err == kite.ErrNoKitesAvailable || err == klient.ErrDialingFailed {
+		return errors.New("unable to connect to host klient, is it down?")
+	}
+
+	return err
+}
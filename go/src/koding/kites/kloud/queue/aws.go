@@ -6,6 +6,7 @@ import (
 	"koding/kites/kloud/klient"
 	"koding/kites/kloud/provider"
 	"koding/kites/kloud/provider/aws"
+	"koding/kites/kloud/stack"
 	"time"
 
 	"golang.org/x/net/context"
@@ -28,8 +29,9 @@ func (q *Queue) CheckAWS() {
 	err := q.FetchProvider("aws", m.Machine)
 	if err != nil {
 		// do not show an error if the query didn't find anything, that
-		// means there is no such a document, which we don't care
-		if err != mgo.ErrNotFound {
+		// means there is no such a document, which we don't care; same
+		// if the machine is being processed by other kloud
+		if err != mgo.ErrNotFound && err != stack.ErrLockAcquired {
 			q.Log.Warning("FetchOne AWS err: %v", err)
 		}
 
@@ -37,6 +39,8 @@ func (q *Queue) CheckAWS() {
 		return
 	}
 
+	defer q.Locker.Unlock(m.ObjectId.Hex())
+
 	if err := q.CheckAWSUsage(m); err != nil {
 		// only log if it's something else
 		switch err {
@@ -5,8 +5,10 @@ import (
 
 	"github.com/koding/logging"
 
+	"koding/db/models"
 	"koding/kites/kloud/machinestate"
 	"koding/kites/kloud/provider/aws"
+	"koding/kites/kloud/stack"
 
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -14,6 +16,7 @@ import (
 
 type Queue struct {
 	AwsProvider *awsprovider.Provider
+	Locker      stack.Locker
 	Log         logging.Logger
 }
 
@@ -34,22 +37,27 @@ func (q *Queue) RunCheckers(interval time.Duration) {
 
 // Fetch provider fetches the machine and populates the fields for the given
 // provider.
-func (q *Queue) FetchProvider(provider string, machine interface{}) error {
+//
+// On success the machine is locked with q.Locker, the caller is
+// responsible for unlocking it. If the fetched machine is already
+// locked by someone else, stack.ErrLockAcquired is returned.
+func (q *Queue) FetchProvider(provider string, machine *models.Machine) error {
 	query := func(c *mgo.Collection) error {
 		// check only machines that:
 		// 1. belongs to the given provider
 		// 2. are running
 		// 3. are not always on machines
-		// 3. are not assigned to anyone yet (unlocked)
 		// 4. are not picked up by others yet recently in last 30 seconds
 		//
+		// Whether the machine is not assigned to anyone yet (unlocked)
+		// is checked afterwards by acquiring its lease.
+		//
 		// The $ne is used to catch documents whose field is not true including
 		// that do not contain that particular field
 		egligibleMachines := bson.M{
 			"provider":            provider,
 			"status.state":        machinestate.Running.String(),
 			"meta.alwaysOn":       bson.M{"$ne": true},
-			"assignee.inProgress": bson.M{"$ne": true},
 			"assignee.assignedAt": bson.M{"$lt": time.Now().UTC().Add(-time.Second * 30)},
 		}
 
@@ -74,5 +82,9 @@ func (q *Queue) FetchProvider(provider string, machine interface{}) error {
 		return nil
 	}
 
-	return q.AwsProvider.DB.Run("jMachines", query)
+	if err := q.AwsProvider.DB.Run("jMachines", query); err != nil {
+		return err
+	}
+
+	return q.Locker.Lock(machine.ObjectId.Hex())
 }
@@ -0,0 +1,356 @@
+// Package reconciler keeps machine states stored in jMachines consistent
+// with the actual states reported by providers.
+package reconciler
+
+import (
+	"fmt"
+	"time"
+
+	"koding/db/models"
+	"koding/db/mongodb"
+	"koding/db/mongodb/modelhelper"
+	"koding/kites/kloud/contexthelper/request"
+	"koding/kites/kloud/machinestate"
+	"koding/kites/kloud/stack"
+
+	"github.com/koding/kite"
+	"github.com/koding/logging"
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Source is a value of the Source field of audit events created
+// by the reconciler.
+const Source = "reconciler"
+
+const (
+	// DefaultInterval is used when Reconciler.Interval is zero.
+	DefaultInterval = 5 * time.Minute
+
+	// DefaultThreshold is used when Reconciler.Threshold is zero.
+	DefaultThreshold = 30 * time.Minute
+
+	// DefaultBatchSize is used when Reconciler.BatchSize is zero.
+	DefaultBatchSize = 100
+)
+
+// StateChecker is implemented by providers, which can read actual
+// states of many machines at once, e.g. by querying cloud API directly
+// instead of dialing klient of each machine.
+type StateChecker interface {
+	// States gives actual states of the given machines. Machines
+	// missing from the result are checked with stack.Machine.Info.
+	States(context.Context, []*models.Machine) (map[bson.ObjectId]machinestate.State, error)
+}
+
+// Reconciler periodically walks machines of each provider and compares
+// their stored states with the actual ones. The machines are checked
+// in batches with StateChecker, if the provider implements it, or
+// with stack.Machine.Info otherwise. Each correction is recorded
+// as a models.MachineAudit event.
+//
+// Machines in transient states (e.g. Starting, Stopping) are checked
+// only after they were not modified for longer than Threshold, as they
+// are likely left behind by a crashed operation.
+//
+// It is safe to run Reconciler on multiple kloud instances sharing
+// the same database - each machine is claimed before it is checked,
+// so only one instance checks it during a single run.
+type Reconciler struct {
+	DB        *mongodb.MongoDB
+	Providers map[string]stack.Provider
+	Locker    stack.Locker
+	Log       logging.Logger
+
+	// ContextCreator is used to create a context for each check,
+	// e.g. to attach a session to it.
+	ContextCreator func(context.Context) context.Context
+
+	// Interval is a time between reconciliation runs.
+	Interval time.Duration
+
+	// Threshold is a time after which a machine in a transient
+	// state is considered stuck.
+	Threshold time.Duration
+
+	// BatchSize is a maximum number of machines checked at once.
+	BatchSize int
+}
+
+// Run reconciles machines every r.Interval. It never returns.
+func (r *Reconciler) Run() {
+	for range time.Tick(r.interval()) {
+		r.RunOnce(time.Now().UTC())
+	}
+}
+
+// RunOnce reconciles all the machines that were not checked since
+// the given time.
+func (r *Reconciler) RunOnce(now time.Time) {
+	for name, p := range r.Providers {
+		for {
+			machines, err := r.fetchBatch(name, now)
+			if err != nil {
+				r.Log.Error("failed to fetch %s machines: %s", name, err)
+			}
+
+			if len(machines) == 0 {
+				break
+			}
+
+			r.reconcileBatch(p, machines, now)
+		}
+	}
+}
+
+// fetchBatch claims up to r.BatchSize machines of the given provider
+// that were not reconciled since the given time.
+func (r *Reconciler) fetchBatch(provider string, now time.Time) ([]*models.Machine, error) {
+	var machines []*models.Machine
+
+	for len(machines) < r.batchSize() {
+		m, err := r.fetch(provider, now)
+		if err == mgo.ErrNotFound {
+			break
+		}
+
+		if err != nil {
+			return machines, err
+		}
+
+		machines = append(machines, m)
+	}
+
+	return machines, nil
+}
+
+// fetch claims a single machine of the given provider that was not
+// reconciled since the given time.
+func (r *Reconciler) fetch(provider string, now time.Time) (*models.Machine, error) {
+	var m models.Machine
+
+	query := func(c *mgo.Collection) error {
+		eligibleMachines := bson.M{
+			"provider": provider,
+			"status.state": bson.M{"$nin": []string{
+				machinestate.NotInitialized.String(),
+				machinestate.Terminated.String(),
+			}},
+			// $not matches also documents that do not contain the field
+			"reconciledAt": bson.M{"$not": bson.M{"$gte": now}},
+		}
+
+		update := mgo.Change{
+			Update: bson.M{
+				"$set": bson.M{
+					"reconciledAt": now,
+				},
+			},
+		}
+
+		_, err := c.Find(eligibleMachines).Apply(update, &m)
+		return err
+	}
+
+	if err := r.DB.Run("jMachines", query); err != nil {
+		return nil, err
+	}
+
+	return &m, nil
+}
+
+func (r *Reconciler) reconcileBatch(p stack.Provider, machines []*models.Machine, now time.Time) {
+	var locked []*models.Machine
+
+	for _, m := range machines {
+		id := m.ObjectId.Hex()
+		state := m.State()
+
+		if IsTransient(state) && !IsStuck(state, m.Status.ModifiedAt, now, r.threshold()) {
+			r.Log.Debug("[%s] skipping machine in %s state, modified at %s", id, state, m.Status.ModifiedAt)
+			continue
+		}
+
+		// Machines that are locked have an ongoing operation.
+		if err := r.Locker.Lock(id); err != nil {
+			r.Log.Debug("[%s] skipping locked machine: %s", id, err)
+			continue
+		}
+		defer r.Locker.Unlock(id)
+
+		locked = append(locked, m)
+	}
+
+	if len(locked) == 0 {
+		return
+	}
+
+	var states map[bson.ObjectId]machinestate.State
+
+	if checker, ok := p.(StateChecker); ok {
+		var err error
+
+		states, err = checker.States(r.context(nil), locked)
+		if err != nil {
+			r.Log.Warning("failed to check states of %d machines: %s", len(locked), err)
+		}
+	}
+
+	for _, m := range locked {
+		actual, ok := states[m.ObjectId]
+		if !ok {
+			var err error
+
+			if actual, err = r.info(p, m); err != nil {
+				continue
+			}
+		}
+
+		r.update(m, actual)
+	}
+}
+
+// info reads the actual state of the machine with stack.Machine.Info.
+func (r *Reconciler) info(p stack.Provider, m *models.Machine) (machinestate.State, error) {
+	id := m.ObjectId.Hex()
+	state := m.State()
+	stuck := IsTransient(state)
+
+	// Providers return the stored state from Info without checking
+	// the actual one when the machine is in transient state, clear it
+	// before building the machine.
+	if stuck {
+		err := modelhelper.ChangeMachineState(m.ObjectId, "Machine state is being reconciled", machinestate.Unknown)
+		if err != nil {
+			r.Log.Error("[%s] unable to reset %s state: %s", id, state, err)
+			return 0, err
+		}
+	}
+
+	actual, err := r.machineInfo(p, m)
+	if err == nil && actual == machinestate.Unknown {
+		err = fmt.Errorf("provider returned %s state", actual)
+	}
+
+	if err != nil {
+		r.Log.Warning("[%s] unable to reconcile machine in %s state: %s", id, state, err)
+
+		if stuck {
+			modelhelper.ChangeMachineState(m.ObjectId, "Machine is marked as "+state.String(), state)
+		}
+
+		return 0, err
+	}
+
+	return actual, nil
+}
+
+// update stores the actual state of the machine, if it differs from
+// the stored one, and records the change as an audit event.
+func (r *Reconciler) update(m *models.Machine, actual machinestate.State) {
+	id := m.ObjectId.Hex()
+	state := m.State()
+
+	if actual == state {
+		return
+	}
+
+	reason := fmt.Sprintf("Machine state was reconciled from %s", state)
+
+	if IsTransient(state) {
+		reason = fmt.Sprintf("Machine was stuck in %s state since %s", state, m.Status.ModifiedAt.Format(time.RFC3339))
+	}
+
+	r.Log.Info("[%s] correcting machine state from %s to %s: %s", id, state, actual, reason)
+
+	if err := modelhelper.ChangeMachineState(m.ObjectId, reason, actual); err != nil {
+		r.Log.Error("[%s] unable to update state: %s", id, err)
+		return
+	}
+
+	audit := &models.MachineAudit{
+		MachineId: m.ObjectId,
+		Provider:  m.Provider,
+		Source:    Source,
+		OldState:  state.String(),
+		NewState:  actual.String(),
+		Reason:    reason,
+	}
+
+	if err := modelhelper.AddMachineAudit(audit); err != nil {
+		r.Log.Error("[%s] unable to record audit event: %s", id, err)
+	}
+}
+
+func (r *Reconciler) machineInfo(p stack.Provider, m *models.Machine) (machinestate.State, error) {
+	ctx := r.context(m)
+
+	machine, err := p.Machine(ctx, m.ObjectId.Hex())
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := machine.Info(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return resp.State, nil
+}
+
+// context creates a context for checking the given machine. If m is nil,
+// the context is created for checking many machines at once.
+func (r *Reconciler) context(m *models.Machine) context.Context {
+	// NOTE: "internal" method skips permission checks in provider.BaseMachine.
+	req := &kite.Request{
+		Method: "internal",
+	}
+
+	if m != nil {
+		if owner := m.Owner(); owner != nil {
+			req.Username = owner.Username
+		}
+	}
+
+	ctx := request.NewContext(context.Background(), req)
+
+	if r.ContextCreator != nil {
+		ctx = r.ContextCreator(ctx)
+	}
+
+	return ctx
+}
+
+func (r *Reconciler) interval() time.Duration {
+	if r.Interval != 0 {
+		return r.Interval
+	}
+	return DefaultInterval
+}
+
+func (r *Reconciler) batchSize() int {
+	if r.BatchSize != 0 {
+		return r.BatchSize
+	}
+	return DefaultBatchSize
+}
+
+func (r *Reconciler) threshold() time.Duration {
+	if r.Threshold != 0 {
+		return r.Threshold
+	}
+	return DefaultThreshold
+}
+
+// IsTransient tells whether the given state is a temporary one,
+// set for the time of an ongoing operation.
+func IsTransient(state machinestate.State) bool {
+	return state.InProgress() || state == machinestate.Snapshotting
+}
+
+// IsStuck tells whether a machine in the given transient state, which
+// was last modified at the given time, is considered to be stuck.
+func IsStuck(state machinestate.State, modifiedAt, now time.Time, threshold time.Duration) bool {
+	return IsTransient(state) && now.Sub(modifiedAt) > threshold
+}
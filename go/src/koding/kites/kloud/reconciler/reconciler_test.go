@@ -0,0 +1,267 @@
+package reconciler_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"koding/db/models"
+	"koding/db/mongodb/modelhelper"
+	"koding/kites/kloud/machinestate"
+	"koding/kites/kloud/reconciler"
+	"koding/kites/kloud/stack"
+
+	"github.com/koding/logging"
+	"golang.org/x/net/context"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestIsStuck(t *testing.T) {
+	now := time.Date(2016, 5, 1, 12, 0, 0, 0, time.UTC)
+	threshold := 30 * time.Minute
+
+	cases := []struct {
+		state      machinestate.State
+		modifiedAt time.Time
+		want       bool
+	}{
+		{machinestate.Starting, now.Add(-time.Hour), true},
+		{machinestate.Stopping, now.Add(-31 * time.Minute), true},
+		{machinestate.Snapshotting, now.Add(-time.Hour), true},
+		{machinestate.Building, now.Add(-10 * time.Minute), false},
+		{machinestate.Running, now.Add(-time.Hour), false},
+		{machinestate.Stopped, now.Add(-time.Hour), false},
+	}
+
+	for i, cas := range cases {
+		got := reconciler.IsStuck(cas.state, cas.modifiedAt, now, threshold)
+
+		if got != cas.want {
+			t.Errorf("%d: %s: got %t, want %t", i, cas.state, got, cas.want)
+		}
+	}
+}
+
+type fakeMachine struct {
+	stack.Machine // only Info is used
+	state         machinestate.State
+}
+
+func (m *fakeMachine) Info(context.Context) (*stack.InfoResponse, error) {
+	return &stack.InfoResponse{State: m.state}, nil
+}
+
+type fakeProvider struct {
+	stack.Provider // only Machine is used
+
+	mu      sync.Mutex
+	states  map[bson.ObjectId]machinestate.State // reported by States
+	infos   map[string]machinestate.State        // reported by Info
+	batches [][]bson.ObjectId
+}
+
+func (p *fakeProvider) Machine(_ context.Context, id string) (stack.Machine, error) {
+	state, ok := p.infos[id]
+	if !ok {
+		return nil, fmt.Errorf("unexpected Info call for %q machine", id)
+	}
+
+	return &fakeMachine{state: state}, nil
+}
+
+func (p *fakeProvider) States(_ context.Context, machines []*models.Machine) (map[bson.ObjectId]machinestate.State, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var batch []bson.ObjectId
+	states := make(map[bson.ObjectId]machinestate.State)
+
+	for _, m := range machines {
+		batch = append(batch, m.ObjectId)
+
+		if state, ok := p.states[m.ObjectId]; ok {
+			states[m.ObjectId] = state
+		}
+	}
+
+	p.batches = append(p.batches, batch)
+
+	return states, nil
+}
+
+type fakeLocker map[string]bool
+
+func (l fakeLocker) Lock(id string) error {
+	if l[id] {
+		return errors.New("lock acquired")
+	}
+	l[id] = true
+	return nil
+}
+
+func (l fakeLocker) Unlock(id string) {
+	delete(l, id)
+}
+
+func TestReconcile(t *testing.T) {
+	url := os.Getenv("WERCKER_MONGODB_URL")
+	if url == "" {
+		url = os.Getenv("MONGODB_URL")
+	}
+
+	if url == "" {
+		t.Skip("either WERCKER_MONGODB_URL or MONGODB_URL should be set")
+	}
+
+	modelhelper.Initialize(url)
+	defer modelhelper.Close()
+
+	const provider = "reconcilertest"
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	newMachine := func(state machinestate.State, modifiedAt time.Time) *models.Machine {
+		m := &models.Machine{
+			ObjectId: bson.NewObjectId(),
+			Provider: provider,
+		}
+
+		m.Status.State = state.String()
+		m.Status.ModifiedAt = modifiedAt
+
+		if err := modelhelper.CreateMachine(m); err != nil {
+			t.Fatalf("CreateMachine()=%s", err)
+		}
+
+		return m
+	}
+
+	var (
+		terminated = newMachine(machinestate.Running, now.Add(-time.Hour))
+		stopped    = newMachine(machinestate.Stopped, now.Add(-time.Hour))
+		stuck      = newMachine(machinestate.Starting, now.Add(-time.Hour))
+		starting   = newMachine(machinestate.Starting, now.Add(-time.Minute))
+		locked     = newMachine(machinestate.Stopping, now.Add(-time.Hour))
+		machines   = []*models.Machine{terminated, stopped, stuck, starting, locked}
+	)
+
+	defer func() {
+		for _, m := range machines {
+			modelhelper.DeleteMachine(m.ObjectId)
+		}
+
+		modelhelper.Mongo.Run(modelhelper.MachineAuditsColl, func(c *mgo.Collection) error {
+			_, err := c.RemoveAll(bson.M{"provider": provider})
+			return err
+		})
+	}()
+
+	p := &fakeProvider{
+		states: map[bson.ObjectId]machinestate.State{
+			terminated.ObjectId: machinestate.Terminated,
+			stopped.ObjectId:    machinestate.Stopped,
+		},
+		infos: map[string]machinestate.State{
+			stuck.ObjectId.Hex(): machinestate.Stopped,
+		},
+	}
+
+	l := fakeLocker{locked.ObjectId.Hex(): true}
+
+	r := &reconciler.Reconciler{
+		DB:        modelhelper.Mongo,
+		Providers: map[string]stack.Provider{provider: p},
+		Locker:    l,
+		Log:       logging.NewCustom("reconciler", false),
+		BatchSize: 2,
+	}
+
+	r.RunOnce(now)
+
+	// All the eligible machines must be checked in batches, the ones
+	// left by other operations must be skipped.
+	var checked []bson.ObjectId
+	for _, batch := range p.batches {
+		if len(batch) > r.BatchSize {
+			t.Errorf("got %d machines in a batch, want at most %d", len(batch), r.BatchSize)
+		}
+
+		checked = append(checked, batch...)
+	}
+
+	if len(checked) != 3 {
+		t.Fatalf("got %d machines checked, want 3: %v", len(checked), checked)
+	}
+
+	if len(l) != 1 || !l[locked.ObjectId.Hex()] {
+		t.Fatalf("unexpected locks left: %v", l)
+	}
+
+	want := map[bson.ObjectId]machinestate.State{
+		terminated.ObjectId: machinestate.Terminated,
+		stopped.ObjectId:    machinestate.Stopped,
+		stuck.ObjectId:      machinestate.Stopped,
+		starting.ObjectId:   machinestate.Starting,
+		locked.ObjectId:     machinestate.Stopping,
+	}
+
+	for id, state := range want {
+		m, err := modelhelper.GetMachine(id.Hex())
+		if err != nil {
+			t.Fatalf("GetMachine(%s)=%s", id.Hex(), err)
+		}
+
+		if m.State() != state {
+			t.Errorf("%s: got %s state, want %s", id.Hex(), m.State(), state)
+		}
+	}
+
+	var audits []*models.MachineAudit
+
+	err := modelhelper.Mongo.Run(modelhelper.MachineAuditsColl, func(c *mgo.Collection) error {
+		return c.Find(bson.M{"provider": provider}).Sort("oldState").All(&audits)
+	})
+	if err != nil {
+		t.Fatalf("Find()=%s", err)
+	}
+
+	wantAudits := []*models.MachineAudit{{
+		MachineId: terminated.ObjectId,
+		OldState:  machinestate.Running.String(),
+		NewState:  machinestate.Terminated.String(),
+	}, {
+		MachineId: stuck.ObjectId,
+		OldState:  machinestate.Starting.String(),
+		NewState:  machinestate.Stopped.String(),
+	}}
+
+	if len(audits) != len(wantAudits) {
+		t.Fatalf("got %d audit events, want %d", len(audits), len(wantAudits))
+	}
+
+	for i, a := range audits {
+		w := wantAudits[i]
+
+		if a.MachineId != w.MachineId || a.OldState != w.OldState || a.NewState != w.NewState {
+			t.Errorf("%d: got %+v, want %+v", i, a, w)
+		}
+
+		if a.Source != reconciler.Source {
+			t.Errorf("%d: got %q source, want %q", i, a.Source, reconciler.Source)
+		}
+	}
+
+	// Machines are claimed for the given time, so they must not
+	// be checked again.
+	p.batches = nil
+
+	r.RunOnce(now)
+
+	if len(p.batches) != 0 {
+		t.Fatalf("got %d batches, want none", len(p.batches))
+	}
+}
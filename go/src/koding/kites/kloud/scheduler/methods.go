@@ -0,0 +1,194 @@
+package scheduler
+
+import (
+	"errors"
+	"time"
+
+	"koding/db/models"
+	"koding/db/mongodb/modelhelper"
+
+	"github.com/koding/kite"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ScheduleRequest represents an argument of the schedule.set,
+// schedule.list and schedule.clear kite methods.
+//
+// When MachineID is set, the request concerns a single machine owned
+// by the requester. When GroupName is set, the request concerns all
+// the group machines and the requester must be the group admin.
+type ScheduleRequest struct {
+	MachineID string `json:"machineId,omitempty"`
+	GroupName string `json:"groupName,omitempty"`
+
+	// Fields used by schedule.set only.
+	Start    string `json:"start,omitempty"`
+	Stop     string `json:"stop,omitempty"`
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// Valid implements the stack.Validator interface.
+func (req *ScheduleRequest) Valid() error {
+	if req.MachineID == "" && req.GroupName == "" {
+		return errors.New("machineId and groupName are empty")
+	}
+	if req.MachineID != "" && req.GroupName != "" {
+		return errors.New("machineId and groupName are mutually exclusive")
+	}
+	if req.MachineID != "" && !bson.IsObjectIdHex(req.MachineID) {
+		return errors.New("invalid machineId")
+	}
+	return nil
+}
+
+// MachineSchedule represents a single item of the schedule.list response.
+type MachineSchedule struct {
+	MachineID string                  `json:"machineId"`
+	Label     string                  `json:"label"`
+	Schedule  *models.MachineSchedule `json:"schedule"`
+}
+
+// Set provides schedule.set as a kite method.
+//
+// A schedule set for a group is applied to all the group machines,
+// except the ones with a schedule set explicitly for the machine.
+func (s *Scheduler) Set(r *kite.Request) (interface{}, error) {
+	req, selector, err := s.authorize(r)
+	if err != nil {
+		return nil, err
+	}
+
+	sched := &models.MachineSchedule{
+		Start:    req.Start,
+		Stop:     req.Stop,
+		Timezone: req.Timezone,
+	}
+
+	if err := Update(sched, time.Now().UTC()); err != nil {
+		return nil, err
+	}
+
+	if req.GroupName != "" {
+		sched.Group = req.GroupName
+
+		selector["$or"] = []bson.M{
+			{"schedule": bson.M{"$exists": false}},
+			{"schedule.group": req.GroupName},
+		}
+	}
+
+	if err := s.update(selector, bson.M{"$set": bson.M{"schedule": sched}}); err != nil {
+		return nil, err
+	}
+
+	return sched, nil
+}
+
+// List provides schedule.list as a kite method.
+func (s *Scheduler) List(r *kite.Request) (interface{}, error) {
+	_, selector, err := s.authorize(r)
+	if err != nil {
+		return nil, err
+	}
+
+	selector["schedule"] = bson.M{"$exists": true}
+
+	var machines []*models.Machine
+
+	query := func(c *mgo.Collection) error {
+		return c.Find(selector).All(&machines)
+	}
+
+	if err := s.DB.Run("jMachines", query); err != nil {
+		return nil, err
+	}
+
+	schedules := make([]*MachineSchedule, len(machines))
+
+	for i, m := range machines {
+		schedules[i] = &MachineSchedule{
+			MachineID: m.ObjectId.Hex(),
+			Label:     m.Label,
+			Schedule:  m.Schedule,
+		}
+	}
+
+	return schedules, nil
+}
+
+// Clear provides schedule.clear as a kite method.
+//
+// Clearing a group schedule does not remove schedules set explicitly
+// for machines.
+func (s *Scheduler) Clear(r *kite.Request) (interface{}, error) {
+	req, selector, err := s.authorize(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GroupName != "" {
+		selector["schedule.group"] = req.GroupName
+	}
+
+	if err := s.update(selector, bson.M{"$unset": bson.M{"schedule": ""}}); err != nil {
+		return nil, err
+	}
+
+	return true, nil
+}
+
+// authorize validates the request and ensures the requester is allowed
+// to manage the schedules. It returns a selector for jMachines documents
+// the request concerns.
+func (s *Scheduler) authorize(r *kite.Request) (*ScheduleRequest, bson.M, error) {
+	if r.Args == nil {
+		return nil, nil, errors.New("no arguments")
+	}
+
+	var req ScheduleRequest
+
+	if err := r.Args.One().Unmarshal(&req); err != nil {
+		return nil, nil, err
+	}
+
+	if err := req.Valid(); err != nil {
+		return nil, nil, err
+	}
+
+	if req.MachineID != "" {
+		m, err := modelhelper.GetMachine(req.MachineID)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if owner := m.Owner(); owner == nil || owner.Username != r.Username {
+			return nil, nil, errors.New("only the machine owner can manage its schedule")
+		}
+
+		return &req, bson.M{"_id": m.ObjectId}, nil
+	}
+
+	group, err := modelhelper.GetGroup(req.GroupName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ok, err := modelhelper.IsAdmin(r.Username, req.GroupName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !ok {
+		return nil, nil, errors.New("only group admins can manage group schedules")
+	}
+
+	return &req, bson.M{"groups.id": group.Id}, nil
+}
+
+func (s *Scheduler) update(selector, change bson.M) error {
+	return s.DB.Run("jMachines", func(c *mgo.Collection) error {
+		_, err := c.UpdateAll(selector, change)
+		return err
+	})
+}
@@ -0,0 +1,78 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"koding/db/models"
+
+	"github.com/robfig/cron"
+)
+
+// Parse parses the cron expression. It accepts standard 5-field
+// expressions (minute, hour, day of month, month, day of week)
+// and descriptors like "@daily".
+func Parse(spec string) (cron.Schedule, error) {
+	spec = strings.TrimSpace(spec)
+
+	if spec == "" {
+		return nil, errors.New("empty cron expression")
+	}
+
+	if !strings.HasPrefix(spec, "@") {
+		fields := strings.Fields(spec)
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("expected 5 fields, found %d: %q", len(fields), spec)
+		}
+
+		// cron.Parse expects seconds as the first field.
+		spec = "0 " + spec
+	}
+
+	return cron.Parse(spec)
+}
+
+// Update validates the schedule and sets its next start and stop times,
+// that are after the given time.
+func Update(s *models.MachineSchedule, now time.Time) error {
+	if s.Start == "" && s.Stop == "" {
+		return errors.New("neither start nor stop expression is set")
+	}
+
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		return fmt.Errorf("invalid timezone %q: %s", s.Timezone, err)
+	}
+
+	s.NextStart, s.NextStop = time.Time{}, time.Time{}
+
+	if s.Start != "" {
+		if s.NextStart, err = next(s.Start, now, loc); err != nil {
+			return fmt.Errorf("invalid start expression: %s", err)
+		}
+	}
+
+	if s.Stop != "" {
+		if s.NextStop, err = next(s.Stop, now, loc); err != nil {
+			return fmt.Errorf("invalid stop expression: %s", err)
+		}
+	}
+
+	return nil
+}
+
+func next(spec string, now time.Time, loc *time.Location) (time.Time, error) {
+	sched, err := Parse(spec)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	t := sched.Next(now.In(loc))
+	if t.IsZero() {
+		return time.Time{}, fmt.Errorf("%q never fires", spec)
+	}
+
+	return t.UTC(), nil
+}
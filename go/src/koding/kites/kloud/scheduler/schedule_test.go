@@ -0,0 +1,49 @@
+package scheduler_test
+
+import (
+	"testing"
+	"time"
+
+	"koding/db/models"
+	"koding/kites/kloud/scheduler"
+)
+
+func TestUpdate(t *testing.T) {
+	// Friday, 17:30 in Istanbul (UTC+3).
+	now := time.Date(2016, time.June, 10, 14, 30, 0, 0, time.UTC)
+
+	s := &models.MachineSchedule{
+		Start:    "0 9 * * 1-5",
+		Stop:     "0 18 * * 1-5",
+		Timezone: "Europe/Istanbul",
+	}
+
+	if err := scheduler.Update(s, now); err != nil {
+		t.Fatalf("Update()=%s", err)
+	}
+
+	// Next start is on Monday, 9:00 in Istanbul.
+	if want := time.Date(2016, time.June, 13, 6, 0, 0, 0, time.UTC); !s.NextStart.Equal(want) {
+		t.Errorf("got %s, want %s", s.NextStart, want)
+	}
+
+	// Next stop is the same day, 18:00 in Istanbul.
+	if want := time.Date(2016, time.June, 10, 15, 0, 0, 0, time.UTC); !s.NextStop.Equal(want) {
+		t.Errorf("got %s, want %s", s.NextStop, want)
+	}
+}
+
+func TestUpdateInvalid(t *testing.T) {
+	cases := map[string]*models.MachineSchedule{
+		"empty":            {},
+		"invalid timezone": {Start: "0 9 * * *", Timezone: "Mars/Olympus"},
+		"invalid start":    {Start: "0 9 * *"},
+		"invalid stop":     {Stop: "0 25 * * *"},
+	}
+
+	for name, s := range cases {
+		if err := scheduler.Update(s, time.Now()); err == nil {
+			t.Errorf("%s: want non-nil error", name)
+		}
+	}
+}
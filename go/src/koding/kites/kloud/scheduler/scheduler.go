@@ -0,0 +1,160 @@
+// Package scheduler starts and stops machines according to their schedules.
+package scheduler
+
+import (
+	"time"
+
+	"koding/db/models"
+	"koding/db/mongodb"
+
+	"github.com/koding/logging"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Actions performed by the scheduler.
+const (
+	ActionStart = "start"
+	ActionStop  = "stop"
+)
+
+// DefaultInterval is used when Scheduler.Interval is zero.
+const DefaultInterval = time.Minute
+
+// Caller calls machine methods, it is implemented by *stack.Kloud.
+type Caller interface {
+	CallMachine(method, username, machineID, provider string) (interface{}, error)
+}
+
+// Scheduler looks for machines with due scheduled actions and
+// executes them.
+//
+// It is safe to run Scheduler on multiple kloud instances sharing
+// the same database - each scheduled action is claimed by advancing
+// its next run time with a conditional update, so only one instance
+// executes it.
+type Scheduler struct {
+	DB  *mongodb.MongoDB
+	Log logging.Logger
+
+	// Caller executes the actions the same way the start and stop
+	// kite methods do, so the machines are locked and their states
+	// are checked and updated.
+	Caller Caller
+
+	// Interval is a time between checks for due actions.
+	Interval time.Duration
+}
+
+// Run checks for due actions every s.Interval. It never returns.
+func (s *Scheduler) Run() {
+	for range time.Tick(s.interval()) {
+		s.RunOnce(time.Now().UTC())
+	}
+}
+
+// RunOnce executes all the actions that are due at the given time.
+func (s *Scheduler) RunOnce(now time.Time) {
+	for _, action := range []string{ActionStart, ActionStop} {
+		machines, err := s.due(action, now)
+		if err != nil {
+			s.Log.Error("failed to fetch machines to %s: %s", action, err)
+			continue
+		}
+
+		for _, m := range machines {
+			if !s.claim(action, m, now) {
+				continue
+			}
+
+			s.execute(action, m)
+		}
+	}
+}
+
+func (s *Scheduler) due(action string, now time.Time) ([]*models.Machine, error) {
+	var machines []*models.Machine
+
+	query := func(c *mgo.Collection) error {
+		return c.Find(bson.M{nextField(action): bson.M{"$lte": now}}).All(&machines)
+	}
+
+	if err := s.DB.Run("jMachines", query); err != nil {
+		return nil, err
+	}
+
+	return machines, nil
+}
+
+// claim advances the next run time of the action. It returns false
+// if the action was already claimed by other kloud instance.
+func (s *Scheduler) claim(action string, m *models.Machine, now time.Time) bool {
+	sched := *m.Schedule
+	old := nextTime(action, &sched)
+
+	if err := Update(&sched, now); err != nil {
+		s.Log.Warning("[%s] invalid schedule, clearing: %s", m.ObjectId.Hex(), err)
+
+		s.DB.Run("jMachines", func(c *mgo.Collection) error {
+			return c.UpdateId(m.ObjectId, bson.M{"$unset": bson.M{"schedule": ""}})
+		})
+
+		return false
+	}
+
+	claim := func(c *mgo.Collection) error {
+		return c.Update(
+			bson.M{"_id": m.ObjectId, nextField(action): old},
+			bson.M{"$set": bson.M{nextField(action): nextTime(action, &sched)}},
+		)
+	}
+
+	switch err := s.DB.Run("jMachines", claim); err {
+	case nil:
+		return true
+	case mgo.ErrNotFound:
+		return false // claimed by other kloud
+	default:
+		s.Log.Error("[%s] failed to claim %s action: %s", m.ObjectId.Hex(), action, err)
+		return false
+	}
+}
+
+func (s *Scheduler) execute(action string, m *models.Machine) {
+	id := m.ObjectId.Hex()
+
+	var username string
+	if owner := m.Owner(); owner != nil {
+		username = owner.Username
+	}
+
+	// The call returns once the action is started, the machine is unlocked
+	// when it finishes.
+	if _, err := s.Caller.CallMachine(action, username, id, m.Provider); err != nil {
+		s.Log.Warning("[%s] unable to %s machine: %s", id, action, err)
+		return
+	}
+
+	s.Log.Info("[%s] scheduled %s started", id, action)
+}
+
+func (s *Scheduler) interval() time.Duration {
+	if s.Interval != 0 {
+		return s.Interval
+	}
+	return DefaultInterval
+}
+
+func nextField(action string) string {
+	if action == ActionStart {
+		return "schedule.nextStart"
+	}
+	return "schedule.nextStop"
+}
+
+func nextTime(action string, s *models.MachineSchedule) time.Time {
+	if action == ActionStart {
+		return s.NextStart
+	}
+	return s.NextStop
+}
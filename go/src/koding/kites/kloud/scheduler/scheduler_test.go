@@ -0,0 +1,177 @@
+package scheduler_test
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"koding/db/models"
+	"koding/db/mongodb"
+	"koding/kites/kloud/machinestate"
+	"koding/kites/kloud/scheduler"
+
+	"github.com/koding/logging"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type call struct {
+	method, username, machineID, provider string
+}
+
+type fakeCaller struct {
+	mu    sync.Mutex
+	calls []call
+}
+
+func (fc *fakeCaller) CallMachine(method, username, machineID, provider string) (interface{}, error) {
+	fc.mu.Lock()
+	fc.calls = append(fc.calls, call{method, username, machineID, provider})
+	fc.mu.Unlock()
+
+	return nil, nil
+}
+
+func newDB(t *testing.T) *mongodb.MongoDB {
+	url := os.Getenv("WERCKER_MONGODB_URL")
+	if url == "" {
+		url = os.Getenv("MONGODB_URL")
+	}
+
+	if url == "" {
+		t.Skip("either WERCKER_MONGODB_URL or MONGODB_URL should be set")
+	}
+
+	return mongodb.NewMongoDB(url)
+}
+
+func newMachine(t *testing.T, db *mongodb.MongoDB, nextStart time.Time) *models.Machine {
+	m := &models.Machine{
+		ObjectId: bson.NewObjectId(),
+		Provider: "aws",
+		Users: []models.MachineUser{{
+			Username: "user",
+			Sudo:     true,
+			Owner:    true,
+		}},
+		Schedule: &models.MachineSchedule{
+			Start:     "0 9 * * *",
+			Stop:      "0 18 * * *",
+			NextStart: nextStart,
+			NextStop:  nextStart.Add(9 * time.Hour),
+		},
+	}
+
+	m.Status.State = machinestate.Stopped.String()
+
+	err := db.Run("jMachines", func(c *mgo.Collection) error {
+		return c.Insert(m)
+	})
+	if err != nil {
+		t.Fatalf("Insert()=%s", err)
+	}
+
+	return m
+}
+
+func removeMachine(db *mongodb.MongoDB, m *models.Machine) {
+	db.Run("jMachines", func(c *mgo.Collection) error {
+		return c.RemoveId(m.ObjectId)
+	})
+}
+
+func TestSchedulerClaim(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	m := newMachine(t, db, now.Add(-time.Minute))
+	defer removeMachine(db, m)
+
+	fc := &fakeCaller{}
+	s := &scheduler.Scheduler{
+		DB:     db,
+		Log:    logging.NewCustom("scheduler", false),
+		Caller: fc,
+	}
+
+	s.RunOnce(now)
+
+	if len(fc.calls) != 1 {
+		t.Fatalf("got %d calls, want 1", len(fc.calls))
+	}
+
+	want := call{scheduler.ActionStart, "user", m.ObjectId.Hex(), "aws"}
+
+	if fc.calls[0] != want {
+		t.Fatalf("got %+v, want %+v", fc.calls[0], want)
+	}
+
+	var got models.Machine
+
+	err := db.Run("jMachines", func(c *mgo.Collection) error {
+		return c.FindId(m.ObjectId).One(&got)
+	})
+	if err != nil {
+		t.Fatalf("FindId()=%s", err)
+	}
+
+	// Claiming advances the next run time, the stop time is not due
+	// so it must be left untouched.
+	if !got.Schedule.NextStart.After(now) {
+		t.Fatalf("got %s next start, want after %s", got.Schedule.NextStart, now)
+	}
+
+	if !got.Schedule.NextStop.Equal(m.Schedule.NextStop) {
+		t.Fatalf("got %s next stop, want %s", got.Schedule.NextStop, m.Schedule.NextStop)
+	}
+
+	// The claimed action must not run again.
+	s.RunOnce(now)
+
+	if len(fc.calls) != 1 {
+		t.Fatalf("got %d calls, want 1", len(fc.calls))
+	}
+}
+
+func TestSchedulerNoDoubleExecution(t *testing.T) {
+	db := newDB(t)
+	defer db.Close()
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	m := newMachine(t, db, now.Add(-time.Minute))
+	defer removeMachine(db, m)
+
+	// Each scheduler represents a separate kloud instance sharing
+	// the same database.
+	fc := &fakeCaller{}
+	schedulers := make([]*scheduler.Scheduler, 8)
+
+	for i := range schedulers {
+		schedulers[i] = &scheduler.Scheduler{
+			DB:     db,
+			Log:    logging.NewCustom("scheduler", false),
+			Caller: fc,
+		}
+	}
+
+	var wg sync.WaitGroup
+
+	for _, s := range schedulers {
+		wg.Add(1)
+
+		go func(s *scheduler.Scheduler) {
+			defer wg.Done()
+			s.RunOnce(now)
+		}(s)
+	}
+
+	wg.Wait()
+
+	if len(fc.calls) != 1 {
+		t.Fatalf("got %d calls, want 1: %+v", len(fc.calls), fc.calls)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"golang.org/x/crypto/ssh"
@@ -62,6 +63,28 @@ func (s *SSHClient) StartCommand(command string) (string, error) {
 	return combinedOutput.String(), nil
 }
 
+// RunScript runs the given shell script on the remote host. The script
+// is written to the standard input of the interpreter command, e.g.
+// "sudo sh -s". It returns combined output of the script.
+func (s *SSHClient) RunScript(interpreter, script string) (string, error) {
+	session, err := s.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	combinedOutput := new(bytes.Buffer)
+	session.Stdin = strings.NewReader(script)
+	session.Stdout = combinedOutput
+	session.Stderr = combinedOutput
+
+	if err := session.Run(interpreter); err != nil {
+		return combinedOutput.String(), err
+	}
+
+	return combinedOutput.String(), nil
+}
+
 // ConnectSSH tries to connect to the given IP and returns a new client.
 func ConnectSSH(ip string, config *ssh.ClientConfig) (*SSHClient, error) {
 	dialFunc := func() (*SSHClient, error) {
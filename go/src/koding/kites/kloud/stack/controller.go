@@ -34,10 +34,28 @@ func TraceFromContext(ctx context.Context) (string, bool) {
 
 type ControlResult struct {
 	EventId string `json:"eventId"`
+
+	// EventCursor points before the first event of the started process,
+	// it's meant to be passed to the event.subscribe method.
+	EventCursor int `json:"eventCursor,omitempty"`
 }
 
 type machineFunc func(context.Context, interface{}) error
 
+// machineArgs represents an argument of the machine kite methods.
+type machineArgs struct {
+	MachineId string
+	Provider  string
+	Debug     bool
+}
+
+// machineFuncs are the machine methods, which can be called with
+// Kloud.CallMachine.
+var machineFuncs = map[string]machineFunc{
+	"start": startMachine,
+	"stop":  stopMachine,
+}
+
 // statePair defines a methods start and final states
 type statePair struct {
 	start machinestate.State
@@ -45,15 +63,16 @@ type statePair struct {
 }
 
 var states = map[string]*statePair{
-	"build":          &statePair{start: machinestate.Building, final: machinestate.Running},
-	"reinit":         &statePair{start: machinestate.Building, final: machinestate.Running},
-	"start":          &statePair{start: machinestate.Starting, final: machinestate.Running},
-	"stop":           &statePair{start: machinestate.Stopping, final: machinestate.Stopped},
-	"destroy":        &statePair{start: machinestate.Terminating, final: machinestate.Terminated},
-	"restart":        &statePair{start: machinestate.Rebooting, final: machinestate.Running},
-	"resize":         &statePair{start: machinestate.Pending, final: machinestate.Running},
-	"createSnapshot": &statePair{start: machinestate.Snapshotting, final: machinestate.Running},
-	"deleteSnapshot": &statePair{start: machinestate.Snapshotting, final: machinestate.Running},
+	"build":           &statePair{start: machinestate.Building, final: machinestate.Running},
+	"reinit":          &statePair{start: machinestate.Building, final: machinestate.Running},
+	"start":           &statePair{start: machinestate.Starting, final: machinestate.Running},
+	"stop":            &statePair{start: machinestate.Stopping, final: machinestate.Stopped},
+	"destroy":         &statePair{start: machinestate.Terminating, final: machinestate.Terminated},
+	"restart":         &statePair{start: machinestate.Rebooting, final: machinestate.Running},
+	"resize":          &statePair{start: machinestate.Pending, final: machinestate.Running},
+	"createSnapshot":  &statePair{start: machinestate.Snapshotting, final: machinestate.Running},
+	"deleteSnapshot":  &statePair{start: machinestate.Snapshotting, final: machinestate.Running},
+	"restoreSnapshot": &statePair{start: machinestate.Building, final: machinestate.Running},
 }
 
 // coreMethods is running and returning the response for the given machineFunc.
@@ -68,16 +87,42 @@ func (k *Kloud) coreMethods(r *kite.Request, fn machineFunc) (result interface{}
 
 	k.Log.Debug("solo: calling %q by %q with %q", r.Username, r.Method, r.Args.Raw)
 
-	var args struct {
-		MachineId string
-		Provider  string
-		Debug     bool
-	}
+	var args machineArgs
 
 	if err := r.Args.One().Unmarshal(&args); err != nil {
 		return nil, err
 	}
 
+	return k.machineMethod(r, r.Method, &args, fn)
+}
+
+// CallMachine calls the given machine method on behalf of kloud itself,
+// e.g. for scheduled actions. The call goes through the same path as the
+// kite method does - the machine is locked, the method is checked against
+// the current machine state and its progress is reported with an eventer.
+// The permission checks are skipped, the username is used only to build
+// the machine session.
+func (k *Kloud) CallMachine(method, username, machineID, provider string) (interface{}, error) {
+	fn, ok := machineFuncs[method]
+	if !ok {
+		return nil, fmt.Errorf("method %q can not be called internally", method)
+	}
+
+	// NOTE: "internal" method skips permission checks in provider.BaseMachine.
+	r := &kite.Request{
+		Method:   "internal",
+		Username: username,
+	}
+
+	args := &machineArgs{
+		MachineId: machineID,
+		Provider:  provider,
+	}
+
+	return k.machineMethod(r, method, args, fn)
+}
+
+func (k *Kloud) machineMethod(r *kite.Request, method string, args *machineArgs, fn machineFunc) (result interface{}, reqErr error) {
 	if args.MachineId == "" {
 		return nil, NewError(ErrMachineIdMissing)
 	}
@@ -91,7 +136,7 @@ func (k *Kloud) coreMethods(r *kite.Request, fn machineFunc) (result interface{}
 	// a distributed lock. It's unlocked when there is an error or if the
 	// method call is finished (unlocking is done inside the responsible
 	// method calls).
-	if r.Method != "info" {
+	if method != "info" {
 		if err := k.Locker.Lock(args.MachineId); err != nil {
 			return nil, err
 		}
@@ -132,14 +177,14 @@ func (k *Kloud) coreMethods(r *kite.Request, fn machineFunc) (result interface{}
 
 	// if debug is enabled, generate TraceID and pass it with the context
 	if args.Debug {
-		ctx = k.setTraceID(r.Username, r.Method, ctx)
+		ctx = k.setTraceID(r.Username, method, ctx)
 	}
 
 	// old events are not needed anymore, so we're just going to remove them.
 	k.cleanupEventers(args.MachineId)
 
 	// each method has his own unique eventer
-	eventId := r.Method + "-" + args.MachineId
+	eventId := method + "-" + args.MachineId
 	ev := k.NewEventer(eventId)
 	ctx = eventer.NewContext(ctx, ev)
 
@@ -162,14 +207,14 @@ func (k *Kloud) coreMethods(r *kite.Request, fn machineFunc) (result interface{}
 	// Check if the given method is in valid methods of that current state. For
 	// example if the method is "build", and the state is "stopped" than this
 	// will return an error.
-	if !methodIn(r.Method, stater.State().ValidMethods()...) {
+	if !methodIn(method, stater.State().ValidMethods()...) {
 		return nil, fmt.Errorf("%s not allowed for current state '%s'. Allowed methods are: %v",
-			r.Method, strings.ToLower(stater.State().String()), stater.State().ValidMethods())
+			method, strings.ToLower(stater.State().String()), stater.State().ValidMethods())
 	}
 
-	pair, ok := states[r.Method]
+	pair, ok := states[method]
 	if !ok {
-		return nil, fmt.Errorf("no state pair available for %s", r.Method)
+		return nil, fmt.Errorf("no state pair available for %s", method)
 	}
 
 	tags := []string{
@@ -180,7 +225,7 @@ func (k *Kloud) coreMethods(r *kite.Request, fn machineFunc) (result interface{}
 	ctx = k.traceRequest(ctx, tags)
 
 	ev.Push(&eventer.Event{
-		Message: r.Method + " started",
+		Message: method + " started",
 		Status:  pair.start,
 	})
 
@@ -189,22 +234,22 @@ func (k *Kloud) coreMethods(r *kite.Request, fn machineFunc) (result interface{}
 	// the current status of the running method.
 	go func() {
 		finalEvent := &eventer.Event{
-			Message:    r.Method + " finished",
+			Message:    method + " finished",
 			Status:     pair.final,
 			Percentage: 100,
 		}
 
 		k.Log.Info("[%s] ======> %s started (requester: %s, provider: %s)<======",
-			args.MachineId, strings.ToUpper(r.Method), r.Username, args.Provider)
+			args.MachineId, strings.ToUpper(method), r.Username, args.Provider)
 		start := time.Now()
 		err := fn(ctx, machine)
 		if err != nil {
 			// don't pass the error directly to the eventer, mask it to avoid
 			// error leaking to the client. We just log it here.
 			k.Log.Error("[%s] ======> %s finished with error: '%s' (requester: %s, provider: %s) <======",
-				args.MachineId, strings.ToUpper(r.Method), err, r.Username, args.Provider)
+				args.MachineId, strings.ToUpper(method), err, r.Username, args.Provider)
 
-			finalEvent.Error = strings.ToTitle(r.Method) + " failed. Please contact support."
+			finalEvent.Error = strings.ToTitle(method) + " failed. Please contact support."
 
 			// however, eventerErr is an error we want to pass explicitly to
 			// the client side
@@ -215,7 +260,7 @@ func (k *Kloud) coreMethods(r *kite.Request, fn machineFunc) (result interface{}
 			finalEvent.Status = stater.State() // fallback to to old state
 		} else {
 			k.Log.Info("[%s] ======> %s finished (time: %s, requester: %s, provider: %s) <======",
-				args.MachineId, strings.ToUpper(r.Method), time.Since(start), r.Username, args.Provider)
+				args.MachineId, strings.ToUpper(method), time.Since(start), r.Username, args.Provider)
 		}
 
 		ev.Push(finalEvent)
@@ -224,7 +269,8 @@ func (k *Kloud) coreMethods(r *kite.Request, fn machineFunc) (result interface{}
 	}()
 
 	return ControlResult{
-		EventId: eventId,
+		EventId:     eventId,
+		EventCursor: eventer.Cursor(ev),
 	}, nil
 }
 
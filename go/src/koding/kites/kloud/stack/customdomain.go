@@ -0,0 +1,270 @@
+package stack
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"koding/kites/kloud/dnsstorage"
+
+	"github.com/koding/kite"
+	"golang.org/x/net/context"
+)
+
+// CertManager obtains TLS certificates for custom domains.
+type CertManager interface {
+	// Challenge creates and stores an ownership challenge of the given
+	// type ("dns-01" or "http-01") for the domain.
+	Challenge(ctx context.Context, d *dnsstorage.Domain, typ string) (*dnsstorage.Challenge, error)
+
+	// Verify obtains a certificate for the domain once its challenge
+	// is published, and installs it on the domain's machine.
+	Verify(ctx context.Context, name string) (*dnsstorage.Certificate, error)
+
+	// Remove uninstalls the certificate of the domain from its machine.
+	Remove(d *dnsstorage.Domain) error
+}
+
+// CustomDomainVerifyTimeout is a maximum time domain.verify waits
+// for a certificate to be issued.
+var CustomDomainVerifyTimeout = 3 * time.Minute
+
+// CustomDomainPendingTimeout is a time after which a custom domain,
+// which ownership was not verified, is released.
+var CustomDomainPendingTimeout = 24 * time.Hour
+
+var customDomainRe = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,63}$`)
+
+type customDomainArgs struct {
+	DomainName string `json:"domainName"`
+	MachineId  string `json:"machineId"`
+
+	// Challenge is a type of ownership challenge, either "dns-01"
+	// (default) or "http-01". Used only by domain.addCustom.
+	Challenge string `json:"challenge,omitempty"`
+}
+
+// CustomDomainResponse is a response of domain.addCustom and domain.verify
+// kite methods.
+type CustomDomainResponse struct {
+	DomainName string `json:"domainName"`
+
+	// IpAddress is the address an A record of the domain is
+	// expected to point to.
+	IpAddress string `json:"ipAddress,omitempty"`
+
+	// Challenge is the ownership challenge, which is required to be
+	// published before calling domain.verify.
+	Challenge *CustomDomainChallenge `json:"challenge,omitempty"`
+
+	// ExpiresAt is the time the domain is going to be released at,
+	// unless its ownership is verified.
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+
+	// NotAfter is the expiration time of the issued certificate.
+	NotAfter time.Time `json:"notAfter,omitempty"`
+}
+
+// CustomDomainChallenge describes how to publish an ownership challenge.
+type CustomDomainChallenge struct {
+	Type string `json:"type"`
+
+	// RecordName and RecordValue describe a TXT record that needs to be
+	// created for a dns-01 challenge.
+	RecordName  string `json:"recordName,omitempty"`
+	RecordValue string `json:"recordValue,omitempty"`
+
+	// Delegation is a name RecordName can be CNAME-delegated to instead,
+	// in which case the certificates are going to be renewed without
+	// user's interaction.
+	Delegation string `json:"delegation,omitempty"`
+
+	// Path and Content describe a response that needs to be served
+	// over HTTP for a http-01 challenge.
+	Path    string `json:"path,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// customDomainFunc is called with the public IP address of the machine.
+type customDomainFunc func(ip string, args *customDomainArgs) (interface{}, error)
+
+func (k *Kloud) customDomainHandler(r *kite.Request, fn customDomainFunc) (interface{}, error) {
+	if r.Args == nil {
+		return nil, NewError(ErrNoArguments)
+	}
+
+	if k.CertManager == nil {
+		return nil, errors.New("custom domains are not supported")
+	}
+
+	args := &customDomainArgs{}
+	if err := r.Args.One().Unmarshal(args); err != nil {
+		return nil, err
+	}
+
+	args.DomainName = strings.ToLower(strings.TrimSuffix(args.DomainName, "."))
+
+	if !customDomainRe.MatchString(args.DomainName) {
+		return nil, fmt.Errorf("invalid domain name %q", args.DomainName)
+	}
+
+	if k.Domainer != nil {
+		zone := k.Domainer.HostedZone()
+
+		if args.DomainName == zone || strings.HasSuffix(args.DomainName, "."+zone) {
+			return nil, fmt.Errorf("domain %q belongs to %q, use domain.add instead", args.DomainName, zone)
+		}
+	}
+
+	m, err := k.GetMachine(r)
+	if err != nil {
+		return nil, err
+	}
+
+	fetcher, ok := m.(PublicIpAddressFetcher)
+
+	var ip string
+	if ok {
+		ip = fetcher.PublicIpAddress()
+	}
+
+	// The machine lock is required only for reading the machine,
+	// the fn talks to the CA and klient, which may take minutes.
+	k.Locker.Unlock(args.MachineId)
+
+	if !ok {
+		return nil, fmt.Errorf("PublicIpAddressHolder is not supported")
+	}
+
+	k.Log.Debug("'%s' method is called with args: %+v\n", r.Method, args)
+
+	return fn(ip, args)
+}
+
+// customDomain gives the custom domain stored for the given machine.
+func (k *Kloud) customDomain(args *customDomainArgs) (*dnsstorage.Domain, error) {
+	d, err := k.DomainStorage.Get(args.DomainName)
+	if err != nil {
+		return nil, fmt.Errorf("domain %q does not exist", args.DomainName)
+	}
+
+	if !d.Custom || d.MachineId != args.MachineId {
+		return nil, fmt.Errorf("domain %q does not belong to the machine", args.DomainName)
+	}
+
+	if d.Expired(time.Now()) {
+		return nil, fmt.Errorf("domain %q was not verified in time, add it again", args.DomainName)
+	}
+
+	return d, nil
+}
+
+// DomainAddCustom is a kite handler for the "domain.addCustom" method.
+//
+// It attaches a domain owned by the user to the machine and returns an
+// ownership challenge, which the user is expected to publish before
+// calling domain.verify. The domain is released if it's not verified
+// within CustomDomainPendingTimeout.
+func (k *Kloud) DomainAddCustom(r *kite.Request) (interface{}, error) {
+	addFunc := func(ip string, args *customDomainArgs) (interface{}, error) {
+		now := time.Now()
+
+		if d, err := k.DomainStorage.Get(args.DomainName); err == nil && !d.Expired(now) {
+			return nil, fmt.Errorf("domain %q already exists", args.DomainName)
+		}
+
+		d := &dnsstorage.Domain{
+			Username:  r.Username,
+			MachineId: args.MachineId,
+			Name:      args.DomainName,
+			Custom:    true,
+			ExpiresAt: now.Add(CustomDomainPendingTimeout).UTC(),
+		}
+
+		if err := k.DomainStorage.Add(d); err != nil {
+			return nil, err
+		}
+
+		c, err := k.CertManager.Challenge(context.Background(), d, args.Challenge)
+		if err != nil {
+			if e := k.DomainStorage.Delete(d.Name); e != nil {
+				k.Log.Warning("unable to delete domain %q: %s", d.Name, e)
+			}
+
+			return nil, err
+		}
+
+		return &CustomDomainResponse{
+			DomainName: d.Name,
+			IpAddress:  ip,
+			ExpiresAt:  d.ExpiresAt,
+			Challenge: &CustomDomainChallenge{
+				Type:        c.Type,
+				RecordName:  c.RecordName,
+				RecordValue: c.RecordValue,
+				Delegation:  c.Delegation,
+				Path:        c.Path,
+				Content:     c.Content,
+			},
+		}, nil
+	}
+
+	return k.customDomainHandler(r, addFunc)
+}
+
+// DomainVerify is a kite handler for the "domain.verify" method.
+//
+// It checks whether the ownership challenge of the custom domain
+// is published, obtains a certificate for the domain and installs
+// it on the machine.
+func (k *Kloud) DomainVerify(r *kite.Request) (interface{}, error) {
+	verifyFunc := func(ip string, args *customDomainArgs) (interface{}, error) {
+		if _, err := k.customDomain(args); err != nil {
+			return nil, err
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), CustomDomainVerifyTimeout)
+		defer cancel()
+
+		cert, err := k.CertManager.Verify(ctx, args.DomainName)
+		if err != nil {
+			return nil, err
+		}
+
+		return &CustomDomainResponse{
+			DomainName: args.DomainName,
+			IpAddress:  ip,
+			NotAfter:   cert.NotAfter,
+		}, nil
+	}
+
+	return k.customDomainHandler(r, verifyFunc)
+}
+
+// DomainRemoveCustom is a kite handler for the "domain.removeCustom" method.
+//
+// It detaches the custom domain from the machine and removes
+// its certificate.
+func (k *Kloud) DomainRemoveCustom(r *kite.Request) (interface{}, error) {
+	removeFunc := func(_ string, args *customDomainArgs) (interface{}, error) {
+		d, err := k.customDomain(args)
+		if err != nil {
+			return nil, err
+		}
+
+		// do not return on error, the machine may be stopped
+		if err := k.CertManager.Remove(d); err != nil {
+			k.Log.Warning("unable to remove certificate of %q: %s", d.Name, err)
+		}
+
+		if err := k.DomainStorage.Delete(d.Name); err != nil {
+			return nil, err
+		}
+
+		return true, nil
+	}
+
+	return k.customDomainHandler(r, removeFunc)
+}
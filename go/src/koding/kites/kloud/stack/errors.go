@@ -37,10 +37,11 @@ const (
 	ErrSnapshotIdMissing         = 108
 	ErrTerraformContextIsMissing = 109
 
-	ErrEventNotFound    = 200
-	ErrEventIdMissing   = 201
-	ErrEventTypeMissing = 202
-	ErrEventArgsEmpty   = 203
+	ErrEventNotFound        = 200
+	ErrEventIdMissing       = 201
+	ErrEventTypeMissing     = 202
+	ErrEventArgsEmpty       = 203
+	ErrEventCallbackMissing = 204
 
 	ErrBadState               = 400
 	ErrProviderNotFound       = 401
@@ -72,10 +73,11 @@ var kloudErrors = map[int]string{
 	ErrTerraformContextIsMissing: "Terraform context file is missing.",
 
 	// Event errors
-	ErrEventIdMissing:   "Event id is missing.",
-	ErrEventTypeMissing: "Event type is missing.",
-	ErrEventNotFound:    "Event not found.",
-	ErrEventArgsEmpty:   "Event arguments is empty, expecting an array.",
+	ErrEventIdMissing:       "Event id is missing.",
+	ErrEventTypeMissing:     "Event type is missing.",
+	ErrEventNotFound:        "Event not found.",
+	ErrEventArgsEmpty:       "Event arguments is empty, expecting an array.",
+	ErrEventCallbackMissing: "Event callback is missing.",
 
 	// Generic errors
 	ErrBadState:               "Bad state.",
@@ -1,9 +1,12 @@
 package stack
 
 import (
+	"time"
+
 	"koding/kites/kloud/eventer"
 
 	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
 )
 
 type EventArg struct {
@@ -63,18 +66,19 @@ func (k *Kloud) Event(r *kite.Request) (interface{}, error) {
 func (k *Kloud) NewEventer(id string) eventer.Eventer {
 	k.Log.Debug("[event] creating a new eventer for id: %s", id)
 
+	// The eventer reads the last event from the log, which is done
+	// before locking, so other eventers are not blocked by it.
+	ev := eventer.NewWithLog(id, k.EventLog, k.Log)
+
 	k.mu.Lock()
 	defer k.mu.Unlock()
 
-	ev, ok := k.Eventers[id]
-	if ok {
+	if _, ok := k.Eventers[id]; ok {
 		// for now we delete old events, but in the future we might store them
 		// in the db for history/logging.
 		k.Log.Debug("[event] cleaning up previous events of id: %s", id)
-		delete(k.Eventers, id)
 	}
 
-	ev = eventer.New(id)
 	k.Eventers[id] = ev
 	return ev
 }
@@ -92,10 +96,153 @@ func (k *Kloud) GetEvent(eventId string) (*eventer.Event, error) {
 	k.mu.RLock()
 	ev, ok := k.Eventers[eventId]
 	k.mu.RUnlock()
-	if !ok {
+	if ok {
+		return ev.Show(), nil
+	}
+
+	// the process may be handled by other kloud instance or the
+	// eventer was lost during restart, fallback to the event log
+	last, err := k.EventLog.Last(eventId)
+	if err != nil {
 		k.Log.Debug("[event] couldn't find eventer for id: %s", eventId)
 		return nil, NewError(ErrEventNotFound)
 	}
 
-	return ev.Show(), nil
+	return last, nil
+}
+
+// EventSubscribeRequest represents an argument of the event.subscribe
+// kite method.
+type EventSubscribeRequest struct {
+	Type    string `json:"type"`
+	EventId string `json:"eventId"`
+
+	// Cursor is a sequence number of the last event the caller has
+	// already seen. Methods that start a process return a cursor
+	// pointing before its first event, e.g. ControlResult.EventCursor.
+	//
+	// Zero streams events of the latest run of the process; as events
+	// of a new run may not be stored yet, callers that start the process
+	// should use the returned cursor instead. Negative cursor replays
+	// full history of the process, including previous runs.
+	Cursor int `json:"cursor"`
+
+	// OnEvent is called with a single *eventer.Event argument, for each
+	// event newer than Cursor, until the final event is sent. When full
+	// history is replayed, it is the final event of the latest run.
+	OnEvent dnode.Function `json:"onEvent"`
+}
+
+// EventSubscribeResponse represents a reply of the event.subscribe
+// kite method.
+type EventSubscribeResponse struct {
+	EventId string `json:"eventId"`
+}
+
+// EventPollInterval tells how often subscriptions check for new events.
+var EventPollInterval = 1 * time.Second
+
+// EventSubscribe streams events of the given process to the caller.
+//
+// The events are read from the event log, so the caller can subscribe
+// to any kloud instance, regardless of the one that handles the process.
+func (k *Kloud) EventSubscribe(r *kite.Request) (interface{}, error) {
+	if r.Args == nil {
+		return nil, NewError(ErrNoArguments)
+	}
+
+	var req EventSubscribeRequest
+
+	if err := r.Args.One().Unmarshal(&req); err != nil {
+		return nil, err
+	}
+
+	if req.EventId == "" {
+		return nil, NewError(ErrEventIdMissing)
+	}
+
+	if req.Type == "" {
+		return nil, NewError(ErrEventTypeMissing)
+	}
+
+	if !req.OnEvent.IsValid() {
+		return nil, NewError(ErrEventCallbackMissing)
+	}
+
+	eventId := req.Type + "-" + req.EventId
+	done := make(chan struct{})
+
+	if r.Client != nil {
+		r.Client.OnDisconnect(func() {
+			close(done)
+		})
+	}
+
+	cursor, run := req.Cursor, 0
+
+	switch {
+	case cursor < 0:
+		cursor, run = 0, k.runCursor(eventId)
+	case cursor == 0:
+		cursor = k.runCursor(eventId)
+		run = cursor
+	}
+
+	go k.streamEvents(eventId, cursor, run, req.OnEvent, done)
+
+	return &EventSubscribeResponse{
+		EventId: eventId,
+	}, nil
+}
+
+// runCursor gives a cursor pointing before the first event of the latest
+// run of the given process.
+func (k *Kloud) runCursor(eventId string) int {
+	k.mu.RLock()
+	ev, ok := k.Eventers[eventId]
+	k.mu.RUnlock()
+
+	if ok {
+		return eventer.Cursor(ev)
+	}
+
+	last, err := k.EventLog.Last(eventId)
+	if err != nil {
+		return 0
+	}
+
+	return last.RunCursor
+}
+
+// streamEvents sends events newer than cursor until it sends the final
+// event of a run, which starts after the given run cursor.
+func (k *Kloud) streamEvents(eventId string, cursor, run int, fn dnode.Function, done <-chan struct{}) {
+	t := time.NewTicker(EventPollInterval)
+	defer t.Stop()
+
+	for {
+		events, err := k.EventLog.Since(eventId, cursor)
+		if err != nil {
+			k.Log.Error("[event] unable to read events for %q: %s", eventId, err)
+		}
+
+		for _, ev := range events {
+			if err := fn.Call(ev); err != nil {
+				k.Log.Debug("[event] subscriber for %q is gone: %s", eventId, err)
+				return
+			}
+
+			cursor = ev.Seq
+
+			if ev.Final() && ev.RunCursor >= run {
+				return
+			}
+		}
+
+		select {
+		case <-done:
+			return
+		case <-t.C:
+		}
+	}
 }
@@ -0,0 +1,132 @@
+package stack
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"koding/kites/kloud/eventer"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+)
+
+func newRequest(args string) *kite.Request {
+	return &kite.Request{
+		Username: "user",
+		Args:     &dnode.Partial{Raw: []byte(args)},
+	}
+}
+
+// subscribeRequest gives event.subscribe request, which sends events
+// to the returned channel.
+func subscribeRequest(id string, cursor int) (*kite.Request, <-chan *eventer.Event) {
+	events := make(chan *eventer.Event, 16)
+
+	msg := &dnode.Message{
+		Arguments: &dnode.Partial{
+			Raw: []byte(fmt.Sprintf(`[{"type":"apply","eventId":%q,"cursor":%d,"onEvent":"[Function]"}]`, id, cursor)),
+		},
+		Callbacks: map[string]dnode.Path{
+			"0": {"0", "onEvent"},
+		},
+	}
+
+	dnode.ParseCallbacks(msg, func(_ uint64, args []interface{}) error {
+		events <- args[0].(*eventer.Event)
+		return nil
+	})
+
+	return &kite.Request{
+		Username: "user",
+		Args:     msg.Arguments,
+	}, events
+}
+
+func TestEventSubscribe(t *testing.T) {
+	EventPollInterval = 10 * time.Millisecond
+
+	k := New()
+	id := "apply-123"
+
+	// previous run of the process
+	ev := k.NewEventer(id)
+	ev.Push(&eventer.Event{Message: "apply started", Percentage: 10})
+	ev.Push(&eventer.Event{Message: "apply finished", Percentage: 100})
+	ev.(*eventer.Events).Flush()
+
+	// the process is started again, possibly by other kloud instance
+	k.DelEventer(id)
+
+	ev = k.NewEventer(id)
+
+	if cursor := eventer.Cursor(ev); cursor != 2 {
+		t.Fatalf("got cursor %d, want 2", cursor)
+	}
+
+	ev.Push(&eventer.Event{Message: "apply started", Percentage: 10})
+	ev.Push(&eventer.Event{Message: "apply in progress", Percentage: 50})
+	ev.Push(&eventer.Event{Message: "apply finished", Percentage: 100})
+	ev.(*eventer.Events).Flush()
+
+	k.DelEventer(id)
+
+	cases := map[string]struct {
+		cursor int
+		want   []int
+	}{
+		"latest run":   {0, []int{3, 4, 5}},
+		"full history": {-1, []int{1, 2, 3, 4, 5}},
+		"cursor":       {3, []int{4, 5}},
+	}
+
+	for name, cas := range cases {
+		t.Run(name, func(t *testing.T) {
+			req, events := subscribeRequest("123", cas.cursor)
+
+			if _, err := k.EventSubscribe(req); err != nil {
+				t.Fatalf("EventSubscribe()=%s", err)
+			}
+
+			var got []int
+
+			for len(got) < len(cas.want) {
+				select {
+				case ev := <-events:
+					got = append(got, ev.Seq)
+
+					if ev.RunCursor != 0 && ev.RunCursor != 2 {
+						t.Errorf("unexpected run cursor: %+v", ev)
+					}
+				case <-time.After(5 * time.Second):
+					t.Fatalf("timed out waiting for events, got %v", got)
+				}
+			}
+
+			// streaming stops after the final event
+			select {
+			case ev := <-events:
+				t.Fatalf("unexpected event after the final one: %+v", ev)
+			case <-time.After(5 * EventPollInterval):
+			}
+
+			for i := range got {
+				if got[i] != cas.want[i] {
+					t.Fatalf("got %v, want %v", got, cas.want)
+				}
+			}
+		})
+	}
+}
+
+func TestEventSubscribeArgs(t *testing.T) {
+	k := New()
+
+	if _, err := k.EventSubscribe(newRequest(`[{"type":"apply","eventId":"123"}]`)); err == nil {
+		t.Fatal("want error for missing callback")
+	}
+
+	if _, err := k.EventSubscribe(newRequest(`[{"type":"apply"}]`)); err == nil {
+		t.Fatal("want error for missing event id")
+	}
+}
@@ -42,12 +42,20 @@ type Kloud struct {
 	// DomainStorage is used to store persistent data about domain data
 	DomainStorage dnsstorage.Storage
 
+	// CertManager obtains TLS certificates for custom domains. If nil,
+	// custom domains are not supported.
+	CertManager CertManager
+
 	// Locker is used to lock/unlock distributed locks based on unique ids
 	Locker Locker
 
 	// Eventers is providing an event mechanism for each method.
 	Eventers map[string]eventer.Eventer
 
+	// EventLog persists events pushed by eventers, so they can be
+	// replayed after kloud restart or by other kloud instance.
+	EventLog eventer.Log
+
 	// mu protects Eventers
 	mu sync.RWMutex
 
@@ -79,6 +87,7 @@ func New() *Kloud {
 		idlock:      idlock.New(),
 		Log:         logging.NewLogger(NAME),
 		Eventers:    make(map[string]eventer.Eventer),
+		EventLog:    eventer.NewMemoryLog(),
 		providers:   make(map[string]interface{}, 0),
 		statusCache: cache.NewMemoryWithTTL(time.Second * 10),
 	}
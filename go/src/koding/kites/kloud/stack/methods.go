@@ -89,44 +89,44 @@ func (k *Kloud) Destroy(r *kite.Request) (resp interface{}, reqErr error) {
 }
 
 func (k *Kloud) Start(r *kite.Request) (resp interface{}, reqErr error) {
-	startFunc := func(ctx context.Context, machine interface{}) error {
-		starter, ok := machine.(Starter)
-		if !ok {
-			return fmt.Errorf("Provider doesn't implement %s interface", r.Method)
-		}
+	return k.coreMethods(r, startMachine)
+}
 
-		err := starter.Start(ctx)
-		if err != nil {
-			// special case `NetworkOut` error since client relies on this
-			// to show a modal
-			if strings.Contains(err.Error(), "NetworkOut") {
-				err = NewEventerError(err)
-			}
+func startMachine(ctx context.Context, machine interface{}) error {
+	starter, ok := machine.(Starter)
+	if !ok {
+		return errors.New("Provider doesn't implement start interface")
+	}
 
-			// special case `plan is expired` error since client relies on this to
-			// show a modal
-			if strings.Contains(strings.ToLower(err.Error()), "plan is expired") {
-				err = NewEventerError(err)
-			}
+	err := starter.Start(ctx)
+	if err != nil {
+		// special case `NetworkOut` error since client relies on this
+		// to show a modal
+		if strings.Contains(err.Error(), "NetworkOut") {
+			err = NewEventerError(err)
 		}
 
-		return err
+		// special case `plan is expired` error since client relies on this to
+		// show a modal
+		if strings.Contains(strings.ToLower(err.Error()), "plan is expired") {
+			err = NewEventerError(err)
+		}
 	}
 
-	return k.coreMethods(r, startFunc)
+	return err
 }
 
 func (k *Kloud) Stop(r *kite.Request) (resp interface{}, reqErr error) {
-	stopFunc := func(ctx context.Context, machine interface{}) error {
-		stopper, ok := machine.(Stopper)
-		if !ok {
-			return fmt.Errorf("Provider doesn't implement %s interface", r.Method)
-		}
+	return k.coreMethods(r, stopMachine)
+}
 
-		return stopper.Stop(ctx)
+func stopMachine(ctx context.Context, machine interface{}) error {
+	stopper, ok := machine.(Stopper)
+	if !ok {
+		return errors.New("Provider doesn't implement stop interface")
 	}
 
-	return k.coreMethods(r, stopFunc)
+	return stopper.Stop(ctx)
 }
 
 func (k *Kloud) Reinit(r *kite.Request) (resp interface{}, reqErr error) {
@@ -181,9 +181,28 @@ func (k *Kloud) CreateSnapshot(r *kite.Request) (reqResp interface{}, reqErr err
 	return k.coreMethods(r, snapshotFunc)
 }
 
+func (k *Kloud) RestoreSnapshot(r *kite.Request) (reqResp interface{}, reqErr error) {
+	restoreFunc := func(ctx context.Context, machine interface{}) error {
+		s, ok := machine.(SnapshotRestorer)
+		if !ok {
+			return fmt.Errorf("Provider doesn't implement %s interface", r.Method)
+		}
+
+		return s.RestoreSnapshot(ctx)
+	}
+
+	return k.coreMethods(r, restoreFunc)
+}
+
 func (k *Kloud) DeleteSnapshot(r *kite.Request) (resp interface{}, kiteErr error) {
+	if r.Args == nil {
+		return nil, NewError(ErrNoArguments)
+	}
+
 	var args struct {
 		SnapshotId string
+		MachineId  string
+		Provider   string
 	}
 
 	if err := r.Args.One().Unmarshal(&args); err != nil {
@@ -194,6 +213,21 @@ func (k *Kloud) DeleteSnapshot(r *kite.Request) (resp interface{}, kiteErr error
 		return nil, NewError(ErrSnapshotIdMissing)
 	}
 
+	// Snapshots of stack machines are deleted by the machine's provider,
+	// as they are kept within user's account.
+	if args.MachineId != "" && args.Provider != "" && args.Provider != "koding" {
+		deleteFunc := func(ctx context.Context, machine interface{}) error {
+			s, ok := machine.(Snapshotter)
+			if !ok {
+				return fmt.Errorf("Provider doesn't implement %s interface", r.Method)
+			}
+
+			return s.DeleteSnapshot(ctx)
+		}
+
+		return k.coreMethods(r, deleteFunc)
+	}
+
 	defer func() {
 		if kiteErr != nil {
 			k.Log.New("username", r.Username, "snapshotId", args.SnapshotId).Error("Could not delete snapshot: %s", kiteErr.Error())
@@ -1 +1,70 @@
 package stack
+
+// Resource actions reported by a dry-run plan.
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionReplace = "replace"
+	ActionDestroy = "destroy"
+)
+
+// ResourceDiff describes a planned change of a single stack resource.
+type ResourceDiff struct {
+	// Name is a full name of the resource, e.g. "aws_instance.example".
+	Name string `json:"name"`
+
+	// Type is a type of the resource, e.g. "aws_instance".
+	Type string `json:"type"`
+
+	// Action is one of: create, update, replace or destroy.
+	Action string `json:"action"`
+
+	// Attributes lists changes of the resource attributes, sorted by name.
+	Attributes []*AttributeDiff `json:"attributes,omitempty"`
+}
+
+// AttributeDiff describes a planned change of a single attribute.
+type AttributeDiff struct {
+	Name string `json:"name"`
+	Old  string `json:"old"`
+	New  string `json:"new"`
+
+	// Computed is true if new value is not known until the resource
+	// is applied.
+	Computed bool `json:"computed,omitempty"`
+
+	// Removed is true if the attribute is going to be removed.
+	Removed bool `json:"removed,omitempty"`
+
+	// RequiresNew is true if the change forces the resource to be
+	// replaced.
+	RequiresNew bool `json:"requiresNew,omitempty"`
+}
+
+// PlanSummary counts resources by planned action.
+type PlanSummary struct {
+	Create  int `json:"create"`
+	Update  int `json:"update"`
+	Replace int `json:"replace"`
+	Destroy int `json:"destroy"`
+}
+
+// NewPlanSummary gives a summary for the given resource diffs.
+func NewPlanSummary(resources []*ResourceDiff) *PlanSummary {
+	var s PlanSummary
+
+	for _, r := range resources {
+		switch r.Action {
+		case ActionCreate:
+			s.Create++
+		case ActionUpdate:
+			s.Update++
+		case ActionReplace:
+			s.Replace++
+		case ActionDestroy:
+			s.Destroy++
+		}
+	}
+
+	return &s
+}
@@ -79,7 +79,7 @@ type Stack interface {
 	Apply(context.Context) (interface{}, error)
 	Authenticate(context.Context) (interface{}, error)
 	Bootstrap(context.Context) (interface{}, error)
-	Plan(context.Context) (interface{}, error)
+	Plan(context.Context) (*PlanResponse, error)
 }
 
 type Machine interface {
@@ -127,6 +127,12 @@ type Snapshotter interface {
 	DeleteSnapshot(ctx context.Context) error
 }
 
+// SnapshotRestorer is implemented by machines that can be rebuilt
+// from a previously created snapshot.
+type SnapshotRestorer interface {
+	RestoreSnapshot(ctx context.Context) error
+}
+
 type PublicIpAddressFetcher interface {
 	PublicIpAddress() string
 }
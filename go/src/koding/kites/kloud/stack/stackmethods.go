@@ -2,14 +2,21 @@ package stack
 
 import (
 	"errors"
+	"strings"
 	"time"
 
 	"golang.org/x/net/context"
 
 	"koding/db/mongodb/modelhelper"
+	"koding/kites/kloud/contexthelper/session"
+	"koding/kites/kloud/policy"
+	"koding/kites/kloud/pricing"
+	"koding/kites/kloud/terraformer"
+	"koding/kites/terraformer/kodingcontext"
 
 	"github.com/koding/cache"
 	"github.com/koding/kite"
+	"gopkg.in/mgo.v2/bson"
 )
 
 // Validator validates and returns non-nil error when it's ill-formed.
@@ -101,6 +108,262 @@ func (k *Kloud) Apply(r *kite.Request) (interface{}, error) {
 	return k.stackMethod(r, Stack.Apply)
 }
 
+/// ROLLBACK
+
+// RollbackRequest represents an argument of the stack.rollback kite method.
+type RollbackRequest struct {
+	Provider  string `json:"provider"`
+	StackID   string `json:"stackId"`
+	GroupName string `json:"groupName"`
+
+	// Revision is a revision of the stack template to roll back to.
+	// If empty, the revision preceding the one the stack was last
+	// applied with is used.
+	Revision string `json:"revision,omitempty"`
+}
+
+// Valid implements the Validator interface.
+func (req *RollbackRequest) Valid() error {
+	if req.StackID == "" {
+		return errors.New("stackId is empty")
+	}
+	if req.GroupName == "" {
+		return errors.New("groupName is empty")
+	}
+	return nil
+}
+
+// Rollbacker provides an interface to re-apply a stack with a previous
+// revision of its template.
+type Rollbacker interface {
+	Rollback(context.Context, *RollbackRequest) (interface{}, error)
+}
+
+// Rollback provides stack.rollback as a kite method.
+//
+// If the requested provider does not implement the Rollbacker interface,
+// the method return with a ErrProviderNotImplemented error.
+func (k *Kloud) Rollback(r *kite.Request) (interface{}, error) {
+	fn := func(s Stack, ctx context.Context) (interface{}, error) {
+		rb, ok := s.(Rollbacker)
+		if !ok {
+			return nil, NewError(ErrProviderNotImplemented)
+		}
+
+		var req RollbackRequest
+
+		if err := r.Args.One().Unmarshal(&req); err != nil {
+			return nil, err
+		}
+
+		if err := req.Valid(); err != nil {
+			return nil, err
+		}
+
+		return rb.Rollback(ctx, &req)
+	}
+
+	return k.stackMethod(r, fn)
+}
+
+/// CANCEL
+
+// CancelRequest represents an argument of the stack.cancel kite method.
+type CancelRequest struct {
+	Provider  string `json:"provider"`
+	StackID   string `json:"stackId,omitempty"`
+	GroupName string `json:"groupName"`
+
+	// EventID is an ID of the event stream returned by the operation
+	// being canceled. It is used to look up the stack when StackID
+	// is empty.
+	EventID string `json:"eventId,omitempty"`
+}
+
+// Valid implements the Validator interface.
+func (req *CancelRequest) Valid() error {
+	if req.StackID == "" && req.EventID == "" {
+		return errors.New("stackId and eventId are empty")
+	}
+	if req.GroupName == "" {
+		return errors.New("groupName is empty")
+	}
+
+	if req.StackID == "" {
+		// Stack event IDs are in the form of "<method>-<stackID>".
+		req.StackID = req.EventID[strings.LastIndex(req.EventID, "-")+1:]
+	}
+
+	if !bson.IsObjectIdHex(req.StackID) {
+		return errors.New("invalid stackId: " + req.StackID)
+	}
+
+	if req.EventID == "" {
+		req.EventID = "apply-" + req.StackID
+	}
+
+	return nil
+}
+
+// Canceler provides an interface to stop an ongoing apply or destroy
+// operation of a stack.
+type Canceler interface {
+	Cancel(context.Context, *CancelRequest) (interface{}, error)
+}
+
+// Cancel provides stack.cancel as a kite method.
+//
+// If the requested provider does not implement the Canceler interface,
+// the method return with a ErrProviderNotImplemented error.
+func (k *Kloud) Cancel(r *kite.Request) (interface{}, error) {
+	fn := func(s Stack, ctx context.Context) (interface{}, error) {
+		c, ok := s.(Canceler)
+		if !ok {
+			return nil, NewError(ErrProviderNotImplemented)
+		}
+
+		var req CancelRequest
+
+		if err := r.Args.One().Unmarshal(&req); err != nil {
+			return nil, err
+		}
+
+		if err := req.Valid(); err != nil {
+			return nil, err
+		}
+
+		return c.Cancel(ctx, &req)
+	}
+
+	return k.stackMethod(r, fn)
+}
+
+// CancelLocalRequest represents an argument of the stack.cancelLocal
+// kite method.
+type CancelLocalRequest struct {
+	ContentID string `json:"contentId"`
+}
+
+// CancelLocal provides stack.cancelLocal as a kite method.
+//
+// Each kloud instance uses its own terraformer instance, so a stack.cancel
+// request may reach other kloud than the one running the operation. The
+// method is called by such kloud, it cancels the operation if it is run
+// by the terraformer of this kloud. It returns false when there is no
+// such operation.
+func (k *Kloud) CancelLocal(r *kite.Request) (interface{}, error) {
+	if !IsKloudctlAuth(r, k.SecretKey) {
+		return nil, errors.New("not authorized to cancel operations")
+	}
+
+	if r.Args == nil {
+		return nil, NewError(ErrNoArguments)
+	}
+
+	var req CancelLocalRequest
+
+	if err := r.Args.One().Unmarshal(&req); err != nil {
+		return nil, err
+	}
+
+	if req.ContentID == "" {
+		return nil, errors.New("contentId is empty")
+	}
+
+	ctx := context.Background()
+
+	if k.ContextCreator != nil {
+		ctx = k.ContextCreator(ctx)
+	}
+
+	sess, ok := session.FromContext(ctx)
+	if !ok {
+		return nil, errors.New("session not available in context")
+	}
+
+	tfKite, err := terraformer.Connect(sess.Terraformer)
+	if err != nil {
+		return nil, err
+	}
+	defer tfKite.Close()
+
+	switch err := tfKite.Cancel(req.ContentID); err {
+	case nil:
+		return true, nil
+	case kodingcontext.ErrNotRunning:
+		return false, nil
+	default:
+		return nil, err
+	}
+}
+
+/// VALIDATE
+
+// ValidateRequest represents an argument of the stack.validate kite method.
+type ValidateRequest struct {
+	Provider  string `json:"provider"`
+	GroupName string `json:"groupName"`
+
+	// Either StackTemplateID, StackID or Template must be set. When StackID
+	// is set, the template the stack was built from is validated.
+	StackTemplateID string `json:"stackTemplateId,omitempty"`
+	StackID         string `json:"stackId,omitempty"`
+
+	// Template is a content of a stack template, which is validated
+	// without being stored. It is built with the given Credentials.
+	Template    string              `json:"template,omitempty"`
+	Credentials map[string][]string `json:"credentials,omitempty"`
+}
+
+// ValidateResponse represents a response of the stack.validate kite method.
+type ValidateResponse struct {
+	Valid      bool                `json:"valid"`
+	Violations []*policy.Violation `json:"violations,omitempty"`
+}
+
+// Valid implements the Validator interface.
+func (req *ValidateRequest) Valid() error {
+	if req.StackTemplateID == "" && req.StackID == "" && req.Template == "" {
+		return errors.New("stackTemplateId, stackId and template are empty")
+	}
+	if req.GroupName == "" {
+		return errors.New("groupName is empty")
+	}
+	return nil
+}
+
+// TemplateValidator validates stack templates against group policies.
+type TemplateValidator interface {
+	Validate(context.Context, *ValidateRequest) (*ValidateResponse, error)
+}
+
+// Validate provides stack.validate as a kite method.
+//
+// If the requested provider does not implement the TemplateValidator
+// interface, the method return with a ErrProviderNotImplemented error.
+func (k *Kloud) Validate(r *kite.Request) (interface{}, error) {
+	fn := func(s Stack, ctx context.Context) (interface{}, error) {
+		v, ok := s.(TemplateValidator)
+		if !ok {
+			return nil, NewError(ErrProviderNotImplemented)
+		}
+
+		var req ValidateRequest
+
+		if err := r.Args.One().Unmarshal(&req); err != nil {
+			return nil, err
+		}
+
+		if err := req.Valid(); err != nil {
+			return nil, err
+		}
+
+		return v.Validate(ctx, &req)
+	}
+
+	return k.stackMethod(r, fn)
+}
+
 /// AUTHENTICATE
 
 // AuthenticateRequest represents an argument of the authenticate kite method.
@@ -147,6 +410,11 @@ type BootstrapRequest struct {
 
 	GroupName string `json:"groupName"`
 
+	// StackTemplateID, when set, makes the bootstrap create resources
+	// for every region used by providers declared in the template,
+	// instead of the credentials regions only.
+	StackTemplateID string `json:"stackTemplateId,omitempty"`
+
 	// Destroy destroys the bootstrap resource associated with the given
 	// identifiers
 	Destroy bool
@@ -171,20 +439,42 @@ func (k *Kloud) Bootstrap(r *kite.Request) (interface{}, error) {
 /// PLAN
 
 // PlanRequest represents an argument of the plan kite method.
+//
+// When StackID is set, the plan is a dry-run of the apply method
+// for the given stack - the result contains resource changes computed
+// against the current state of the stack.
 type PlanRequest struct {
 	Provider        string `json:"provider"`
 	StackTemplateID string `json:"stackTemplateId"`
+	StackID         string `json:"stackId,omitempty"`
 	GroupName       string `json:"groupName"`
+
+	// Credentials sets or overrides credentials set in jComputeStack,
+	// used only with StackID or Template.
+	Credentials map[string][]string `json:"credentials,omitempty"`
+
+	// Template is a content of a stack template, which is planned
+	// without being stored. When StackID is set, the template is
+	// planned against the stack instead of the one it was built from.
+	Template string `json:"template,omitempty"`
 }
 
 // PlanResponse represents a reponse type of the plan kite method.
 type PlanResponse struct {
 	Machines interface{} `json:"machines"`
+
+	// Resources and Summary are set only for dry-run plans.
+	Resources []*ResourceDiff `json:"resources,omitempty"`
+	Summary   *PlanSummary    `json:"summary,omitempty"`
+
+	// Cost is an estimated monthly cost of the stack, set only
+	// by providers that support cost estimation.
+	Cost *pricing.Estimate `json:"cost,omitempty"`
 }
 
 // Valid implements the Validator interface.
 func (req *PlanRequest) Valid() error {
-	if req.StackTemplateID == "" {
+	if req.StackTemplateID == "" && req.StackID == "" && req.Template == "" {
 		return errors.New("stackIdTemplate is not passed")
 	}
 	if req.GroupName == "" {
@@ -195,7 +485,11 @@ func (req *PlanRequest) Valid() error {
 
 // Plan provides plan as a kite method.
 func (k *Kloud) Plan(r *kite.Request) (interface{}, error) {
-	return k.stackMethod(r, Stack.Plan)
+	fn := func(s Stack, ctx context.Context) (interface{}, error) {
+		return s.Plan(ctx)
+	}
+
+	return k.stackMethod(r, fn)
 }
 
 /// STATUS
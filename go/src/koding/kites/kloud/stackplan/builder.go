@@ -205,6 +205,14 @@ func (b *Builder) BuildStack(stackID string, credentials map[string][]string) er
 		}
 
 		b.Stack.Template = stackTemplate.Template.Content
+		b.Stack.TemplateID = baseStackID
+
+		// Revisions are stored when templates are saved, this only
+		// picks the one the stack is built from.
+		b.Stack.Revision = stackTemplate.Template.Sum
+		if b.Stack.Revision == "" {
+			b.Stack.Revision = modelhelper.StackTemplateSum(stackTemplate.Template.Content)
+		}
 	} else {
 		overallErr = ResError(err, "jStackTemplate")
 	}
@@ -230,6 +238,44 @@ func (b *Builder) BuildStack(stackID string, credentials map[string][]string) er
 	return overallErr
 }
 
+// BuildRevision replaces the template built with BuildStack with the
+// given revision of it. If revision is empty, the revision preceding
+// the one the stack was last applied with is used.
+//
+// It is a no-op if the stack is already built from the revision.
+func (b *Builder) BuildRevision(revision string) error {
+	if b.Stack == nil || b.Stack.TemplateID == "" {
+		return errors.New("stack template is not built")
+	}
+
+	var rev *models.StackTemplateRevision
+	var err error
+
+	if revision == "" {
+		current := b.Stack.Stack.StackRevision
+		if current == "" {
+			return errors.New("stack was not applied yet, nothing to roll back to")
+		}
+
+		rev, err = modelhelper.GetPreviousStackTemplateRevision(b.Stack.TemplateID, current)
+	} else if revision != b.Stack.Revision {
+		rev, err = modelhelper.GetStackTemplateRevision(b.Stack.TemplateID, revision)
+	} else {
+		return nil
+	}
+
+	if err != nil {
+		return ResError(err, "jStackTemplateRevision")
+	}
+
+	b.Log.Debug("Using revision %q of %q template", rev.Revision, b.Stack.TemplateID)
+
+	b.Stack.Template = rev.Content
+	b.Stack.Revision = rev.Revision
+
+	return nil
+}
+
 // FindMachine looks for a jMachine document in b.Machines which meta.assignedLabel
 // matches the given paramter.
 //
@@ -429,6 +475,7 @@ func (b *Builder) BuildCredentials(method, username, groupname string, identifie
 	// 3- count relationship with credential id and jaccount id as user or
 	// owner. Any non valid credentials will be discarded
 	validKeys := make(map[string]string, len(credentials))
+	validIdents := make([]string, 0, len(credentials))
 
 	permittedTargets, ok := credPermissions[method]
 	if !ok {
@@ -455,6 +502,16 @@ func (b *Builder) BuildCredentials(method, username, groupname string, identifie
 		validKeys[cred.Identifier] = cred.Provider
 	}
 
+	// Credentials are kept in the order they were requested, the first
+	// credential of a provider is the default one.
+	seen := make(map[string]bool, len(validKeys))
+	for _, ident := range identifiers {
+		if _, ok := validKeys[ident]; ok && !seen[ident] {
+			seen[ident] = true
+			validIdents = append(validIdents, ident)
+		}
+	}
+
 	// 4- fetch credentialdata with identifier
 	data := make(map[string]interface{}, len(validKeys))
 	for ident, provider := range validKeys {
@@ -483,10 +540,10 @@ func (b *Builder) BuildCredentials(method, username, groupname string, identifie
 		},
 	}
 
-	for ident, provider := range validKeys {
+	for _, ident := range validIdents {
 		cred := &Credential{
 			Title:      credentialTitles[ident],
-			Provider:   provider,
+			Provider:   validKeys[ident],
 			Identifier: ident,
 			Meta:       data[ident], // TODO(rjeczalik): rename the field to Data
 		}
@@ -533,7 +590,11 @@ func (b *Builder) BuildTemplate(content, contentID string) error {
 		return errors.New("error injecting koding variables: " + err.Error())
 	}
 
-	for _, cred := range b.Credentials {
+	// Credentials are injected in reverse order, so the variables
+	// hold values of the first credential of each provider.
+	for i := len(b.Credentials) - 1; i >= 0; i-- {
+		cred := b.Credentials[i]
+
 		if err := template.InjectVariables(cred.Provider, cred.Meta); err != nil {
 			return fmt.Errorf("error injecting variables for %q: %s", cred.Provider, err)
 		}
@@ -601,9 +662,15 @@ func (b *Builder) InterpolateField(resource map[string]interface{}, resourceName
 
 // UpdateStack updates jComputeStack document using b.Stack field.
 func (b *Builder) UpdateStack() error {
+	change := bson.M{
+		"credentials": b.Stack.Credentials,
+	}
+
+	if b.Stack.Revision != "" {
+		change["stackRevision"] = b.Stack.Revision
+	}
+
 	return modelhelper.UpdateStack(b.Stack.ID, bson.M{
-		"$set": bson.M{
-			"credentials": b.Stack.Credentials,
-		},
+		"$set": change,
 	})
 }
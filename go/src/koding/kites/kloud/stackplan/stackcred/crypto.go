@@ -0,0 +1,328 @@
+package stackcred
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"koding/kites/kloud/stack"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// EnvelopeKey is a key of a credential data value under which
+// its encrypted envelope is stored.
+const EnvelopeKey = "_envelope"
+
+// KeyProvider provides versioned key-encryption keys, which are used
+// to encrypt data keys of credential envelopes.
+//
+// The Keyfile type implements a KeyProvider backed by a local file.
+// An external key management service can be used by implementing
+// this interface on top of its API.
+type KeyProvider interface {
+	// KeyID gives an identifier of the current key, which is used
+	// for encrypting new data keys.
+	KeyID() string
+
+	// Encrypt encrypts the data key with the current key, returning
+	// the identifier of the key that was used.
+	Encrypt(dataKey []byte) (keyID string, ciphertext []byte, err error)
+
+	// Decrypt decrypts the data key with the key of the given identifier.
+	Decrypt(keyID string, ciphertext []byte) ([]byte, error)
+}
+
+// Envelope represents an encrypted credential data value.
+//
+// The value is encrypted with AES-256-GCM using a random data key,
+// which is encrypted with a key-encryption key from a KeyProvider.
+type Envelope struct {
+	KeyID string `json:"keyId" bson:"keyId"`
+	Key   string `json:"key" bson:"key"`     // encrypted data key, base64-encoded
+	Nonce string `json:"nonce" bson:"nonce"` // base64-encoded
+	Data  string `json:"data" bson:"data"`   // encrypted value, base64-encoded
+}
+
+// Seal encrypts JSON representation of the given credential data
+// value with a new data key.
+//
+// The envelope is bound to the credential identifier, so it can't
+// be opened as a data value of other credential.
+func Seal(kp KeyProvider, ident string, v interface{}) (*Envelope, error) {
+	p, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	return seal(kp, ident, p)
+}
+
+func seal(kp KeyProvider, ident string, plaintext []byte) (*Envelope, error) {
+	dataKey := make([]byte, 32)
+
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	keyID, key, err := kp.Encrypt(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Envelope{
+		KeyID: keyID,
+		Key:   base64.StdEncoding.EncodeToString(key),
+		Nonce: base64.StdEncoding.EncodeToString(nonce),
+		Data:  base64.StdEncoding.EncodeToString(gcm.Seal(nil, nonce, plaintext, aad(keyID, ident))),
+	}, nil
+}
+
+// Open decrypts the envelope of the given credential, returning
+// JSON representation of the credential data value.
+func (e *Envelope) Open(kp KeyProvider, ident string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(e.Key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid envelope key: %s", err)
+	}
+
+	nonce, err := base64.StdEncoding.DecodeString(e.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid envelope nonce: %s", err)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(e.Data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid envelope data: %s", err)
+	}
+
+	dataKey, err := kp.Decrypt(e.KeyID, key)
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(nonce) != gcm.NonceSize() {
+		return nil, errors.New("invalid envelope nonce size")
+	}
+
+	return gcm.Open(nil, nonce, data, aad(e.KeyID, ident))
+}
+
+// aad gives additional authenticated data of an envelope, which binds
+// it to both the key and the credential.
+func aad(keyID, ident string) []byte {
+	return []byte(keyID + "\x00" + ident)
+}
+
+// value gives a representation of the envelope that is stored
+// as a credential data value.
+func (e *Envelope) value() bson.M {
+	return bson.M{
+		EnvelopeKey: bson.M{
+			"keyId": e.KeyID,
+			"key":   e.Key,
+			"nonce": e.Nonce,
+			"data":  e.Data,
+		},
+	}
+}
+
+// ParseEnvelope reads an envelope from the store-specific representation
+// of a credential data value, e.g. bson.M for MongoDB or raw JSON
+// for socialapi.
+//
+// If the data value is not encrypted, the method returns false.
+func ParseEnvelope(raw interface{}) (*Envelope, bool) {
+	var m map[string]interface{}
+
+	switch v := raw.(type) {
+	case bson.M:
+		m = v
+	case map[string]interface{}:
+		m = v
+	case json.RawMessage:
+		if json.Unmarshal(v, &m) != nil {
+			return nil, false
+		}
+	case []byte:
+		if json.Unmarshal(v, &m) != nil {
+			return nil, false
+		}
+	default:
+		return nil, false
+	}
+
+	var env map[string]interface{}
+
+	switch v := m[EnvelopeKey].(type) {
+	case bson.M:
+		env = v
+	case map[string]interface{}:
+		env = v
+	default:
+		return nil, false
+	}
+
+	e := &Envelope{}
+
+	for key, dst := range map[string]*string{"keyId": &e.KeyID, "key": &e.Key, "nonce": &e.Nonce, "data": &e.Data} {
+		s, ok := env[key].(string)
+		if !ok {
+			return nil, false
+		}
+		*dst = s
+	}
+
+	return e, true
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// cryptStore wraps a Store, encrypting each credential data value
+// on Put and decrypting them on Fetch.
+//
+// Data values that are not encrypted yet are fetched as is, so
+// existing credentials are readable until they are re-encrypted
+// with Reencrypt.
+type cryptStore struct {
+	*StoreOptions
+	store Store
+}
+
+var _ Store = (*cryptStore)(nil)
+
+// NewCryptStore gives a Store that keeps credential data values
+// of the given store encrypted with keys provided by opts.KeyProvider.
+func NewCryptStore(s Store, opts *StoreOptions) Store {
+	return &cryptStore{
+		StoreOptions: opts,
+		store:        s,
+	}
+}
+
+func (cs *cryptStore) Fetch(username string, creds map[string]interface{}) error {
+	raw := make(map[string]interface{}, len(creds))
+	for ident := range creds {
+		raw[ident] = nil
+	}
+
+	err := cs.store.Fetch(username, raw)
+	e, ok := err.(*NotFoundError)
+
+	if err != nil && (!ok || e.Err != nil) {
+		return err
+	}
+
+	missing := make(map[string]struct{})
+	if e != nil {
+		for _, ident := range e.Identifiers {
+			missing[ident] = struct{}{}
+		}
+	}
+
+	for ident, v := range creds {
+		if _, ok := missing[ident]; ok {
+			continue
+		}
+
+		if err := cs.decode(raw[ident], v, creds, ident); err != nil {
+			cs.Log.Warning("failed to decode credential data for %q: %s", ident, err)
+
+			missing[ident] = struct{}{}
+		}
+	}
+
+	if len(missing) != 0 {
+		idents := make([]string, 0, len(missing))
+		for ident := range missing {
+			idents = append(idents, ident)
+		}
+
+		return &NotFoundError{
+			Identifiers: idents,
+		}
+	}
+
+	return nil
+}
+
+func (cs *cryptStore) decode(raw, v interface{}, creds map[string]interface{}, ident string) error {
+	if env, ok := ParseEnvelope(raw); ok {
+		p, err := env.Open(cs.KeyProvider, ident)
+		if err != nil {
+			return err
+		}
+
+		if v == nil {
+			var m map[string]interface{}
+			if err := json.Unmarshal(p, &m); err != nil {
+				return err
+			}
+
+			creds[ident] = m
+			return nil
+		}
+
+		raw = p
+	}
+
+	if v == nil {
+		creds[ident] = raw
+		return nil
+	}
+
+	if err := cs.objectBuilder().Decode(raw, v); err != nil {
+		return err
+	}
+
+	if validator, ok := v.(stack.Validator); ok {
+		if err := validator.Valid(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (cs *cryptStore) Put(username string, creds map[string]interface{}) error {
+	sealed := make(map[string]interface{}, len(creds))
+
+	for ident, data := range creds {
+		env, err := Seal(cs.KeyProvider, ident, data)
+		if err != nil {
+			return fmt.Errorf("%q: unable to encrypt: %s", ident, err)
+		}
+
+		sealed[ident] = env.value()
+	}
+
+	return cs.store.Put(username, sealed)
+}
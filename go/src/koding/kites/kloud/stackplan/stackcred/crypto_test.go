@@ -0,0 +1,225 @@
+package stackcred_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"koding/kites/kloud/stackplan/stackcred"
+
+	"github.com/koding/logging"
+)
+
+type testCred struct {
+	AccessKey string `json:"access_key" hcl:"access_key"`
+	SecretKey string `json:"secret_key" hcl:"secret_key"`
+}
+
+func newKeyfile(t *testing.T) *stackcred.Keyfile {
+	kf, err := stackcred.NewKeyfile()
+	if err != nil {
+		t.Fatalf("NewKeyfile()=%s", err)
+	}
+	return kf
+}
+
+func TestKeyfileRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stackcred")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "keyfile.json")
+
+	kf := newKeyfile(t)
+
+	old, err := stackcred.Seal(kf, "cred", &testCred{AccessKey: "access", SecretKey: "secret"})
+	if err != nil {
+		t.Fatalf("Seal()=%s", err)
+	}
+
+	id, err := kf.Rotate()
+	if err != nil {
+		t.Fatalf("Rotate()=%s", err)
+	}
+
+	if id == old.KeyID || kf.KeyID() != id {
+		t.Fatalf("got key %q (current %q), want new key different than %q", id, kf.KeyID(), old.KeyID)
+	}
+
+	if err := kf.WriteFile(path); err != nil {
+		t.Fatalf("WriteFile()=%s", err)
+	}
+
+	kf, err = stackcred.ReadKeyfile(path)
+	if err != nil {
+		t.Fatalf("ReadKeyfile()=%s", err)
+	}
+
+	if kf.KeyID() != id {
+		t.Fatalf("got %q, want %q", kf.KeyID(), id)
+	}
+
+	p, err := old.Open(kf, "cred")
+	if err != nil {
+		t.Fatalf("Open()=%s", err)
+	}
+
+	if want := `{"access_key":"access","secret_key":"secret"}`; string(p) != want {
+		t.Fatalf("got %s, want %s", p, want)
+	}
+
+	if _, err := old.Open(newKeyfile(t), "cred"); err == nil {
+		t.Fatal("expected Open to fail with unknown key")
+	}
+
+	if _, err := old.Open(kf, "other-cred"); err == nil {
+		t.Fatal("expected Open to fail for other credential")
+	}
+}
+
+func TestKeyfileReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stackcred")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "keyfile.json")
+
+	if err := newKeyfile(t).WriteFile(path); err != nil {
+		t.Fatalf("WriteFile()=%s", err)
+	}
+
+	// running service
+	kf, err := stackcred.ReadKeyfile(path)
+	if err != nil {
+		t.Fatalf("ReadKeyfile()=%s", err)
+	}
+
+	// kloudctl credential-rotate -new-key
+	rotated, err := stackcred.ReadKeyfile(path)
+	if err != nil {
+		t.Fatalf("ReadKeyfile()=%s", err)
+	}
+
+	id, err := rotated.Rotate()
+	if err != nil {
+		t.Fatalf("Rotate()=%s", err)
+	}
+
+	if err := rotated.WriteFile(path); err != nil {
+		t.Fatalf("WriteFile()=%s", err)
+	}
+
+	env, err := stackcred.Seal(rotated, "cred", &testCred{AccessKey: "access", SecretKey: "secret"})
+	if err != nil {
+		t.Fatalf("Seal()=%s", err)
+	}
+
+	if _, err := env.Open(kf, "cred"); err != nil {
+		t.Fatalf("Open()=%s", err)
+	}
+
+	if kf.KeyID() != id {
+		t.Fatalf("got %q, want %q", kf.KeyID(), id)
+	}
+}
+
+func TestCryptStore(t *testing.T) {
+	kf := newKeyfile(t)
+	creds := Creds{}
+
+	opts := &stackcred.StoreOptions{
+		Log:         logging.NewLogger("test"),
+		KeyProvider: kf,
+	}
+
+	s := stackcred.NewCryptStore(creds, opts)
+
+	want := &testCred{AccessKey: "access", SecretKey: "secret"}
+
+	if err := s.Put("user", map[string]interface{}{"cred1": want}); err != nil {
+		t.Fatalf("Put()=%s", err)
+	}
+
+	if _, ok := stackcred.ParseEnvelope(creds["cred1"]); !ok {
+		t.Fatalf("want data value to be encrypted, got %+v", creds["cred1"])
+	}
+
+	// plaintext value, stored before encryption was enabled
+	creds["cred2"] = map[string]interface{}{
+		"access_key": "access2",
+		"secret_key": "secret2",
+	}
+
+	got1, got2 := &testCred{}, &testCred{}
+
+	if err := s.Fetch("user", map[string]interface{}{"cred1": got1, "cred2": got2}); err != nil {
+		t.Fatalf("Fetch()=%s", err)
+	}
+
+	if !reflect.DeepEqual(got1, want) {
+		t.Fatalf("got %+v, want %+v", got1, want)
+	}
+
+	if want2 := (&testCred{AccessKey: "access2", SecretKey: "secret2"}); !reflect.DeepEqual(got2, want2) {
+		t.Fatalf("got %+v, want %+v", got2, want2)
+	}
+
+	raw := map[string]interface{}{"cred1": nil}
+
+	if err := s.Fetch("user", raw); err != nil {
+		t.Fatalf("Fetch()=%s", err)
+	}
+
+	wantRaw := map[string]interface{}{
+		"access_key": "access",
+		"secret_key": "secret",
+	}
+
+	if !reflect.DeepEqual(raw["cred1"], wantRaw) {
+		t.Fatalf("got %+v, want %+v", raw["cred1"], wantRaw)
+	}
+
+	// data value encrypted with unknown key is reported missing
+	other := stackcred.NewCryptStore(creds, &stackcred.StoreOptions{
+		Log:         logging.NewLogger("test"),
+		KeyProvider: newKeyfile(t),
+	})
+
+	err, ok := other.Fetch("user", map[string]interface{}{"cred1": &testCred{}, "cred2": &testCred{}}).(*stackcred.NotFoundError)
+	if !ok {
+		t.Fatalf("expected err to be NotFoundError, was %T", err)
+	}
+
+	if len(err.Identifiers) != 1 || err.Identifiers[0] != "cred1" {
+		t.Fatalf(`expected err.Identifiers=["cred1"]; got %v`, err.Identifiers)
+	}
+
+	// data value copied from other credential is reported missing
+	creds["cred3"] = creds["cred1"]
+
+	err, ok = s.Fetch("user", map[string]interface{}{"cred3": &testCred{}}).(*stackcred.NotFoundError)
+	if !ok {
+		t.Fatalf("expected err to be NotFoundError, was %T", err)
+	}
+
+	if len(err.Identifiers) != 1 || err.Identifiers[0] != "cred3" {
+		t.Fatalf(`expected err.Identifiers=["cred3"]; got %v`, err.Identifiers)
+	}
+}
+
+func TestReencryptSocialStore(t *testing.T) {
+	opts := &stackcred.ReencryptOptions{
+		KeyProvider: newKeyfile(t),
+		CredURL:     "http://localhost:7000/api/social/credential",
+	}
+
+	if _, err := stackcred.Reencrypt(opts); err != stackcred.ErrSocialStore {
+		t.Fatalf("got %v, want %v", err, stackcred.ErrSocialStore)
+	}
+}
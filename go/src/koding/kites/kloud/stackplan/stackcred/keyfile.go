@@ -0,0 +1,255 @@
+package stackcred
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// Keyfile is a KeyProvider, which keeps versioned AES-256 keys
+// in a local JSON file:
+//
+//	{
+//	  "current": "2",
+//	  "keys": {
+//	    "1": "<base64-encoded key>",
+//	    "2": "<base64-encoded key>"
+//	  }
+//	}
+//
+// Keys are never removed from the file by Rotate, so envelopes
+// encrypted with older keys are still readable.
+//
+// Keyfile read with ReadKeyfile is reloaded when it is asked to decrypt
+// with a key it does not know, so running services pick up keys added
+// to the file by other processes, e.g. kloudctl credential-rotate.
+type Keyfile struct {
+	Current string            `json:"current"`
+	Keys    map[string][]byte `json:"keys"`
+
+	mu   sync.RWMutex
+	path string // set when read from a file
+}
+
+var _ KeyProvider = (*Keyfile)(nil)
+
+// NewKeyfile gives new keyfile with a single, randomly generated key.
+func NewKeyfile() (*Keyfile, error) {
+	kf := &Keyfile{
+		Keys: make(map[string][]byte),
+	}
+
+	if _, err := kf.Rotate(); err != nil {
+		return nil, err
+	}
+
+	return kf, nil
+}
+
+// ReadKeyfile reads keyfile from the given path.
+func ReadKeyfile(path string) (*Keyfile, error) {
+	p, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	kf := &Keyfile{
+		path: path,
+	}
+
+	if err := json.Unmarshal(p, kf); err != nil {
+		return nil, fmt.Errorf("unable to read keyfile %q: %s", path, err)
+	}
+
+	if err := kf.valid(); err != nil {
+		return nil, fmt.Errorf("invalid keyfile %q: %s", path, err)
+	}
+
+	return kf, nil
+}
+
+// WriteFile atomically writes keyfile to the given path.
+func (kf *Keyfile) WriteFile(path string) error {
+	kf.mu.RLock()
+	p, err := json.MarshalIndent(kf, "", "\t")
+	kf.mu.RUnlock()
+
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(filepath.Split(path))
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(p); err != nil {
+		return nonil(err, f.Close(), os.Remove(f.Name()))
+	}
+
+	if err := nonil(f.Chmod(0600), f.Sync(), f.Close()); err != nil {
+		return nonil(err, os.Remove(f.Name()))
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		return nonil(err, os.Remove(f.Name()))
+	}
+
+	return nil
+}
+
+// Rotate generates a new key and makes it the current one.
+// It returns the identifier of the new key.
+func (kf *Keyfile) Rotate() (string, error) {
+	key := make([]byte, 32)
+
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+
+	kf.mu.Lock()
+	defer kf.mu.Unlock()
+
+	var max int
+	for id := range kf.Keys {
+		if n, err := strconv.Atoi(id); err == nil && n > max {
+			max = n
+		}
+	}
+
+	if kf.Keys == nil {
+		kf.Keys = make(map[string][]byte)
+	}
+
+	id := strconv.Itoa(max + 1)
+
+	kf.Keys[id] = key
+	kf.Current = id
+
+	return id, nil
+}
+
+// KeyID implements the KeyProvider interface.
+func (kf *Keyfile) KeyID() string {
+	kf.mu.RLock()
+	defer kf.mu.RUnlock()
+
+	return kf.Current
+}
+
+// Encrypt implements the KeyProvider interface.
+func (kf *Keyfile) Encrypt(dataKey []byte) (string, []byte, error) {
+	kf.mu.RLock()
+	id, key := kf.Current, kf.Keys[kf.Current]
+	kf.mu.RUnlock()
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", nil, err
+	}
+
+	return id, gcm.Seal(nonce, nonce, dataKey, []byte(id)), nil
+}
+
+// Decrypt implements the KeyProvider interface.
+func (kf *Keyfile) Decrypt(keyID string, ciphertext []byte) ([]byte, error) {
+	key, ok := kf.key(keyID)
+
+	if !ok {
+		if err := kf.reload(); err != nil {
+			return nil, fmt.Errorf("key %q not found: %s", keyID, err)
+		}
+
+		key, ok = kf.key(keyID)
+	}
+
+	if !ok {
+		return nil, fmt.Errorf("key %q not found", keyID)
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ciphertext) < gcm.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+
+	n := gcm.NonceSize()
+
+	return gcm.Open(nil, ciphertext[:n], ciphertext[n:], []byte(keyID))
+}
+
+func (kf *Keyfile) key(keyID string) ([]byte, bool) {
+	kf.mu.RLock()
+	defer kf.mu.RUnlock()
+
+	key, ok := kf.Keys[keyID]
+	return key, ok
+}
+
+// reload reads the keys again from the file. Keys already known
+// are kept, even when they are not in the file anymore.
+func (kf *Keyfile) reload() error {
+	if kf.path == "" {
+		return nil
+	}
+
+	newKf, err := ReadKeyfile(kf.path)
+	if err != nil {
+		return err
+	}
+
+	kf.mu.Lock()
+	defer kf.mu.Unlock()
+
+	for id, key := range newKf.Keys {
+		kf.Keys[id] = key
+	}
+
+	kf.Current = newKf.Current
+
+	return nil
+}
+
+func (kf *Keyfile) valid() error {
+	if len(kf.Keys) == 0 {
+		return errors.New("no keys")
+	}
+
+	if _, ok := kf.Keys[kf.Current]; !ok {
+		return fmt.Errorf("current key %q not found", kf.Current)
+	}
+
+	for id, key := range kf.Keys {
+		if len(key) != 32 {
+			return fmt.Errorf("key %q is not 32 bytes long", id)
+		}
+	}
+
+	return nil
+}
+
+func nonil(err ...error) error {
+	for _, e := range err {
+		if e != nil {
+			return e
+		}
+	}
+
+	return nil
+}
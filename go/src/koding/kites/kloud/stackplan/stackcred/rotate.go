@@ -0,0 +1,155 @@
+package stackcred
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"koding/db/models"
+	"koding/db/mongodb"
+	"koding/db/mongodb/modelhelper"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/koding/logging"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// ReencryptOptions configures Reencrypt.
+type ReencryptOptions struct {
+	MongoDB     *mongodb.MongoDB
+	KeyProvider KeyProvider
+	Log         logging.Logger
+
+	// CredURL is the socialapi credential endpoint kloud is configured
+	// with, if any. Credentials kept there can't be iterated over,
+	// thus Reencrypt refuses to run when it is set.
+	CredURL string
+
+	// DryRun, when true, makes Reencrypt only count the credentials
+	// that would be re-encrypted.
+	DryRun bool
+}
+
+// ErrSocialStore is returned by Reencrypt when credentials are kept
+// in socialapi instead of jCredentialDatas.
+var ErrSocialStore = errors.New("re-encrypting credentials kept in socialapi is not supported")
+
+// ReencryptResult summarizes a single Reencrypt run.
+type ReencryptResult struct {
+	Total       int // number of all credential data values
+	Reencrypted int // encrypted with an older key and re-encrypted
+	Encrypted   int // stored as plaintext and encrypted
+}
+
+// Reencrypt re-encrypts in place all credential data values stored
+// in jCredentialDatas, that are encrypted with a key other than the
+// current one of opts.KeyProvider. Values stored as plaintext are
+// encrypted as well.
+//
+// It is used to rotate keys: after the key provider is configured with
+// a new current key, Reencrypt ensures no data values are encrypted
+// with the old keys, so they can be removed.
+//
+// Only jCredentialDatas is covered - when kloud keeps credentials
+// in socialapi (see StoreOptions.CredURL), Reencrypt fails with
+// ErrSocialStore, as old keys can't be safely removed.
+//
+// Failures of single data values do not stop the run, they are
+// returned as a multierror after all values were processed.
+func Reencrypt(opts *ReencryptOptions) (*ReencryptResult, error) {
+	if opts.CredURL != "" {
+		return nil, ErrSocialStore
+	}
+
+	var (
+		res   ReencryptResult
+		errs  error
+		keyID = opts.KeyProvider.KeyID()
+	)
+
+	iter := opts.MongoDB.GetIter(modelhelper.CredentialDatasColl, func(c *mgo.Collection) *mgo.Query {
+		return c.Find(nil)
+	})
+
+	for {
+		var data models.CredentialData
+
+		if !iter.Next(&data) {
+			break
+		}
+
+		res.Total++
+
+		p, oldKeyID, err := plaintext(opts.KeyProvider, data.Identifier, data.Meta)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("%q: %s", data.Identifier, err))
+			continue
+		}
+
+		if p == nil {
+			continue // up to date
+		}
+
+		// The selector ensures values updated concurrently
+		// with the run are not overwritten.
+		selector := bson.M{"_id": data.Id}
+
+		if oldKeyID != "" {
+			res.Reencrypted++
+			selector["meta."+EnvelopeKey+".keyId"] = oldKeyID
+		} else {
+			res.Encrypted++
+			selector["meta."+EnvelopeKey] = bson.M{"$exists": false}
+		}
+
+		if opts.DryRun {
+			continue
+		}
+
+		env, err := seal(opts.KeyProvider, data.Identifier, p)
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("%q: %s", data.Identifier, err))
+			continue
+		}
+
+		err = opts.MongoDB.Run(modelhelper.CredentialDatasColl, func(c *mgo.Collection) error {
+			return c.Update(selector, bson.M{"$set": bson.M{"meta": env.value()}})
+		})
+
+		if err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("%q: %s", data.Identifier, err))
+			continue
+		}
+
+		if opts.Log != nil {
+			opts.Log.Debug("re-encrypted credential data for %q with key %q", data.Identifier, keyID)
+		}
+	}
+
+	if err := iter.Close(); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+
+	return &res, errs
+}
+
+// plaintext gives JSON representation of the meta value if it requires
+// (re-)encryption with the current key of kp, or nil otherwise.
+//
+// If the meta value is already encrypted, the identifier of its
+// key is returned as well.
+func plaintext(kp KeyProvider, ident string, meta bson.M) (p []byte, keyID string, err error) {
+	env, ok := ParseEnvelope(meta)
+	if !ok {
+		p, err = json.Marshal(meta)
+		return p, "", err
+	}
+
+	if env.KeyID == kp.KeyID() {
+		return nil, env.KeyID, nil
+	}
+
+	p, err = env.Open(kp, ident)
+	return p, env.KeyID, err
+}
@@ -72,6 +72,10 @@ type StoreOptions struct {
 	CredURL       *url.URL
 	ObjectBuilder *object.Builder
 	Client        *http.Client
+
+	// KeyProvider, when non-nil, is used to keep credential data
+	// values encrypted in the store.
+	KeyProvider KeyProvider
 }
 
 func (opts *StoreOptions) objectBuilder() *object.Builder {
@@ -92,16 +96,28 @@ func (opts *StoreOptions) new(logName string) *StoreOptions {
 // NewStore gives new credential store for the given options.
 //
 // The returned Store keeps all credentials encrypted in Sneaker.
+//
+// If opts.KeyProvider is non-nil, the credential data values are
+// additionally encrypted with envelope encryption before they are
+// put to the store.
 func NewStore(opts *StoreOptions) Store {
+	var s Store
+
 	if opts.CredURL == nil {
-		return &mongoStore{
+		s = &mongoStore{
 			StoreOptions: opts.new("mongo"),
 		}
+	} else {
+		s = &socialStore{
+			StoreOptions: opts.new("social"),
+		}
 	}
 
-	return &socialStore{
-		StoreOptions: opts.new("social"),
+	if opts.KeyProvider != nil {
+		s = NewCryptStore(s, opts.new("crypt"))
 	}
+
+	return s
 }
 
 // MigratingStore creates a Store that on Fetch tries to fetch
@@ -26,11 +26,13 @@ var defaultLog = logging.NewCustom("stackplan", false)
 
 // credPermissions defines the permission grid for the given method
 var credPermissions = map[string][]string{
-	"bootstrap":    []string{"owner"},
-	"plan":         []string{"user", "owner"},
-	"apply":        []string{"user", "owner"},
-	"authenticate": []string{"user", "owner"},
-	"migrate":      []string{"owner"},
+	"bootstrap":      []string{"owner"},
+	"plan":           []string{"user", "owner"},
+	"apply":          []string{"user", "owner"},
+	"authenticate":   []string{"user", "owner"},
+	"migrate":        []string{"owner"},
+	"stack.rollback": []string{"user", "owner"},
+	"stack.validate": []string{"user", "owner"},
 }
 
 // Machine represents a jComputeStack.machine value.
@@ -124,6 +126,12 @@ type Stack struct {
 	// Template is a raw Terraform template.
 	Template string
 
+	// TemplateID is a jStackTemplate._id the stack is built from.
+	TemplateID string
+
+	// Revision is a revision of the Template.
+	Revision string
+
 	// Stack is a jComputeStack value.
 	Stack *models.ComputeStack
 }
@@ -395,6 +403,29 @@ func parseResource(resource string) (string, string, string, error) {
 	return provider, resourceType, label, nil
 }
 
+// ResourceLabels gives labels of all the resources present in the
+// given state, e.g. "foo" for the "aws_instance.foo" resource.
+func ResourceLabels(state *terraform.State) map[string]bool {
+	labels := make(map[string]bool)
+
+	for _, m := range state.Modules {
+		for resource, r := range m.Resources {
+			if r.Primary == nil {
+				continue
+			}
+
+			_, _, label, err := parseResource(resource)
+			if err != nil {
+				continue
+			}
+
+			labels[label] = true
+		}
+	}
+
+	return labels
+}
+
 // isVariable checkes whether the given string is a template variable, such as:
 // "${var.region}"
 func IsVariable(v string) bool {
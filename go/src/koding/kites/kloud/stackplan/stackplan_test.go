@@ -0,0 +1,39 @@
+package stackplan_test
+
+import (
+	"reflect"
+	"testing"
+
+	"koding/kites/kloud/stackplan"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestResourceLabels(t *testing.T) {
+	state := &terraform.State{
+		Modules: []*terraform.ModuleState{{
+			Resources: map[string]*terraform.ResourceState{
+				"aws_instance.foo": {
+					Primary: &terraform.InstanceState{ID: "i-123"},
+				},
+				"aws_instance.bar": {
+					// tainted or not yet created resource
+				},
+				"aws_security_group.baz": {
+					Primary: &terraform.InstanceState{ID: "sg-123"},
+				},
+			},
+		}},
+	}
+
+	want := map[string]bool{
+		"foo": true,
+		"baz": true,
+	}
+
+	got := stackplan.ResourceLabels(state)
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
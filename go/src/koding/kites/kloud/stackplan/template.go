@@ -102,10 +102,29 @@ func (t *Template) Flush() error {
 }
 
 func (t *Template) decode(resource string, out interface{}) error {
-	obj := t.node.Filter(resource)
+	obj := expandItems(t.node.Filter(resource))
 	return hcl.DecodeObject(out, obj)
 }
 
+// expandItems replaces keyless items with items of their object values.
+//
+// Filtering a block, which holds a list of objects - e.g. a list
+// of aliased providers - gives a keyless item, which hcl is not able
+// to decode into a map.
+func expandItems(list *ast.ObjectList) *ast.ObjectList {
+	expanded := &ast.ObjectList{}
+
+	for _, item := range list.Items {
+		if obj, ok := item.Val.(*ast.ObjectType); ok && len(item.Keys) == 0 {
+			expanded.Items = append(expanded.Items, obj.List.Items...)
+		} else {
+			expanded.Items = append(expanded.Items, item)
+		}
+	}
+
+	return expanded
+}
+
 func (t *Template) String() string {
 	out, err := t.JsonOutput()
 	if err != nil {
@@ -3,16 +3,26 @@ package terraformer
 import (
 	"fmt"
 	"koding/kites/terraformer"
+	"koding/kites/terraformer/kodingcontext"
+	"koding/kites/terraformer/storage"
 	"time"
 
 	"github.com/hashicorp/terraform/terraform"
 	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
 )
 
 // Terraformer represents a remote terraformer instance.
 type Terraformer struct {
 	Client *kite.Client
-	kite   *kite.Kite
+
+	// Timeout is a maximum duration of apply and destroy operations,
+	// after which they are canceled. If zero, there's no timeout.
+	//
+	// It is initialized with Options.Timeout.
+	Timeout time.Duration
+
+	kite *kite.Kite
 }
 
 // Options are used to connect to a terraformer kite.
@@ -20,6 +30,10 @@ type Options struct {
 	Endpoint  string
 	SecretKey string
 	Kite      *kite.Kite
+
+	// Timeout is a maximum duration of apply and destroy operations,
+	// after which they are canceled. If zero, there's no timeout.
+	Timeout time.Duration
 }
 
 // Connect connects to a remote terraformer instance with the given kite instance.
@@ -39,11 +53,26 @@ func Connect(opts *Options) (*Terraformer, error) {
 	<-connected
 
 	return &Terraformer{
-		kite:   opts.Kite,
-		Client: tfKite,
+		kite:    opts.Kite,
+		Client:  tfKite,
+		Timeout: opts.Timeout,
 	}, nil
 }
 
+// OutputCallback gives a callback for the TerraformRequest.Output field,
+// which passes each line of terraform output to the given func.
+func OutputCallback(fn func(*terraformer.Output)) dnode.Function {
+	return dnode.Callback(func(r *dnode.Partial) {
+		var out terraformer.Output
+
+		if err := r.One().Unmarshal(&out); err != nil {
+			return
+		}
+
+		fn(&out)
+	})
+}
+
 func (t *Terraformer) Close() {
 	t.Client.Close()
 }
@@ -63,7 +92,7 @@ func (t *Terraformer) Plan(req *terraformer.TerraformRequest) (*terraform.Plan,
 }
 
 func (t *Terraformer) Apply(req *terraformer.TerraformRequest) (*terraform.State, error) {
-	resp, err := t.Client.Tell("apply", req)
+	resp, err := t.tell("apply", req)
 	if err != nil {
 		return nil, err
 	}
@@ -77,7 +106,56 @@ func (t *Terraformer) Apply(req *terraformer.TerraformRequest) (*terraform.State
 }
 
 func (t *Terraformer) Destroy(req *terraformer.TerraformRequest) (*terraform.State, error) {
-	resp, err := t.Client.Tell("destroy", req)
+	resp, err := t.tell("destroy", req)
+	if err != nil {
+		return nil, err
+	}
+
+	var state *terraform.State
+	if err := resp.Unmarshal(&state); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// Cancel stops an ongoing apply or destroy operation for the given content.
+//
+// If the operation is not run by this terraformer instance, it returns
+// kodingcontext.ErrNotRunning error.
+func (t *Terraformer) Cancel(contentID string) error {
+	_, err := t.Client.Tell("cancel", &terraformer.TerraformRequest{ContentID: contentID})
+	if e, ok := err.(*kite.Error); ok && e.Message == kodingcontext.ErrNotRunning.Error() {
+		return kodingcontext.ErrNotRunning
+	}
+
+	return err
+}
+
+// States lists stored versions of the state for the given content.
+func (t *Terraformer) States(contentID string) ([]*storage.StateVersion, error) {
+	resp, err := t.Client.Tell("state.list", &terraformer.StateRequest{ContentID: contentID})
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []*storage.StateVersion
+	if err := resp.Unmarshal(&versions); err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// State fetches the given version of the state for the given content.
+// If version is 0, the latest stored state is fetched.
+func (t *Terraformer) State(contentID string, version int) (*terraform.State, error) {
+	req := &terraformer.StateRequest{
+		ContentID: contentID,
+		Version:   version,
+	}
+
+	resp, err := t.Client.Tell("state.get", req)
 	if err != nil {
 		return nil, err
 	}
@@ -90,6 +168,37 @@ func (t *Terraformer) Destroy(req *terraformer.TerraformRequest) (*terraform.Sta
 	return state, nil
 }
 
+// tell calls the given long-running method, canceling it if it does
+// not finish within t.Timeout.
+func (t *Terraformer) tell(method string, req *terraformer.TerraformRequest) (*dnode.Partial, error) {
+	resp, err := t.Client.TellWithTimeout(method, t.Timeout, req)
+	if e, ok := err.(*kite.Error); ok && e.Type == "timeout" {
+		err = fmt.Errorf("terraform %s did not finish within %s", method, t.Timeout)
+
+		if e := t.Cancel(req.ContentID); e != nil {
+			err = fmt.Errorf("%s, unable to cancel it: %s", err, e)
+		}
+
+		return nil, err
+	}
+
+	if err != nil {
+		return nil, canceledErr(err)
+	}
+
+	return resp, nil
+}
+
+// canceledErr translates the remote error of a canceled operation
+// to kodingcontext.ErrCanceled.
+func canceledErr(err error) error {
+	if e, ok := err.(*kite.Error); ok && e.Message == kodingcontext.ErrCanceled.Error() {
+		return kodingcontext.ErrCanceled
+	}
+
+	return err
+}
+
 // Ping checks if the given terraformer response with "pong" to the "ping" we send.
 // A nil error means a successfull pong result.
 func (t *Terraformer) Ping() error {
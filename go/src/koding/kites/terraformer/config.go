@@ -1,5 +1,7 @@
 package terraformer
 
+import "time"
+
 // Config defines the configuration.
 type Config struct {
 	// Port
@@ -21,6 +23,14 @@ type Config struct {
 	// LocalStorePath stores base path for local store
 	LocalStorePath string `required:"true"`
 
+	// LockTTL is a time after which a state lock held by a crashed
+	// terraformer instance expires.
+	LockTTL time.Duration
+
+	// MongoURL is used to lock states kept in S3, which can't be
+	// locked with the storage alone.
+	MongoURL string
+
 	// SecretKey is used for kite-to-kite communication.
 	SecretKey string
 }
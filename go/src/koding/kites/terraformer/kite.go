@@ -30,6 +30,11 @@ func NewKite(t *Terraformer, conf *Config) (*kite.Kite, error) {
 	k.HandleFunc("apply", t.Apply)
 	k.HandleFunc("destroy", t.Destroy)
 	k.HandleFunc("plan", t.Plan)
+	k.HandleFunc("cancel", t.Cancel)
+
+	// State history
+	k.HandleFunc("state.list", t.States)
+	k.HandleFunc("state.get", t.State)
 
 	// artifact handling
 	k.HandleHTTPFunc("/healthCheck", artifact.HealthCheckHandler(Name))
@@ -21,11 +21,35 @@ func (c *KodingContext) Apply(content io.Reader, destroy bool) (*terraform.State
 	cmd.Destroy = destroy
 
 	paths, err := c.run(cmd, content, destroy, c.populateApplyArgs)
+	if c.Canceled() {
+		return c.partialState()
+	}
+
 	if err != nil {
 		return nil, err
 	}
 
-	stateFile, err := os.Open(paths.statePath)
+	return readState(paths.statePath)
+}
+
+// partialState reads the state left by a canceled operation, so
+// the resources created before the cancellation can be tracked.
+func (c *KodingContext) partialState() (*terraform.State, error) {
+	paths, err := c.paths()
+	if err != nil {
+		return nil, ErrCanceled
+	}
+
+	state, err := readState(paths.statePath)
+	if err != nil {
+		return nil, ErrCanceled
+	}
+
+	return state, ErrCanceled
+}
+
+func readState(path string) (*terraform.State, error) {
+	stateFile, err := os.Open(path)
 	if err != nil {
 		return nil, err
 	}
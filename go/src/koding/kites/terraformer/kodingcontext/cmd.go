@@ -36,9 +36,11 @@ func (c *KodingContext) run(cmd cli.Command, content io.Reader, destroy bool, ar
 	}
 
 	// copy all contents from local to remote for later operating
-	e := c.LocalStorage.Clone(c.ContentID, c.RemoteStorage)
-	if e != nil && err == nil {
-		err = e
+	if !c.DryRun {
+		e := c.LocalStorage.Clone(c.ContentID, c.RemoteStorage)
+		if e != nil && err == nil {
+			err = e
+		}
 	}
 
 	if err != nil {
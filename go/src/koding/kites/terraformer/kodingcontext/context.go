@@ -26,12 +26,24 @@ const (
 
 var (
 	shutdownChans   map[string]chan struct{}
+	canceled        map[string]bool
 	shutdownChansMu sync.Mutex
 	shutdownChansWG sync.WaitGroup
 )
 
+var (
+	// ErrNotRunning is returned by Cancel when there is no ongoing
+	// operation for the given content.
+	ErrNotRunning = errors.New("no operation is running for the content")
+
+	// ErrCanceled is returned by Apply when the operation was
+	// stopped with Cancel.
+	ErrCanceled = errors.New("operation was canceled")
+)
+
 type Context interface {
 	Get(string, string) (*KodingContext, error)
+	Cancel(string) error
 	Shutdown() error
 }
 
@@ -68,6 +80,7 @@ func New(ls, rs storage.Interface, log logging.Logger, debug bool) (*context, er
 	}
 
 	shutdownChans = make(map[string]chan struct{})
+	canceled = make(map[string]bool)
 
 	return c, nil
 }
@@ -106,6 +119,28 @@ func (c *context) BroadcastForceShutdown() {
 	shutdownChansMu.Unlock()
 }
 
+// Cancel requests the ongoing operation of the given content to stop.
+// Terraform finishes the resources it is currently working on and
+// stops, the state of already processed resources is preserved.
+func (c *context) Cancel(contentID string) error {
+	shutdownChansMu.Lock()
+	defer shutdownChansMu.Unlock()
+
+	shutdownChan, ok := shutdownChans[contentID]
+	if !ok {
+		return ErrNotRunning
+	}
+
+	canceled[contentID] = true
+
+	select {
+	case shutdownChan <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
 // Shutdown shutsdown koding context
 func (c *context) Shutdown() error {
 	shutdown := make(chan struct{}, 1)
@@ -150,7 +185,9 @@ func (c *context) createShutdownChan(contentID string) (<-chan struct{}, error)
 		return nil, errors.New("content is already locked")
 	}
 
-	resultCh := make(chan struct{})
+	// Buffered, so a cancel request sent before terraform starts
+	// listening on the channel is not lost.
+	resultCh := make(chan struct{}, 1)
 
 	shutdownChans[contentID] = resultCh
 	shutdownChansWG.Add(1)
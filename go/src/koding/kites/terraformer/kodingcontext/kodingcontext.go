@@ -37,14 +37,28 @@ type KodingContext struct {
 	context
 
 	Buffer       *bytes.Buffer
-	ui           *cli.PrefixedUi
+	ui           cli.Ui
 	Variables    map[string]string
 	ShutdownChan <-chan struct{}
 	ContentID    string
 
+	// DryRun, when true, does not persist the content and the results
+	// of the operation to the remote storage. It is used for planning
+	// changes against a stored state, without modifying it.
+	DryRun bool
+
 	debug bool
 }
 
+// SetOutput makes the context pass each line of terraform output
+// to the given func, as the operation progresses.
+func (c *KodingContext) SetOutput(fn OutputFunc) {
+	c.ui = &outputUi{
+		Ui: c.ui,
+		fn: fn,
+	}
+}
+
 // TerraformContextOpts creates a basic context options for terraform itself
 func (c *KodingContext) TerraformContextOpts() *terraform.ContextOpts {
 	return c.TerraformContextOptsWithPlan(nil)
@@ -72,6 +86,15 @@ func (c *KodingContext) TerraformContextOptsWithPlan(p *terraform.Plan) *terrafo
 	}
 }
 
+// Canceled tells whether the operation of the context was
+// requested to stop with Context.Cancel.
+func (c *KodingContext) Canceled() bool {
+	shutdownChansMu.Lock()
+	defer shutdownChansMu.Unlock()
+
+	return canceled[c.ContentID]
+}
+
 // Close terminates the existing context
 func (c *KodingContext) Close() error {
 	if c.ContentID == "" {
@@ -80,6 +103,7 @@ func (c *KodingContext) Close() error {
 
 	shutdownChansMu.Lock()
 	delete(shutdownChans, c.ContentID)
+	delete(canceled, c.ContentID)
 	shutdownChansWG.Done()
 	shutdownChansMu.Unlock()
 
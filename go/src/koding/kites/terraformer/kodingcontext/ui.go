@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strings"
 
 	"github.com/mitchellh/cli"
 )
@@ -43,3 +44,43 @@ func NewUI(w io.Writer, traceID string) *cli.PrefixedUi {
 		},
 	}
 }
+
+// OutputFunc is called with each line of terraform output.
+type OutputFunc func(line string, isErr bool)
+
+// outputUi passes each line of the output written to the underlying Ui
+// to the given func as well.
+type outputUi struct {
+	cli.Ui
+	fn OutputFunc
+}
+
+var _ cli.Ui = (*outputUi)(nil)
+
+func (u *outputUi) Output(message string) {
+	u.Ui.Output(message)
+	u.emit(message, false)
+}
+
+func (u *outputUi) Info(message string) {
+	u.Ui.Info(message)
+	u.emit(message, false)
+}
+
+func (u *outputUi) Warn(message string) {
+	u.Ui.Warn(message)
+	u.emit(message, false)
+}
+
+func (u *outputUi) Error(message string) {
+	u.Ui.Error(message)
+	u.emit(message, true)
+}
+
+func (u *outputUi) emit(message string, isErr bool) {
+	for _, line := range strings.Split(message, "\n") {
+		if line = strings.TrimRight(line, " \t\r"); line != "" {
+			u.fn(line, isErr)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package terraformer
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Output is a single line of terraform output, it is sent to the
+// TerraformRequest.Output callback while the operation progresses.
+type Output struct {
+	// Resource is a name of the resource the line refers to,
+	// e.g. "aws_instance.example". Empty for general output.
+	Resource string `json:"resource,omitempty"`
+
+	// Line is the output line, e.g. "aws_instance.example: Creating...".
+	Line string `json:"line"`
+
+	// Error is true when the line was written to terraform's error output.
+	Error bool `json:"error,omitempty"`
+}
+
+var resourceRe = regexp.MustCompile(`^(?:\* )?((?:module\.[^.\s:]+\.)*[a-z0-9_]+\.[^\s:]+): `)
+
+// NewOutput parses the given terraform output line.
+func NewOutput(line string, isErr bool) *Output {
+	out := &Output{
+		Line:  line,
+		Error: isErr,
+	}
+
+	if m := resourceRe.FindStringSubmatch(strings.TrimSpace(line)); m != nil {
+		out.Resource = m[1]
+	}
+
+	return out
+}
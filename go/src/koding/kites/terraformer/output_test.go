@@ -0,0 +1,52 @@
+package terraformer_test
+
+import (
+	"reflect"
+	"testing"
+
+	"koding/kites/terraformer"
+)
+
+func TestNewOutput(t *testing.T) {
+	cases := []struct {
+		line  string
+		isErr bool
+		want  *terraformer.Output
+	}{{
+		"aws_instance.example: Creating...",
+		false,
+		&terraformer.Output{Resource: "aws_instance.example", Line: "aws_instance.example: Creating..."},
+	}, {
+		"aws_instance.example.0: Still creating... (10s elapsed)",
+		false,
+		&terraformer.Output{Resource: "aws_instance.example.0", Line: "aws_instance.example.0: Still creating... (10s elapsed)"},
+	}, {
+		"module.vpc.aws_subnet.main: Creation complete",
+		false,
+		&terraformer.Output{Resource: "module.vpc.aws_subnet.main", Line: "module.vpc.aws_subnet.main: Creation complete"},
+	}, {
+		"* aws_instance.example: Error launching source instance: InvalidKeyPair.NotFound",
+		true,
+		&terraformer.Output{Resource: "aws_instance.example", Line: "* aws_instance.example: Error launching source instance: InvalidKeyPair.NotFound", Error: true},
+	}, {
+		"  ami: \"\" => \"ami-1234\"",
+		false,
+		&terraformer.Output{Line: "  ami: \"\" => \"ami-1234\""},
+	}, {
+		"Apply complete! Resources: 2 added, 0 changed, 0 destroyed.",
+		false,
+		&terraformer.Output{Line: "Apply complete! Resources: 2 added, 0 changed, 0 destroyed."},
+	}, {
+		"Error applying plan:",
+		true,
+		&terraformer.Output{Line: "Error applying plan:", Error: true},
+	}}
+
+	for i, cas := range cases {
+		got := terraformer.NewOutput(cas.line, cas.isErr)
+
+		if !reflect.DeepEqual(got, cas.want) {
+			t.Errorf("%d: got %+v, want %+v", i, got, cas.want)
+		}
+	}
+}
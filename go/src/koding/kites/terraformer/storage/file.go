@@ -82,6 +82,45 @@ func (f *File) Write(filePath string, file io.Reader) (err error) {
 	return nil
 }
 
+// CreateExclusive writes to a file with given path only if it does not
+// exist yet. Otherwise it fails with an error for which os.IsExist
+// returns true.
+func (f *File) CreateExclusive(filePath string, file io.Reader) error {
+	f.log.Debug("creating %q", filePath)
+
+	dirPath, err := f.fullPath(path.Dir(filePath))
+	if err != nil {
+		return f.errorf(err, "CreateExclusive: fullPath of %q failed", path.Dir(filePath))
+	}
+
+	if err := os.MkdirAll(dirPath, os.ModePerm); err != nil {
+		return f.errorf(err, "CreateExclusive: mkdir %q failed", dirPath)
+	}
+
+	fullPath, err := f.fullPath(filePath)
+	if err != nil {
+		return f.errorf(err, "CreateExclusive: fullPath of %q failed", filePath)
+	}
+
+	tf, err := os.OpenFile(fullPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if os.IsExist(err) {
+		return err // not logged, callers expect it
+	}
+	if err != nil {
+		return f.errorf(err, "CreateExclusive: creating %q failed", fullPath)
+	}
+
+	_, err = io.Copy(tf, file)
+
+	err = nonil(err, tf.Sync(), tf.Close())
+	if err != nil {
+		os.Remove(fullPath)
+		return f.errorf(err, "CreateExclusive: writing %q failed", fullPath)
+	}
+
+	return nil
+}
+
 // Remove removes the file from system
 func (f File) Remove(filePath string) error {
 	f.log.Debug("removing %q", filePath)
@@ -110,6 +149,9 @@ func (f *File) Read(filePath string) (io.Reader, error) {
 	}
 
 	r, err := os.Open(fullPath)
+	if os.IsNotExist(err) {
+		return nil, err // not logged, callers often expect it
+	}
 	if err != nil {
 		return nil, f.errorf(err, "Read: opening %q failed", fullPath)
 	}
@@ -163,6 +205,35 @@ func (f *File) Clone(filePath string, target Interface) error {
 	return nil
 }
 
+// List gives paths of files stored under the given directory. It does
+// not descend into subdirectories. If the directory does not exist,
+// List returns empty list.
+func (f *File) List(dirPath string) ([]string, error) {
+	fullPath, err := f.fullPath(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	fileInfos, err := ioutil.ReadDir(fullPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, f.errorf(err, "List: read %q dir failed", fullPath)
+	}
+
+	var files []string
+	for _, fileInfo := range fileInfos {
+		if fileInfo.IsDir() {
+			continue
+		}
+
+		files = append(files, path.Join(dirPath, fileInfo.Name()))
+	}
+
+	return files, nil
+}
+
 func (f *File) fullPath(filePath string) (string, error) {
 	dir, err := f.BasePath()
 	if err != nil {
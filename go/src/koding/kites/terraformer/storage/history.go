@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HistoryDir is a directory, relative to the storage base path, which
+// keeps snapshots of terraform states.
+const HistoryDir = "history"
+
+// ErrNoVersion is returned by History when the requested state version
+// does not exist.
+var ErrNoVersion = errors.New("state version does not exist")
+
+// StateVersion describes a single snapshot of a terraform state.
+type StateVersion struct {
+	ContentID string    `json:"contentId"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (v *StateVersion) path() string {
+	return path.Join(HistoryDir, v.ContentID, fmt.Sprintf("%08d.%d.tfstate", v.Version, v.CreatedAt.Unix()))
+}
+
+// History keeps versioned snapshots of terraform states.
+//
+// The snapshots are kept outside of content directories, so they are
+// not cloned to local storage when operating on a content.
+//
+// History does not synchronize concurrent writes for the same
+// content - the caller is expected to hold a state lock.
+type History struct {
+	Storage Interface
+}
+
+// Add stores the state as a next version for the given content.
+func (h *History) Add(contentID string, state io.Reader) (*StateVersion, error) {
+	versions, err := h.List(contentID)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &StateVersion{
+		ContentID: contentID,
+		Version:   1,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if n := len(versions); n != 0 {
+		v.Version = versions[n-1].Version + 1
+	}
+
+	if err := h.Storage.Write(v.path(), state); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// List gives all the stored versions of the content's state, sorted
+// from the oldest to the newest one.
+func (h *History) List(contentID string) ([]*StateVersion, error) {
+	files, err := h.Storage.List(path.Join(HistoryDir, contentID))
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]*StateVersion, 0, len(files))
+
+	for _, file := range files {
+		v, err := parseStateVersion(contentID, path.Base(file))
+		if err != nil {
+			continue // ignore files not written by History
+		}
+
+		versions = append(versions, v)
+	}
+
+	sort.Sort(byVersion(versions))
+
+	return versions, nil
+}
+
+// Read gives the state of the given version. If version is 0,
+// the latest version is read.
+//
+// Caller is responsible for closing the state.
+func (h *History) Read(contentID string, version int) (*StateVersion, io.Reader, error) {
+	versions, err := h.List(contentID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(versions) == 0 {
+		return nil, nil, ErrNoVersion
+	}
+
+	v := versions[len(versions)-1]
+
+	if version != 0 {
+		i := sort.Search(len(versions), func(i int) bool { return versions[i].Version >= version })
+		if i == len(versions) || versions[i].Version != version {
+			return nil, nil, ErrNoVersion
+		}
+
+		v = versions[i]
+	}
+
+	r, err := h.Storage.Read(v.path())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return v, r, nil
+}
+
+func parseStateVersion(contentID, name string) (*StateVersion, error) {
+	parts := strings.Split(name, ".")
+	if len(parts) != 3 || parts[2] != "tfstate" {
+		return nil, fmt.Errorf("invalid state file name: %q", name)
+	}
+
+	version, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StateVersion{
+		ContentID: contentID,
+		Version:   version,
+		CreatedAt: time.Unix(created, 0).UTC(),
+	}, nil
+}
+
+type byVersion []*StateVersion
+
+func (v byVersion) Len() int           { return len(v) }
+func (v byVersion) Less(i, j int) bool { return v[i].Version < v[j].Version }
+func (v byVersion) Swap(i, j int)      { v[i], v[j] = v[j], v[i] }
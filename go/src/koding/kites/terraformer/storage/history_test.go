@@ -0,0 +1,223 @@
+package storage_test
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"koding/kites/kloud/pkg/lease"
+	"koding/kites/terraformer/storage"
+
+	"github.com/koding/logging"
+)
+
+func newFile(t *testing.T) (*storage.File, func()) {
+	dir, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+
+	f, err := storage.NewFile(dir, logging.NewLogger("test"))
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatalf("NewFile()=%s", err)
+	}
+
+	return f, func() { os.RemoveAll(dir) }
+}
+
+func TestHistory(t *testing.T) {
+	f, cleanup := newFile(t)
+	defer cleanup()
+
+	h := &storage.History{Storage: f}
+
+	if _, _, err := h.Read("stack", 0); err != storage.ErrNoVersion {
+		t.Fatalf("got %v, want %v", err, storage.ErrNoVersion)
+	}
+
+	for _, state := range []string{"state-1", "state-2", "state-3"} {
+		if _, err := h.Add("stack", strings.NewReader(state)); err != nil {
+			t.Fatalf("Add(%q)=%s", state, err)
+		}
+	}
+
+	versions, err := h.List("stack")
+	if err != nil {
+		t.Fatalf("List()=%s", err)
+	}
+
+	if len(versions) != 3 {
+		t.Fatalf("got %d versions, want 3", len(versions))
+	}
+
+	for i, v := range versions {
+		if v.Version != i+1 {
+			t.Errorf("%d: got version %d, want %d", i, v.Version, i+1)
+		}
+	}
+
+	cases := map[int]string{
+		0: "state-3",
+		1: "state-1",
+		2: "state-2",
+	}
+
+	for version, want := range cases {
+		_, r, err := h.Read("stack", version)
+		if err != nil {
+			t.Fatalf("Read(%d)=%s", version, err)
+		}
+
+		p, err := ioutil.ReadAll(r)
+		r.(*os.File).Close()
+		if err != nil {
+			t.Fatalf("ReadAll()=%s", err)
+		}
+
+		if got := string(p); got != want {
+			t.Errorf("%d: got %q, want %q", version, got, want)
+		}
+	}
+
+	if _, _, err := h.Read("stack", 4); err != storage.ErrNoVersion {
+		t.Fatalf("got %v, want %v", err, storage.ErrNoVersion)
+	}
+}
+
+func TestLocker(t *testing.T) {
+	f, cleanup := newFile(t)
+	defer cleanup()
+
+	l := &storage.Locker{
+		Storage: f,
+		TTL:     time.Minute,
+		Log:     logging.NewLogger("test"),
+	}
+
+	lk, err := l.Lock("stack", "apply")
+	if err != nil {
+		t.Fatalf("Lock()=%s", err)
+	}
+
+	if _, err := l.Lock("stack", "destroy"); !storage.IsLocked(err) {
+		t.Fatalf("got %v, want LockedError", err)
+	}
+
+	other, err := l.Lock("other-stack", "plan")
+	if err != nil {
+		t.Fatalf("Lock()=%s", err)
+	}
+	defer other.Unlock()
+
+	if err := lk.Unlock(); err != nil {
+		t.Fatalf("Unlock()=%s", err)
+	}
+
+	lk, err = l.Lock("stack", "destroy")
+	if err != nil {
+		t.Fatalf("Lock()=%s", err)
+	}
+
+	if err := lk.Unlock(); err != nil {
+		t.Fatalf("Unlock()=%s", err)
+	}
+}
+
+func TestLockerExpired(t *testing.T) {
+	f, cleanup := newFile(t)
+	defer cleanup()
+
+	l := &storage.Locker{
+		Storage: f,
+		TTL:     time.Minute,
+		Log:     logging.NewLogger("test"),
+	}
+
+	expired := `{"id":"crashed","contentId":"stack","operation":"apply","expiresAt":"2000-01-01T00:00:00Z"}`
+
+	if err := f.Write("locks/stack.lock", strings.NewReader(expired)); err != nil {
+		t.Fatalf("Write()=%s", err)
+	}
+
+	lk, err := l.Lock("stack", "apply")
+	if err != nil {
+		t.Fatalf("Lock()=%s", err)
+	}
+
+	if err := lk.Unlock(); err != nil {
+		t.Fatalf("Unlock()=%s", err)
+	}
+}
+
+func TestLockerConcurrent(t *testing.T) {
+	f, cleanup := newFile(t)
+	defer cleanup()
+
+	// remote wraps file storage, hiding its exclusive creation,
+	// like S3 does.
+	remote := struct{ storage.Interface }{f}
+
+	if _, err := (&storage.Locker{Storage: remote}).Lock("stack", "apply"); err == nil {
+		t.Fatal("want error locking storage without leases")
+	}
+
+	expired := `{"id":"crashed","contentId":"stack","operation":"apply","expiresAt":"2000-01-01T00:00:00Z"}`
+
+	cases := map[string]*storage.Locker{
+		"file": {
+			Storage: f,
+			TTL:     time.Minute,
+			Log:     logging.NewLogger("test"),
+		},
+		"leases": {
+			Storage: remote,
+			Leases:  lease.NewMemory(),
+			TTL:     time.Minute,
+			Log:     logging.NewLogger("test"),
+		},
+	}
+
+	for name, l := range cases {
+		t.Run(name, func(t *testing.T) {
+			for _, init := range []string{"", expired} {
+				if init != "" {
+					if err := f.Write("locks/stack.lock", strings.NewReader(init)); err != nil {
+						t.Fatalf("Write()=%s", err)
+					}
+				}
+
+				var wg sync.WaitGroup
+				locks := make(chan *storage.Lock, 16)
+
+				for i := 0; i < cap(locks); i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+
+						lk, err := l.Lock("stack", "apply")
+						if err == nil {
+							locks <- lk
+						} else if !storage.IsLocked(err) {
+							t.Errorf("Lock()=%s", err)
+						}
+					}()
+				}
+
+				wg.Wait()
+				close(locks)
+
+				if n := len(locks); n != 1 {
+					t.Fatalf("got %d locks held, want 1", n)
+				}
+
+				if err := (<-locks).Unlock(); err != nil {
+					t.Fatalf("Unlock()=%s", err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,410 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"syscall"
+	"time"
+
+	"koding/kites/kloud/pkg/lease"
+
+	"github.com/koding/logging"
+)
+
+// LockDir is a directory, relative to the storage base path, which
+// keeps state locks.
+const LockDir = "locks"
+
+// DefaultLockTTL is used when Locker.TTL is zero.
+const DefaultLockTTL = 2 * time.Minute
+
+// LockInfo describes a state lock.
+type LockInfo struct {
+	ID        string    `json:"id"`
+	ContentID string    `json:"contentId"`
+	Operation string    `json:"operation"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// LockedError is returned by Locker when the state is already locked
+// by other operation.
+type LockedError struct {
+	Info *LockInfo
+}
+
+// Error implements the built-in error interface.
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("state of %q is locked by %q operation since %s",
+		e.Info.ContentID, e.Info.Operation, e.Info.CreatedAt.Format(time.RFC3339))
+}
+
+// IsLocked returns true if the err was caused by a state being
+// already locked.
+func IsLocked(err error) bool {
+	_, ok := err.(*LockedError)
+	return ok
+}
+
+// Locker provides exclusive locks for terraform states kept in the
+// storage, so it is safe to run multiple terraformer instances that
+// share the same remote storage.
+//
+// The lock is kept alive by the holder by refreshing it periodically,
+// so a lock left by a crashed instance expires after TTL.
+//
+// Locks are acquired atomically - File storage creates lock files
+// exclusively, storages that can't do that, like S3, require Leases
+// to be set.
+type Locker struct {
+	Storage Interface
+
+	// Leases is used to lock states kept in storages which
+	// do not support exclusive creation of files.
+	Leases lease.Backend
+
+	TTL time.Duration
+	Log logging.Logger
+}
+
+// Lock is a held state lock.
+type Lock struct {
+	LockInfo
+
+	locker  *Locker
+	backend lockBackend
+	once    sync.Once
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// lockBackend atomically manages lock of a single state.
+type lockBackend interface {
+	// acquire takes the lock, if it is held by other holder,
+	// it returns *LockedError.
+	acquire(info *LockInfo) error
+
+	// refresh extends the lock, it returns errLockLost if
+	// the lock is held by other holder.
+	refresh(info *LockInfo) error
+
+	// release releases the lock, it is a nop if the lock is
+	// held by other holder.
+	release(info *LockInfo) error
+}
+
+var errLockLost = errors.New("lock was taken over by other holder")
+
+// Lock locks the state of the given content. The operation is used
+// to describe the lock holder.
+func (l *Locker) Lock(contentID, operation string) (*Lock, error) {
+	backend, err := l.backend()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+
+	lk := &Lock{
+		LockInfo: LockInfo{
+			ID:        newLockID(),
+			ContentID: contentID,
+			Operation: operation,
+			CreatedAt: now,
+			ExpiresAt: now.Add(l.ttl()),
+		},
+		locker:  l,
+		backend: backend,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	if err := backend.acquire(&lk.LockInfo); err != nil {
+		return nil, err
+	}
+
+	go lk.refresh()
+
+	return lk, nil
+}
+
+// Unlock releases the lock. It is a nop if the lock was already
+// taken over by other holder after it expired.
+func (lk *Lock) Unlock() (err error) {
+	lk.once.Do(func() {
+		close(lk.stop)
+		<-lk.done
+
+		err = lk.backend.release(&lk.LockInfo)
+	})
+
+	return err
+}
+
+func (lk *Lock) refresh() {
+	defer close(lk.done)
+
+	t := time.NewTicker(lk.locker.ttl() / 3)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-lk.stop:
+			return
+		case <-t.C:
+			info := lk.LockInfo
+			info.ExpiresAt = time.Now().UTC().Add(lk.locker.ttl())
+
+			switch err := lk.backend.refresh(&info); err {
+			case nil:
+				lk.ExpiresAt = info.ExpiresAt
+			case errLockLost:
+				lk.locker.Log.Error("state lock of %q was taken over by other operation", lk.ContentID)
+				return
+			default:
+				lk.locker.Log.Warning("failed to refresh state lock of %q: %s", lk.ContentID, err)
+			}
+		}
+	}
+}
+
+func (l *Locker) backend() (lockBackend, error) {
+	if l.Leases != nil {
+		return &leaseLocks{locker: l}, nil
+	}
+
+	if f, ok := l.Storage.(*File); ok {
+		return &fileLocks{locker: l, file: f}, nil
+	}
+
+	return nil, fmt.Errorf("storage %T does not support exclusive locks, leases are required", l.Storage)
+}
+
+// fileLocks creates lock files exclusively, while taking over an expired
+// lock, refreshing and releasing it is serialized with flock(2) on a
+// mutex file kept next to the lock.
+type fileLocks struct {
+	locker *Locker
+	file   *File
+}
+
+func (fl *fileLocks) acquire(info *LockInfo) error {
+	file := fl.locker.path(info.ContentID)
+
+	err := fl.create(file, info)
+	if !os.IsExist(err) {
+		return err
+	}
+
+	return fl.withMutex(file, func() error {
+		cur, err := fl.locker.read(file)
+		if err != nil && !IsNotExist(err) {
+			return err
+		}
+
+		if cur != nil && cur.ExpiresAt.After(time.Now().UTC()) {
+			return &LockedError{Info: cur}
+		}
+
+		if cur != nil {
+			if err := fl.file.Remove(file); err != nil {
+				return err
+			}
+		}
+
+		// Other holder may have created the lock after it was
+		// removed, without taking the mutex.
+		err = fl.create(file, info)
+		if os.IsExist(err) {
+			if cur, e := fl.locker.read(file); e == nil {
+				return &LockedError{Info: cur}
+			}
+		}
+
+		return err
+	})
+}
+
+func (fl *fileLocks) refresh(info *LockInfo) error {
+	file := fl.locker.path(info.ContentID)
+
+	return fl.withMutex(file, func() error {
+		cur, err := fl.locker.read(file)
+		if IsNotExist(err) {
+			return errLockLost
+		}
+		if err != nil {
+			return err
+		}
+
+		if cur.ID != info.ID {
+			return errLockLost
+		}
+
+		return fl.locker.write(file, info)
+	})
+}
+
+func (fl *fileLocks) release(info *LockInfo) error {
+	file := fl.locker.path(info.ContentID)
+
+	return fl.withMutex(file, func() error {
+		cur, err := fl.locker.read(file)
+		if IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if cur.ID != info.ID {
+			return nil
+		}
+
+		return fl.file.Remove(file)
+	})
+}
+
+func (fl *fileLocks) create(file string, info *LockInfo) error {
+	p, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	return fl.file.CreateExclusive(file, bytes.NewReader(p))
+}
+
+func (fl *fileLocks) withMutex(file string, fn func() error) error {
+	mu, err := fl.file.fullPath(file + ".mu")
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(mu, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+
+	return fn()
+}
+
+// leaseLocks guards locks with leases, the lock files are written
+// to the storage only to describe the lock holders.
+type leaseLocks struct {
+	locker *Locker
+}
+
+func (ll *leaseLocks) acquire(info *LockInfo) error {
+	file := ll.locker.path(info.ContentID)
+
+	_, err := ll.locker.Leases.Acquire(ll.leaseID(info), info.ID, ll.locker.ttl())
+	if err == lease.ErrLocked {
+		cur, e := ll.locker.read(file)
+		if e != nil {
+			cur = &LockInfo{ContentID: info.ContentID}
+		}
+
+		return &LockedError{Info: cur}
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := ll.locker.write(file, info); err != nil {
+		ll.locker.Log.Warning("failed to describe state lock of %q: %s", info.ContentID, err)
+	}
+
+	return nil
+}
+
+func (ll *leaseLocks) refresh(info *LockInfo) error {
+	_, err := ll.locker.Leases.Renew(ll.leaseID(info), info.ID, ll.locker.ttl())
+	if err == lease.ErrNotHeld {
+		return errLockLost
+	}
+
+	return err
+}
+
+func (ll *leaseLocks) release(info *LockInfo) error {
+	file := ll.locker.path(info.ContentID)
+
+	// The description is removed before releasing the lease,
+	// so it is not possible to remove one of the next holder.
+	if cur, err := ll.locker.read(file); err == nil && cur.ID == info.ID {
+		if err := ll.locker.Storage.Remove(file); err != nil {
+			ll.locker.Log.Warning("failed to remove state lock of %q: %s", info.ContentID, err)
+		}
+	}
+
+	return ll.locker.Leases.Release(ll.leaseID(info), info.ID)
+}
+
+func (ll *leaseLocks) leaseID(info *LockInfo) string {
+	return "terraformer:" + info.ContentID
+}
+
+func (l *Locker) read(file string) (*LockInfo, error) {
+	r, err := l.Storage.Read(file)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := ioutil.ReadAll(r)
+
+	if c, ok := r.(io.Closer); ok {
+		c.Close()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var info LockInfo
+	if err := json.Unmarshal(p, &info); err != nil {
+		return nil, err
+	}
+
+	return &info, nil
+}
+
+func (l *Locker) write(file string, info *LockInfo) error {
+	p, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	return l.Storage.Write(file, bytes.NewReader(p))
+}
+
+func (l *Locker) path(contentID string) string {
+	return path.Join(LockDir, contentID+".lock")
+}
+
+func (l *Locker) ttl() time.Duration {
+	if l.TTL != 0 {
+		return l.TTL
+	}
+	return DefaultLockTTL
+}
+
+func newLockID() string {
+	p := make([]byte, 16)
+	rand.Read(p)
+	return hex.EncodeToString(p)
+}
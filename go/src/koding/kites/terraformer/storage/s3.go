@@ -158,6 +158,33 @@ func (s *S3) Clone(path string, target Interface) error {
 	return err
 }
 
+// List gives keys of all the objects stored under the given path.
+func (s *S3) List(path string) ([]string, error) {
+	params := &s3.ListObjectsInput{
+		Bucket: aws.String(s.bucketName),
+	}
+
+	if path != "" {
+		path = path + "/"
+		params.Prefix = aws.String(path)
+	}
+
+	var keys []string
+	err := s.s3.ListObjectsPages(params, func(resp *s3.ListObjectsOutput, _ bool) bool {
+		for _, obj := range resp.Contents {
+			if key := aws.StringValue(obj.Key); key != path {
+				keys = append(keys, key)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
 func (s *S3) ensureClosed(r io.Reader, path string) {
 	if c, ok := r.(io.Closer); ok {
 		if err := c.Close(); err != nil {
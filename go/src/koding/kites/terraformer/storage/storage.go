@@ -1,7 +1,12 @@
 // Package storage provides backend storage systems
 package storage
 
-import "io"
+import (
+	"io"
+	"os"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
 
 // nonil returns first non-nil error it encounters
 func nonil(err ...error) error {
@@ -20,4 +25,19 @@ type Interface interface {
 	Remove(string) error
 	Clone(string, Interface) error
 	BasePath() (string, error)
+	List(string) ([]string, error)
+}
+
+// IsNotExist returns true if the err was returned by Read for
+// a non-existing file.
+func IsNotExist(err error) bool {
+	if os.IsNotExist(err) {
+		return true
+	}
+
+	if e, ok := err.(awserr.Error); ok && e.Code() == "NoSuchKey" {
+		return true
+	}
+
+	return false
 }
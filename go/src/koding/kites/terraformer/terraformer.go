@@ -3,6 +3,7 @@
 package terraformer
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -13,12 +14,15 @@ import (
 	"sync"
 	"syscall"
 
+	"koding/db/mongodb"
 	"koding/kites/common"
+	"koding/kites/kloud/pkg/lease"
 	"koding/kites/terraformer/kodingcontext"
 	"koding/kites/terraformer/storage"
 
 	"github.com/hashicorp/terraform/terraform"
 	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
 	"github.com/koding/logging"
 	"github.com/koding/metrics"
 )
@@ -48,6 +52,13 @@ type Terraformer struct {
 	// Store app runtime config
 	Config *Config
 
+	// History keeps snapshots of states written by apply and destroy.
+	History *storage.History
+
+	// Locker is used to lock a state for the whole duration of
+	// plan, apply and destroy operations.
+	Locker *storage.Locker
+
 	closeChan chan struct{} // To signal when terraformer is closing
 
 	closing bool
@@ -60,6 +71,23 @@ type TerraformRequest struct {
 	Variables map[string]string
 	ContentID string
 	TraceID   string
+
+	// DryRun, when true, makes the plan operation not store the
+	// content, so it can be used for computing changes against
+	// the current state of the applied stack.
+	DryRun bool
+
+	// Output, if valid, is called with *Output value for each
+	// line of apply and destroy output, as the operation progresses.
+	Output dnode.Function
+}
+
+// StateRequest is an argument for state.list and state.get kite requests
+type StateRequest struct {
+	ContentID string
+
+	// Version of the state to get. If zero, the latest one is returned.
+	Version int
 }
 
 // New creates a new terraformer
@@ -70,13 +98,19 @@ func New(conf *Config, log logging.Logger) (*Terraformer, error) {
 	}
 
 	var rs storage.Interface
+	var leases lease.Backend
 	if conf.AWS.Key != "" && conf.AWS.Secret != "" && conf.AWS.Bucket != "" {
+		if conf.MongoURL == "" {
+			return nil, errors.New("MongoURL is required to lock states kept in remote store")
+		}
+
 		s3, err := storage.NewS3(conf.AWS.Key, conf.AWS.Secret, conf.AWS.Bucket, log)
 		if err != nil {
 			return nil, fmt.Errorf("error while creating remote store: %s", err)
 		}
 
 		rs = s3
+		leases = lease.NewMongoDB(mongodb.NewMongoDB(conf.MongoURL))
 	} else {
 		remotePath := filepath.Dir(conf.LocalStorePath)
 		if conf.AWS.Bucket != "" {
@@ -101,11 +135,18 @@ func New(conf *Config, log logging.Logger) (*Terraformer, error) {
 	}
 
 	t := &Terraformer{
-		Log:       log,
-		Metrics:   common.MustInitMetrics(Name),
-		Debug:     conf.Debug,
-		Context:   c,
-		Config:    conf,
+		Log:     log,
+		Metrics: common.MustInitMetrics(Name),
+		Debug:   conf.Debug,
+		Context: c,
+		Config:  conf,
+		History: &storage.History{Storage: rs},
+		Locker: &storage.Locker{
+			Storage: rs,
+			Leases:  leases,
+			TTL:     conf.LockTTL,
+			Log:     log,
+		},
 		closeChan: make(chan struct{}),
 	}
 
@@ -169,6 +210,12 @@ func (t *Terraformer) Plan(r *kite.Request) (interface{}, error) {
 		return nil, err
 	}
 
+	unlock, err := t.lock(args.ContentID, r.Method)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
 	c, err := t.Context.Get(args.ContentID, args.TraceID)
 	if err != nil {
 		return nil, err
@@ -177,6 +224,7 @@ func (t *Terraformer) Plan(r *kite.Request) (interface{}, error) {
 
 	// set variables if sent
 	c.Variables = args.Variables
+	c.DryRun = args.DryRun
 
 	destroy := false
 	return c.Plan(strings.NewReader(args.Content), destroy)
@@ -200,6 +248,12 @@ func (t *Terraformer) apply(r *kite.Request, destroy bool) (*terraform.State, er
 		return nil, err
 	}
 
+	unlock, err := t.lock(args.ContentID, r.Method)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
 	c, err := t.Context.Get(args.ContentID, args.TraceID)
 	if err != nil {
 		return nil, err
@@ -209,13 +263,141 @@ func (t *Terraformer) apply(r *kite.Request, destroy bool) (*terraform.State, er
 	// set variables if sent
 	c.Variables = args.Variables
 
+	// stream the output if requested
+	if args.Output.IsValid() {
+		c.SetOutput(t.output(args.ContentID, args.Output))
+	}
+
 	// set content if non-empty
 	var content io.Reader
 	if args.Content != "" {
 		content = strings.NewReader(args.Content)
 	}
 
-	return c.Apply(content, destroy)
+	state, err := c.Apply(content, destroy)
+	if err == kodingcontext.ErrCanceled && state != nil {
+		// keep the partial state of the canceled operation
+		t.addHistory(args.ContentID, state)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	t.addHistory(args.ContentID, state)
+
+	return state, nil
+}
+
+// Cancel provides a kite call for stopping an ongoing apply or
+// destroy operation of the given content.
+//
+// Terraform is stopped gracefully - the resources that are being
+// currently created or destroyed are finished and the partial
+// state is stored. The canceled operation fails with
+// kodingcontext.ErrCanceled error.
+func (t *Terraformer) Cancel(r *kite.Request) (interface{}, error) {
+	args := TerraformRequest{}
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	if args.ContentID == "" {
+		return nil, errors.New("contentID is not set")
+	}
+
+	// NOTE: the state lock is not taken, as it is held by
+	// the operation being canceled.
+	if err := t.Context.Cancel(args.ContentID); err != nil {
+		return nil, err
+	}
+
+	return true, nil
+}
+
+// States provides a kite call for listing stored versions of a state
+func (t *Terraformer) States(r *kite.Request) (interface{}, error) {
+	args := StateRequest{}
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	if args.ContentID == "" {
+		return nil, errors.New("contentID is not set")
+	}
+
+	return t.History.List(args.ContentID)
+}
+
+// State provides a kite call for fetching a stored version of a state
+func (t *Terraformer) State(r *kite.Request) (interface{}, error) {
+	args := StateRequest{}
+	if err := r.Args.One().Unmarshal(&args); err != nil {
+		return nil, err
+	}
+
+	if args.ContentID == "" {
+		return nil, errors.New("contentID is not set")
+	}
+
+	_, rd, err := t.History.Read(args.ContentID, args.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	if c, ok := rd.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	return terraform.ReadState(rd)
+}
+
+// lock locks the state of the given content, the returned func
+// is used to unlock it.
+func (t *Terraformer) lock(contentID, method string) (func(), error) {
+	if contentID == "" {
+		return nil, errors.New("contentID is not set")
+	}
+
+	lk, err := t.Locker.Lock(contentID, method)
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		if err := lk.Unlock(); err != nil {
+			t.Log.Warning("failed to unlock state of %q: %s", contentID, err)
+		}
+	}, nil
+}
+
+// addHistory stores a snapshot of the state, failing to do so does not
+// fail the operation.
+func (t *Terraformer) addHistory(contentID string, state *terraform.State) {
+	var buf bytes.Buffer
+
+	if err := terraform.WriteState(state, &buf); err != nil {
+		t.Log.Warning("failed to encode state of %q: %s", contentID, err)
+		return
+	}
+
+	v, err := t.History.Add(contentID, &buf)
+	if err != nil {
+		t.Log.Warning("failed to store state of %q: %s", contentID, err)
+		return
+	}
+
+	t.Log.Debug("stored version %d of %q state", v.Version, contentID)
+}
+
+// output gives a func that sends each line of terraform output
+// to the given callback.
+func (t *Terraformer) output(contentID string, fn dnode.Function) kodingcontext.OutputFunc {
+	return func(line string, isErr bool) {
+		if err := fn.Call(NewOutput(line, isErr)); err != nil {
+			t.Log.Debug("failed to send output of %q: %s", contentID, err)
+		}
+	}
 }
 
 func (t *Terraformer) handleState(r *kite.Request) (interface{}, error) {
@@ -35,8 +35,18 @@ type ServerOptions struct {
 	// Server config.
 	BaseVirtualHost string `json:"baseVirtualHost"`
 	HostedZone      string `json:"hostedZone" required:"true"`
-	AccessKey       string `json:"accessKey" required:"true"`
-	SecretKey       string `json:"secretKey" required:"true"`
+
+	// DNS config, see dnsclient.Options for details.
+	//
+	// AccessKey and SecretKey are required by the default "route53" backend.
+	DNSBackend       string `json:"dnsBackend,omitempty"`
+	DNSServer        string `json:"dnsServer,omitempty"`
+	DNSTSIGKey       string `json:"dnsTSIGKey,omitempty"`
+	DNSTSIGSecret    string `json:"dnsTSIGSecret,omitempty"`
+	DNSTSIGAlgorithm string `json:"dnsTSIGAlgorithm,omitempty"`
+	DNSPath          string `json:"dnsPath,omitempty"`
+	AccessKey        string `json:"accessKey"`
+	SecretKey        string `json:"secretKey"`
 
 	// Server kite config.
 	Port        int            `json:"port" required:"true"`
@@ -60,7 +70,7 @@ type ServerOptions struct {
 // of the tunneling sessions for the clients.
 type Server struct {
 	Server *tunnel.Server
-	DNS    *dnsclient.Route53
+	DNS    dnsclient.Client
 
 	opts      *ServerOptions
 	record    *dnsclient.Record
@@ -120,12 +130,27 @@ func NewServer(opts *ServerOptions) (*Server, error) {
 	}
 
 	dnsOpts := &dnsclient.Options{
-		Creds:      credentials.NewStaticCredentials(optsCopy.AccessKey, optsCopy.SecretKey, ""),
-		HostedZone: optsCopy.HostedZone,
-		Log:        optsCopy.Log,
-		Debug:      optsCopy.Debug,
+		Backend:       optsCopy.DNSBackend,
+		HostedZone:    optsCopy.HostedZone,
+		Server:        optsCopy.DNSServer,
+		TSIGKey:       optsCopy.DNSTSIGKey,
+		TSIGSecret:    optsCopy.DNSTSIGSecret,
+		TSIGAlgorithm: optsCopy.DNSTSIGAlgorithm,
+		Path:          optsCopy.DNSPath,
+		Log:           optsCopy.Log,
+		Debug:         optsCopy.Debug,
+	}
+
+	switch optsCopy.DNSBackend {
+	case "", "route53":
+		if optsCopy.AccessKey == "" || optsCopy.SecretKey == "" {
+			return nil, errors.New("access key and secret key are required for route53 DNS backend")
+		}
+
+		dnsOpts.Creds = credentials.NewStaticCredentials(optsCopy.AccessKey, optsCopy.SecretKey, "")
 	}
-	dns, err := dnsclient.NewRoute53Client(dnsOpts)
+
+	dns, err := dnsclient.NewClient(dnsOpts)
 	if err != nil {
 		return nil, err
 	}
@@ -19,6 +19,7 @@ import (
 	"sync"
 	"time"
 
+	"koding/klient/audit"
 	"koding/klient/client"
 	"koding/klient/collaboration"
 	"koding/klient/command"
@@ -76,6 +77,10 @@ type Klient struct {
 	// terminal provides wmethods
 	terminal *terminal.Terminal
 
+	// processes provides exec.* methods for running long-running
+	// processes with streamed output
+	processes *command.Processes
+
 	// vagrant handlers
 	vagrant *vagrant.Handlers
 
@@ -110,6 +115,10 @@ type Klient struct {
 	// and updates current binary if version is never than config.Version.
 	updater *Updater
 
+	// audit records methods called by remote users, it is nil
+	// when the audit log is disabled
+	audit *audit.Audit
+
 	// uploader streams logs to an S3 bucket
 	uploader       *uploader.Uploader
 	logUploadDelay time.Duration
@@ -133,6 +142,7 @@ type KlientConfig struct {
 
 	ScreenrcPath string
 	DBPath       string
+	AuditLogPath string
 
 	UpdateInterval time.Duration
 	UpdateURL      string
@@ -171,12 +181,20 @@ func NewKlient(conf *KlientConfig) *Klient {
 		"fs.createDirectory":   true,
 		"fs.move":              true,
 		"fs.copy":              true,
+		"fs.watch":             true,
+		"fs.unwatch":           true,
+		"fs.search":            true,
+		"fs.find":              true,
 		"webterm.getSessions":  true,
 		"webterm.connect":      true,
 		"webterm.killSession":  true,
 		"webterm.killSessions": true,
 		"webterm.rename":       true,
 		"exec":                 true,
+		"exec.start":           true,
+		"exec.signal":          true,
+		"exec.wait":            true,
+		"exec.list":            true,
 		"klient.share":         true,
 		"klient.unshare":       true,
 		"klient.shared":        true,
@@ -213,6 +231,19 @@ func NewKlient(conf *KlientConfig) *Klient {
 		Log:       k.Log,
 	})
 
+	var auditLog *audit.Audit
+	if conf.AuditLogPath != "" {
+		auditLog = audit.New(&audit.Options{
+			File:  conf.AuditLogPath,
+			Owner: k.Config.Username,
+			Log:   k.Log,
+			Rotated: func(file, rotated string) error {
+				_, err := up.UploadRotated(file, rotated)
+				return err
+			},
+		})
+	}
+
 	vagrantOpts := &vagrant.Options{
 		Home:   conf.VagrantHome,
 		DB:     db, // nil is ok, fallbacks to in-memory storage
@@ -255,12 +286,14 @@ func NewKlient(conf *KlientConfig) *Klient {
 		tunnel:  t,
 		vagrant: vagrant.NewHandlers(vagrantOpts),
 		// docker:   docker.New("unix://var/run/docker.sock", k.Log),
-		terminal: term,
-		usage:    usg,
-		log:      k.Log,
-		config:   conf,
-		remote:   remote.NewRemote(remoteOpts),
-		uploader: up,
+		terminal:  term,
+		processes: command.NewProcesses(k.Log),
+		usage:     usg,
+		log:       k.Log,
+		config:    conf,
+		remote:    remote.NewRemote(remoteOpts),
+		uploader:  up,
+		audit:     auditLog,
 		updater: &Updater{
 			Endpoint:       conf.UpdateURL,
 			Interval:       conf.UpdateInterval,
@@ -365,6 +398,10 @@ func (k *Klient) RegisterMethods() {
 	k.kite.HandleFunc("fs.copy", fs.Copy)
 	k.kite.HandleFunc("fs.getDiskInfo", fs.GetDiskInfo)
 	k.kite.HandleFunc("fs.getPathSize", fs.GetPathSize)
+	k.kite.HandleFunc("fs.watch", fs.Watch)
+	k.kite.HandleFunc("fs.unwatch", fs.Unwatch)
+	k.kite.HandleFunc("fs.search", fs.Search)
+	k.kite.HandleFunc("fs.find", fs.Find)
 
 	// Vagrant
 	k.kite.HandleFunc("vagrant.create", k.vagrant.Create)
@@ -376,13 +413,23 @@ func (k *Klient) RegisterMethods() {
 	k.kite.HandleFunc("vagrant.status", k.vagrant.Status)
 	k.kite.HandleFunc("vagrant.version", k.vagrant.Version)
 	k.kite.HandleFunc("vagrant.listForwardedPorts", k.vagrant.ForwardedPorts)
+	k.kite.HandleFunc("vagrant.snapshotSave", k.vagrant.SnapshotSave)
+	k.kite.HandleFunc("vagrant.snapshotRestore", k.vagrant.SnapshotRestore)
+	k.kite.HandleFunc("vagrant.snapshotDelete", k.vagrant.SnapshotDelete)
 
 	// Tunnel
 	k.kite.HandleFunc("tunnel.info", k.tunnel.Info)
+	k.kite.HandleFunc("tunnel.setCertificate", k.tunnel.SetCertificate)
 
 	// Log
 	k.kite.HandleFunc("log.upload", k.uploader.Upload)
 
+	// Audit log
+	if k.audit != nil {
+		k.kite.FinalFunc(k.audit.Record)
+		k.kite.HandleFunc("klient.audit", k.audit.Query)
+	}
+
 	// Docker
 	// k.kite.HandleFunc("docker.create", k.docker.Create)
 	// k.kite.HandleFunc("docker.connect", k.docker.Connect)
@@ -393,6 +440,10 @@ func (k *Klient) RegisterMethods() {
 
 	// Execution
 	k.kite.HandleFunc("exec", command.Exec)
+	k.kite.HandleFunc("exec.start", k.processes.Start)
+	k.kite.HandleFunc("exec.signal", k.processes.Signal)
+	k.kite.HandleFunc("exec.wait", k.processes.Wait)
+	k.kite.HandleFunc("exec.list", k.processes.List)
 
 	// Terminal
 	k.kite.HandleFunc("webterm.getSessions", k.terminal.GetSessions)
@@ -475,6 +526,9 @@ func (k *Klient) RegisterMethods() {
 						k.log.Warning("Couldn't delete user from storage: '%s'", err)
 					}
 					k.terminal.CloseSessions(user)
+					k.processes.CloseProcesses(user)
+					fs.DefaultWatcher.CloseWatches(user)
+					fs.DefaultSearcher.CloseSearches(user)
 				}
 			}
 		}()
@@ -553,7 +607,12 @@ func (k *Klient) Run() {
 		// Additionally do not block startup routine with log uploading.
 		time.Sleep(k.logUploadDelay)
 
-		for _, file := range uploader.LogFiles {
+		files := uploader.LogFiles
+		if k.audit != nil {
+			files = append(files[:len(files):len(files)], k.audit.File())
+		}
+
+		for _, file := range files {
 			_, err := k.uploader.UploadFile(file, k.config.LogUploadInterval)
 			if err != nil && !os.IsNotExist(err) {
 				k.log.Warning("failed to upload %q: %s", file, err)
@@ -654,6 +713,9 @@ func (k *Klient) register(registerURL *url.URL) error {
 
 func (k *Klient) Close() {
 	k.collab.Close()
+	if k.audit != nil {
+		k.audit.Close()
+	}
 	k.kite.Close()
 }
 
@@ -707,19 +769,25 @@ func (k *Klient) checkAuth(r *kite.Request) (interface{}, error) {
 		return true, nil
 	}
 
-	// Allow collaboration users as well
+	// Allow collaboration users as well, limited to methods
+	// their roles allow for.
 	sharedUsers, err := k.collab.GetAll()
 	if err != nil {
 		return nil, fmt.Errorf("Can't read shared users from the storage. Err: %v", err)
 	}
 
-	sharedUsernames := make([]string, 0, len(sharedUsers))
-	for username := range sharedUsers {
-		sharedUsernames = append(sharedUsernames, username)
+	option, ok := sharedUsers[r.Username]
+	if !ok {
+		return nil, fmt.Errorf("User '%s' is not allowed to make a call to us.", r.Username)
+	}
+
+	var role collaboration.Role
+	if option != nil {
+		role = option.Role
 	}
 
-	if !userIn(r.Username, sharedUsernames...) {
-		return nil, fmt.Errorf("User '%s' is not allowed to make a call to us.", r.Username)
+	if !role.Allows(r.Method) {
+		return nil, fmt.Errorf("User '%s' with '%s' role is not allowed to call '%s' method.", r.Username, role, r.Method)
 	}
 
 	return true, nil
@@ -0,0 +1,438 @@
+// Package audit provides an append-only log of methods called on klient
+// by remote users.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/logging"
+)
+
+var defaultLog = logging.NewCustom("audit", false)
+
+const (
+	// DefaultMaxSize is a size of the audit log file after which
+	// it gets rotated.
+	DefaultMaxSize = 10 * 1024 * 1024
+
+	// DefaultBackups is a number of rotated audit log files that are kept.
+	DefaultBackups = 3
+
+	// DefaultLimit is a maximum number of entries returned by a query.
+	DefaultLimit = 100
+
+	// maxArgLen is a maximum length of a single argument value,
+	// longer values are truncated.
+	maxArgLen = 1024
+)
+
+// IgnoredMethods are not recorded in the audit log, as they are called
+// periodically and do not perform any action on the machine.
+var IgnoredMethods = map[string]bool{
+	"kite.ping":      true,
+	"kite.heartbeat": true,
+	"klient.usage":   true,
+	"klient.info":    true,
+	"klient.audit":   true,
+}
+
+// Args are names of request arguments, which values are recorded
+// in the audit log.
+var Args = []string{
+	"path",
+	"oldPath",
+	"newPath",
+	"pattern",
+	"command",
+	"dir",
+	"user",
+	"id",
+	"signal",
+	"session",
+	"mode",
+	"username",
+	"role",
+	"file",
+	"key",
+}
+
+// Entry represents a single audit log record.
+type Entry struct {
+	Time     time.Time         `json:"time"`
+	Username string            `json:"username"`
+	Method   string            `json:"method"`
+	Args     map[string]string `json:"args,omitempty"`
+	OK       bool              `json:"ok"`
+	Error    string            `json:"error,omitempty"`
+}
+
+// Options represents arguments required to create an Audit value.
+type Options struct {
+	File    string      // required
+	Owner   string      // required; user allowed to query the log
+	MaxSize int64       // optional; DefaultMaxSize if 0
+	Backups int         // optional; DefaultBackups if 0
+	Log     kite.Logger // optional; defaultLog if nil
+
+	// Rotated, if non-nil, is called with the audit log file path and
+	// the path it was rotated to, so the rest of its content can be
+	// uploaded, e.g. with (*logrotate.Uploader).UploadRotated.
+	//
+	// It is called outside of the audit lock, by the Write call
+	// which rotated the file.
+	Rotated func(file, rotated string) error
+}
+
+// Audit records calls of klient methods in a JSON-lines file, which is
+// rotated after it grows over MaxSize.
+type Audit struct {
+	opts Options
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+// New gives new Audit value built from the given options.
+//
+// The audit log file is created lazily, upon first record.
+func New(opts *Options) *Audit {
+	a := &Audit{
+		opts: *opts,
+	}
+
+	if a.opts.MaxSize == 0 {
+		a.opts.MaxSize = DefaultMaxSize
+	}
+
+	if a.opts.Backups == 0 {
+		a.opts.Backups = DefaultBackups
+	}
+
+	return a
+}
+
+// File gives a path of the audit log file.
+func (a *Audit) File() string {
+	return a.opts.File
+}
+
+// Record is a kite.FinalFunc, which writes an audit log entry for
+// every authenticated request.
+//
+// It passes the resp and err values unchanged.
+func (a *Audit) Record(r *kite.Request, resp interface{}, err error) (interface{}, error) {
+	if r.Auth == nil || IgnoredMethods[r.Method] {
+		return resp, err
+	}
+
+	e := &Entry{
+		Time:     time.Now().UTC(),
+		Username: r.Username,
+		Method:   r.Method,
+		Args:     requestArgs(r),
+		OK:       err == nil,
+	}
+
+	if err != nil {
+		e.Error = err.Error()
+	}
+
+	if err := a.Write(e); err != nil {
+		a.log().Warning("failed to write audit log entry for %s/%s: %s", e.Username, e.Method, err)
+	}
+
+	return resp, err
+}
+
+// Write appends the given entry to the audit log file.
+func (a *Audit) Write(e *Entry) error {
+	p, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	p = append(p, '\n')
+
+	a.mu.Lock()
+	rotated, err := a.write(p)
+	a.mu.Unlock()
+
+	if rotated && a.opts.Rotated != nil {
+		if err := a.opts.Rotated(a.opts.File, a.backup(1)); err != nil {
+			a.log().Warning("failed to upload rotated %q: %s", a.opts.File, err)
+		}
+	}
+
+	return err
+}
+
+// write appends p to the audit log file, rotating it first if it would
+// grow over MaxSize. It returns true if the file was rotated.
+func (a *Audit) write(p []byte) (rotated bool, err error) {
+	if a.f != nil && a.size+int64(len(p)) > a.opts.MaxSize {
+		if err := a.rotate(); err != nil {
+			a.log().Warning("failed to rotate %q: %s", a.opts.File, err)
+		} else {
+			rotated = true
+		}
+	}
+
+	if a.f == nil {
+		if err := a.open(); err != nil {
+			return rotated, err
+		}
+	}
+
+	n, err := a.f.Write(p)
+	a.size += int64(n)
+
+	return rotated, err
+}
+
+// Close closes the audit log file.
+func (a *Audit) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.f == nil {
+		return nil
+	}
+
+	err := a.f.Close()
+	a.f = nil
+
+	return err
+}
+
+// QueryRequest represents a request of the "klient.audit" kite method.
+type QueryRequest struct {
+	// Username, if non-empty, limits entries to the ones of the given user.
+	Username string `json:"username"`
+
+	// Method, if non-empty, limits entries to the methods matching the
+	// given pattern, e.g. "fs.*".
+	Method string `json:"method"`
+
+	// Since, if non-zero, limits entries to the ones recorded after it.
+	Since time.Time `json:"since"`
+
+	// Limit is a maximum number of the most recent entries to return.
+	// If 0, DefaultLimit is used.
+	Limit int `json:"limit"`
+}
+
+// Query is a kite handler for the "klient.audit" method.
+//
+// It returns matching entries, ordered from the oldest one.
+func (a *Audit) Query(r *kite.Request) (interface{}, error) {
+	if r.Username != a.opts.Owner && r.Username != "koding" {
+		return nil, fmt.Errorf("User '%s' is not allowed to read the audit log.", r.Username)
+	}
+
+	var req QueryRequest
+
+	if r.Args != nil {
+		if err := r.Args.One().Unmarshal(&req); err != nil {
+			return nil, err
+		}
+	}
+
+	return a.Entries(&req)
+}
+
+// Entries reads entries matching the given query, from all the audit log
+// files, including rotated ones.
+func (a *Audit) Entries(req *QueryRequest) ([]*Entry, error) {
+	if req.Method != "" {
+		if _, err := path.Match(req.Method, ""); err != nil {
+			return nil, fmt.Errorf("invalid method pattern %q: %s", req.Method, err)
+		}
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var entries []*Entry
+
+	for i := a.opts.Backups; i >= 0; i-- {
+		err := a.read(a.backup(i), func(e *Entry) {
+			if !req.match(e) {
+				return
+			}
+
+			entries = append(entries, e)
+
+			if len(entries) > limit {
+				entries = entries[1:]
+			}
+		})
+
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	if entries == nil {
+		entries = []*Entry{}
+	}
+
+	return entries, nil
+}
+
+func (req *QueryRequest) match(e *Entry) bool {
+	if req.Username != "" && req.Username != e.Username {
+		return false
+	}
+
+	if req.Method != "" {
+		if ok, _ := path.Match(req.Method, e.Method); !ok {
+			return false
+		}
+	}
+
+	if !req.Since.IsZero() && e.Time.Before(req.Since) {
+		return false
+	}
+
+	return true
+}
+
+func (a *Audit) open() error {
+	if err := os.MkdirAll(filepath.Dir(a.opts.File), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(a.opts.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	a.f = f
+	a.size = fi.Size()
+
+	return nil
+}
+
+// rotate moves the audit log file to <file>.1, shifting older backups
+// and removing the oldest one.
+func (a *Audit) rotate() error {
+	if err := a.f.Close(); err != nil {
+		a.log().Warning("failed to close %q: %s", a.opts.File, err)
+	}
+
+	a.f = nil
+	a.size = 0
+
+	os.Remove(a.backup(a.opts.Backups))
+
+	for i := a.opts.Backups - 1; i >= 0; i-- {
+		if err := os.Rename(a.backup(i), a.backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (a *Audit) backup(n int) string {
+	if n == 0 {
+		return a.opts.File
+	}
+
+	return fmt.Sprintf("%s.%d", a.opts.File, n)
+}
+
+func (a *Audit) read(file string, fn func(*Entry)) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		var e Entry
+
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			a.log().Debug("skipping malformed entry in %q: %s", file, err)
+			continue
+		}
+
+		fn(&e)
+	}
+
+	return scanner.Err()
+}
+
+func (a *Audit) log() kite.Logger {
+	if a.opts.Log != nil {
+		return a.opts.Log
+	}
+
+	return defaultLog
+}
+
+// requestArgs reads values of Args from the first request argument.
+//
+// The raw JSON is decoded instead of r.Args.One(), as the arguments
+// may contain callbacks.
+func requestArgs(r *kite.Request) map[string]string {
+	if r.Args == nil {
+		return nil
+	}
+
+	var raw []json.RawMessage
+
+	if err := json.Unmarshal(r.Args.Raw, &raw); err != nil || len(raw) == 0 {
+		return nil
+	}
+
+	var v map[string]interface{}
+
+	if err := json.Unmarshal(raw[0], &v); err != nil {
+		return nil
+	}
+
+	args := make(map[string]string)
+
+	for _, key := range Args {
+		s, ok := v[key].(string)
+		if !ok || s == "" {
+			continue
+		}
+
+		if len(s) > maxArgLen {
+			s = s[:maxArgLen] + "..."
+		}
+
+		args[key] = s
+	}
+
+	if len(args) == 0 {
+		return nil
+	}
+
+	return args
+}
@@ -0,0 +1,149 @@
+package audit_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"koding/klient/audit"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+)
+
+func newRequest(username, method, args string) *kite.Request {
+	return &kite.Request{
+		Username: username,
+		Method:   method,
+		Auth:     &kite.Auth{Type: "kiteKey"},
+		Args:     &dnode.Partial{Raw: []byte(args)},
+	}
+}
+
+func TestAudit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var rotated []string
+	var a *audit.Audit
+
+	a = audit.New(&audit.Options{
+		File:    filepath.Join(dir, "klient.audit.log"),
+		Owner:   "owner",
+		MaxSize: 512,
+		Backups: 1,
+		Rotated: func(file, backup string) error {
+			if file != a.File() {
+				t.Errorf("got %q file, want %q", file, a.File())
+			}
+
+			// The lock must be released when the file is uploaded.
+			if _, err := a.Entries(&audit.QueryRequest{Limit: 1}); err != nil {
+				t.Errorf("Entries()=%s", err)
+			}
+
+			rotated = append(rotated, backup)
+			return nil
+		},
+	})
+	defer a.Close()
+
+	reqs := []struct {
+		req *kite.Request
+		err error
+	}{
+		{newRequest("alice", "fs.writeFile", `[{"path":"/tmp/foo","content":"Zm9v"}]`), nil},
+		{newRequest("bob", "exec", `[{"command":"rm -rf /tmp/foo"}]`), errors.New("not allowed")},
+		{newRequest("alice", "kite.ping", `[]`), nil},
+		{newRequest("alice", "webterm.connect", `[{"session":"abc","remote":{}}]`), nil},
+	}
+
+	for _, r := range reqs {
+		if _, err := a.Record(r.req, nil, r.err); err != r.err {
+			t.Fatalf("Record()=%v, want %v", err, r.err)
+		}
+	}
+
+	entries, err := a.Entries(&audit.QueryRequest{})
+	if err != nil {
+		t.Fatalf("Entries()=%s", err)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("got %d entries, want 3: %+v", len(entries), entries)
+	}
+
+	if e := entries[0]; e.Method != "fs.writeFile" || e.Args["path"] != "/tmp/foo" || e.Args["content"] != "" || !e.OK {
+		t.Errorf("unexpected entry: %+v", e)
+	}
+
+	if e := entries[1]; e.Username != "bob" || e.Args["command"] != "rm -rf /tmp/foo" || e.OK || e.Error != "not allowed" {
+		t.Errorf("unexpected entry: %+v", e)
+	}
+
+	entries, err = a.Entries(&audit.QueryRequest{Username: "alice", Method: "webterm.*"})
+	if err != nil {
+		t.Fatalf("Entries()=%s", err)
+	}
+
+	if len(entries) != 1 || entries[0].Args["session"] != "abc" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+
+	// Write enough entries to rotate the file several times.
+	for i := 0; i < 20; i++ {
+		a.Record(newRequest("alice", "fs.remove", `[{"path":"/tmp/bar"}]`), nil, nil)
+	}
+
+	if len(rotated) == 0 {
+		t.Fatal("want the rotated file to be uploaded")
+	}
+
+	for _, backup := range rotated {
+		if backup != a.File()+".1" {
+			t.Fatalf("got %q rotated file, want %q", backup, a.File()+".1")
+		}
+	}
+
+	if _, err := os.Stat(a.File() + ".1"); err != nil {
+		t.Fatalf("want rotated file: %s", err)
+	}
+
+	if _, err := os.Stat(a.File() + ".2"); !os.IsNotExist(err) {
+		t.Fatalf("want at most one backup, got %v", err)
+	}
+
+	entries, err = a.Entries(&audit.QueryRequest{Limit: 2})
+	if err != nil {
+		t.Fatalf("Entries()=%s", err)
+	}
+
+	if len(entries) != 2 || entries[1].Method != "fs.remove" {
+		t.Fatalf("unexpected entries: %+v", entries)
+	}
+}
+
+func TestAuditQueryOwner(t *testing.T) {
+	a := audit.New(&audit.Options{
+		File:  filepath.Join(os.TempDir(), "nonexisting", "klient.audit.log"),
+		Owner: "owner",
+	})
+
+	if _, err := a.Query(newRequest("alice", "klient.audit", `[{}]`)); err == nil {
+		t.Fatal("want non-nil error for non-owner")
+	}
+
+	v, err := a.Query(newRequest("owner", "klient.audit", `[{}]`))
+	if err != nil {
+		t.Fatalf("Query()=%s", err)
+	}
+
+	if entries, ok := v.([]*audit.Entry); !ok || len(entries) != 0 {
+		t.Fatalf("got %#v, want empty entries", v)
+	}
+}
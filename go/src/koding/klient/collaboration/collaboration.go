@@ -27,10 +27,14 @@ func New(boltDB *bolt.DB) *Collaboration {
 	}
 }
 
+// Share adds the given user to the shared users. The optional role limits
+// methods the user is allowed to call, it defaults to RoleReadOnly for new
+// users. Sharing with already shared user without a role keeps its role.
 func (c *Collaboration) Share(r *kite.Request) (interface{}, error) {
 	var params struct {
 		Username  string
 		Permanent bool
+		Role      string
 	}
 
 	if r.Args.One().Unmarshal(&params) != nil || params.Username == "" {
@@ -38,15 +42,26 @@ func (c *Collaboration) Share(r *kite.Request) (interface{}, error) {
 	}
 
 	option, err := c.Get(params.Username)
-	if err == nil {
-		// if the user is already a permanant user just return lazily, we don't
-		// need change anything
-		if option.Permanent {
+	shared := err == nil
+
+	var role Role
+	if shared && params.Role == "" {
+		role = option.Role
+	} else if role, err = ParseRole(params.Role); err != nil {
+		return nil, err
+	}
+
+	// if the user is already a permanant user just return lazily, we don't
+	// need change anything apart from the role
+	if shared && option.Permanent {
+		if option.Role == role {
 			return "shared", nil
 		}
+
+		params.Permanent = true
 	}
 
-	newOption := &Option{Permanent: params.Permanent}
+	newOption := &Option{Permanent: params.Permanent, Role: role}
 	if err := c.Set(params.Username, newOption); err != nil {
 		return nil, errors.New("user is already in the shared list.")
 	}
@@ -84,12 +99,38 @@ func (c *Collaboration) Unshare(r *kite.Request) (interface{}, error) {
 	return "unshared", nil
 }
 
+// Shared returns a comma-separated list of shared users. If called with
+// { detailed: true } argument, it returns a map of shared users to their
+// options instead, which includes their roles.
 func (c *Collaboration) Shared(r *kite.Request) (interface{}, error) {
+	var params struct {
+		Detailed bool
+	}
+
+	if r.Args != nil {
+		// the method was historically called without arguments,
+		// ignore the error for backward compatibility
+		r.Args.One().Unmarshal(&params)
+	}
+
 	users, err := c.GetAll()
 	if err != nil {
 		return nil, err
 	}
 
+	if params.Detailed {
+		options := make(map[string]*Option, len(users))
+		for username, option := range users {
+			o := *option
+			if o.Role == "" {
+				o.Role = RoleFull
+			}
+			options[username] = &o
+		}
+
+		return options, nil
+	}
+
 	usernames := make([]string, 0)
 	for username := range users {
 		usernames = append(usernames, username)
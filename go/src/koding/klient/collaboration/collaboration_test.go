@@ -0,0 +1,99 @@
+package collaboration
+
+import (
+	"testing"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+)
+
+func newShareRequest(args string) *kite.Request {
+	return &kite.Request{
+		Method: "klient.share",
+		Args:   &dnode.Partial{Raw: []byte(args)},
+	}
+}
+
+func TestShareRole(t *testing.T) {
+	c := &Collaboration{Storage: NewMemoryStorage()}
+
+	cases := []struct {
+		args string
+		want *Option
+	}{{
+		// new users get the least privileged role
+		`[{"username":"user","permanent":false}]`,
+		&Option{Role: RoleReadOnly},
+	}, {
+		`[{"username":"user","role":"full"}]`,
+		&Option{Role: RoleFull},
+	}, {
+		// re-sharing without a role keeps the existing one
+		`[{"username":"user"}]`,
+		&Option{Role: RoleFull},
+	}, {
+		`[{"username":"user","permanent":true,"role":"terminal"}]`,
+		&Option{Permanent: true, Role: RoleTerminal},
+	}, {
+		`[{"username":"user","permanent":true}]`,
+		&Option{Permanent: true, Role: RoleTerminal},
+	}, {
+		// role of a permanent user can be changed
+		`[{"username":"user","role":"files"}]`,
+		&Option{Permanent: true, Role: RoleFiles},
+	}}
+
+	for i, cas := range cases {
+		if _, err := c.Share(newShareRequest(cas.args)); err != nil {
+			t.Fatalf("%d: Share()=%s", i, err)
+		}
+
+		got, err := c.Get("user")
+		if err != nil {
+			t.Fatalf("%d: Get()=%s", i, err)
+		}
+
+		if *got != *cas.want {
+			t.Fatalf("%d: got %+v, want %+v", i, got, cas.want)
+		}
+	}
+
+	if _, err := c.Share(newShareRequest(`[{"username":"other","role":"admin"}]`)); err == nil {
+		t.Fatal("want error for unknown role")
+	}
+}
+
+func TestShareLegacyRole(t *testing.T) {
+	c := &Collaboration{Storage: NewMemoryStorage()}
+
+	// users shared before roles were introduced are stored without one
+	if err := c.Set("user", &Option{Permanent: true}); err != nil {
+		t.Fatalf("Set()=%s", err)
+	}
+
+	if _, err := c.Share(newShareRequest(`[{"username":"user","permanent":true}]`)); err != nil {
+		t.Fatalf("Share()=%s", err)
+	}
+
+	got, err := c.Get("user")
+	if err != nil {
+		t.Fatalf("Get()=%s", err)
+	}
+
+	if want := (Option{Permanent: true}); *got != want {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	if !got.Role.Allows("exec") {
+		t.Fatal("want legacy user to be allowed to call exec")
+	}
+
+	v, err := c.Shared(&kite.Request{Args: &dnode.Partial{Raw: []byte(`[{"detailed":true}]`)}})
+	if err != nil {
+		t.Fatalf("Shared()=%s", err)
+	}
+
+	if role := v.(map[string]*Option)["user"].Role; role != RoleFull {
+		t.Fatalf("got %q role, want %q", role, RoleFull)
+	}
+}
@@ -0,0 +1,115 @@
+package collaboration
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// Role defines which methods a shared user is allowed to call.
+type Role string
+
+// The following roles can be assigned to shared users with klient.share
+// method.
+const (
+	// RoleReadOnly allows for browsing, reading, watching and searching
+	// files, listing terminal sessions and processes. Users shared
+	// without an explicit role get this role.
+	RoleReadOnly Role = "read-only"
+
+	// RoleTerminal allows for using terminal sessions only.
+	RoleTerminal Role = "terminal"
+
+	// RoleFiles allows for using all the fs.* methods.
+	RoleFiles Role = "files"
+
+	// RoleFull allows for calling every method. Users shared before
+	// roles were introduced are stored without a role and have this one.
+	RoleFull Role = "full"
+)
+
+// commonMethods are allowed for every role.
+var commonMethods = []string{
+	"kite.*",
+	"klient.info",
+	"klient.usage",
+	"os.home",
+	"os.currentUsername",
+	"client.*",
+}
+
+// roleMethods maps roles to method patterns, as matched by path.Match.
+var roleMethods = map[Role][]string{
+	RoleReadOnly: {
+		"fs.readDirectory",
+		"fs.glob",
+		"fs.readFile",
+		"fs.getInfo",
+		"fs.getDiskInfo",
+		"fs.getPathSize",
+		"fs.watch",
+		"fs.unwatch",
+		"fs.search",
+		"fs.find",
+		"webterm.getSessions",
+		"exec.list",
+	},
+	RoleTerminal: {
+		"webterm.*",
+	},
+	RoleFiles: {
+		"fs.*",
+	},
+	RoleFull: {
+		"*",
+	},
+}
+
+// Roles gives a list of all valid roles.
+func Roles() []Role {
+	return []Role{RoleReadOnly, RoleTerminal, RoleFiles, RoleFull}
+}
+
+// ParseRole gives a role for the given name. Empty name gives the least
+// privileged role, RoleReadOnly.
+func ParseRole(s string) (Role, error) {
+	if s == "" {
+		return RoleReadOnly, nil
+	}
+
+	role := Role(s)
+
+	if _, ok := roleMethods[role]; !ok {
+		return "", fmt.Errorf("unknown role %q, valid roles are: %s", s, strings.Join(roleNames(), ", "))
+	}
+
+	return role, nil
+}
+
+// Allows returns true if the role allows for calling the given method.
+//
+// Empty role is treated as RoleFull, as it is stored only for users
+// shared before roles were introduced, who had access to all methods.
+func (r Role) Allows(method string) bool {
+	if r == "" {
+		r = RoleFull
+	}
+
+	for _, patterns := range [][]string{commonMethods, roleMethods[r]} {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, method); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func roleNames() []string {
+	var names []string
+	for _, role := range Roles() {
+		names = append(names, string(role))
+	}
+	return names
+}
@@ -0,0 +1,51 @@
+package collaboration
+
+import "testing"
+
+func TestRoleAllows(t *testing.T) {
+	cases := []struct {
+		role   Role
+		method string
+		want   bool
+	}{
+		{RoleReadOnly, "fs.readFile", true},
+		{RoleReadOnly, "fs.writeFile", false},
+		{RoleReadOnly, "exec", false},
+		{RoleReadOnly, "kite.ping", true},
+		{RoleTerminal, "webterm.connect", true},
+		{RoleTerminal, "fs.readFile", false},
+		{RoleFiles, "fs.remove", true},
+		{RoleFiles, "sshkeys.add", false},
+		{RoleFiles, "klient.info", true},
+		{RoleFull, "sshkeys.add", true},
+		// users stored before roles were introduced keep full access
+		{"", "exec", true},
+		{"", "webterm.connect", true},
+	}
+
+	for _, cas := range cases {
+		if got := cas.role.Allows(cas.method); got != cas.want {
+			t.Errorf("%q.Allows(%q)=%t, want %t", cas.role, cas.method, got, cas.want)
+		}
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	for _, role := range Roles() {
+		got, err := ParseRole(string(role))
+		if err != nil {
+			t.Errorf("ParseRole(%q)=%s", role, err)
+		}
+		if got != role {
+			t.Errorf("got %q, want %q", got, role)
+		}
+	}
+
+	if got, err := ParseRole(""); err != nil || got != RoleReadOnly {
+		t.Errorf("ParseRole(\"\")=%q, %v; want %q", got, err, RoleReadOnly)
+	}
+
+	if _, err := ParseRole("admin"); err == nil {
+		t.Error("want non-nil error for unknown role")
+	}
+}
@@ -13,6 +13,10 @@ type Option struct {
 	// Permananet means the user is shared
 	Permanent bool   `json:"permanent"`
 	Test      string `json:"test"`
+
+	// Role defines methods the user is allowed to call. Empty
+	// role is treated as RoleFull, see Role.Allows.
+	Role Role `json:"role,omitempty"`
 }
 
 type Storage interface {
@@ -0,0 +1,496 @@
+package command
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+
+	"koding/klient/kiteerrortypes"
+	"koding/klient/util"
+)
+
+// ProcessTTL is the time finished processes are kept for, so their exit
+// status can be still read with exec.wait or exec.list methods.
+var ProcessTTL = 10 * time.Minute
+
+// StartRequest represents a request for the exec.start method.
+type StartRequest struct {
+	// Command is executed with /bin/bash -c.
+	Command string
+
+	// Dir is a working directory of the process. If empty, a home
+	// directory of the user running the process is used.
+	Dir string
+
+	// Env holds environment variables, which are set for the process
+	// in addition to the klient ones.
+	Env map[string]string
+
+	// Timeout is a number of seconds after which the process is killed.
+	// Zero means no timeout.
+	Timeout int
+
+	// User is a system user the process is run as. If empty, the process
+	// is run as the user running klient. Running processes as other
+	// users requires klient to run as root.
+	User string
+
+	// Stdout and Stderr, if valid, are called with chunks of the process
+	// output as it is written.
+	Stdout dnode.Function
+	Stderr dnode.Function
+
+	// Exit, if valid, is called with *ProcessInfo value when the process
+	// exits.
+	Exit dnode.Function
+}
+
+// SignalRequest represents a request for the exec.signal method.
+type SignalRequest struct {
+	// ID of the process.
+	ID string
+
+	// Signal is sent to the process group of the process, so its
+	// children receive it as well. It is either a signal name, like
+	// "SIGINT" or "INT", or a signal number. If empty, SIGTERM is sent.
+	Signal string
+}
+
+// WaitRequest represents a request for the exec.wait method.
+type WaitRequest struct {
+	// ID of the process.
+	ID string
+
+	// Timeout is a number of seconds after which waiting is cancelled
+	// and running process info is returned. Zero means waiting until
+	// the process exits.
+	Timeout int
+}
+
+// ProcessInfo describes a process started with exec.start method.
+type ProcessInfo struct {
+	ID         string    `json:"id"`
+	PID        int       `json:"pid"`
+	Command    string    `json:"command"`
+	Dir        string    `json:"dir"`
+	User       string    `json:"user"`
+	StartedAt  time.Time `json:"startedAt"`
+	Running    bool      `json:"running"`
+	ExitStatus int       `json:"exitStatus"`         // -1 if the process was killed with a signal
+	Signal     string    `json:"signal,omitempty"`   // signal, which killed the process
+	TimedOut   bool      `json:"timedOut,omitempty"` // whether the process was killed due to timeout
+	FinishedAt time.Time `json:"finishedAt"`         // zero if the process is still running
+}
+
+type process struct {
+	owner string // kite user, which started the process
+	cmd   *exec.Cmd
+	done  chan struct{}
+
+	mu   sync.Mutex
+	info ProcessInfo
+}
+
+func (p *process) Info() *ProcessInfo {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info := p.info
+	return &info
+}
+
+func (p *process) signal(sig syscall.Signal) error {
+	// The process is a process group leader, signalling
+	// the negative pid signals whole group.
+	return syscall.Kill(-p.cmd.Process.Pid, sig)
+}
+
+// Processes provides kite.handleFuncs to start and control long-running
+// processes, which output is streamed to the caller.
+//
+// Processes are visible only to the kite user, who started them.
+type Processes struct {
+	Log kite.Logger
+
+	mu    sync.Mutex
+	procs map[string]*process
+}
+
+// NewProcesses gives new Processes value.
+func NewProcesses(log kite.Logger) *Processes {
+	return &Processes{
+		Log:   log,
+		procs: make(map[string]*process),
+	}
+}
+
+// Start starts the requested process and returns its *ProcessInfo without
+// waiting for it to finish.
+func (p *Processes) Start(r *kite.Request) (interface{}, error) {
+	var req StartRequest
+
+	if r.Args.One().Unmarshal(&req) != nil || req.Command == "" {
+		return nil, errors.New("{ command: [string], dir: [string], env: [object], timeout: [number], user: [string] }")
+	}
+
+	return p.start(r.Username, &req)
+}
+
+// Signal sends the requested signal to the process.
+func (p *Processes) Signal(r *kite.Request) (interface{}, error) {
+	var req SignalRequest
+
+	if r.Args.One().Unmarshal(&req) != nil || req.ID == "" {
+		return nil, errors.New("{ id: [string], signal: [string] }")
+	}
+
+	sig, err := parseSignal(req.Signal)
+	if err != nil {
+		return nil, err
+	}
+
+	proc, err := p.get(r.Username, req.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-proc.done:
+		return nil, fmt.Errorf("process %q has already finished", req.ID)
+	default:
+	}
+
+	if err := proc.signal(sig); err != nil {
+		return nil, util.NewKiteError(kiteerrortypes.ProcessError, err)
+	}
+
+	return true, nil
+}
+
+// Wait waits for the process to finish and returns its *ProcessInfo.
+func (p *Processes) Wait(r *kite.Request) (interface{}, error) {
+	var req WaitRequest
+
+	if r.Args.One().Unmarshal(&req) != nil || req.ID == "" {
+		return nil, errors.New("{ id: [string], timeout: [number] }")
+	}
+
+	proc, err := p.get(r.Username, req.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var timeout <-chan time.Time
+
+	if req.Timeout > 0 {
+		t := time.NewTimer(time.Duration(req.Timeout) * time.Second)
+		defer t.Stop()
+
+		timeout = t.C
+	}
+
+	select {
+	case <-proc.done:
+	case <-timeout:
+	}
+
+	return proc.Info(), nil
+}
+
+// List returns []*ProcessInfo of processes started by the caller,
+// sorted by their start time.
+func (p *Processes) List(r *kite.Request) (interface{}, error) {
+	return p.list(r.Username), nil
+}
+
+// CloseProcesses kills all running processes started by the given
+// kite user.
+func (p *Processes) CloseProcesses(username string) {
+	p.mu.Lock()
+	var procs []*process
+	for _, proc := range p.procs {
+		if proc.owner == username {
+			procs = append(procs, proc)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, proc := range procs {
+		select {
+		case <-proc.done:
+		default:
+			if err := proc.signal(syscall.SIGKILL); err != nil {
+				p.Log.Warning("unable to kill process %q of user %q: %s", proc.info.ID, username, err)
+			}
+		}
+	}
+}
+
+func (p *Processes) start(owner string, req *StartRequest) (*ProcessInfo, error) {
+	u, err := runAs(req.User)
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("/bin/bash", "-c", req.Command)
+	cmd.Dir = req.Dir
+	cmd.Env = os.Environ()
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if cmd.Dir == "" {
+		cmd.Dir = u.HomeDir
+	}
+
+	if cred := u.credential; cred != nil {
+		cmd.SysProcAttr.Credential = cred
+		cmd.Env = append(cmd.Env, "HOME="+u.HomeDir, "USER="+u.Username, "LOGNAME="+u.Username)
+	}
+
+	for k, v := range req.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+
+	if req.Stdout.IsValid() {
+		cmd.Stdout = &callbackWriter{fn: req.Stdout}
+	}
+
+	if req.Stderr.IsValid() {
+		cmd.Stderr = &callbackWriter{fn: req.Stderr}
+	}
+
+	id, err := processID()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, util.NewKiteError(kiteerrortypes.ProcessError, err)
+	}
+
+	proc := &process{
+		owner: owner,
+		cmd:   cmd,
+		done:  make(chan struct{}),
+		info: ProcessInfo{
+			ID:        id,
+			PID:       cmd.Process.Pid,
+			Command:   req.Command,
+			Dir:       cmd.Dir,
+			User:      u.Username,
+			StartedAt: time.Now(),
+			Running:   true,
+		},
+	}
+
+	p.mu.Lock()
+	p.procs[id] = proc
+	p.mu.Unlock()
+
+	if req.Timeout > 0 {
+		t := time.AfterFunc(time.Duration(req.Timeout)*time.Second, func() {
+			proc.mu.Lock()
+			proc.info.TimedOut = true
+			proc.mu.Unlock()
+
+			if err := proc.signal(syscall.SIGKILL); err != nil {
+				p.Log.Warning("unable to kill timed out process %q: %s", id, err)
+			}
+		})
+
+		go func() {
+			<-proc.done
+			t.Stop()
+		}()
+	}
+
+	go p.wait(proc, req.Exit)
+
+	return proc.Info(), nil
+}
+
+func (p *Processes) wait(proc *process, exit dnode.Function) {
+	err := proc.cmd.Wait()
+
+	proc.mu.Lock()
+	proc.info.Running = false
+	proc.info.FinishedAt = time.Now()
+
+	if err != nil {
+		proc.info.ExitStatus = -1
+
+		if e, ok := err.(*exec.ExitError); ok {
+			ws := e.Sys().(syscall.WaitStatus)
+
+			if ws.Signaled() {
+				proc.info.Signal = ws.Signal().String()
+			} else {
+				proc.info.ExitStatus = ws.ExitStatus()
+			}
+		}
+	}
+
+	if proc.info.TimedOut && proc.info.Signal == "" {
+		proc.info.TimedOut = false // process finished before it was killed
+	}
+	proc.mu.Unlock()
+
+	close(proc.done)
+
+	info := proc.Info()
+
+	if err != nil {
+		p.Log.Debug("process %q finished: %s", info.ID, err)
+	}
+
+	if exit.IsValid() {
+		if err := exit.Call(info); err != nil {
+			p.Log.Warning("unable to notify about process %q exit: %s", info.ID, err)
+		}
+	}
+
+	time.AfterFunc(ProcessTTL, func() {
+		p.mu.Lock()
+		delete(p.procs, info.ID)
+		p.mu.Unlock()
+	})
+}
+
+func (p *Processes) get(owner, id string) (*process, error) {
+	p.mu.Lock()
+	proc, ok := p.procs[id]
+	p.mu.Unlock()
+
+	if !ok || proc.owner != owner {
+		return nil, util.KiteErrorf(kiteerrortypes.ProcessNotFound, "process %q not found", id)
+	}
+
+	return proc, nil
+}
+
+func (p *Processes) list(owner string) []*ProcessInfo {
+	p.mu.Lock()
+	infos := make([]*ProcessInfo, 0, len(p.procs))
+	for _, proc := range p.procs {
+		if proc.owner == owner {
+			infos = append(infos, proc.Info())
+		}
+	}
+	p.mu.Unlock()
+
+	sort.Sort(byStartTime(infos))
+
+	return infos
+}
+
+// callbackWriter writes process output to a dnode callback.
+type callbackWriter struct {
+	fn dnode.Function
+}
+
+func (w *callbackWriter) Write(p []byte) (int, error) {
+	// Errors are ignored, as the caller may disconnect
+	// while the process is still running.
+	w.fn.Call(string(p))
+
+	return len(p), nil
+}
+
+type processUser struct {
+	*user.User
+	credential *syscall.Credential // nil when run as current user
+}
+
+func runAs(username string) (*processUser, error) {
+	current, err := user.Current()
+	if err != nil {
+		return nil, err
+	}
+
+	if username == "" || username == current.Username {
+		return &processUser{User: current}, nil
+	}
+
+	if os.Geteuid() != 0 {
+		return nil, fmt.Errorf("running processes as %q user requires klient to run as root", username)
+	}
+
+	u, err := user.Lookup(username)
+	if err != nil {
+		return nil, err
+	}
+
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uid of %q user: %s", username, err)
+	}
+
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid gid of %q user: %s", username, err)
+	}
+
+	return &processUser{
+		User: u,
+		credential: &syscall.Credential{
+			Uid: uint32(uid),
+			Gid: uint32(gid),
+		},
+	}, nil
+}
+
+var signals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"KILL": syscall.SIGKILL,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+	"TERM": syscall.SIGTERM,
+	"CONT": syscall.SIGCONT,
+	"STOP": syscall.SIGSTOP,
+}
+
+func parseSignal(s string) (syscall.Signal, error) {
+	if s == "" {
+		return syscall.SIGTERM, nil
+	}
+
+	if n, err := strconv.Atoi(s); err == nil && n > 0 {
+		return syscall.Signal(n), nil
+	}
+
+	if sig, ok := signals[strings.TrimPrefix(strings.ToUpper(s), "SIG")]; ok {
+		return sig, nil
+	}
+
+	return 0, fmt.Errorf("unknown signal %q", s)
+}
+
+func processID() (string, error) {
+	p := make([]byte, 8)
+
+	if _, err := rand.Read(p); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(p), nil
+}
+
+type byStartTime []*ProcessInfo
+
+func (p byStartTime) Len() int           { return len(p) }
+func (p byStartTime) Less(i, j int) bool { return p[i].StartedAt.Before(p[j].StartedAt) }
+func (p byStartTime) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
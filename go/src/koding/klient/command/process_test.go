@@ -0,0 +1,161 @@
+package command
+
+import (
+	"bytes"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+
+	"koding/klient/kiteerrortypes"
+)
+
+type output struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (o *output) Call(args ...interface{}) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.buf.WriteString(args[0].(string))
+	return nil
+}
+
+func (o *output) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return o.buf.String()
+}
+
+func waitProcess(t *testing.T, p *Processes, owner, id string) *ProcessInfo {
+	proc, err := p.get(owner, id)
+	if err != nil {
+		t.Fatalf("get()=%s", err)
+	}
+
+	select {
+	case <-proc.done:
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timed out waiting for %q process", id)
+	}
+
+	return proc.Info()
+}
+
+func TestProcesses(t *testing.T) {
+	p := NewProcesses(kite.New("test", "0.0.1").Log)
+
+	stdout, stderr := &output{}, &output{}
+
+	info, err := p.start("user", &StartRequest{
+		Command: `echo "$FOO"; pwd; echo err >&2; exit 3`,
+		Dir:     "/tmp",
+		Env:     map[string]string{"FOO": "bar"},
+		Stdout:  dnode.Function{Caller: stdout},
+		Stderr:  dnode.Function{Caller: stderr},
+	})
+	if err != nil {
+		t.Fatalf("start()=%s", err)
+	}
+
+	if !info.Running || info.PID == 0 {
+		t.Fatalf("want running process, got %+v", info)
+	}
+
+	info = waitProcess(t, p, "user", info.ID)
+
+	if info.Running || info.ExitStatus != 3 {
+		t.Fatalf("want finished process with exit status 3, got %+v", info)
+	}
+
+	if got, want := stdout.String(), "bar\n/tmp\n"; got != want {
+		t.Errorf("got stdout %q, want %q", got, want)
+	}
+
+	if got, want := stderr.String(), "err\n"; got != want {
+		t.Errorf("got stderr %q, want %q", got, want)
+	}
+
+	if _, err := p.get("other", info.ID); err == nil {
+		t.Fatal("want process to be not visible to other users")
+	} else if e, ok := err.(*kite.Error); !ok || e.Type != kiteerrortypes.ProcessNotFound {
+		t.Fatalf("got %#v, want ProcessNotFound error", err)
+	}
+
+	if list := p.list("user"); len(list) != 1 || list[0].ID != info.ID {
+		t.Fatalf("got %+v, want single %q process", list, info.ID)
+	}
+}
+
+func TestProcessesSignal(t *testing.T) {
+	p := NewProcesses(kite.New("test", "0.0.1").Log)
+
+	info, err := p.start("user", &StartRequest{Command: "sleep 60"})
+	if err != nil {
+		t.Fatalf("start()=%s", err)
+	}
+
+	proc, err := p.get("user", info.ID)
+	if err != nil {
+		t.Fatalf("get()=%s", err)
+	}
+
+	if err := proc.signal(syscall.SIGINT); err != nil {
+		t.Fatalf("signal()=%s", err)
+	}
+
+	info = waitProcess(t, p, "user", info.ID)
+
+	if info.ExitStatus != -1 || info.Signal != syscall.SIGINT.String() {
+		t.Fatalf("want process killed with SIGINT, got %+v", info)
+	}
+}
+
+func TestProcessesTimeout(t *testing.T) {
+	p := NewProcesses(kite.New("test", "0.0.1").Log)
+
+	info, err := p.start("user", &StartRequest{
+		Command: "sleep 60",
+		Timeout: 1,
+	})
+	if err != nil {
+		t.Fatalf("start()=%s", err)
+	}
+
+	info = waitProcess(t, p, "user", info.ID)
+
+	if !info.TimedOut || info.Signal != syscall.SIGKILL.String() {
+		t.Fatalf("want process killed due to timeout, got %+v", info)
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	cases := map[string]syscall.Signal{
+		"":        syscall.SIGTERM,
+		"SIGKILL": syscall.SIGKILL,
+		"int":     syscall.SIGINT,
+		"1":       syscall.SIGHUP,
+	}
+
+	for s, want := range cases {
+		got, err := parseSignal(s)
+		if err != nil {
+			t.Errorf("parseSignal(%q)=%s", s, err)
+			continue
+		}
+
+		if got != want {
+			t.Errorf("parseSignal(%q)=%s, want %s", s, got, want)
+		}
+	}
+
+	if _, err := parseSignal("SIGFOO"); err == nil {
+		t.Error("want non-nil error for unknown signal")
+	}
+}
@@ -0,0 +1,161 @@
+package fs
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// gitignoreRule is a single pattern read from a .gitignore file.
+type gitignoreRule struct {
+	pattern  []string // pattern split by "/"
+	negate   bool     // pattern starts with "!"
+	dirOnly  bool     // pattern ends with "/"
+	anchored bool     // pattern contains "/", so it's matched against a full path
+}
+
+// gitignore holds rules of a single .gitignore file, which apply to
+// files within dir.
+type gitignore struct {
+	dir   string
+	rules []gitignoreRule
+}
+
+// readGitignore reads .gitignore file in the given directory. It returns
+// nil if the file does not exist or contains no rules.
+func readGitignore(dir string) *gitignore {
+	f, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	g := &gitignore{
+		dir: dir,
+	}
+
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		if rule, ok := parseGitignoreRule(scanner.Text()); ok {
+			g.rules = append(g.rules, rule)
+		}
+	}
+
+	if len(g.rules) == 0 {
+		return nil
+	}
+
+	return g
+}
+
+func parseGitignoreRule(line string) (gitignoreRule, bool) {
+	var rule gitignoreRule
+
+	line = strings.TrimRight(line, " \t\r")
+
+	if line == "" || line[0] == '#' {
+		return rule, false
+	}
+
+	if line[0] == '!' {
+		rule.negate = true
+		line = line[1:]
+	} else if line[0] == '\\' {
+		line = line[1:] // escaped "#" or "!"
+	}
+
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+		line = strings.TrimLeft(line, "/")
+	}
+
+	if line == "" {
+		return rule, false
+	}
+
+	rule.pattern = strings.Split(line, "/")
+
+	return rule, true
+}
+
+// match tells whether the given path is matched by any of the rules.
+// If the path matched, ignored tells whether it is ignored or
+// explicitly included with a negated rule.
+func (g *gitignore) match(path string, isDir bool) (matched, ignored bool) {
+	rel, err := filepath.Rel(g.dir, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return false, false
+	}
+
+	elems := strings.Split(filepath.ToSlash(rel), "/")
+
+	// The last matching rule decides.
+	for i := len(g.rules) - 1; i >= 0; i-- {
+		rule := &g.rules[i]
+
+		if rule.dirOnly && !isDir {
+			continue
+		}
+
+		var ok bool
+
+		if rule.anchored {
+			ok = matchElems(rule.pattern, elems)
+		} else {
+			ok, _ = filepath.Match(rule.pattern[0], elems[len(elems)-1])
+		}
+
+		if ok {
+			return true, !rule.negate
+		}
+	}
+
+	return false, false
+}
+
+// matchElems matches path elements against pattern elements, where
+// "**" matches zero or more path elements.
+func matchElems(pattern, elems []string) bool {
+	for len(pattern) != 0 {
+		if pattern[0] == "**" {
+			for i := len(elems); i >= 0; i-- {
+				if matchElems(pattern[1:], elems[i:]) {
+					return true
+				}
+			}
+
+			return false
+		}
+
+		if len(elems) == 0 {
+			return false
+		}
+
+		if ok, _ := filepath.Match(pattern[0], elems[0]); !ok {
+			return false
+		}
+
+		pattern, elems = pattern[1:], elems[1:]
+	}
+
+	return len(elems) == 0
+}
+
+// gitignored tells whether the given path is ignored by any of the
+// .gitignore files, ordered from the outermost one.
+func gitignored(ignores []*gitignore, path string, isDir bool) bool {
+	for i := len(ignores) - 1; i >= 0; i-- {
+		if matched, ignored := ignores[i].match(path, isDir); matched {
+			return ignored
+		}
+	}
+
+	return false
+}
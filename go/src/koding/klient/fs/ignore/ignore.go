@@ -0,0 +1,17 @@
+// Package ignore provides the list of folders, which are skipped by
+// default by both klient file system methods and fuseklient.
+package ignore
+
+// Folders are names of version control, build and dependency folders,
+// which are not watched, searched nor mounted by default.
+var Folders = []string{
+	".svn",
+	".hg",
+	".build",
+	".vagrant",
+	".git",
+	".logs",
+	"CVS",
+	"logs",
+	"node_modules",
+}
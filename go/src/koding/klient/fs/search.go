@@ -0,0 +1,684 @@
+package fs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+)
+
+const (
+	// DefaultMaxResults is the maximum number of results of a single
+	// fs.search or fs.find request, if not requested otherwise.
+	DefaultMaxResults = 1000
+
+	// MaxResults is the upper limit of the requested maximum number
+	// of results.
+	MaxResults = 10000
+
+	// MaxContext is the maximum number of context lines reported
+	// before and after a match.
+	MaxContext = 10
+
+	// maxLineLen is the maximum length of reported lines, longer lines
+	// are truncated.
+	maxLineLen = 512
+
+	// resultBatchSize is the number of results sent to the caller
+	// with a single callback call.
+	resultBatchSize = 100
+
+	// resultFlushInterval is the maximum time results are buffered
+	// before they're sent to the caller.
+	resultFlushInterval = 200 * time.Millisecond
+)
+
+var (
+	errResultLimit = errors.New("result limit reached")
+	errCanceled    = errors.New("canceled")
+)
+
+// SearchOptions represents a request of the fs.search method.
+type SearchOptions struct {
+	// Path to a directory to search in.
+	Path string
+
+	// Pattern to search for. It's a literal string, unless Regexp
+	// is true.
+	Pattern string
+
+	// Regexp makes the Pattern treated as a regular expression, as
+	// accepted by the regexp package.
+	Regexp bool
+
+	// CaseSensitive disables case-insensitive matching.
+	CaseSensitive bool
+
+	// Include, if non-empty, limits search to files which names match
+	// at least one of the glob patterns, e.g. "*.go".
+	Include []string
+
+	// Exclude skips files and directories which names match at least
+	// one of the glob patterns.
+	Exclude []string
+
+	// IgnoreFolders specifies names of folders, which are not searched.
+	// If nil, DefaultIgnoreFolders is used.
+	IgnoreFolders []string
+
+	// NoGitignore disables skipping files ignored by .gitignore files.
+	NoGitignore bool
+
+	// Context is a number of lines reported before and after each
+	// matching line, up to MaxContext.
+	Context int
+
+	// MaxResults is the maximum number of matches. If zero,
+	// DefaultMaxResults is used.
+	MaxResults int
+
+	// OnMatch is called with []*SearchMatch value, as matches are found.
+	OnMatch dnode.Function
+
+	// OnDone, if valid, is called with *SearchResult value, when
+	// the search is finished.
+	OnDone dnode.Function
+}
+
+// FindOptions represents a request of the fs.find method.
+type FindOptions struct {
+	// Path to a directory to search in.
+	Path string
+
+	// Pattern is matched against file names. If it contains any of
+	// the glob special characters, it's matched as a glob pattern,
+	// otherwise names containing the pattern match.
+	Pattern string
+
+	// CaseSensitive disables case-insensitive matching.
+	CaseSensitive bool
+
+	// Type, if non-empty, limits results to either "file" or "dir".
+	Type string
+
+	// Include, Exclude, IgnoreFolders and NoGitignore work the same
+	// as for SearchOptions.
+	Include       []string
+	Exclude       []string
+	IgnoreFolders []string
+	NoGitignore   bool
+
+	// MaxResults is the maximum number of found files. If zero,
+	// DefaultMaxResults is used.
+	MaxResults int
+
+	// OnMatch is called with []*FileEntry value, as files are found.
+	OnMatch dnode.Function
+
+	// OnDone, if valid, is called with *SearchResult value, when
+	// the search is finished.
+	OnDone dnode.Function
+}
+
+// SearchMatch describes a single line matching fs.search pattern.
+type SearchMatch struct {
+	Path   string   `json:"path"`
+	Line   int      `json:"line"`   // 1-based line number
+	Column int      `json:"column"` // 1-based column of the first match, in characters
+	Text   string   `json:"text"`
+	Before []string `json:"before,omitempty"` // context lines before the match
+	After  []string `json:"after,omitempty"`  // context lines after the match
+}
+
+// SearchResult summarizes fs.search or fs.find request.
+type SearchResult struct {
+	ID        string `json:"id"`
+	Results   int    `json:"results"`             // number of matches or found files
+	Files     int    `json:"files"`               // number of visited files
+	Truncated bool   `json:"truncated,omitempty"` // whether the result limit was reached
+	Canceled  bool   `json:"canceled,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// SearchResponse represents a response of the fs.search and fs.find
+// methods.
+type SearchResponse struct {
+	// ID of the search.
+	ID string `json:"id"`
+
+	// Cancel stops the search.
+	Cancel dnode.Function `json:"cancel"`
+}
+
+// Searcher manages searches started with fs.search and fs.find methods,
+// enforcing per user limits.
+type Searcher struct {
+	// MaxSearches is the maximum number of concurrent searches per user.
+	MaxSearches int
+
+	// MaxFileSize is the maximum size of searched files, bigger files
+	// are skipped.
+	MaxFileSize int64
+
+	mu       sync.Mutex
+	searches map[string]*search
+}
+
+// DefaultSearcher is used by Search and Find kite handlers.
+var DefaultSearcher = NewSearcher()
+
+// NewSearcher gives new Searcher value with default limits.
+func NewSearcher() *Searcher {
+	return &Searcher{
+		MaxSearches: 4,
+		MaxFileSize: 4 * 1024 * 1024,
+		searches:    make(map[string]*search),
+	}
+}
+
+// Search is a kite handler for the fs.search method.
+func Search(r *kite.Request) (interface{}, error) {
+	return DefaultSearcher.Search(r)
+}
+
+// Find is a kite handler for the fs.find method.
+func Find(r *kite.Request) (interface{}, error) {
+	return DefaultSearcher.Find(r)
+}
+
+// Search starts searching file contents and returns *SearchResponse.
+//
+// The search is canceled when the caller disconnects.
+func (s *Searcher) Search(r *kite.Request) (interface{}, error) {
+	var params SearchOptions
+
+	if r.Args == nil {
+		return nil, errors.New("arguments are not passed")
+	}
+
+	if r.Args.One().Unmarshal(&params) != nil || params.Path == "" || params.Pattern == "" || !params.OnMatch.IsValid() {
+		return nil, errors.New("{ path: [string], pattern: [string], onMatch: [function], onDone: [function], regexp: [bool], caseSensitive: [bool], include: [array], exclude: [array], context: [number], maxResults: [number] }")
+	}
+
+	sr, err := s.search(r.Username, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.response(r, sr), nil
+}
+
+// Find starts searching file names and returns *SearchResponse.
+//
+// The search is canceled when the caller disconnects.
+func (s *Searcher) Find(r *kite.Request) (interface{}, error) {
+	var params FindOptions
+
+	if r.Args == nil {
+		return nil, errors.New("arguments are not passed")
+	}
+
+	if r.Args.One().Unmarshal(&params) != nil || params.Path == "" || !params.OnMatch.IsValid() {
+		return nil, errors.New("{ path: [string], onMatch: [function], onDone: [function], pattern: [string], caseSensitive: [bool], type: [string], include: [array], exclude: [array], maxResults: [number] }")
+	}
+
+	sr, err := s.find(r.Username, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.response(r, sr), nil
+}
+
+// CloseSearches cancels all searches of the given user.
+func (s *Searcher) CloseSearches(user string) {
+	s.mu.Lock()
+	for _, sr := range s.searches {
+		if sr.user == user {
+			sr.cancel()
+		}
+	}
+	s.mu.Unlock()
+}
+
+func (s *Searcher) response(r *kite.Request, sr *search) *SearchResponse {
+	r.Client.OnDisconnect(sr.cancel)
+
+	return &SearchResponse{
+		ID: sr.id,
+		Cancel: dnode.Callback(func(*dnode.Partial) {
+			sr.cancel()
+		}),
+	}
+}
+
+func (s *Searcher) search(user string, params *SearchOptions) (*search, error) {
+	expr := params.Pattern
+	if !params.Regexp {
+		expr = regexp.QuoteMeta(expr)
+	}
+
+	if !params.CaseSensitive {
+		expr = "(?i)" + expr
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %s", params.Pattern, err)
+	}
+
+	context := params.Context
+	if context < 0 {
+		context = 0
+	}
+
+	if context > MaxContext {
+		context = MaxContext
+	}
+
+	wk := &walker{
+		root:      params.Path,
+		include:   params.Include,
+		exclude:   params.Exclude,
+		ignore:    params.IgnoreFolders,
+		gitignore: !params.NoGitignore,
+	}
+
+	sr, err := s.start(user, wk, params.MaxResults, params.OnMatch, params.OnDone)
+	if err != nil {
+		return nil, err
+	}
+
+	go sr.run(func(path string, fi os.FileInfo) error {
+		if fi.IsDir() || !fi.Mode().IsRegular() || fi.Size() > s.MaxFileSize {
+			return nil
+		}
+
+		return sr.grep(path, re, context)
+	})
+
+	return sr, nil
+}
+
+func (s *Searcher) find(user string, params *FindOptions) (*search, error) {
+	switch params.Type {
+	case "", "file", "dir":
+	default:
+		return nil, fmt.Errorf("unknown type %q", params.Type)
+	}
+
+	pattern := params.Pattern
+	if !params.CaseSensitive {
+		pattern = strings.ToLower(pattern)
+	}
+
+	isGlob := strings.ContainsAny(pattern, `*?[\`)
+
+	if isGlob {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %s", params.Pattern, err)
+		}
+	}
+
+	wk := &walker{
+		root:      params.Path,
+		include:   params.Include,
+		exclude:   params.Exclude,
+		ignore:    params.IgnoreFolders,
+		gitignore: !params.NoGitignore,
+	}
+
+	sr, err := s.start(user, wk, params.MaxResults, params.OnMatch, params.OnDone)
+	if err != nil {
+		return nil, err
+	}
+
+	go sr.run(func(path string, fi os.FileInfo) error {
+		if (params.Type == "file" && fi.IsDir()) || (params.Type == "dir" && !fi.IsDir()) {
+			return nil
+		}
+
+		name := fi.Name()
+		if !params.CaseSensitive {
+			name = strings.ToLower(name)
+		}
+
+		var ok bool
+		if isGlob {
+			ok, _ = filepath.Match(pattern, name)
+		} else {
+			ok = strings.Contains(name, pattern)
+		}
+
+		if !ok {
+			return nil
+		}
+
+		return sr.send(makeFileEntry(path, fi))
+	})
+
+	return sr, nil
+}
+
+// start validates common options and registers new search.
+func (s *Searcher) start(user string, wk *walker, max int, onMatch, onDone dnode.Function) (*search, error) {
+	fi, err := os.Stat(wk.root)
+	if err != nil {
+		return nil, err
+	}
+
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%q is not a directory", wk.root)
+	}
+
+	wk.root = filepath.Clean(wk.root)
+
+	for _, patterns := range [][]string{wk.include, wk.exclude} {
+		for _, pattern := range patterns {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %s", pattern, err)
+			}
+		}
+	}
+
+	if wk.ignore == nil {
+		wk.ignore = DefaultIgnoreFolders
+	}
+
+	if max <= 0 {
+		max = DefaultMaxResults
+	}
+
+	if max > MaxResults {
+		max = MaxResults
+	}
+
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	wk.done = done
+
+	sr := &search{
+		id:      id,
+		user:    user,
+		max:     max,
+		walker:  wk,
+		onMatch: onMatch,
+		onDone:  onDone,
+		s:       s,
+		done:    done,
+		flushed: time.Now(),
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for _, other := range s.searches {
+		if other.user == user {
+			n++
+		}
+	}
+
+	if n >= s.MaxSearches {
+		return nil, fmt.Errorf("maximum number of %d concurrent searches per user reached", s.MaxSearches)
+	}
+
+	s.searches[id] = sr
+
+	return sr, nil
+}
+
+type search struct {
+	id      string
+	user    string
+	max     int
+	walker  *walker
+	onMatch dnode.Function
+	onDone  dnode.Function
+
+	s    *Searcher
+	once sync.Once
+	done chan struct{}
+
+	// Fields below are accessed only by the run goroutine.
+	batch   []interface{}
+	flushed time.Time
+	result  SearchResult
+}
+
+func (sr *search) cancel() {
+	sr.once.Do(func() {
+		close(sr.done)
+	})
+}
+
+// run walks the search tree, calling fn for every file, and reports
+// the result to the caller.
+func (sr *search) run(fn func(string, os.FileInfo) error) {
+	err := sr.walker.walk(func(path string, fi os.FileInfo) error {
+		if !fi.IsDir() {
+			sr.result.Files++
+		}
+
+		return fn(path, fi)
+	})
+
+	sr.s.mu.Lock()
+	delete(sr.s.searches, sr.id)
+	sr.s.mu.Unlock()
+
+	sr.flush()
+
+	sr.result.ID = sr.id
+
+	switch err {
+	case nil:
+	case errResultLimit:
+		sr.result.Truncated = true
+	case errCanceled:
+		sr.result.Canceled = true
+	default:
+		sr.result.Error = err.Error()
+	}
+
+	sr.cancel()
+
+	if sr.onDone.IsValid() {
+		if err := sr.onDone.Call(&sr.result); err != nil {
+			log.Printf("search %s: unable to send result: %s", sr.id, err)
+		}
+	}
+}
+
+// send buffers the given result, sending buffered results to the caller
+// if the batch is full or it was not flushed for resultFlushInterval.
+func (sr *search) send(v interface{}) error {
+	if sr.result.Results >= sr.max {
+		return errResultLimit
+	}
+
+	sr.batch = append(sr.batch, v)
+	sr.result.Results++
+
+	if len(sr.batch) >= resultBatchSize || time.Since(sr.flushed) >= resultFlushInterval {
+		sr.flush()
+	}
+
+	return nil
+}
+
+func (sr *search) flush() {
+	sr.flushed = time.Now()
+
+	if len(sr.batch) == 0 {
+		return
+	}
+
+	batch := sr.batch
+	sr.batch = nil
+
+	if err := sr.onMatch.Call(batch); err != nil {
+		log.Printf("search %s: unable to send results: %s", sr.id, err)
+	}
+}
+
+// grep sends matches of re found in the given file.
+func (sr *search) grep(path string, re *regexp.Regexp, context int) error {
+	p, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil // file may be already removed or not readable
+	}
+
+	if isBinary(p) {
+		return nil
+	}
+
+	if !re.Match(p) {
+		return nil
+	}
+
+	lines := strings.Split(string(p), "\n")
+
+	for i, line := range lines {
+		loc := re.FindStringIndex(line)
+		if loc == nil {
+			continue
+		}
+
+		m := &SearchMatch{
+			Path:   path,
+			Line:   i + 1,
+			Column: utf8.RuneCountInString(line[:loc[0]]) + 1,
+			Text:   truncateLine(line),
+		}
+
+		start := i - context
+		if start < 0 {
+			start = 0
+		}
+
+		for j := start; j < i; j++ {
+			m.Before = append(m.Before, truncateLine(lines[j]))
+		}
+
+		for j := i + 1; j <= i+context && j < len(lines); j++ {
+			m.After = append(m.After, truncateLine(lines[j]))
+		}
+
+		if err := sr.send(m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// walker walks a directory tree, skipping ignored files.
+type walker struct {
+	root      string
+	include   []string
+	exclude   []string
+	ignore    []string
+	gitignore bool
+	done      <-chan struct{}
+}
+
+// walk calls fn for every file and directory within the walker root,
+// in lexical order.
+func (wk *walker) walk(fn func(string, os.FileInfo) error) error {
+	return wk.walkDir(wk.root, nil, fn)
+}
+
+func (wk *walker) walkDir(dir string, ignores []*gitignore, fn func(string, os.FileInfo) error) error {
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if dir == wk.root {
+			return err
+		}
+		return nil // directory may be already removed or not readable
+	}
+
+	if wk.gitignore {
+		if g := readGitignore(dir); g != nil {
+			ignores = append(ignores[:len(ignores):len(ignores)], g)
+		}
+	}
+
+	for _, fi := range fis {
+		select {
+		case <-wk.done:
+			return errCanceled
+		default:
+		}
+
+		path := filepath.Join(dir, fi.Name())
+
+		if wk.skip(fi) || gitignored(ignores, path, fi.IsDir()) {
+			continue
+		}
+
+		if err := fn(path, fi); err != nil {
+			return err
+		}
+
+		if fi.IsDir() {
+			if err := wk.walkDir(path, ignores, fn); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// skip tells whether the given file is skipped by the walker filters.
+func (wk *walker) skip(fi os.FileInfo) bool {
+	if matchAny(wk.exclude, fi.Name()) {
+		return true
+	}
+
+	if fi.IsDir() {
+		return contains(wk.ignore, fi.Name())
+	}
+
+	return len(wk.include) != 0 && !matchAny(wk.include, fi.Name())
+}
+
+// isBinary tells whether the given content looks like a binary file.
+func isBinary(p []byte) bool {
+	if len(p) > 8000 {
+		p = p[:8000]
+	}
+
+	return bytes.IndexByte(p, 0) != -1
+}
+
+func truncateLine(line string) string {
+	line = strings.TrimSuffix(line, "\r")
+
+	if len(line) <= maxLineLen {
+		return line
+	}
+
+	n := maxLineLen
+	for n > 0 && !utf8.RuneStart(line[n]) {
+		n--
+	}
+
+	return line[:n] + "..."
+}
@@ -0,0 +1,312 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/dnode"
+)
+
+var searchTree = map[string]string{
+	".gitignore":          "*.log\nbuild/\n!keep.log\n",
+	"main.go":             "package main\n\nfunc main() {\n\tprintln(\"Hello\")\n}\n",
+	"README.md":           "hello world\n",
+	"debug.log":           "hello\n",
+	"keep.log":            "hello\n",
+	"build/out.txt":       "hello\n",
+	"node_modules/foo.js": "hello\n",
+	"sub/.gitignore":      "*.txt\n",
+	"sub/a.txt":           "hello\n",
+	"sub/b.md":            "hello\n",
+	"sub/bin":             "hello\x00\n",
+}
+
+func newSearchTree(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "fs.search")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+
+	for file, content := range searchTree {
+		path := filepath.Join(dir, filepath.FromSlash(file))
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("MkdirAll()=%s", err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("WriteFile()=%s", err)
+		}
+	}
+
+	return dir
+}
+
+type searchResults struct {
+	results []interface{}
+	done    chan *SearchResult
+}
+
+func newSearchResults() *searchResults {
+	return &searchResults{
+		done: make(chan *SearchResult, 1),
+	}
+}
+
+func (sr *searchResults) onMatch() dnode.Function {
+	return dnode.Function{Caller: callerFunc(func(args ...interface{}) error {
+		sr.results = append(sr.results, args[0].([]interface{})...)
+		return nil
+	})}
+}
+
+func (sr *searchResults) onDone() dnode.Function {
+	return dnode.Function{Caller: callerFunc(func(args ...interface{}) error {
+		sr.done <- args[0].(*SearchResult)
+		return nil
+	})}
+}
+
+// wait waits for the search to finish; results are safe to read
+// after it returns.
+func (sr *searchResults) wait(t *testing.T) *SearchResult {
+	select {
+	case res := <-sr.done:
+		return res
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for search to finish")
+		return nil
+	}
+}
+
+type callerFunc func(...interface{}) error
+
+func (fn callerFunc) Call(args ...interface{}) error {
+	return fn(args...)
+}
+
+func TestSearch(t *testing.T) {
+	dir := newSearchTree(t)
+	defer os.RemoveAll(dir)
+
+	cases := map[string]struct {
+		opts    SearchOptions
+		want    []string // "<file>:<line>:<column>"
+		trunc   bool
+		context map[string][2][]string
+	}{
+		"literal case-insensitive": {
+			opts: SearchOptions{Pattern: "hello", Context: 1},
+			want: []string{"README.md:1:1", "keep.log:1:1", "main.go:4:11", "sub/b.md:1:1"},
+			context: map[string][2][]string{
+				"main.go": {{"func main() {"}, {"}"}},
+			},
+		},
+		"regexp case-sensitive": {
+			opts: SearchOptions{Pattern: "^hel+o", Regexp: true, CaseSensitive: true},
+			want: []string{"README.md:1:1", "keep.log:1:1", "sub/b.md:1:1"},
+		},
+		"include and no gitignore": {
+			opts: SearchOptions{Pattern: "hello", Include: []string{"*.txt", "*.log"}, NoGitignore: true},
+			want: []string{"build/out.txt:1:1", "debug.log:1:1", "keep.log:1:1", "sub/a.txt:1:1"},
+		},
+		"exclude and ignore folders": {
+			opts: SearchOptions{Pattern: "hello", Exclude: []string{"sub", "*.md"}, IgnoreFolders: []string{}},
+			want: []string{"keep.log:1:1", "main.go:4:11", "node_modules/foo.js:1:1"},
+		},
+		"max results": {
+			opts:  SearchOptions{Pattern: "hello", MaxResults: 2},
+			want:  []string{"README.md:1:1", "keep.log:1:1"},
+			trunc: true,
+		},
+	}
+
+	for name, cas := range cases {
+		t.Run(name, func(t *testing.T) {
+			results := newSearchResults()
+
+			opts := cas.opts
+			opts.Path = dir
+			opts.OnMatch = results.onMatch()
+			opts.OnDone = results.onDone()
+
+			if _, err := NewSearcher().search("user", &opts); err != nil {
+				t.Fatalf("search()=%s", err)
+			}
+
+			res := results.wait(t)
+
+			if res.Error != "" || res.Truncated != cas.trunc || res.Results != len(cas.want) {
+				t.Fatalf("unexpected result: %+v", res)
+			}
+
+			var got []string
+			for _, v := range results.results {
+				m := v.(*SearchMatch)
+				rel, _ := filepath.Rel(dir, m.Path)
+				rel = filepath.ToSlash(rel)
+
+				got = append(got, rel+":"+strconv.Itoa(m.Line)+":"+strconv.Itoa(m.Column))
+
+				if ctx, ok := cas.context[rel]; ok {
+					if !reflect.DeepEqual(m.Before, ctx[0]) || !reflect.DeepEqual(m.After, ctx[1]) {
+						t.Errorf("%s: got %q/%q context, want %q/%q", rel, m.Before, m.After, ctx[0], ctx[1])
+					}
+				}
+			}
+
+			if !reflect.DeepEqual(got, cas.want) {
+				t.Fatalf("got %v, want %v", got, cas.want)
+			}
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	dir := newSearchTree(t)
+	defer os.RemoveAll(dir)
+
+	cases := map[string]struct {
+		opts FindOptions
+		want []string
+	}{
+		"glob": {
+			opts: FindOptions{Pattern: "*.md"},
+			want: []string{"README.md", "sub/b.md"},
+		},
+		"substring case-insensitive": {
+			opts: FindOptions{Pattern: "MAIN"},
+			want: []string{"main.go"},
+		},
+		"substring case-sensitive": {
+			opts: FindOptions{Pattern: "MAIN", CaseSensitive: true},
+			want: nil,
+		},
+		"directories": {
+			opts: FindOptions{Type: "dir"},
+			want: []string{"sub"},
+		},
+		"files": {
+			opts: FindOptions{Type: "file", Include: []string{"*.log", "*.txt"}},
+			want: []string{"keep.log"},
+		},
+	}
+
+	for name, cas := range cases {
+		t.Run(name, func(t *testing.T) {
+			results := newSearchResults()
+
+			opts := cas.opts
+			opts.Path = dir
+			opts.OnMatch = results.onMatch()
+			opts.OnDone = results.onDone()
+
+			if _, err := NewSearcher().find("user", &opts); err != nil {
+				t.Fatalf("find()=%s", err)
+			}
+
+			if res := results.wait(t); res.Error != "" || res.Results != len(cas.want) {
+				t.Fatalf("unexpected result: %+v", res)
+			}
+
+			var got []string
+			for _, v := range results.results {
+				rel, _ := filepath.Rel(dir, v.(*FileEntry).FullPath)
+				got = append(got, filepath.ToSlash(rel))
+			}
+
+			sort.Strings(got)
+
+			if !reflect.DeepEqual(got, cas.want) {
+				t.Fatalf("got %v, want %v", got, cas.want)
+			}
+		})
+	}
+}
+
+func TestSearchLimits(t *testing.T) {
+	dir := newSearchTree(t)
+	defer os.RemoveAll(dir)
+
+	s := NewSearcher()
+	s.MaxSearches = 0
+
+	opts := &SearchOptions{
+		Path:    dir,
+		Pattern: "hello",
+		OnMatch: newSearchResults().onMatch(),
+	}
+
+	if _, err := s.search("user", opts); err == nil {
+		t.Fatal("want search limit error")
+	}
+
+	opts.Pattern, opts.Regexp = "(", true
+
+	if _, err := NewSearcher().search("user", opts); err == nil {
+		t.Fatal("want invalid pattern error")
+	}
+}
+
+func TestSearchCancel(t *testing.T) {
+	dir := newSearchTree(t)
+	defer os.RemoveAll(dir)
+
+	done := make(chan struct{})
+	close(done)
+
+	wk := &walker{
+		root: dir,
+		done: done,
+	}
+
+	err := wk.walk(func(string, os.FileInfo) error {
+		t.Fatal("unexpected walk of canceled search")
+		return nil
+	})
+
+	if err != errCanceled {
+		t.Fatalf("got %v, want %v", err, errCanceled)
+	}
+}
+
+func TestGitignore(t *testing.T) {
+	cases := []struct {
+		rule  string
+		path  string
+		isDir bool
+		match bool
+	}{
+		{"*.log", "a/b/c.log", false, true},
+		{"/*.log", "a/c.log", false, false},
+		{"/*.log", "c.log", false, true},
+		{"build/", "build", false, false},
+		{"build/", "a/build", true, true},
+		{"a/**/c", "a/c", true, true},
+		{"a/**/c", "a/b/b/c", false, true},
+		{"**/c", "a/b/c", false, true},
+		{"a/b", "x/a/b", false, false},
+		{"# comment", "# comment", false, false},
+	}
+
+	for _, cas := range cases {
+		rule, ok := parseGitignoreRule(cas.rule)
+
+		g := &gitignore{dir: "/root"}
+		if ok {
+			g.rules = append(g.rules, rule)
+		}
+
+		match, _ := g.match(filepath.Join("/root", filepath.FromSlash(cas.path)), cas.isDir)
+
+		if match != cas.match {
+			t.Errorf("%q matching %q: got %t, want %t", cas.rule, cas.path, match, cas.match)
+		}
+	}
+}
@@ -0,0 +1,667 @@
+package fs
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"koding/klient/fs/ignore"
+
+	"github.com/koding/kite"
+	"github.com/koding/kite/dnode"
+	"gopkg.in/fsnotify.v1"
+)
+
+// DefaultIgnoreFolders are names of folders, which are not watched
+// recursively, unless configured otherwise. It is the same list that
+// is used by fuseklient's remote transport.
+var DefaultIgnoreFolders = ignore.Folders
+
+const (
+	// DefaultWatchWindow is a time window in which events of the same
+	// file are coalesced into a single one.
+	DefaultWatchWindow = 200 * time.Millisecond
+
+	// MaxWatchWindow is the maximum coalescing window.
+	MaxWatchWindow = 10 * time.Second
+)
+
+// Watch operations reported by fs.watch method.
+const (
+	OpCreate = "create"
+	OpWrite  = "write"
+	OpRemove = "remove"
+	OpRename = "rename"
+	OpChmod  = "chmod"
+)
+
+var watchOps = []struct {
+	op   fsnotify.Op
+	name string
+}{
+	{fsnotify.Create, OpCreate},
+	{fsnotify.Write, OpWrite},
+	{fsnotify.Remove, OpRemove},
+	{fsnotify.Rename, OpRename},
+	{fsnotify.Chmod, OpChmod},
+}
+
+// WatchOptions represents a request of the fs.watch method.
+type WatchOptions struct {
+	// Path to a directory to watch.
+	Path string
+
+	// Recursive makes nested directories watched as well, including
+	// the ones created after the watch was started.
+	Recursive bool
+
+	// Include, if non-empty, limits events to files which names match
+	// at least one of the glob patterns, e.g. "*.go".
+	Include []string
+
+	// Exclude drops events of files which names or names of any of
+	// their parent directories match at least one of the glob patterns.
+	// Excluded directories are not watched.
+	Exclude []string
+
+	// IgnoreFolders specifies names of folders, which are not watched.
+	// If nil, DefaultIgnoreFolders is used.
+	IgnoreFolders []string
+
+	// Events, if non-empty, limits events to the given operations:
+	// "create", "write", "remove", "rename" or "chmod".
+	Events []string
+
+	// Window is a time, in milliseconds, in which events of the same
+	// file are coalesced. If zero, DefaultWatchWindow is used.
+	Window int
+
+	// OnChange is called with []*WatchEvent value, each time events
+	// are flushed after the coalescing window.
+	OnChange dnode.Function
+}
+
+// WatchEvent describes changes of a single file.
+type WatchEvent struct {
+	Path string     `json:"path"`
+	Ops  []string   `json:"ops"`            // all operations coalesced within the window
+	File *FileEntry `json:"file,omitempty"` // nil if the file does not exist anymore
+}
+
+// WatchResponse represents a response of the fs.watch method.
+type WatchResponse struct {
+	// ID of the watch, used by fs.unwatch method.
+	ID string `json:"id"`
+
+	// Stop stops the watch.
+	Stop dnode.Function `json:"stop"`
+}
+
+// Watcher manages watches started with fs.watch method, enforcing
+// per user limits.
+type Watcher struct {
+	// MaxWatches is the maximum number of watches per user.
+	MaxWatches int
+
+	// MaxDirs is the maximum number of watched directories per user,
+	// summed over all watches.
+	MaxDirs int
+
+	mu      sync.Mutex
+	watches map[string]*watch
+	dirs    map[string]int // number of watched directories per user
+}
+
+// DefaultWatcher is used by Watch and Unwatch kite handlers.
+var DefaultWatcher = NewWatcher()
+
+// NewWatcher gives new Watcher value with default limits.
+func NewWatcher() *Watcher {
+	return &Watcher{
+		MaxWatches: 16,
+		MaxDirs:    8192,
+		watches:    make(map[string]*watch),
+		dirs:       make(map[string]int),
+	}
+}
+
+// Watch is a kite handler for the fs.watch method.
+func Watch(r *kite.Request) (interface{}, error) {
+	return DefaultWatcher.Watch(r)
+}
+
+// Unwatch is a kite handler for the fs.unwatch method.
+func Unwatch(r *kite.Request) (interface{}, error) {
+	return DefaultWatcher.Unwatch(r)
+}
+
+// Watch starts watching the requested path and returns *WatchResponse.
+//
+// The watch is stopped when the caller disconnects.
+func (w *Watcher) Watch(r *kite.Request) (interface{}, error) {
+	var params WatchOptions
+
+	if r.Args == nil {
+		return nil, errors.New("arguments are not passed")
+	}
+
+	if r.Args.One().Unmarshal(&params) != nil || params.Path == "" || !params.OnChange.IsValid() {
+		return nil, errors.New("{ path: [string], onChange: [function], recursive: [bool], include: [array], exclude: [array], events: [array], window: [number] }")
+	}
+
+	wt, err := w.watch(r.Username, &params)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Client.OnDisconnect(func() {
+		w.stop(wt)
+	})
+
+	return &WatchResponse{
+		ID: wt.id,
+		Stop: dnode.Callback(func(*dnode.Partial) {
+			w.stop(wt)
+		}),
+	}, nil
+}
+
+// Unwatch stops the watch with the requested ID.
+func (w *Watcher) Unwatch(r *kite.Request) (interface{}, error) {
+	var params struct {
+		ID string
+	}
+
+	if r.Args == nil || r.Args.One().Unmarshal(&params) != nil || params.ID == "" {
+		return nil, errors.New("{ id: [string] }")
+	}
+
+	w.mu.Lock()
+	wt, ok := w.watches[params.ID]
+	w.mu.Unlock()
+
+	if !ok || wt.user != r.Username {
+		return nil, fmt.Errorf("watch %q not found", params.ID)
+	}
+
+	w.stop(wt)
+
+	return true, nil
+}
+
+// CloseWatches stops all watches of the given user.
+func (w *Watcher) CloseWatches(user string) {
+	var watches []*watch
+
+	w.mu.Lock()
+	for _, wt := range w.watches {
+		if wt.user == user {
+			watches = append(watches, wt)
+		}
+	}
+	w.mu.Unlock()
+
+	for _, wt := range watches {
+		w.stop(wt)
+	}
+}
+
+func (w *Watcher) watch(user string, params *WatchOptions) (*watch, error) {
+	root := filepath.Clean(params.Path)
+
+	fi, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+
+	if !fi.IsDir() {
+		return nil, fmt.Errorf("%q is not a directory", root)
+	}
+
+	for _, patterns := range [][]string{params.Include, params.Exclude} {
+		for _, pattern := range patterns {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %s", pattern, err)
+			}
+		}
+	}
+
+	ops, err := parseOps(params.Events)
+	if err != nil {
+		return nil, err
+	}
+
+	window := DefaultWatchWindow
+	if params.Window > 0 {
+		window = time.Duration(params.Window) * time.Millisecond
+	}
+
+	if window > MaxWatchWindow {
+		window = MaxWatchWindow
+	}
+
+	ignore := params.IgnoreFolders
+	if ignore == nil {
+		ignore = DefaultIgnoreFolders
+	}
+
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+
+	if w.count(user) >= w.MaxWatches {
+		return nil, fmt.Errorf("maximum number of %d watches per user reached", w.MaxWatches)
+	}
+
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	wt := &watch{
+		id:        id,
+		user:      user,
+		root:      root,
+		recursive: params.Recursive,
+		include:   params.Include,
+		exclude:   params.Exclude,
+		ignore:    ignore,
+		ops:       ops,
+		window:    window,
+		onChange:  params.OnChange,
+		w:         w,
+		fsw:       fsw,
+		dirs:      make(map[string]struct{}),
+		done:      make(chan struct{}),
+	}
+
+	if _, err := wt.addTree(root); err != nil {
+		wt.close()
+		return nil, err
+	}
+
+	w.mu.Lock()
+	n := w.countLocked(user)
+	if n < w.MaxWatches {
+		w.watches[id] = wt
+	}
+	w.mu.Unlock()
+
+	if n >= w.MaxWatches {
+		wt.close()
+		return nil, fmt.Errorf("maximum number of %d watches per user reached", w.MaxWatches)
+	}
+
+	go wt.loop()
+
+	return wt, nil
+}
+
+func (w *Watcher) count(user string) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.countLocked(user)
+}
+
+func (w *Watcher) countLocked(user string) int {
+	n := 0
+	for _, wt := range w.watches {
+		if wt.user == user {
+			n++
+		}
+	}
+	return n
+}
+
+func (w *Watcher) stop(wt *watch) {
+	w.mu.Lock()
+	_, ok := w.watches[wt.id]
+	delete(w.watches, wt.id)
+	w.mu.Unlock()
+
+	if ok {
+		wt.close()
+	}
+}
+
+// reserve accounts n more watched directories for the given user. It
+// fails if the user would exceed the MaxDirs limit.
+func (w *Watcher) reserve(user string, n int) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if n > 0 && w.dirs[user]+n > w.MaxDirs {
+		return fmt.Errorf("maximum number of %d watched directories per user reached", w.MaxDirs)
+	}
+
+	w.dirs[user] += n
+
+	if w.dirs[user] <= 0 {
+		delete(w.dirs, user)
+	}
+
+	return nil
+}
+
+type watch struct {
+	id        string
+	user      string
+	root      string
+	recursive bool
+	include   []string
+	exclude   []string
+	ignore    []string
+	ops       fsnotify.Op
+	window    time.Duration
+	onChange  dnode.Function
+
+	w    *Watcher
+	fsw  *fsnotify.Watcher
+	once sync.Once
+	done chan struct{}
+
+	mu   sync.Mutex
+	dirs map[string]struct{} // watched directories
+}
+
+func (wt *watch) close() {
+	wt.once.Do(func() {
+		close(wt.done)
+
+		wt.mu.Lock()
+		n := len(wt.dirs)
+		wt.dirs = nil
+		wt.mu.Unlock()
+
+		wt.w.reserve(wt.user, -n)
+
+		if err := wt.fsw.Close(); err != nil {
+			log.Println("watch close error:", err)
+		}
+	})
+}
+
+// addTree watches the given directory and, for recursive watches, all
+// its subdirectories. It returns paths of all the files found in nested
+// directories.
+func (wt *watch) addTree(dir string) ([]string, error) {
+	var dirs, files []string
+
+	walkFn := func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			if path == dir {
+				return err
+			}
+			return nil // file may be already removed
+		}
+
+		if path != dir {
+			if wt.skip(path, fi.IsDir()) {
+				if fi.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			files = append(files, path)
+		}
+
+		if fi.IsDir() {
+			dirs = append(dirs, path)
+
+			if !wt.recursive {
+				if path != dir {
+					return filepath.SkipDir
+				}
+			}
+		}
+
+		return nil
+	}
+
+	if err := filepath.Walk(dir, walkFn); err != nil {
+		return nil, err
+	}
+
+	if !wt.recursive {
+		dirs = dirs[:1]
+	}
+
+	if err := wt.w.reserve(wt.user, len(dirs)); err != nil {
+		return nil, err
+	}
+
+	var added int
+
+	wt.mu.Lock()
+	for _, d := range dirs {
+		if wt.dirs == nil {
+			break // watch was closed
+		}
+
+		if _, ok := wt.dirs[d]; ok {
+			continue
+		}
+
+		if err := wt.fsw.Add(d); err != nil {
+			log.Printf("watch %s: unable to watch %q: %s", wt.id, d, err)
+			continue
+		}
+
+		wt.dirs[d] = struct{}{}
+		added++
+	}
+	wt.mu.Unlock()
+
+	wt.w.reserve(wt.user, added-len(dirs))
+
+	return files, nil
+}
+
+func (wt *watch) removeDir(dir string) {
+	wt.mu.Lock()
+	var n int
+	for d := range wt.dirs {
+		if d == dir || strings.HasPrefix(d, dir+string(os.PathSeparator)) {
+			delete(wt.dirs, d)
+			n++
+		}
+	}
+	wt.mu.Unlock()
+
+	wt.w.reserve(wt.user, -n)
+}
+
+// skip tells whether events for the given path are dropped.
+func (wt *watch) skip(path string, isDir bool) bool {
+	rel, err := filepath.Rel(wt.root, path)
+	if err != nil || rel == "." {
+		return false
+	}
+
+	elems := strings.Split(rel, string(os.PathSeparator))
+
+	for i, elem := range elems {
+		if (i < len(elems)-1 || isDir) && contains(wt.ignore, elem) {
+			return true
+		}
+
+		if matchAny(wt.exclude, elem) {
+			return true
+		}
+	}
+
+	if len(wt.include) != 0 && !isDir && !matchAny(wt.include, elems[len(elems)-1]) {
+		return true
+	}
+
+	return false
+}
+
+func (wt *watch) loop() {
+	var (
+		pending = make(map[string]fsnotify.Op)
+		order   []string
+		timer   = time.NewTimer(wt.window)
+		flush   <-chan time.Time
+	)
+
+	timer.Stop()
+	defer timer.Stop()
+
+	add := func(path string, op fsnotify.Op) {
+		if op&wt.ops == 0 {
+			return
+		}
+
+		if _, ok := pending[path]; !ok {
+			order = append(order, path)
+		}
+
+		pending[path] |= op & wt.ops
+
+		if flush == nil {
+			timer.Reset(wt.window)
+			flush = timer.C
+		}
+	}
+
+	for {
+		select {
+		case <-wt.done:
+			return
+
+		case ev, ok := <-wt.fsw.Events:
+			if !ok {
+				return
+			}
+
+			fi, err := os.Lstat(ev.Name)
+			isDir := err == nil && fi.IsDir()
+
+			if ev.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+				wt.removeDir(ev.Name)
+			}
+
+			if wt.skip(ev.Name, isDir) {
+				continue
+			}
+
+			add(ev.Name, ev.Op)
+
+			if wt.recursive && isDir && ev.Op&fsnotify.Create != 0 {
+				// Files created in the new directory before it was
+				// watched are reported as created as well.
+				files, err := wt.addTree(ev.Name)
+				if err != nil {
+					log.Printf("watch %s: %s", wt.id, err)
+				}
+
+				for _, file := range files {
+					add(file, fsnotify.Create)
+				}
+			}
+
+		case err, ok := <-wt.fsw.Errors:
+			if !ok {
+				return
+			}
+
+			log.Printf("watch %s: watcher error: %s", wt.id, err)
+
+		case <-flush:
+			flush = nil
+
+			events := make([]*WatchEvent, 0, len(order))
+			for _, path := range order {
+				events = append(events, newWatchEvent(path, pending[path]))
+			}
+
+			pending = make(map[string]fsnotify.Op)
+			order = nil
+
+			if err := wt.onChange.Call(events); err != nil {
+				log.Printf("watch %s: unable to send events: %s", wt.id, err)
+			}
+		}
+	}
+}
+
+func newWatchEvent(path string, op fsnotify.Op) *WatchEvent {
+	ev := &WatchEvent{
+		Path: path,
+	}
+
+	for _, o := range watchOps {
+		if op&o.op != 0 {
+			ev.Ops = append(ev.Ops, o.name)
+		}
+	}
+
+	if fi, err := os.Lstat(path); err == nil {
+		ev.File = makeFileEntry(path, fi)
+	}
+
+	return ev
+}
+
+func parseOps(events []string) (fsnotify.Op, error) {
+	if len(events) == 0 {
+		return fsnotify.Create | fsnotify.Write | fsnotify.Remove | fsnotify.Rename | fsnotify.Chmod, nil
+	}
+
+	var ops fsnotify.Op
+
+Events:
+	for _, event := range events {
+		for _, o := range watchOps {
+			if o.name == event {
+				ops |= o.op
+				continue Events
+			}
+		}
+
+		return 0, fmt.Errorf("unknown event %q", event)
+	}
+
+	return ops, nil
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func randomID() (string, error) {
+	p := make([]byte, 8)
+
+	if _, err := rand.Read(p); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(p), nil
+}
@@ -0,0 +1,197 @@
+package fs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/koding/kite/dnode"
+)
+
+type watchEvents chan []*WatchEvent
+
+func (ch watchEvents) Call(args ...interface{}) error {
+	ch <- args[0].([]*WatchEvent)
+	return nil
+}
+
+// collect gathers events until no more events are received within
+// the given timeout.
+func (ch watchEvents) collect(timeout time.Duration) map[string][]string {
+	events := make(map[string][]string)
+
+	for {
+		select {
+		case evs := <-ch:
+			for _, ev := range evs {
+				events[ev.Path] = append(events[ev.Path], ev.Ops...)
+			}
+		case <-time.After(timeout):
+			return events
+		}
+	}
+}
+
+func TestWatchRecursive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fs.watch")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, d := range []string{"src", "node_modules", "build"} {
+		if err := os.Mkdir(filepath.Join(dir, d), 0755); err != nil {
+			t.Fatalf("Mkdir()=%s", err)
+		}
+	}
+
+	w := NewWatcher()
+	events := make(watchEvents, 16)
+
+	wt, err := w.watch("user", &WatchOptions{
+		Path:      dir,
+		Recursive: true,
+		Exclude:   []string{"build", "*.tmp"},
+		Window:    50,
+		OnChange:  dnode.Function{Caller: events},
+	})
+	if err != nil {
+		t.Fatalf("watch()=%s", err)
+	}
+	defer w.stop(wt)
+
+	writes := []string{
+		"src/main.go",
+		"src/main.go", // coalesced with the above
+		"src/main.go.tmp",
+		"node_modules/foo.js",
+		"build/main",
+		"src/pkg/pkg.go", // in a directory created after the watch started
+	}
+
+	if err := os.Mkdir(filepath.Join(dir, "src", "pkg"), 0755); err != nil {
+		t.Fatalf("Mkdir()=%s", err)
+	}
+
+	time.Sleep(100 * time.Millisecond) // wait for the new directory to be watched
+
+	for _, file := range writes {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte("foo"), 0644); err != nil {
+			t.Fatalf("WriteFile()=%s", err)
+		}
+	}
+
+	got := events.collect(500 * time.Millisecond)
+
+	var paths []string
+	for path := range got {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	want := []string{
+		filepath.Join(dir, "src", "main.go"),
+		filepath.Join(dir, "src", "pkg"),
+		filepath.Join(dir, "src", "pkg", "pkg.go"),
+	}
+
+	if !reflect.DeepEqual(paths, want) {
+		t.Fatalf("got %v, want %v", paths, want)
+	}
+
+	if ops := got[want[0]]; len(ops) == 0 || ops[0] != OpCreate {
+		t.Fatalf("got %v ops, want create first", ops)
+	}
+}
+
+func TestWatchFilters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fs.watch")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	w := NewWatcher()
+	events := make(watchEvents, 16)
+
+	wt, err := w.watch("user", &WatchOptions{
+		Path:     dir,
+		Include:  []string{"*.go"},
+		Events:   []string{OpRemove},
+		Window:   50,
+		OnChange: dnode.Function{Caller: events},
+	})
+	if err != nil {
+		t.Fatalf("watch()=%s", err)
+	}
+	defer w.stop(wt)
+
+	for _, file := range []string{"main.go", "README.md"} {
+		path := filepath.Join(dir, file)
+
+		if err := ioutil.WriteFile(path, []byte("foo"), 0644); err != nil {
+			t.Fatalf("WriteFile()=%s", err)
+		}
+
+		if err := os.Remove(path); err != nil {
+			t.Fatalf("Remove()=%s", err)
+		}
+	}
+
+	got := events.collect(500 * time.Millisecond)
+	want := map[string][]string{
+		filepath.Join(dir, "main.go"): {OpRemove},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestWatchLimits(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fs.watch")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, d := range []string{"a", "b", "c"} {
+		if err := os.Mkdir(filepath.Join(dir, d), 0755); err != nil {
+			t.Fatalf("Mkdir()=%s", err)
+		}
+	}
+
+	w := NewWatcher()
+	w.MaxWatches = 1
+	w.MaxDirs = 3
+
+	opts := &WatchOptions{
+		Path:     filepath.Join(dir, "a"),
+		OnChange: dnode.Function{Caller: make(watchEvents)},
+	}
+
+	wt, err := w.watch("user", opts)
+	if err != nil {
+		t.Fatalf("watch()=%s", err)
+	}
+
+	if _, err := w.watch("user", opts); err == nil {
+		t.Fatal("want watch limit error")
+	}
+
+	w.stop(wt)
+
+	opts.Path, opts.Recursive = dir, true
+
+	if _, err := w.watch("user", opts); err == nil {
+		t.Fatal("want directory limit error")
+	}
+
+	if n := w.dirs["user"]; n != 0 {
+		t.Fatalf("got %d watched directories, want 0", n)
+	}
+}
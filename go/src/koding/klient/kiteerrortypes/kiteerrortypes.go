@@ -65,6 +65,10 @@ const (
 	// non-exit status way.
 	ProcessError = "ProcessError"
 
+	// Returned from klient/command.Processes when a process with the given ID
+	// was not started by the caller or it has already expired.
+	ProcessNotFound = "ProcessNotFound"
+
 	// Returned from klient/client/Publish when there are no listeners for the given
 	// event.
 	NoSubscribers = "NoSubscribers"
@@ -23,6 +23,8 @@ var (
 	flagDebug       = flag.Bool("debug", false, "Debug mode")
 	flagScreenrc    = flag.String("screenrc", "/opt/koding/etc/screenrc", "Default screenrc path")
 	flagDBPath      = flag.String("dbpath", "", "Bolt DB database path. Must be absolute)")
+	flagAuditLog    = flag.String("audit-log", "", "Audit log file path. Must be absolute")
+	flagNoAuditLog  = flag.Bool("no-audit-log", false, "Turn off recording audit log")
 
 	// Registration flags
 	flagKiteHome   = flag.String("kite-home", defaultKiteHome(), "Change kite home path")
@@ -106,10 +108,12 @@ func realMain() int {
 	}
 
 	dbPath := ""
+	auditLogPath := ""
 	vagrantHome := ""
 	u, err := user.Current()
 	if err == nil {
 		dbPath = filepath.Join(u.HomeDir, filepath.FromSlash(".config/koding/klient.bolt"))
+		auditLogPath = filepath.Join(u.HomeDir, filepath.FromSlash(".config/koding/klient.audit.log"))
 		vagrantHome = filepath.Join(u.HomeDir, ".vagrant.d")
 	}
 
@@ -117,6 +121,14 @@ func realMain() int {
 		dbPath = *flagDBPath
 	}
 
+	if *flagAuditLog != "" {
+		auditLogPath = *flagAuditLog
+	}
+
+	if *flagNoAuditLog {
+		auditLogPath = ""
+	}
+
 	if *flagVagrantHome != "" {
 		vagrantHome = *flagVagrantHome
 	} else if s := os.Getenv("VAGRANT_CWD"); s != "" {
@@ -129,6 +141,7 @@ func realMain() int {
 		Region:            protocol.Region,
 		Version:           protocol.Version,
 		DBPath:            dbPath,
+		AuditLogPath:      auditLogPath,
 		IP:                *flagIP,
 		Port:              *flagPort,
 		RegisterURL:       *flagRegisterURL,
@@ -0,0 +1,100 @@
+package tunnel
+
+import (
+	"errors"
+
+	"koding/klient/storage"
+
+	"github.com/koding/kite"
+)
+
+// Certificate is a TLS certificate served by the tlsproxy
+// for a custom domain of the machine.
+type Certificate struct {
+	Cert string `json:"cert"` // PEM-encoded certificate chain
+	Key  string `json:"key"`  // PEM-encoded private key
+}
+
+// SetCertificateRequest represents a request for tunnel.setCertificate method.
+type SetCertificateRequest struct {
+	Domain string `json:"domain"`
+
+	// Cert and Key are PEM-encoded certificate chain and private key.
+	// If Cert is empty, certificate of the domain is removed.
+	Cert string `json:"cert,omitempty"`
+	Key  string `json:"key,omitempty"`
+}
+
+// SetCertificate is a kite handler for the "tunnel.setCertificate" method.
+//
+// It configures the tlsproxy to serve the given certificate for the domain.
+// The certificates are persisted and restored when klient is restarted.
+func (t *Tunnel) SetCertificate(r *kite.Request) (interface{}, error) {
+	if r.Args == nil {
+		return nil, errors.New("invalid request")
+	}
+
+	var req SetCertificateRequest
+
+	if err := r.Args.One().Unmarshal(&req); err != nil {
+		return nil, err
+	}
+
+	if req.Domain == "" {
+		return nil, errors.New("domain is empty")
+	}
+
+	if t.proxy == nil {
+		return nil, errors.New("tlsproxy is not running")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	certs, err := t.db.Certificates()
+	if err != nil && err != storage.ErrKeyNotFound {
+		return nil, err
+	}
+
+	if certs == nil {
+		certs = make(map[string]*Certificate)
+	}
+
+	if req.Cert == "" {
+		t.proxy.RemoveCertificate(req.Domain)
+		delete(certs, req.Domain)
+	} else {
+		if err := t.proxy.SetCertificate(req.Domain, []byte(req.Cert), []byte(req.Key)); err != nil {
+			return nil, err
+		}
+
+		certs[req.Domain] = &Certificate{
+			Cert: req.Cert,
+			Key:  req.Key,
+		}
+	}
+
+	if err := t.db.SetCertificates(certs); err != nil {
+		return nil, err
+	}
+
+	return true, nil
+}
+
+func (t *Tunnel) restoreCertificates() {
+	certs, err := t.db.Certificates()
+	if err == storage.ErrKeyNotFound {
+		return
+	}
+
+	if err != nil {
+		t.opts.Log.Warning("tunnel: unable to restore certificates: %s", err)
+		return
+	}
+
+	for domain, cert := range certs {
+		if err := t.proxy.SetCertificate(domain, []byte(cert.Cert), []byte(cert.Key)); err != nil {
+			t.opts.Log.Warning("tunnel: unable to restore certificate for %q: %s", domain, err)
+		}
+	}
+}
@@ -48,3 +48,16 @@ func (s *Storage) Services() (tunnelproxy.Services, error) {
 func (s *Storage) SetServices(srvc tunnelproxy.Services) error {
 	return s.db.SetValue("services", srvc)
 }
+
+func (s *Storage) Certificates() (map[string]*Certificate, error) {
+	certs := make(map[string]*Certificate)
+	if err := s.db.GetValue("certificates", &certs); err != nil {
+		return nil, err
+	}
+
+	return certs, nil
+}
+
+func (s *Storage) SetCertificates(certs map[string]*Certificate) error {
+	return s.db.SetValue("certificates", certs)
+}
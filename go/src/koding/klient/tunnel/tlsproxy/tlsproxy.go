@@ -16,6 +16,7 @@ import (
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
@@ -94,6 +95,13 @@ type Proxy struct {
 	listener   net.Listener
 	closed     uint32
 	once       util.OnceSuccessful
+
+	// defaultCert is served when no certificate is
+	// configured for the requested server name.
+	defaultCert *tls.Certificate
+
+	mu    sync.RWMutex // protects certs
+	certs map[string]*tls.Certificate
 }
 
 func NewProxy(listenAddr, targetAddr string) (*Proxy, error) {
@@ -111,9 +119,18 @@ func NewProxy(listenAddr, targetAddr string) (*Proxy, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	p := &Proxy{
+		Log:         defaultLog,
+		targetAddr:  targetAddr,
+		defaultCert: &crt,
+		certs:       make(map[string]*tls.Certificate),
+	}
+
 	cfg := &tls.Config{
-		Certificates: []tls.Certificate{crt},
-		Rand:         rand.Reader,
+		Certificates:   []tls.Certificate{crt},
+		GetCertificate: p.getCertificate,
+		Rand:           rand.Reader,
 		// Don't offer SSL3.
 		MinVersion: tls.VersionTLS10,
 		// Workaround TLS_FALLBACK_SCSV bug. For details see:
@@ -125,17 +142,52 @@ func NewProxy(listenAddr, targetAddr string) (*Proxy, error) {
 		return nil, err
 	}
 
-	p := &Proxy{
-		Log:        defaultLog,
-		targetAddr: targetAddr,
-		listener:   listener,
-	}
+	p.listener = listener
 
 	go p.serve()
 
 	return p, nil
 }
 
+// SetCertificate configures the proxy to serve the given PEM-encoded
+// certificate chain and private key for connections to the domain.
+func (p *Proxy) SetCertificate(domain string, certPEM, keyPEM []byte) error {
+	crt, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.certs[normalize(domain)] = &crt
+	p.mu.Unlock()
+
+	return nil
+}
+
+// RemoveCertificate removes the certificate of the given domain,
+// the default one is going to be served instead.
+func (p *Proxy) RemoveCertificate(domain string) {
+	p.mu.Lock()
+	delete(p.certs, normalize(domain))
+	p.mu.Unlock()
+}
+
+func (p *Proxy) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	p.mu.RLock()
+	crt, ok := p.certs[normalize(hello.ServerName)]
+	p.mu.RUnlock()
+
+	if ok {
+		return crt, nil
+	}
+
+	return p.defaultCert, nil
+}
+
+func normalize(domain string) string {
+	return strings.ToLower(strings.TrimSuffix(domain, "."))
+}
+
 func (p *Proxy) Close() error {
 	if atomic.CompareAndSwapUint32(&p.closed, 0, 1) {
 		return p.listener.Close()
@@ -0,0 +1,100 @@
+package tlsproxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func newCert(t *testing.T, domain string) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey()=%s", err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate()=%s", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalECPrivateKey()=%s", err)
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return certPEM, keyPEM
+}
+
+func peerName(t *testing.T, p *Proxy, serverName string) string {
+	conn, err := tls.Dial("tcp", p.listener.Addr().String(), &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		t.Fatalf("Dial()=%s", err)
+	}
+	defer conn.Close()
+
+	if err := conn.Handshake(); err != nil {
+		t.Fatalf("Handshake()=%s", err)
+	}
+
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		t.Fatal("no peer certificates")
+	}
+
+	return certs[0].Subject.CommonName
+}
+
+func TestProxySetCertificate(t *testing.T) {
+	p, err := NewProxy("127.0.0.1:0", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("NewProxy()=%s", err)
+	}
+	defer p.Close()
+
+	def := peerName(t, p, "example.com")
+
+	if err := p.SetCertificate("Example.com.", []byte("invalid"), []byte("invalid")); err == nil {
+		t.Fatal("expected SetCertificate to fail for invalid certificate")
+	}
+
+	certPEM, keyPEM := newCert(t, "example.com")
+
+	if err := p.SetCertificate("Example.com.", certPEM, keyPEM); err != nil {
+		t.Fatalf("SetCertificate()=%s", err)
+	}
+
+	if got, want := peerName(t, p, "example.com"), "example.com"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	if got := peerName(t, p, "other.example.com"); got != def {
+		t.Fatalf("got %q, want %q", got, def)
+	}
+
+	p.RemoveCertificate("example.com")
+
+	if got := peerName(t, p, "example.com"); got != def {
+		t.Fatalf("got %q, want %q", got, def)
+	}
+}
@@ -150,6 +150,7 @@ func New(opts *Options) (*Tunnel, error) {
 		}
 
 		t.proxy = p
+		t.restoreCertificates()
 	}
 
 	go t.eventloop()
@@ -95,6 +95,11 @@ type UploadRequest struct {
 
 	// Key is required when Content is set.
 	Key string `json:"key"`
+
+	// Rotated is a path the File was rotated to. If non-empty, the part
+	// of Rotated content which was not yet uploaded is uploaded under
+	// the File key.
+	Rotated string `json:"rotated"`
 }
 
 // Valid validates the request.
@@ -103,11 +108,23 @@ func (req *UploadRequest) Valid() error {
 		return errors.New("missing key")
 	}
 
-	if req.File != "" {
+	if req.Rotated != "" {
+		if req.File == "" {
+			return errors.New("missing file")
+		}
+
+		if _, err := os.Stat(req.Rotated); err != nil {
+			return err
+		}
+
+		req.Rotated = filepath.ToSlash(filepath.Clean(req.Rotated))
+	} else if req.File != "" {
 		if _, err := os.Stat(req.File); err != nil {
 			return err
 		}
+	}
 
+	if req.File != "" {
 		req.File = filepath.ToSlash(filepath.Clean(req.File))
 	}
 
@@ -131,6 +148,17 @@ func (up *Uploader) UploadFile(file string, interval time.Duration) (*url.URL, e
 	return up.upload(req)
 }
 
+// UploadRotated uploads the rest of the given file content, after the
+// file was rotated to the given path.
+func (up *Uploader) UploadRotated(file, rotated string) (*url.URL, error) {
+	req := &UploadRequest{
+		File:    file,
+		Rotated: rotated,
+	}
+
+	return up.upload(req)
+}
+
 // Upload is a kite handler for the "log.upload" method.
 func (up *Uploader) Upload(r *kite.Request) (interface{}, error) {
 	if r.Args == nil {
@@ -250,9 +278,12 @@ func (up *Uploader) process() {
 
 			var r response
 
-			if req.File != "" {
+			switch {
+			case req.Rotated != "":
+				r.url, r.err = up.rotate.UploadRotated(prefix, req.File, req.Rotated)
+			case req.File != "":
 				r.url, r.err = up.rotate.UploadFile(prefix, req.File)
-			} else {
+			default:
 				r.url, r.err = up.rotate.Upload(path.Clean(prefix+"/"+req.Key), bytes.NewReader(req.Content))
 			}
 
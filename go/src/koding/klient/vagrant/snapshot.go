@@ -0,0 +1,123 @@
+package vagrant
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/koding/kite"
+	"github.com/koding/vagrantutil"
+)
+
+// SnapshotRequest represents vagrant.snapshot{Save,Restore,Delete} requests.
+type SnapshotRequest struct {
+	Name string `json:"name"`
+}
+
+// Valid validates the snapshot request.
+func (req *SnapshotRequest) Valid() error {
+	if req.Name == "" {
+		return errors.New("snapshot name is empty")
+	}
+
+	if strings.ContainsAny(req.Name, " \t\n/\\") {
+		return fmt.Errorf("invalid snapshot name: %q", req.Name)
+	}
+
+	return nil
+}
+
+// SnapshotSave creates a VirtualBox snapshot of the box specified in the
+// path, by executing "vagrant snapshot save".
+func (h *Handlers) SnapshotSave(r *kite.Request) (interface{}, error) {
+	return h.withPath(r, h.snapshot("save"))
+}
+
+// SnapshotRestore restores the box specified in the path to the given
+// snapshot, by executing "vagrant snapshot restore". The box is
+// booted after the restore.
+func (h *Handlers) SnapshotRestore(r *kite.Request) (interface{}, error) {
+	return h.withPath(r, h.snapshot("restore"))
+}
+
+// SnapshotDelete deletes the given snapshot of the box specified
+// in the path, by executing "vagrant snapshot delete".
+func (h *Handlers) SnapshotDelete(r *kite.Request) (interface{}, error) {
+	return h.withPath(r, h.snapshot("delete"))
+}
+
+func (h *Handlers) snapshot(cmd string) vagrantFunc {
+	return func(r *kite.Request, v *vagrantutil.Vagrant) (interface{}, error) {
+		var req SnapshotRequest
+
+		if err := r.Args.One().Unmarshal(&req); err != nil {
+			return nil, err
+		}
+
+		if err := req.Valid(); err != nil {
+			return nil, err
+		}
+
+		fn := func() (<-chan *vagrantutil.CommandOutput, error) {
+			return startCmd(v.VagrantfilePath, "vagrant", "snapshot", cmd, req.Name)
+		}
+
+		return h.watchCommand(r, v.VagrantfilePath, fn)
+	}
+}
+
+// startCmd starts the given command in the dir directory. Both stdout
+// and stderr are streamed to the returned channel, an error the command
+// exits with is sent as the last element.
+func startCmd(dir, name string, args ...string) (<-chan *vagrantutil.CommandOutput, error) {
+	cmd := exec.Command(name, args...)
+	cmd.Dir = dir
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	out := make(chan *vagrantutil.CommandOutput)
+
+	output := func(r io.Reader) {
+		defer wg.Done()
+
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				out <- &vagrantutil.CommandOutput{Line: line}
+			}
+		}
+	}
+
+	wg.Add(2)
+	go output(stdout)
+	go output(stderr)
+
+	go func() {
+		wg.Wait()
+
+		if err := cmd.Wait(); err != nil {
+			out <- &vagrantutil.CommandOutput{Error: err}
+		}
+
+		close(out)
+	}()
+
+	return out, nil
+}
@@ -0,0 +1,25 @@
+package vagrant_test
+
+import (
+	"testing"
+
+	"koding/klient/vagrant"
+)
+
+func TestSnapshotRequestValid(t *testing.T) {
+	cases := map[string]bool{
+		"":                  false,
+		"koding-1234":       true,
+		"with space":        false,
+		"../escape":         false,
+		"koding_2016-01-01": true,
+	}
+
+	for name, ok := range cases {
+		req := &vagrant.SnapshotRequest{Name: name}
+
+		if err := req.Valid(); (err == nil) != ok {
+			t.Errorf("%q: got %v, want valid=%t", name, err, ok)
+		}
+	}
+}
@@ -114,17 +114,28 @@ type Uploader struct {
 // The key is constructed by joining prefix and the
 // canonical form of the file path.
 func (l *Uploader) UploadFile(prefix, file string) (*url.URL, error) {
-	key := filepath.ToSlash(filepath.Clean(file))
-	if prefix != "" {
-		key = path.Clean(prefix + "/" + key)
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
 	}
 
-	f, err := os.Open(file)
+	return l.Upload(fileKey(prefix, file), f)
+}
+
+// UploadRotated uploads the content of the rotated file, which was moved
+// away from the given file path, e.g. file.log -> file.log.1.
+//
+// The content is uploaded under the key of the original file, so only
+// the part which was not already uploaded is streamed. Subsequent
+// uploads of the original file are going to stream it from the beginning,
+// as its checksum no longer matches.
+func (l *Uploader) UploadRotated(prefix, file, rotated string) (*url.URL, error) {
+	f, err := os.Open(rotated)
 	if err != nil {
 		return nil, err
 	}
 
-	return l.Upload(key, f)
+	return l.Upload(fileKey(prefix, file), f)
 }
 
 // Upload streams the given content under the given key.
@@ -294,6 +305,15 @@ func readChecksum(rs io.ReadSeeker, offset, size int64) (string, error) {
 	return hex.EncodeToString(p[:]), nil
 }
 
+func fileKey(prefix, file string) string {
+	key := filepath.ToSlash(filepath.Clean(file))
+	if prefix != "" {
+		key = path.Clean(prefix + "/" + key)
+	}
+
+	return key
+}
+
 func isGzip(key string) bool {
 	return strings.HasSuffix(strings.ToLower(key), ".gz")
 }
@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -176,3 +179,70 @@ func TestLogrotate_Upload(t *testing.T) {
 		}
 	}
 }
+
+func TestLogrotate_UploadRotated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "logrotate")
+	if err != nil {
+		t.Fatalf("TempDir()=%s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	ub := make(UserBucket)
+
+	l := &logrotate.Uploader{
+		UserBucket: ub,
+		MetaStore: &storage.EncodingStorage{
+			Interface: storage.NewMemoryStorage(),
+		},
+	}
+
+	file := filepath.Join(dir, "file.log")
+	rotated := file + ".1"
+
+	write := func(file string, size int64) {
+		if err := ioutil.WriteFile(file, []byte(content[:size]), 0644); err != nil {
+			t.Fatalf("WriteFile()=%s", err)
+		}
+	}
+
+	// The file gets uploaded, grows and gets rotated.
+	write(file, n)
+
+	if _, err := l.UploadFile("", file); err != nil {
+		t.Fatalf("UploadFile()=%s", err)
+	}
+
+	write(file, 2*n)
+
+	if err := os.Rename(file, rotated); err != nil {
+		t.Fatalf("Rename()=%s", err)
+	}
+
+	write(file, n/2)
+
+	if _, err := l.UploadRotated("", file, rotated); err != nil {
+		t.Fatalf("UploadRotated()=%s", err)
+	}
+
+	if _, err := l.UploadFile("", file); err != nil {
+		t.Fatalf("UploadFile()=%s", err)
+	}
+
+	key := filepath.ToSlash(filepath.Clean(file))
+
+	want := map[string]string{
+		key + ".gz.0": content[:n],
+		key + ".gz.1": content[n : 2*n],
+		key + ".gz.2": content[:n/2],
+	}
+
+	if len(ub) != len(want) {
+		t.Fatalf("got %d parts, want %d", len(ub), len(want))
+	}
+
+	for key, s := range want {
+		if got := string(ub[key]); got != s {
+			t.Errorf("%s: got %q, want %q", key, got, s)
+		}
+	}
+}